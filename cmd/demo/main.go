@@ -2,19 +2,24 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"time"
 
 	"payment_go/pkg/interfaces"
+	"payment_go/pkg/logging"
 	"payment_go/pkg/plugin"
 )
 
 func main() {
+	// Structured logger that masks customer and recipient details
+	logger := logging.New(os.Stdout, slog.LevelDebug, logging.Config{Mode: logging.ModeProduction})
+
 	// Initialize the plugin loader
 	loader := plugin.NewPluginLoader()
+	loader.SetLogger(logger)
 
 	// Check command line arguments
 	if len(os.Args) < 2 {
@@ -62,20 +67,15 @@ func main() {
 		"success_rate":  0.9, // 90% success rate
 	}
 
-	err = paymentChannel.Initialize(config)
+	// The loader validates the config and hands the plugin host services
+	err = loader.InitializePlugin(channelID, config)
 	if err != nil {
 		log.Fatalf("❌ Failed to initialize plugin: %v", err)
 	}
 
-	// Validate configuration
-	err = paymentChannel.ValidateConfig(config)
-	if err != nil {
-		log.Fatalf("❌ Configuration validation failed: %v", err)
-	}
-
-	fmt.Printf("⚙️  Plugin initialized with configuration:\n")
-	configJSON, _ := json.MarshalIndent(config, "   ", "  ")
-	fmt.Printf("%s\n\n", string(configJSON))
+	fmt.Printf("⚙️  Plugin initialized\n")
+	logger.Info("plugin configured", "channel_id", channelID, "config", config)
+	fmt.Println()
 
 	// Demo: Collection Order (代收下单)
 	fmt.Printf("💳 Demo: Collection Order (代收下单)\n")
@@ -103,6 +103,7 @@ func main() {
 		},
 	}
 
+	logger.Info("submitting collection order", "request", collectReq)
 	collectResp, err := paymentChannel.CollectOrder(context.Background(), collectReq)
 	if err != nil {
 		log.Printf("❌ Collection order failed: %v", err)
@@ -113,7 +114,7 @@ func main() {
 		fmt.Printf("   Amount: %.2f %s\n", collectResp.Amount, collectResp.Currency)
 		fmt.Printf("   Status: %s\n", collectResp.Status)
 		fmt.Printf("   Payment URL: %s\n", collectResp.PaymentURL)
-		fmt.Printf("   QR Code: %s\n", collectResp.QRCode[:50] + "...")
+		fmt.Printf("   QR Code: %s\n", collectResp.QRCode)
 	}
 
 	// Demo: Balance Inquiry (余额查询)
@@ -166,6 +167,7 @@ func main() {
 		},
 	}
 
+	logger.Info("submitting payout order", "request", payoutReq)
 	payoutResp, err := paymentChannel.PayoutOrder(context.Background(), payoutReq)
 	if err != nil {
 		log.Printf("❌ Payout order failed: %v", err)
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"payment_go/pkg/config"
+	"payment_go/pkg/gateway"
+	"payment_go/pkg/tracing"
+)
+
+func main() {
+	configPath := flag.String("config", "gateway.json", "path to the gateway configuration file")
+	check := flag.Bool("check", false, "validate the configuration and plugins, then exit without serving")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	if *check {
+		if err := gateway.Check(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Configuration check failed:\n%v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Configuration OK: %d channel(s) in %s\n", len(cfg.Channels), cfg.Environment)
+		return
+	}
+
+	tracing.SetupPropagation()
+
+	gw, err := gateway.Build(cfg)
+	if err != nil {
+		log.Fatalf("❌ Failed to start gateway: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if interval := time.Duration(cfg.Secrets.RefreshInterval); interval > 0 {
+		go gw.Loader().WatchSecrets(ctx, interval)
+	}
+	go gw.Loader().WatchHealth(ctx, time.Duration(cfg.Health.Interval))
+	go gw.WatchOrders(ctx)
+	if notifier := gw.Notifier(); notifier != nil {
+		go notifier.Run(ctx)
+	}
+
+	server := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           gw.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		log.Printf("🚀 Payment gateway listening on %s (%d channels, %s)", cfg.Listen, len(cfg.Channels), cfg.Environment)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("❌ HTTP server failed: %v", err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	log.Printf("🛑 Shutting down...")
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer shutdownCancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("⚠️  HTTP shutdown: %v", err)
+	}
+	// Calls still running in plugins are drained before plugins shut down
+	if err := gw.Loader().Shutdown(shutdownCtx); err != nil {
+		log.Printf("⚠️  Plugin shutdown: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"payment_go/pkg/secrets"
+)
+
+const usage = `Usage: keystore [-file path] <command> [args]
+
+Commands:
+  genkey         print a new random master key (hex)
+  set <name>     store a secret read from stdin
+  delete <name>  remove a secret
+  list           list stored secret names
+
+The master key is read from GATEWAY_KEYSTORE_KEY.
+`
+
+func main() {
+	path := flag.String("file", "secrets.keystore", "path to the keystore file")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if args[0] == "genkey" {
+		key, err := secrets.GenerateKey()
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		fmt.Println(hex.EncodeToString(key))
+		return
+	}
+
+	key, err := secrets.ParseKey(os.Getenv("GATEWAY_KEYSTORE_KEY"))
+	if err != nil {
+		log.Fatalf("❌ GATEWAY_KEYSTORE_KEY: %v", err)
+	}
+	keystore, err := secrets.OpenKeystore(*path, key)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	switch {
+	case args[0] == "set" && len(args) == 2:
+		// Reading the value from stdin keeps it out of shell history
+		value, err := bufio.NewReader(os.Stdin).ReadString(0)
+		if err != nil && value == "" {
+			log.Fatalf("❌ no secret value on stdin")
+		}
+		if err := keystore.Set(args[1], strings.TrimRight(value, "\r\n")); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		fmt.Printf("✅ Stored secret %s\n", args[1])
+	case args[0] == "delete" && len(args) == 2:
+		if err := keystore.Delete(args[1]); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		fmt.Printf("✅ Deleted secret %s\n", args[1])
+	case args[0] == "list" && len(args) == 1:
+		names, err := keystore.Names()
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
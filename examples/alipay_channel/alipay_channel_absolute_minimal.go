@@ -39,15 +39,20 @@ func (ac *AlipayChannelAbsoluteMinimal) GetInfo() *interfaces.PluginInfo {
 			"callback",
 		},
 		ConfigSchema: map[string]interface{}{
-			"app_id": map[string]interface{}{
-				"type":        "string",
-				"required":    true,
-				"description": "Alipay application ID",
-			},
-			"private_key": map[string]interface{}{
-				"type":        "string",
-				"required":    true,
-				"description": "Alipay private key for signing",
+			"type":     "object",
+			"required": []interface{}{"app_id", "private_key"},
+			"properties": map[string]interface{}{
+				"app_id": map[string]interface{}{
+					"type":        "string",
+					"minLength":   1,
+					"description": "Alipay application ID",
+				},
+				"private_key": map[string]interface{}{
+					"type":        "string",
+					"minLength":   1,
+					"writeOnly":   true,
+					"description": "Alipay private key for signing",
+				},
 			},
 		},
 	}
@@ -55,22 +60,23 @@ func (ac *AlipayChannelAbsoluteMinimal) GetInfo() *interfaces.PluginInfo {
 
 // Initialize sets up the channel with configuration
 func (ac *AlipayChannelAbsoluteMinimal) Initialize(config map[string]interface{}) error {
-	if appID, ok := config["app_id"].(string); ok {
-		ac.config.AppID = appID
+	if err := ac.ValidateConfig(config); err != nil {
+		return err
 	}
-	if privateKey, ok := config["private_key"].(string); ok {
-		ac.config.PrivateKey = privateKey
+	ac.config = &AlipayConfigAbsoluteMinimal{
+		AppID:      config["app_id"].(string),
+		PrivateKey: config["private_key"].(string),
 	}
 	return nil
 }
 
 // ValidateConfig validates the configuration
 func (ac *AlipayChannelAbsoluteMinimal) ValidateConfig(config map[string]interface{}) error {
-	if config["app_id"] == nil || config["app_id"].(string) == "" {
-		return errors.New("app_id is required")
+	if appID, _ := config["app_id"].(string); appID == "" {
+		return errors.New("app_id is required and must be a string")
 	}
-	if config["private_key"] == nil || config["private_key"].(string) == "" {
-		return errors.New("private_key is required")
+	if privateKey, _ := config["private_key"].(string); privateKey == "" {
+		return errors.New("private_key is required and must be a string")
 	}
 	return nil
 }
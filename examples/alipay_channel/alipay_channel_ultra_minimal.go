@@ -3,14 +3,21 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"strconv"
 	"time"
 
+	"payment_go/pkg/host"
 	"payment_go/pkg/interfaces"
 )
 
 // AlipayChannelUltraMinimal implements the PaymentChannel interface with absolute minimal dependencies
 type AlipayChannelUltraMinimal struct {
 	config *AlipayConfigUltraMinimal
+	// client is the host's egress client
+	client *http.Client
+	// clock is the host's clock
+	clock interfaces.Clock
 }
 
 // AlipayConfigUltraMinimal holds ultra-minimal configuration
@@ -21,7 +28,7 @@ type AlipayConfigUltraMinimal struct {
 
 // NewPluginUltraMinimal creates a new instance of the ultra-minimal plugin
 func NewPluginUltraMinimal() interfaces.Plugin {
-	return &AlipayChannelUltraMinimal{}
+	return &AlipayChannelUltraMinimal{clock: host.SystemClock{}}
 }
 
 // GetInfo returns metadata about this plugin
@@ -39,17 +46,37 @@ func (ac *AlipayChannelUltraMinimal) GetInfo() *interfaces.PluginInfo {
 			"payout_query",
 			"balance_inquiry",
 			"callback",
+			"download_statement",
 		},
-		ConfigSchema: map[string]interface{}{
-			"app_id": map[string]interface{}{
-				"type":        "string",
-				"required":    true,
-				"description": "Alipay application ID",
+		OperatingLimits: interfaces.OperatingLimits{
+			Currencies: []string{"CNY"},
+			PaymentMethods: []string{
+				interfaces.PaymentMethodQRCode,
+				interfaces.PaymentMethodWAP,
+				interfaces.PaymentMethodWeb,
+				interfaces.PaymentMethodApp,
+			},
+			Limits: []interfaces.AmountLimit{
+				{Operation: "collect_order", Min: 0.01, Max: 100000000},
+				{Operation: "payout_order", Min: 0.1},
 			},
-			"private_key": map[string]interface{}{
-				"type":        "string",
-				"required":    true,
-				"description": "Alipay private key for signing",
+			Timezone: "Asia/Shanghai",
+		},
+		ConfigSchema: map[string]interface{}{
+			"type":     "object",
+			"required": []interface{}{"app_id", "private_key"},
+			"properties": map[string]interface{}{
+				"app_id": map[string]interface{}{
+					"type":        "string",
+					"minLength":   1,
+					"description": "Alipay application ID",
+				},
+				"private_key": map[string]interface{}{
+					"type":        "string",
+					"minLength":   1,
+					"writeOnly":   true,
+					"description": "Alipay private key for signing",
+				},
 			},
 		},
 	}
@@ -57,41 +84,47 @@ func (ac *AlipayChannelUltraMinimal) GetInfo() *interfaces.PluginInfo {
 
 // Initialize sets up the channel with configuration
 func (ac *AlipayChannelUltraMinimal) Initialize(config map[string]interface{}) error {
+	if err := ac.ValidateConfig(config); err != nil {
+		return err
+	}
 	ac.config = &AlipayConfigUltraMinimal{
 		AppID:      config["app_id"].(string),
 		PrivateKey: config["private_key"].(string),
 	}
+	if ac.client == nil {
+		ac.client = host.Defaults().HTTPClient
+	}
+	if ac.clock == nil {
+		ac.clock = host.SystemClock{}
+	}
 	return nil
 }
 
+// InitializeWithHost sets up the channel with configuration and host services
+func (ac *AlipayChannelUltraMinimal) InitializeWithHost(config map[string]interface{}, services interfaces.HostServices) error {
+	if services.HTTPClient != nil {
+		ac.client = services.HTTPClient
+	}
+	if services.Clock != nil {
+		ac.clock = services.Clock
+	}
+	return ac.Initialize(config)
+}
+
 // ValidateConfig validates the configuration
 func (ac *AlipayChannelUltraMinimal) ValidateConfig(config map[string]interface{}) error {
-	if config["app_id"] == nil || config["app_id"].(string) == "" {
-		return fmt.Errorf("app_id is required")
+	if appID, _ := config["app_id"].(string); appID == "" {
+		return fmt.Errorf("app_id is required and must be a string")
 	}
-	if config["private_key"] == nil || config["private_key"].(string) == "" {
-		return fmt.Errorf("private_key is required")
+	if privateKey, _ := config["private_key"].(string); privateKey == "" {
+		return fmt.Errorf("private_key is required and must be a string")
 	}
 	return nil
 }
 
-// CollectOrder creates an ultra-minimal Alipay collection order
+// CollectOrder creates an Alipay trade for the requested payment method
 func (ac *AlipayChannelUltraMinimal) CollectOrder(ctx context.Context, req *interfaces.CollectOrderRequest) (*interfaces.CollectOrderResponse, error) {
-	return &interfaces.CollectOrderResponse{
-		BaseResponse: interfaces.BaseResponse{
-			Success:   true,
-			Code:      "SUCCESS",
-			Message:   "Alipay collection order created successfully",
-			RequestID: req.RequestID,
-			Timestamp: time.Now(),
-		},
-		OrderID:        req.OrderID,
-		ChannelOrderID: fmt.Sprintf("ALIPAY_%s", req.OrderID),
-		Amount:         req.Amount,
-		Currency:       req.Currency,
-		PaymentURL:     fmt.Sprintf("https://openapi.alipay.com/gateway.do?order_id=%s", req.OrderID),
-		Status:         "pending",
-	}, nil
+	return ac.createTrade(ctx, req)
 }
 
 // PayoutOrder creates an ultra-minimal Alipay payout order
@@ -102,7 +135,7 @@ func (ac *AlipayChannelUltraMinimal) PayoutOrder(ctx context.Context, req *inter
 			Code:      "SUCCESS",
 			Message:   "Alipay payout order created successfully",
 			RequestID: req.RequestID,
-			Timestamp: time.Now(),
+			Timestamp: ac.clock.Now(),
 		},
 		OrderID:        req.OrderID,
 		ChannelOrderID: fmt.Sprintf("ALIPAY_PAYOUT_%s", req.OrderID),
@@ -120,7 +153,7 @@ func (ac *AlipayChannelUltraMinimal) CollectQuery(ctx context.Context, req *inte
 			Code:      "SUCCESS",
 			Message:   "Order query successful",
 			RequestID: req.RequestID,
-			Timestamp: time.Now(),
+			Timestamp: ac.clock.Now(),
 		},
 		OrderID:        req.OrderID,
 		ChannelOrderID: fmt.Sprintf("ALIPAY_%s", req.OrderID),
@@ -138,7 +171,7 @@ func (ac *AlipayChannelUltraMinimal) PayoutQuery(ctx context.Context, req *inter
 			Code:      "SUCCESS",
 			Message:   "Payout query successful",
 			RequestID: req.RequestID,
-			Timestamp: time.Now(),
+			Timestamp: ac.clock.Now(),
 		},
 		OrderID:        req.OrderID,
 		ChannelOrderID: fmt.Sprintf("ALIPAY_PAYOUT_%s", req.OrderID),
@@ -156,25 +189,70 @@ func (ac *AlipayChannelUltraMinimal) BalanceInquiry(ctx context.Context, req *in
 			Code:      "SUCCESS",
 			Message:   "Balance inquiry successful",
 			RequestID: req.RequestID,
-			Timestamp: time.Now(),
+			Timestamp: ac.clock.Now(),
 		},
 		Balance:     1000000.0,
 		Currency:    "CNY",
 		AccountType: "default",
-		LastUpdated: time.Now(),
+		LastUpdated: ac.clock.Now(),
 	}, nil
 }
 
-// Callback handles ultra-minimal Alipay callbacks
+// Callback handles ultra-minimal Alipay callbacks, reporting asynchronous
+// payment, close and refund notifications as events. Signatures are not
+// verified in this minimal example.
 func (ac *AlipayChannelUltraMinimal) Callback(ctx context.Context, req *interfaces.CallbackRequest) (*interfaces.CallbackResponse, error) {
-	return &interfaces.CallbackResponse{
+	resp := &interfaces.CallbackResponse{
 		BaseResponse: interfaces.BaseResponse{
 			Success:   true,
 			Code:      "SUCCESS",
 			Message:   "Callback processed successfully",
 			RequestID: req.RequestID,
-			Timestamp: time.Now(),
+			Timestamp: ac.clock.Now(),
 		},
 		Processed: true,
-	}, nil
+		Ack:       "success",
+	}
+
+	field := func(name string) string {
+		value, _ := req.CallbackData[name].(string)
+		return value
+	}
+	event := &interfaces.CallbackEvent{
+		ID:             field("notify_id"),
+		OrderID:        field("out_trade_no"),
+		ChannelOrderID: field("trade_no"),
+		Currency:       "CNY",
+		Raw:            req.CallbackData,
+	}
+	amount, at := &event.Amount, field("gmt_payment")
+	value := field("total_amount")
+	switch {
+	case field("refund_fee") != "" && field("gmt_refund") != "":
+		// Refunds notify with the trade's status, so the refund fields decide.
+		// refund_fee is the total refunded so far, not this refund's amount.
+		event.Type, event.RefundID = interfaces.EventRefundSucceeded, field("out_biz_no")
+		amount, value, at = &event.RefundedTotal, field("refund_fee"), field("gmt_refund")
+	case field("trade_status") == "TRADE_SUCCESS" || field("trade_status") == "TRADE_FINISHED":
+		event.Type = interfaces.EventPaymentSucceeded
+	case field("trade_status") == "TRADE_CLOSED":
+		event.Type, at = interfaces.EventPaymentClosed, field("gmt_close")
+	default:
+		// WAIT_BUYER_PAY and the like say nothing new
+		return resp, nil
+	}
+	if value != "" {
+		// An amount read as zero would mean the whole order
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid amount %q in notification %s: %w", value, event.ID, err)
+		}
+		*amount = parsed
+	}
+	// Alipay times are Beijing time
+	if parsed, err := time.ParseInLocation("2006-01-02 15:04:05", at, time.FixedZone("CST", 8*3600)); err == nil {
+		event.OccurredAt = parsed
+	}
+	resp.Event = event
+	return resp, nil
 }
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"payment_go/pkg/interfaces"
+)
+
+// paymentTimeout is how long a trade stays payable
+const paymentTimeout = 30 * time.Minute
+
+// trade is the OpenAPI method and product code serving a payment method
+type trade struct {
+	method      string
+	productCode string
+}
+
+// trades maps the payment methods the plugin supports to Alipay trades
+var trades = map[string]trade{
+	interfaces.PaymentMethodQRCode: {"alipay.trade.precreate", "FACE_TO_FACE_PAYMENT"},
+	interfaces.PaymentMethodWAP:    {"alipay.trade.wap.pay", "QUICK_WAP_WAY"},
+	interfaces.PaymentMethodWeb:    {"alipay.trade.page.pay", "FAST_INSTANT_TRADE_PAY"},
+	interfaces.PaymentMethodApp:    {"alipay.trade.app.pay", "QUICK_MSECURITY_PAY"},
+}
+
+// createTrade creates the Alipay trade for the requested payment method,
+// QR code by default. Only the QR code trade is created server side; the
+// others are signed requests the payer's browser or the Alipay SDK sends.
+func (ac *AlipayChannelUltraMinimal) createTrade(ctx context.Context, req *interfaces.CollectOrderRequest) (*interfaces.CollectOrderResponse, error) {
+	if ac.config == nil {
+		return nil, errors.New("plugin is not initialized")
+	}
+	paymentMethod := req.PaymentMethod
+	if paymentMethod == "" {
+		paymentMethod = interfaces.PaymentMethodQRCode
+	}
+	t, ok := trades[paymentMethod]
+	if !ok {
+		return nil, fmt.Errorf("payment method %s is not supported", paymentMethod)
+	}
+
+	expiresAt := ac.clock.Now().Add(paymentTimeout)
+	subject := req.Description
+	if subject == "" {
+		subject = req.OrderID
+	}
+	params, err := ac.newRequest(t.method, map[string]string{
+		"out_trade_no": req.OrderID,
+		"total_amount": strconv.FormatFloat(req.Amount, 'f', 2, 64),
+		"subject":      subject,
+		"product_code": t.productCode,
+		"time_expire":  expiresAt.In(billDateZone).Format(time.DateTime),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if req.NotifyURL != "" {
+		params.Set("notify_url", req.NotifyURL)
+	}
+	if req.ReturnURL != "" && (paymentMethod == interfaces.PaymentMethodWAP || paymentMethod == interfaces.PaymentMethodWeb) {
+		params.Set("return_url", req.ReturnURL)
+	}
+	if err := signParams(params, ac.config.PrivateKey); err != nil {
+		return nil, err
+	}
+
+	resp := &interfaces.CollectOrderResponse{
+		BaseResponse: interfaces.BaseResponse{
+			Success:   true,
+			Code:      "SUCCESS",
+			Message:   "Alipay collection order created successfully",
+			RequestID: req.RequestID,
+			Timestamp: ac.clock.Now(),
+		},
+		OrderID:  req.OrderID,
+		Amount:   req.Amount,
+		Currency: req.Currency,
+		Status:   "pending",
+		Action:   &interfaces.PaymentAction{ExpiresAt: &expiresAt},
+	}
+	switch paymentMethod {
+	case interfaces.PaymentMethodQRCode:
+		return ac.precreate(ctx, params, resp)
+	case interfaces.PaymentMethodWAP:
+		resp.Action.Type = interfaces.ActionRedirect
+		resp.Action.URL = alipayGateway + "?" + params.Encode()
+		resp.PaymentURL = resp.Action.URL
+	case interfaces.PaymentMethodWeb:
+		resp.Action.Type = interfaces.ActionForm
+		resp.Action.HTML = autoSubmitForm(params)
+		resp.PaymentURL = alipayGateway + "?" + params.Encode()
+	case interfaces.PaymentMethodApp:
+		resp.Action.Type = interfaces.ActionSDK
+		resp.Action.SDKPayload = params.Encode()
+	}
+	return resp, nil
+}
+
+// precreate sends alipay.trade.precreate and fills resp with the QR code
+// content it returns. A failed trade is reported in resp, not as an error,
+// and marked NotCreated only when Alipay's code says it refused the request;
+// after a system error the trade may exist, and a query settles it.
+func (ac *AlipayChannelUltraMinimal) precreate(ctx context.Context, params url.Values, resp *interfaces.CollectOrderResponse) (*interfaces.CollectOrderResponse, error) {
+	body, err := ac.httpGet(ctx, alipayGateway+"?"+params.Encode(), 1<<20)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Response struct {
+			Code    string `json:"code"`
+			Msg     string `json:"msg"`
+			SubCode string `json:"sub_code"`
+			SubMsg  string `json:"sub_msg"`
+			QRCode  string `json:"qr_code"`
+		} `json:"alipay_trade_precreate_response"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("invalid precreate response: %w", err)
+	}
+	if result.Response.Code != "10000" {
+		resp.Success = false
+		resp.Code = result.Response.SubCode
+		resp.Message = fmt.Sprintf("%s: %s", result.Response.Msg, result.Response.SubMsg)
+		resp.NotCreated = refused(result.Response.Code, result.Response.SubCode)
+		resp.Status = ""
+		if resp.NotCreated {
+			resp.Status = "failed"
+		}
+		resp.Action = nil
+		return resp, nil
+	}
+
+	resp.Action.Type = interfaces.ActionQRCode
+	resp.Action.QRContent = result.Response.QRCode
+	resp.QRCode = result.Response.QRCode
+	return resp, nil
+}
+
+// refusedCodes are the Alipay gateway codes for requests it refused
+// before acting on them: insufficient authorization, missing or invalid
+// parameters and insufficient permissions. 20000, service unavailable,
+// leaves the outcome unknown.
+var refusedCodes = map[string]bool{"20001": true, "40001": true, "40002": true, "40006": true}
+
+// ambiguousSubCodes are business failures (40004) that do not prove the
+// trade was not created: a system error, or a trade already under this
+// out_trade_no
+var ambiguousSubCodes = map[string]bool{
+	"ACQ.SYSTEM_ERROR":      true,
+	"ACQ.TRADE_HAS_SUCCESS": true,
+	"ACQ.TRADE_HAS_CLOSE":   true,
+}
+
+// refused reports whether an Alipay response code proves no trade was created
+func refused(code, subCode string) bool {
+	if code == "40004" {
+		return !ambiguousSubCodes[subCode]
+	}
+	return refusedCodes[code]
+}
+
+// autoSubmitForm renders params as a form posting itself to Alipay, the
+// way alipay.trade.page.pay is meant to be opened
+func autoSubmitForm(params url.Values) string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var form strings.Builder
+	fmt.Fprintf(&form, `<form name="alipaysubmit" method="post" action="%s?charset=utf-8">`, alipayGateway)
+	for _, name := range names {
+		fmt.Fprintf(&form, `<input type="hidden" name="%s" value="%s">`, html.EscapeString(name), html.EscapeString(params.Get(name)))
+	}
+	form.WriteString(`</form><script>document.forms["alipaysubmit"].submit();</script>`)
+	return form.String()
+}
@@ -2,41 +2,60 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"math/rand"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"payment_go/pkg/host"
 	"payment_go/pkg/interfaces"
+	"payment_go/pkg/schema"
+	"payment_go/pkg/tracing"
 )
 
 // MockChannel implements the PaymentChannel interface for testing and demonstration
 type MockChannel struct {
-	config map[string]interface{}
-	orders map[string]*MockOrder
+	// config is replaced whole on Reconfigure and never modified in place
+	config atomic.Pointer[map[string]interface{}]
+	logger *slog.Logger
+	clock  interfaces.Clock
+	// orders are kept in the host KV store under "orders/<order_id>"
+	orders interfaces.KVStore
 }
 
 // MockOrder represents a mock order in the system
 type MockOrder struct {
-	OrderID        string
-	ChannelOrderID string
-	Amount         float64
-	Currency       string
-	Status         string
-	CreatedAt      time.Time
-	PaidAt         *time.Time
-	CompletedAt    *time.Time
-	CustomerInfo   *interfaces.CustomerInfo
-	RecipientInfo  *interfaces.RecipientInfo
+	OrderID        string                    `json:"order_id"`
+	ChannelOrderID string                    `json:"channel_order_id"`
+	Amount         float64                   `json:"amount"`
+	Currency       string                    `json:"currency"`
+	Status         string                    `json:"status"`
+	CreatedAt      time.Time                 `json:"created_at"`
+	PaidAt         *time.Time                `json:"paid_at,omitempty"`
+	CompletedAt    *time.Time                `json:"completed_at,omitempty"`
+	CustomerInfo   *interfaces.CustomerInfo  `json:"customer_info,omitempty"`
+	RecipientInfo  *interfaces.RecipientInfo `json:"recipient_info,omitempty"`
 }
 
 // NewPlugin creates a new instance of the MockChannel plugin
 // This function must be exported and named exactly "NewPlugin" for the plugin loader
 func NewPlugin() interfaces.Plugin {
+	defaults := host.Defaults()
 	return &MockChannel{
-		orders: make(map[string]*MockOrder),
+		logger: defaults.Logger,
+		clock:  defaults.Clock,
+		orders: defaults.KV,
 	}
 }
 
+// SetLogger receives the host's redacting logger
+func (mc *MockChannel) SetLogger(logger *slog.Logger) {
+	mc.logger = logger
+}
+
 // GetInfo returns metadata about this plugin
 func (mc *MockChannel) GetInfo() *interfaces.PluginInfo {
 	return &interfaces.PluginInfo{
@@ -52,55 +71,97 @@ func (mc *MockChannel) GetInfo() *interfaces.PluginInfo {
 			"payout_query",
 			"balance_inquiry",
 			"callback",
+			"download_statement",
 		},
-		ConfigSchema: map[string]interface{}{
-			"mock_delay_ms": map[string]interface{}{
-				"type":        "integer",
-				"default":     100,
-				"description": "Artificial delay in milliseconds for testing",
-			},
-			"success_rate": map[string]interface{}{
-				"type":        "float",
-				"default":     0.95,
-				"description": "Success rate for mock operations (0.0-1.0)",
-			},
-		},
+		ConfigSchema: configSchema,
 	}
 }
 
+// configSchema is the plugin's ConfigSchema
+var configSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"mock_delay_ms": map[string]interface{}{
+			"type":        "integer",
+			"default":     100,
+			"minimum":     0,
+			"maximum":     10000,
+			"description": "Artificial delay in milliseconds for testing",
+		},
+		"success_rate": map[string]interface{}{
+			"type":        "number",
+			"default":     0.95,
+			"minimum":     0.0,
+			"maximum":     1.0,
+			"description": "Success rate for mock operations (0.0-1.0)",
+		},
+	},
+}
+
+// compiledSchema validates and coerces configs the way the loader does, so
+// the stored config always holds an int delay and a float64 rate
+var compiledSchema = func() *schema.Schema {
+	compiled, err := schema.Compile(configSchema)
+	if err != nil {
+		panic(err)
+	}
+	return compiled
+}()
+
 // Initialize sets up the plugin with configuration
 func (mc *MockChannel) Initialize(config map[string]interface{}) error {
-	mc.config = config
+	cleaned, err := compiledSchema.Apply(config)
+	if err != nil {
+		return err
+	}
+	mc.config.Store(&cleaned)
 	return nil
 }
 
-// ValidateConfig validates the plugin configuration
-func (mc *MockChannel) ValidateConfig(config map[string]interface{}) error {
-	if delay, exists := config["mock_delay_ms"]; exists {
-		if delayInt, ok := delay.(int); ok {
-			if delayInt < 0 || delayInt > 10000 {
-				return fmt.Errorf("mock_delay_ms must be between 0 and 10000")
-			}
-		}
+// Reconfigure swaps in a new configuration; calls in flight keep the old one
+func (mc *MockChannel) Reconfigure(config map[string]interface{}) error {
+	return mc.Initialize(config)
+}
+
+func (mc *MockChannel) currentConfig() map[string]interface{} {
+	if config := mc.config.Load(); config != nil {
+		return *config
 	}
+	return nil
+}
 
-	if rate, exists := config["success_rate"]; exists {
-		if rateFloat, ok := rate.(float64); ok {
-			if rateFloat < 0.0 || rateFloat > 1.0 {
-				return fmt.Errorf("success_rate must be between 0.0 and 1.0")
-			}
-		}
+// InitializeWithHost sets up the plugin with configuration and host services
+func (mc *MockChannel) InitializeWithHost(config map[string]interface{}, services interfaces.HostServices) error {
+	if services.Logger != nil {
+		mc.logger = services.Logger
+	}
+	if services.Clock != nil {
+		mc.clock = services.Clock
+	}
+	if services.KV != nil {
+		mc.orders = services.KV
 	}
+	return mc.Initialize(config)
+}
 
-	return nil
+// Probe simulates a cheap upstream ping for active health checks
+func (mc *MockChannel) Probe(ctx context.Context) error {
+	mc.simulateDelay(ctx)
+	return ctx.Err()
+}
+
+// ValidateConfig validates the plugin configuration against its schema
+func (mc *MockChannel) ValidateConfig(config map[string]interface{}) error {
+	_, err := compiledSchema.Apply(config)
+	return err
 }
 
 // CollectOrder creates a mock collection order
 func (mc *MockChannel) CollectOrder(ctx context.Context, req *interfaces.CollectOrderRequest) (*interfaces.CollectOrderResponse, error) {
-	mc.simulateDelay()
+	mc.simulateDelay(ctx)
 
 	// Generate a mock channel order ID
-	channelOrderID := fmt.Sprintf("MOCK_%d", time.Now().UnixNano())
+	channelOrderID := fmt.Sprintf("MOCK_%d", mc.clock.Now().UnixNano())
 
 	// Create mock order
 	mockOrder := &MockOrder{
@@ -109,29 +170,36 @@ func (mc *MockChannel) CollectOrder(ctx context.Context, req *interfaces.Collect
 		Amount:         req.Amount,
 		Currency:       req.Currency,
 		Status:         "pending",
-		CreatedAt:      time.Now(),
+		CreatedAt:      mc.clock.Now(),
 		CustomerInfo:   req.CustomerInfo,
 	}
 
-	mc.orders[req.OrderID] = mockOrder
+	if err := mc.saveOrder(ctx, mockOrder); err != nil {
+		return nil, err
+	}
+	mc.logger.DebugContext(ctx, "mock collection order created", "request", req)
 
 	// Simulate success/failure based on config
 	if mc.shouldSucceed() {
+		// QR content as a real channel returns it; the gateway's /qrcode
+		// endpoint renders it
+		qrContent := fmt.Sprintf("https://mock-payment.com/qr/%s", channelOrderID)
 		return &interfaces.CollectOrderResponse{
 			BaseResponse: interfaces.BaseResponse{
 				Success:   true,
 				Code:      "SUCCESS",
 				Message:   "Mock collection order created successfully",
 				RequestID: req.RequestID,
-				Timestamp: time.Now(),
+				Timestamp: mc.clock.Now(),
 			},
 			OrderID:        req.OrderID,
 			ChannelOrderID: channelOrderID,
 			Amount:         req.Amount,
 			Currency:       req.Currency,
 			PaymentURL:     fmt.Sprintf("https://mock-payment.com/pay/%s", channelOrderID),
-			QRCode:         fmt.Sprintf("data:image/png;base64,MOCK_QR_%s", channelOrderID),
+			QRCode:         qrContent,
 			Status:         "pending",
+			Action:         &interfaces.PaymentAction{Type: interfaces.ActionQRCode, QRContent: qrContent},
 		}, nil
 	}
 
@@ -141,22 +209,24 @@ func (mc *MockChannel) CollectOrder(ctx context.Context, req *interfaces.Collect
 			Code:      "MOCK_ERROR",
 			Message:   "Mock collection order failed",
 			RequestID: req.RequestID,
-			Timestamp: time.Now(),
+			Timestamp: mc.clock.Now(),
 		},
 		OrderID:        req.OrderID,
 		ChannelOrderID: channelOrderID,
 		Amount:         req.Amount,
 		Currency:       req.Currency,
 		Status:         "failed",
+		// Simulated refusals never reach an upstream
+		NotCreated: true,
 	}, nil
 }
 
 // PayoutOrder creates a mock payout order
 func (mc *MockChannel) PayoutOrder(ctx context.Context, req *interfaces.PayoutOrderRequest) (*interfaces.PayoutOrderResponse, error) {
-	mc.simulateDelay()
+	mc.simulateDelay(ctx)
 
 	// Generate a mock channel order ID
-	channelOrderID := fmt.Sprintf("MOCK_PAYOUT_%d", time.Now().UnixNano())
+	channelOrderID := fmt.Sprintf("MOCK_PAYOUT_%d", mc.clock.Now().UnixNano())
 
 	// Create mock order
 	mockOrder := &MockOrder{
@@ -165,11 +235,14 @@ func (mc *MockChannel) PayoutOrder(ctx context.Context, req *interfaces.PayoutOr
 		Amount:         req.Amount,
 		Currency:       req.Currency,
 		Status:         "processing",
-		CreatedAt:      time.Now(),
+		CreatedAt:      mc.clock.Now(),
 		RecipientInfo:  req.RecipientInfo,
 	}
 
-	mc.orders[req.OrderID] = mockOrder
+	if err := mc.saveOrder(ctx, mockOrder); err != nil {
+		return nil, err
+	}
+	mc.logger.DebugContext(ctx, "mock payout order created", "request", req)
 
 	// Simulate success/failure based on config
 	if mc.shouldSucceed() {
@@ -179,7 +252,7 @@ func (mc *MockChannel) PayoutOrder(ctx context.Context, req *interfaces.PayoutOr
 				Code:      "SUCCESS",
 				Message:   "Mock payout order created successfully",
 				RequestID: req.RequestID,
-				Timestamp: time.Now(),
+				Timestamp: mc.clock.Now(),
 			},
 			OrderID:        req.OrderID,
 			ChannelOrderID: channelOrderID,
@@ -195,21 +268,26 @@ func (mc *MockChannel) PayoutOrder(ctx context.Context, req *interfaces.PayoutOr
 			Code:      "MOCK_ERROR",
 			Message:   "Mock payout order failed",
 			RequestID: req.RequestID,
-			Timestamp: time.Now(),
+			Timestamp: mc.clock.Now(),
 		},
 		OrderID:        req.OrderID,
 		ChannelOrderID: channelOrderID,
 		Amount:         req.Amount,
 		Currency:       req.Currency,
 		Status:         "failed",
+		// Simulated refusals never reach an upstream
+		NotCreated: true,
 	}, nil
 }
 
 // CollectQuery queries a mock collection order
 func (mc *MockChannel) CollectQuery(ctx context.Context, req *interfaces.CollectQueryRequest) (*interfaces.CollectQueryResponse, error) {
-	mc.simulateDelay()
+	mc.simulateDelay(ctx)
 
-	mockOrder, exists := mc.orders[req.OrderID]
+	mockOrder, exists, err := mc.loadOrder(ctx, req.OrderID)
+	if err != nil {
+		return nil, err
+	}
 	if !exists {
 		return &interfaces.CollectQueryResponse{
 			BaseResponse: interfaces.BaseResponse{
@@ -217,16 +295,19 @@ func (mc *MockChannel) CollectQuery(ctx context.Context, req *interfaces.Collect
 				Code:      "ORDER_NOT_FOUND",
 				Message:   "Mock order not found",
 				RequestID: req.RequestID,
-				Timestamp: time.Now(),
+				Timestamp: mc.clock.Now(),
 			},
 		}, nil
 	}
 
 	// Simulate order completion after some time
-	if mockOrder.Status == "pending" && time.Since(mockOrder.CreatedAt) > 5*time.Second {
+	if mockOrder.Status == "pending" && mc.clock.Now().Sub(mockOrder.CreatedAt) > 5*time.Second {
 		mockOrder.Status = "completed"
-		now := time.Now()
+		now := mc.clock.Now()
 		mockOrder.PaidAt = &now
+		if err := mc.saveOrder(ctx, mockOrder); err != nil {
+			return nil, err
+		}
 	}
 
 	return &interfaces.CollectQueryResponse{
@@ -235,7 +316,7 @@ func (mc *MockChannel) CollectQuery(ctx context.Context, req *interfaces.Collect
 			Code:      "SUCCESS",
 			Message:   "Mock collection order queried successfully",
 			RequestID: req.RequestID,
-			Timestamp: time.Now(),
+			Timestamp: mc.clock.Now(),
 		},
 		OrderID:        mockOrder.OrderID,
 		ChannelOrderID: mockOrder.ChannelOrderID,
@@ -248,9 +329,12 @@ func (mc *MockChannel) CollectQuery(ctx context.Context, req *interfaces.Collect
 
 // PayoutQuery queries a mock payout order
 func (mc *MockChannel) PayoutQuery(ctx context.Context, req *interfaces.PayoutQueryRequest) (*interfaces.PayoutQueryResponse, error) {
-	mc.simulateDelay()
+	mc.simulateDelay(ctx)
 
-	mockOrder, exists := mc.orders[req.OrderID]
+	mockOrder, exists, err := mc.loadOrder(ctx, req.OrderID)
+	if err != nil {
+		return nil, err
+	}
 	if !exists {
 		return &interfaces.PayoutQueryResponse{
 			BaseResponse: interfaces.BaseResponse{
@@ -258,16 +342,19 @@ func (mc *MockChannel) PayoutQuery(ctx context.Context, req *interfaces.PayoutQu
 				Code:      "ORDER_NOT_FOUND",
 				Message:   "Mock order not found",
 				RequestID: req.RequestID,
-				Timestamp: time.Now(),
+				Timestamp: mc.clock.Now(),
 			},
 		}, nil
 	}
 
 	// Simulate payout completion after some time
-	if mockOrder.Status == "processing" && time.Since(mockOrder.CreatedAt) > 3*time.Second {
+	if mockOrder.Status == "processing" && mc.clock.Now().Sub(mockOrder.CreatedAt) > 3*time.Second {
 		mockOrder.Status = "completed"
-		now := time.Now()
+		now := mc.clock.Now()
 		mockOrder.CompletedAt = &now
+		if err := mc.saveOrder(ctx, mockOrder); err != nil {
+			return nil, err
+		}
 	}
 
 	return &interfaces.PayoutQueryResponse{
@@ -276,7 +363,7 @@ func (mc *MockChannel) PayoutQuery(ctx context.Context, req *interfaces.PayoutQu
 			Code:      "SUCCESS",
 			Message:   "Mock payout order queried successfully",
 			RequestID: req.RequestID,
-			Timestamp: time.Now(),
+			Timestamp: mc.clock.Now(),
 		},
 		OrderID:        mockOrder.OrderID,
 		ChannelOrderID: mockOrder.ChannelOrderID,
@@ -289,7 +376,7 @@ func (mc *MockChannel) PayoutQuery(ctx context.Context, req *interfaces.PayoutQu
 
 // BalanceInquiry checks mock account balance
 func (mc *MockChannel) BalanceInquiry(ctx context.Context, req *interfaces.BalanceInquiryRequest) (*interfaces.BalanceInquiryResponse, error) {
-	mc.simulateDelay()
+	mc.simulateDelay(ctx)
 
 	// Generate a mock balance
 	balance := 1000000.0 + rand.Float64()*500000.0 // Random balance between 1M and 1.5M
@@ -300,53 +387,178 @@ func (mc *MockChannel) BalanceInquiry(ctx context.Context, req *interfaces.Balan
 			Code:      "SUCCESS",
 			Message:   "Mock balance inquiry successful",
 			RequestID: req.RequestID,
-			Timestamp: time.Now(),
+			Timestamp: mc.clock.Now(),
 		},
 		Balance:     balance,
 		Currency:    "CNY",
 		AccountType: req.AccountType,
-		LastUpdated: time.Now(),
+		LastUpdated: mc.clock.Now(),
 	}, nil
 }
 
-// Callback processes mock incoming messages
+// mockCallbackEvents maps the statuses mock notifications carry to the
+// event they report, for collections and payouts
+var mockCallbackEvents = map[bool]map[string]string{
+	false: {
+		"completed": interfaces.EventPaymentSucceeded,
+		"closed":    interfaces.EventPaymentClosed,
+		"refunded":  interfaces.EventRefundSucceeded,
+	},
+	true: {
+		"completed": interfaces.EventPayoutCompleted,
+		"failed":    interfaces.EventPayoutFailed,
+		"returned":  interfaces.EventPayoutReturned,
+	},
+}
+
+// Callback processes mock upstream notifications: callback_data names the
+// mock order by order_id and carries its new status, which is recorded and
+// reported back as an event. Notifications about unknown orders or with a
+// status the order's kind does not have are not processed.
 func (mc *MockChannel) Callback(ctx context.Context, req *interfaces.CallbackRequest) (*interfaces.CallbackResponse, error) {
-	mc.simulateDelay()
+	mc.simulateDelay(ctx)
+
+	orderID, _ := req.CallbackData["order_id"].(string)
+	status, _ := req.CallbackData["status"].(string)
+	mockOrder, exists, err := mc.loadOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	var eventType string
+	if exists {
+		eventType = mockCallbackEvents[mockOrder.RecipientInfo != nil][status]
+	}
+	if eventType == "" {
+		return &interfaces.CallbackResponse{
+			BaseResponse: interfaces.BaseResponse{
+				Success:   false,
+				Code:      "INVALID_NOTIFICATION",
+				Message:   "Mock callback names no known order and status",
+				RequestID: req.RequestID,
+				Timestamp: mc.clock.Now(),
+			},
+			Message: "Mock callback names no known order and status",
+		}, nil
+	}
 
-	// Simulate callback processing
-	processed := mc.shouldSucceed()
-	message := "Mock callback processed successfully"
-	if !processed {
-		message = "Mock callback processing failed"
+	occurredAt := mc.clock.Now()
+	if raw, ok := req.CallbackData["occurred_at"].(string); ok {
+		if parsed, err := time.Parse(time.RFC3339, raw); err == nil {
+			occurredAt = parsed
+		}
+	}
+	mockOrder.Status = status
+	if err := mc.saveOrder(ctx, mockOrder); err != nil {
+		return nil, err
 	}
 
+	notifyID, _ := req.CallbackData["notify_id"].(string)
 	return &interfaces.CallbackResponse{
 		BaseResponse: interfaces.BaseResponse{
-			Success:   processed,
+			Success:   true,
 			Code:      "SUCCESS",
-			Message:   message,
+			Message:   "Mock callback processed successfully",
 			RequestID: req.RequestID,
-			Timestamp: time.Now(),
+			Timestamp: mc.clock.Now(),
+		},
+		Processed: true,
+		Message:   "Mock callback processed successfully",
+		Event: &interfaces.CallbackEvent{
+			Type:           eventType,
+			ID:             notifyID,
+			OrderID:        mockOrder.OrderID,
+			ChannelOrderID: mockOrder.ChannelOrderID,
+			Amount:         mockOrder.Amount,
+			Currency:       mockOrder.Currency,
+			OccurredAt:     occurredAt,
+			Raw:            req.CallbackData,
 		},
-		Processed: processed,
-		Message:   message,
+		Ack: "success",
 	}, nil
 }
 
-// Helper methods
-func (mc *MockChannel) simulateDelay() {
-	if delay, exists := mc.config["mock_delay_ms"]; exists {
-		if delayInt, ok := delay.(int); ok {
-			time.Sleep(time.Duration(delayInt) * time.Millisecond)
+// DownloadStatement generates a bill of the mock orders that completed on
+// the requested day
+func (mc *MockChannel) DownloadStatement(ctx context.Context, req *interfaces.StatementRequest) (interfaces.StatementStream, error) {
+	if req.BillType != "" && req.BillType != interfaces.BillTrade {
+		return nil, fmt.Errorf("unsupported bill type %s", req.BillType)
+	}
+	mc.simulateDelay(ctx)
+
+	year, month, day := req.Date.Date()
+	start := time.Date(year, month, day, 0, 0, 0, 0, req.Date.Location())
+	end := start.AddDate(0, 0, 1)
+
+	keys, err := mc.orders.List(ctx, "orders/")
+	if err != nil {
+		return nil, err
+	}
+	var lines []interfaces.StatementLine
+	for _, key := range keys {
+		mockOrder, exists, err := mc.loadOrder(ctx, strings.TrimPrefix(key, "orders/"))
+		if err != nil {
+			return nil, err
+		}
+		if !exists || mockOrder.Status != "completed" {
+			continue
 		}
+
+		line := interfaces.StatementLine{
+			Type:           interfaces.StatementCollect,
+			OrderID:        mockOrder.OrderID,
+			ChannelOrderID: mockOrder.ChannelOrderID,
+			Amount:         mockOrder.Amount,
+			Currency:       mockOrder.Currency,
+			CreatedAt:      mockOrder.CreatedAt,
+		}
+		completedAt := mockOrder.PaidAt
+		if mockOrder.RecipientInfo != nil {
+			line.Type = interfaces.StatementPayout
+			completedAt = mockOrder.CompletedAt
+		}
+		if completedAt == nil || completedAt.Before(start) || !completedAt.Before(end) {
+			continue
+		}
+		line.CompletedAt = *completedAt
+		lines = append(lines, line)
+	}
+	return interfaces.NewStatementStream(lines), nil
+}
+
+// Helper methods
+func (mc *MockChannel) saveOrder(ctx context.Context, order *MockOrder) error {
+	data, err := json.Marshal(order)
+	if err != nil {
+		return fmt.Errorf("failed to encode mock order: %w", err)
+	}
+	return mc.orders.Set(ctx, "orders/"+order.OrderID, data, 0)
+}
+
+func (mc *MockChannel) loadOrder(ctx context.Context, orderID string) (*MockOrder, bool, error) {
+	data, exists, err := mc.orders.Get(ctx, "orders/"+orderID)
+	if err != nil || !exists {
+		return nil, false, err
+	}
+	var order MockOrder
+	if err := json.Unmarshal(data, &order); err != nil {
+		return nil, false, fmt.Errorf("failed to decode mock order: %w", err)
+	}
+	return &order, true, nil
+}
+
+func (mc *MockChannel) simulateDelay(ctx context.Context) {
+	// The delay stands in for the upstream round trip, so trace it as one
+	_, span := tracing.StartSpan(ctx, "mock.upstream")
+	defer span.End()
+
+	if delay, ok := mc.currentConfig()["mock_delay_ms"].(int); ok {
+		time.Sleep(time.Duration(delay) * time.Millisecond)
 	}
 }
 
 func (mc *MockChannel) shouldSucceed() bool {
-	if rate, exists := mc.config["success_rate"]; exists {
-		if rateFloat, ok := rate.(float64); ok {
-			return rand.Float64() < rateFloat
-		}
+	if rate, ok := mc.currentConfig()["success_rate"].(float64); ok {
+		return rand.Float64() < rate
 	}
 	return rand.Float64() < 0.95 // Default 95% success rate
 }
@@ -0,0 +1,89 @@
+// Package audit records security decisions the gateway makes, such as
+// refusing a callback as a possible replay, so they can be reviewed later.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry is one audited decision
+type Entry struct {
+	At time.Time `json:"at"`
+	// Action is what was decided, e.g. "callback.rejected"
+	Action    string `json:"action"`
+	ChannelID string `json:"channel_id,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	SourceIP  string `json:"source_ip,omitempty"`
+	// Reason is a stable code for why, Detail a readable explanation
+	Reason string `json:"reason"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Sink records audit entries
+type Sink interface {
+	Record(ctx context.Context, entry Entry) error
+}
+
+// LogSink records entries as warnings on a logger
+type LogSink struct {
+	logger *slog.Logger
+}
+
+// NewLogSink creates a sink logging to logger
+func NewLogSink(logger *slog.Logger) *LogSink {
+	return &LogSink{logger: logger}
+}
+
+// Record implements Sink
+func (ls *LogSink) Record(ctx context.Context, entry Entry) error {
+	ls.logger.WarnContext(ctx, "audit",
+		"action", entry.Action,
+		"channel_id", entry.ChannelID,
+		"request_id", entry.RequestID,
+		"source_ip", entry.SourceIP,
+		"reason", entry.Reason,
+		"detail", entry.Detail)
+	return nil
+}
+
+// FileSink appends entries to a file, one JSON object per line
+type FileSink struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// OpenFileSink opens or creates the audit file at path for appending
+func OpenFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+	return &FileSink{file: file}, nil
+}
+
+// Record implements Sink
+func (fs *FileSink) Record(ctx context.Context, entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	if _, err := fs.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	return nil
+}
+
+// Close closes the audit file
+func (fs *FileSink) Close() error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	return fs.file.Close()
+}
@@ -0,0 +1,49 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSinkAppends(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, reason := range []string{"first", "second"} {
+		sink, err := OpenFileSink(path)
+		if err != nil {
+			t.Fatalf("OpenFileSink failed: %v", err)
+		}
+		if err := sink.Record(ctx, Entry{At: at, Action: "callback.rejected", ChannelID: "alipay", Reason: reason}); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+		sink.Close()
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer file.Close()
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Expected a JSON entry per line, got %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 2 || entries[0].Reason != "first" || entries[1].Reason != "second" {
+		t.Fatalf("Expected both entries in order after reopening, got %+v", entries)
+	}
+	if !entries[1].At.Equal(at) || entries[1].ChannelID != "alipay" || entries[1].Action != "callback.rejected" {
+		t.Errorf("Expected the entry's fields to round trip, got %+v", entries[1])
+	}
+}
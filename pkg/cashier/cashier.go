@@ -0,0 +1,74 @@
+// Package cashier renders the gateway-hosted payment page for collection
+// orders, and issues the signed, short-lived tokens that address it. The
+// page shows the order and how to pay it, polls for the outcome and sends
+// the payer back to the merchant once the order is paid or expired.
+package cashier
+
+import (
+	"embed"
+	"html/template"
+	"io"
+
+	"golang.org/x/text/language"
+
+	"payment_go/pkg/interfaces"
+)
+
+//go:embed templates/cashier.html
+var templates embed.FS
+
+var page = template.Must(template.New("cashier.html").Funcs(template.FuncMap{
+	// t is replaced per render with the page language's translations
+	"t": func(key string) string { return key },
+	// trusted marks HTML from a plugin, such as an auto-submitting form,
+	// as safe; plugins run inside the gateway and are trusted already
+	"trusted": func(html string) template.HTML { return template.HTML(html) },
+}).ParseFS(templates, "templates/cashier.html"))
+
+// Page is what the cashier shows for an order
+type Page struct {
+	Lang language.Tag
+	// Invalid shows only that the link does not lead to an order
+	Invalid     bool
+	OrderID     string
+	Description string
+	// Amount is formatted in major units, e.g. "100.50"
+	Amount   string
+	Currency string
+	// Status is "pending" while the payer can pay, else the outcome:
+	// "succeeded", "failed" or "closed"
+	Status string
+	// Final is set once the payer can do nothing more on the page
+	Final  bool
+	Action *interfaces.PaymentAction
+	// QRCodeURL serves the image of Action.QRContent
+	QRCodeURL string
+	// StatusURL answers the page's polls with the order's status
+	StatusURL string
+	ReturnURL string
+}
+
+// view is the template's data
+type view struct {
+	Page
+	// Text are the translations the page's script needs
+	Text map[string]string
+}
+
+// Render writes p as HTML in its language
+func Render(w io.Writer, p Page) error {
+	if p.Lang == language.Und {
+		p.Lang = languages[0]
+	}
+	tmpl, err := page.Clone()
+	if err != nil {
+		return err
+	}
+	tmpl.Funcs(template.FuncMap{"t": func(key string) string { return translate(p.Lang, key) }})
+
+	text := make(map[string]string)
+	for _, key := range []string{"succeeded", "failed", "closed", "returning"} {
+		text[key] = translate(p.Lang, key)
+	}
+	return tmpl.Execute(w, view{Page: p, Text: text})
+}
@@ -0,0 +1,91 @@
+package cashier
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/text/language"
+
+	"payment_go/pkg/interfaces"
+)
+
+func render(t *testing.T, p Page) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Render(&buf, p); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	return buf.String()
+}
+
+func TestRenderActions(t *testing.T) {
+	expires := time.Now().Add(10 * time.Minute)
+	page := Page{
+		OrderID:     "ORDER_001",
+		Description: "Coffee <large>",
+		Amount:      "100.50",
+		Currency:    "CNY",
+		Status:      "pending",
+		QRCodeURL:   "/pay/t/qrcode",
+		StatusURL:   "/pay/t/status",
+		ReturnURL:   "https://shop.example.com/done",
+	}
+
+	page.Action = &interfaces.PaymentAction{Type: interfaces.ActionQRCode, QRContent: "https://qr.example.com/x", ExpiresAt: &expires}
+	html := render(t, page)
+	for _, want := range []string{`lang="en"`, "100.50 CNY", "ORDER_001", "Coffee &lt;large&gt;", `src="/pay/t/qrcode"`, "Scan the QR code", `"/pay/t/status"`, `data-expires="`} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Expected the QR page to contain %q", want)
+		}
+	}
+
+	page.Action = &interfaces.PaymentAction{Type: interfaces.ActionRedirect, URL: "https://pay.example.com/?a=1&b=2"}
+	if html := render(t, page); !strings.Contains(html, `href="https://pay.example.com/?a=1&amp;b=2"`) {
+		t.Error("Expected a link to the payment URL")
+	}
+
+	page.Action = &interfaces.PaymentAction{Type: interfaces.ActionForm, HTML: `<form id="pay" action="https://pay.example.com"></form>`}
+	if html := render(t, page); !strings.Contains(html, page.Action.HTML) {
+		t.Error("Expected the channel's form as is")
+	}
+
+	page.Action = nil
+	if html := render(t, page); !strings.Contains(html, "cannot be paid here") {
+		t.Error("Expected a notice for an order without an action")
+	}
+}
+
+func TestRenderFinal(t *testing.T) {
+	html := render(t, Page{Lang: language.SimplifiedChinese, OrderID: "ORDER_001", Status: "succeeded", Final: true, ReturnURL: "https://shop.example.com/done"})
+	if !strings.Contains(html, `lang="zh-Hans"`) || !strings.Contains(html, "支付成功") || !strings.Contains(html, "返回商户") {
+		t.Errorf("Expected a Chinese success page, got %s", html)
+	}
+	if strings.Contains(html, "<script>") {
+		t.Error("Expected no polling on a final page")
+	}
+
+	html = render(t, Page{Invalid: true})
+	if !strings.Contains(html, "This payment link is invalid") || strings.Contains(html, "<script>") {
+		t.Errorf("Expected only the invalid link notice, got %s", html)
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	testCases := []struct {
+		explicit, accept string
+		expected         language.Tag
+	}{
+		{"", "", language.English},
+		{"", "zh-CN,zh;q=0.9,en;q=0.8", language.SimplifiedChinese},
+		{"", "fr-FR", language.English},
+		{"en", "zh-CN", language.English},
+		{"zh", "en-US", language.SimplifiedChinese},
+	}
+	for _, tc := range testCases {
+		if got := Language(tc.explicit, tc.accept); got != tc.expected {
+			t.Errorf("Language(%q, %q): expected %v, got %v", tc.explicit, tc.accept, tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package cashier
+
+import "golang.org/x/text/language"
+
+// languages are the languages the cashier is translated into, the first
+// being the fallback
+var languages = []language.Tag{language.English, language.SimplifiedChinese}
+
+var matcher = language.NewMatcher(languages)
+
+// messages holds the page's text by language and key
+var messages = map[language.Tag]map[string]string{
+	language.English: {
+		"title":     "Checkout",
+		"order":     "Order",
+		"amount":    "Amount",
+		"scan":      "Scan the QR code with your wallet app to pay",
+		"continue":  "Continue to payment",
+		"app":       "Return to the app to complete the payment",
+		"none":      "This order cannot be paid here",
+		"expires":   "Time left",
+		"waiting":   "Waiting for payment…",
+		"succeeded": "Payment received",
+		"failed":    "Payment failed",
+		"closed":    "This order has expired",
+		"returning": "Returning to the merchant…",
+		"back":      "Back to the merchant",
+		"not_found": "This payment link is invalid",
+	},
+	language.SimplifiedChinese: {
+		"title":     "收银台",
+		"order":     "订单号",
+		"amount":    "金额",
+		"scan":      "请使用钱包 App 扫码支付",
+		"continue":  "继续支付",
+		"app":       "请返回 App 完成支付",
+		"none":      "该订单无法在此支付",
+		"expires":   "剩余时间",
+		"waiting":   "等待支付…",
+		"succeeded": "支付成功",
+		"failed":    "支付失败",
+		"closed":    "订单已过期",
+		"returning": "正在返回商户…",
+		"back":      "返回商户",
+		"not_found": "支付链接无效",
+	},
+}
+
+// Language picks the page language from an explicit choice, such as a
+// lang query parameter, then the Accept-Language header
+func Language(explicit, acceptLanguage string) language.Tag {
+	_, index := language.MatchStrings(matcher, explicit, acceptLanguage)
+	return languages[index]
+}
+
+// translate returns the text for key in lang, falling back to English
+func translate(lang language.Tag, key string) string {
+	if text, ok := messages[lang][key]; ok {
+		return text
+	}
+	return messages[languages[0]][key]
+}
@@ -0,0 +1,107 @@
+package cashier
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultTokenTTL is how long a cashier link works when no TTL is set
+const DefaultTokenTTL = 15 * time.Minute
+
+// MinKeySize is the shortest signing key accepted, in bytes
+const MinKeySize = 32
+
+// Token verification errors
+var (
+	ErrInvalidToken = errors.New("invalid cashier token")
+	ErrTokenExpired = errors.New("cashier token has expired")
+)
+
+// Claims are what a token grants access to: one collection of a merchant
+// until ExpiresAt
+type Claims struct {
+	MerchantID string
+	OrderID    string
+	ExpiresAt  time.Time
+}
+
+// claims is the signed payload of a token
+type claims struct {
+	MerchantID string `json:"m"`
+	OrderID    string `json:"o"`
+	ExpiresAt  int64  `json:"e"`
+}
+
+// Signer issues and verifies cashier tokens. A token is the base64url JSON
+// claims and their HMAC-SHA256, so order IDs cannot be guessed or altered.
+type Signer struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewSigner creates a signer with key, which must be at least MinKeySize
+// bytes. Tokens expire after ttl, DefaultTokenTTL when zero.
+func NewSigner(key []byte, ttl time.Duration) (*Signer, error) {
+	if len(key) < MinKeySize {
+		return nil, fmt.Errorf("cashier signing key must be at least %d bytes", MinKeySize)
+	}
+	if ttl < 0 {
+		return nil, fmt.Errorf("cashier token ttl must not be negative")
+	}
+	if ttl == 0 {
+		ttl = DefaultTokenTTL
+	}
+	return &Signer{key: key, ttl: ttl, now: time.Now}, nil
+}
+
+// Sign returns a token for the merchant's collection order
+func (s *Signer) Sign(merchantID, orderID string) string {
+	payload, _ := json.Marshal(claims{
+		MerchantID: merchantID,
+		OrderID:    orderID,
+		ExpiresAt:  s.now().Add(s.ttl).Unix(),
+	})
+	body := base64.RawURLEncoding.EncodeToString(payload)
+	return body + "." + base64.RawURLEncoding.EncodeToString(s.mac(body))
+}
+
+// Verify checks token and returns its claims. A genuine token past its
+// expiry returns its claims with ErrTokenExpired, so the caller can still
+// send the payer back to the merchant.
+func (s *Signer) Verify(token string) (Claims, error) {
+	body, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return Claims{}, ErrInvalidToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, s.mac(body)) {
+		return Claims{}, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	var c claims
+	if err := json.Unmarshal(payload, &c); err != nil || c.MerchantID == "" || c.OrderID == "" {
+		return Claims{}, ErrInvalidToken
+	}
+
+	result := Claims{MerchantID: c.MerchantID, OrderID: c.OrderID, ExpiresAt: time.Unix(c.ExpiresAt, 0)}
+	if !s.now().Before(result.ExpiresAt) {
+		return result, ErrTokenExpired
+	}
+	return result, nil
+}
+
+func (s *Signer) mac(body string) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(body))
+	return h.Sum(nil)
+}
@@ -0,0 +1,76 @@
+package cashier
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestSignVerify(t *testing.T) {
+	signer, err := NewSigner(testKey, time.Minute)
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	signer.now = func() time.Time { return now }
+
+	token := signer.Sign("MERCHANT_001", "ORDER_001")
+	if strings.Contains(token, "ORDER_001") {
+		t.Errorf("Expected the order ID not to appear in the token, got %s", token)
+	}
+	claims, err := signer.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if claims.MerchantID != "MERCHANT_001" || claims.OrderID != "ORDER_001" || !claims.ExpiresAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("Expected the signed claims back, got %+v", claims)
+	}
+
+	now = now.Add(time.Minute)
+	claims, err = signer.Verify(token)
+	if !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Expected %v, got %v", ErrTokenExpired, err)
+	}
+	if claims.OrderID != "ORDER_001" {
+		t.Errorf("Expected an expired token to keep its claims, got %+v", claims)
+	}
+}
+
+func TestVerifyRejectsForgeries(t *testing.T) {
+	signer, _ := NewSigner(testKey, 0)
+	other, _ := NewSigner([]byte(strings.Repeat("k", MinKeySize)), 0)
+	token := signer.Sign("MERCHANT_001", "ORDER_001")
+	body, signature, _ := strings.Cut(token, ".")
+	forged, _, _ := strings.Cut(signer.Sign("MERCHANT_001", "ORDER_002"), ".")
+
+	testCases := map[string]string{
+		"empty":          "",
+		"no signature":   body,
+		"bad encoding":   body + ".!!!",
+		"swapped body":   forged + "." + signature,
+		"truncated":      token[:len(token)-2],
+		"other key":      other.Sign("MERCHANT_001", "ORDER_001"),
+		"garbage claims": "e30." + signature,
+	}
+	for name, token := range testCases {
+		if _, err := signer.Verify(token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected %v, got %v", name, ErrInvalidToken, err)
+		}
+	}
+}
+
+func TestNewSigner(t *testing.T) {
+	if _, err := NewSigner(testKey[:MinKeySize-1], 0); err == nil {
+		t.Error("Expected a short key to be rejected")
+	}
+	if _, err := NewSigner(testKey, -time.Second); err == nil {
+		t.Error("Expected a negative ttl to be rejected")
+	}
+	signer, err := NewSigner(testKey, 0)
+	if err != nil || signer.ttl != DefaultTokenTTL {
+		t.Errorf("Expected the default ttl, got %v, %v", signer, err)
+	}
+}
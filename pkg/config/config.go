@@ -0,0 +1,566 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"payment_go/pkg/fees"
+	"payment_go/pkg/host"
+	"payment_go/pkg/logging"
+	"payment_go/pkg/qrcode"
+	"payment_go/pkg/routing"
+)
+
+// minSecretSize is the shortest signing secret accepted, in bytes
+const minSecretSize = 32
+
+// Environments a channel can run in
+const (
+	EnvSandbox    = "sandbox"
+	EnvProduction = "production"
+)
+
+// Gateway is the declarative gateway configuration file
+type Gateway struct {
+	// Listen is the HTTP listen address, e.g. ":8080"
+	Listen string `json:"listen"`
+	// Environment is the default for channels that do not set their own
+	Environment string         `json:"environment"`
+	Logging     logging.Config `json:"logging"`
+	Secrets     Secrets        `json:"secrets"`
+	Health      Health         `json:"health"`
+	Ledger      Ledger         `json:"ledger"`
+	QRCode      QRCode         `json:"qr_code"`
+	Cashier     Cashier        `json:"cashier"`
+	// Notifications configures telling merchants about their orders
+	Notifications Notifications `json:"notifications"`
+	// Callbacks configures how upstream notifications are remembered and
+	// rejections audited; each channel has its own CallbackPolicy
+	Callbacks Callbacks `json:"callbacks"`
+	// Fees are the fee rules; with none, transactions are free
+	Fees []fees.Rule `json:"fees,omitempty"`
+	// Routes are channel groups merchants can address instead of a channel
+	Routes   []routing.Route `json:"routes,omitempty"`
+	Channels []Channel       `json:"channels"`
+}
+
+// Ledger configures where the double-entry ledger is stored
+type Ledger struct {
+	// Path is the journal file; when empty the ledger is kept in memory and
+	// lost on restart
+	Path string `json:"path,omitempty"`
+}
+
+// QRCode configures how the gateway renders QR codes
+type QRCode struct {
+	// Level is the error correction level, L, M, Q or H; default M, or H
+	// with a logo
+	Level string `json:"level,omitempty"`
+	// Logo is the path of a PNG drawn over the middle of every code
+	Logo string `json:"logo,omitempty"`
+}
+
+// Cashier configures the gateway-hosted payment page; it is enabled when
+// Secret is set
+type Cashier struct {
+	// BaseURL is the gateway's public address cashier links point at,
+	// e.g. "https://pay.example.com"
+	BaseURL string `json:"base_url,omitempty"`
+	// Secret signs the tokens in cashier links, at least 32 bytes,
+	// normally supplied through interpolation
+	Secret string `json:"secret,omitempty"`
+	// TokenTTL is how long a cashier link works, default 15m
+	TokenTTL Duration `json:"token_ttl,omitempty"`
+}
+
+// Notifications configures the merchant notification dispatcher; it is
+// enabled when Secret is set
+type Notifications struct {
+	// Secret signs events for merchants without their own secret, at least
+	// 32 bytes, normally supplied through interpolation
+	Secret string `json:"secret,omitempty"`
+	// MerchantSecrets are per-merchant signing secrets by merchant ID
+	MerchantSecrets map[string]string `json:"merchant_secrets,omitempty"`
+	// Path is the delivery queue file; when empty the queue is kept in
+	// memory and pending deliveries are lost on restart
+	Path string `json:"path,omitempty"`
+	// Schedule is the wait before each retry, default 15s, 1m, 5m, 30m,
+	// 1h, 2h, 6h, 12h
+	Schedule []Duration `json:"schedule,omitempty"`
+	// Timeout bounds each delivery, default 10s
+	Timeout Duration `json:"timeout,omitempty"`
+	// Retention is how long delivered and failed deliveries are kept,
+	// default 30 days
+	Retention Duration `json:"retention,omitempty"`
+	// AllowPrivateNetworks lets notify URLs reach loopback, private and
+	// link-local addresses, which are refused by default
+	AllowPrivateNetworks bool `json:"allow_private_networks,omitempty"`
+	// AdminToken is the bearer token /notifications requests must carry;
+	// without it the endpoint is closed
+	AdminToken string `json:"admin_token,omitempty"`
+}
+
+// Enabled reports whether merchant notifications are configured
+func (n Notifications) Enabled() bool {
+	return n.Secret != "" || len(n.MerchantSecrets) > 0 || n.Path != "" || len(n.Schedule) > 0 || n.Timeout != 0
+}
+
+// Callbacks configures the processing of upstream notifications
+type Callbacks struct {
+	// TTL is how long processed callbacks are remembered, so replays
+	// within it are not processed again, default 7 days
+	TTL Duration `json:"ttl,omitempty"`
+	// Path is the file processed callbacks are remembered in; when empty
+	// they are kept in memory and forgotten on restart
+	Path string `json:"path,omitempty"`
+	// AuditPath is a file rejected callbacks are appended to as JSON
+	// lines; when empty they are logged
+	AuditPath string `json:"audit_path,omitempty"`
+}
+
+// defaultCallbackTTL is the gateway's default Callbacks.TTL
+const defaultCallbackTTL = 7 * 24 * time.Hour
+
+// Health configures active health probing of channels
+type Health struct {
+	// Interval between probe rounds, default 30s
+	Interval Duration `json:"interval,omitempty"`
+	// Timeout bounds each probe, default 5s
+	Timeout Duration `json:"timeout,omitempty"`
+	// UnhealthyAfter consecutive failures mark a channel unhealthy, default 3
+	UnhealthyAfter int `json:"unhealthy_after,omitempty"`
+	// DegradedLatency marks slower successful probes as degraded
+	DegradedLatency Duration `json:"degraded_latency,omitempty"`
+}
+
+// Secrets configures where "secret://name" references in channel config are
+// resolved. Backends are consulted in the order keystore, dir, env; any left
+// unset is skipped.
+type Secrets struct {
+	// Keystore is the path of an encrypted keystore file
+	Keystore string `json:"keystore,omitempty"`
+	// KeystoreKey is the keystore master key as hex or base64, normally
+	// supplied through interpolation, e.g. "${GATEWAY_KEYSTORE_KEY}"
+	KeystoreKey string `json:"keystore_key,omitempty"`
+	// Dir holds one file per secret, named after the secret
+	Dir string `json:"dir,omitempty"`
+	// EnvPrefix enables environment variables starting with this prefix
+	EnvPrefix string `json:"env_prefix,omitempty"`
+	// RefreshInterval is how often secrets are re-read to detect rotation;
+	// zero disables rotation
+	RefreshInterval Duration `json:"refresh_interval,omitempty"`
+}
+
+// Channel configures one payment channel and the plugin serving it
+type Channel struct {
+	ID          string                 `json:"id"`
+	Plugin      PluginSource           `json:"plugin"`
+	Environment string                 `json:"environment,omitempty"`
+	Config      map[string]interface{} `json:"config"`
+	Egress      host.EgressPolicy      `json:"egress"`
+	Policies    Policies               `json:"policies"`
+	Polling     Polling                `json:"polling"`
+	Callbacks   CallbackPolicy         `json:"callbacks"`
+}
+
+// CallbackPolicy says which of the channel's upstream notifications the
+// gateway accepts, to defend against replays
+type CallbackPolicy struct {
+	// MaxAge rejects events the upstream dates more than this before they
+	// arrive. It must cover the upstream's own retries, e.g. 25h for
+	// Alipay, and is required once the policy is set; zero accepts any age.
+	MaxAge Duration `json:"max_age,omitempty"`
+	// AllowedIPs are the addresses and CIDR ranges callbacks may come
+	// from; empty allows any
+	AllowedIPs []string `json:"allowed_ips,omitempty"`
+}
+
+// Sources parses AllowedIPs
+func (p CallbackPolicy) Sources() ([]netip.Prefix, error) {
+	var sources []netip.Prefix
+	for _, source := range p.AllowedIPs {
+		if strings.Contains(source, "/") {
+			prefix, err := netip.ParsePrefix(source)
+			if err != nil {
+				return nil, fmt.Errorf("invalid callback source %q: %w", source, err)
+			}
+			sources = append(sources, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid callback source %q: %w", source, err)
+		}
+		addr = addr.Unmap()
+		sources = append(sources, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return sources, nil
+}
+
+// Polling configures how the gateway queries the channel for orders stuck
+// in pending or processing, in case their callbacks were lost
+type Polling struct {
+	Disabled bool `json:"disabled,omitempty"`
+	// Initial is the age at which an order is first polled and the
+	// shortest wait between polls, default 10s; the waits double from there
+	Initial Duration `json:"initial,omitempty"`
+	// MaxInterval caps the wait between polls, default 5m
+	MaxInterval Duration `json:"max_interval,omitempty"`
+	// MaxAge stops polling orders older than this, default 24h
+	MaxAge Duration `json:"max_age,omitempty"`
+	// Timeout bounds each status query, default 15s
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+// PluginSource says where a channel's plugin comes from. Exactly one field must be set.
+type PluginSource struct {
+	// Path is a .so file opened with the Go plugin package
+	Path string `json:"path,omitempty"`
+	// Static names a plugin compiled into the gateway binary
+	Static string `json:"static,omitempty"`
+	// Command runs the plugin as a subprocess speaking JSON over stdin/stdout
+	Command []string `json:"command,omitempty"`
+}
+
+// Kind returns "path", "static" or "command", or "" when no source is set
+func (ps PluginSource) Kind() string {
+	switch {
+	case ps.Path != "":
+		return "path"
+	case ps.Static != "":
+		return "static"
+	case len(ps.Command) > 0:
+		return "command"
+	}
+	return ""
+}
+
+func (ps PluginSource) count() int {
+	n := 0
+	if ps.Path != "" {
+		n++
+	}
+	if ps.Static != "" {
+		n++
+	}
+	if len(ps.Command) > 0 {
+		n++
+	}
+	return n
+}
+
+// Policies are the middleware policies applied to calls on a channel
+type Policies struct {
+	// Timeout bounds each plugin call
+	Timeout Duration `json:"timeout,omitempty"`
+	// MaxConcurrent limits in-flight calls; further calls are rejected
+	MaxConcurrent int `json:"max_concurrent,omitempty"`
+}
+
+// Duration is a time.Duration written as a string such as "5s" in config files
+type Duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("duration must be a string such as \"5s\"")
+	}
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Load reads, interpolates and validates the config file at path.
+// Environment variables are looked up with os.LookupEnv.
+func Load(path string) (*Gateway, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	cfg, err := Parse(data, os.LookupEnv)
+	if err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Parse decodes a JSON config, expands ${VAR} references in string values
+// using lookup, applies defaults and validates the result
+func Parse(data []byte, lookup func(string) (string, bool)) (*Gateway, error) {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	// Interpolating decoded strings, rather than the raw text, means a
+	// variable's value can never change the structure of the document
+	var expandErrs []error
+	raw = expandValue(raw, lookup, &expandErrs)
+	if len(expandErrs) > 0 {
+		return nil, errors.Join(expandErrs...)
+	}
+
+	expanded, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(expanded))
+	decoder.DisallowUnknownFields()
+	var cfg Gateway
+	if err := decoder.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	cfg.applyDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (g *Gateway) applyDefaults() {
+	if g.Listen == "" {
+		g.Listen = ":8080"
+	}
+	if g.Environment == "" {
+		g.Environment = EnvSandbox
+	}
+	if g.Health.Interval == 0 {
+		g.Health.Interval = Duration(30 * time.Second)
+	}
+	if g.Environment == EnvProduction {
+		g.Logging.Mode = logging.ModeProduction
+	} else if g.Logging.Mode == "" {
+		g.Logging.Mode = logging.ModeSandbox
+	}
+	for i := range g.Channels {
+		if g.Channels[i].Environment == "" {
+			g.Channels[i].Environment = g.Environment
+		}
+		if g.Channels[i].Config == nil {
+			g.Channels[i].Config = map[string]interface{}{}
+		}
+	}
+}
+
+// Validate reports every structural problem in the config
+func (g *Gateway) Validate() error {
+	var errs []error
+	if !validEnvironment(g.Environment) {
+		errs = append(errs, fmt.Errorf("environment must be %q or %q, got %q", EnvSandbox, EnvProduction, g.Environment))
+	}
+	if g.Secrets.Keystore != "" && g.Secrets.KeystoreKey == "" {
+		errs = append(errs, fmt.Errorf("secrets: keystore_key is required with keystore"))
+	}
+	if g.Secrets.RefreshInterval < 0 {
+		errs = append(errs, fmt.Errorf("secrets: refresh_interval must not be negative"))
+	}
+	if g.Health.Interval < 0 || g.Health.Timeout < 0 || g.Health.DegradedLatency < 0 || g.Health.UnhealthyAfter < 0 {
+		errs = append(errs, fmt.Errorf("health: durations and unhealthy_after must not be negative"))
+	}
+	if _, err := fees.New(g.Fees); err != nil {
+		errs = append(errs, fmt.Errorf("fees: %w", err))
+	}
+	if g.QRCode.Level != "" {
+		level, err := qrcode.ParseLevel(g.QRCode.Level)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("qr_code: %w", err))
+		} else if g.QRCode.Logo != "" && level < qrcode.LevelQ {
+			errs = append(errs, fmt.Errorf("qr_code: %w", qrcode.ErrLogoLevel))
+		}
+	}
+	if g.Cashier != (Cashier{}) {
+		if len(g.Cashier.Secret) < minSecretSize {
+			errs = append(errs, fmt.Errorf("cashier: secret must be at least %d bytes", minSecretSize))
+		}
+		if g.Cashier.BaseURL == "" {
+			errs = append(errs, fmt.Errorf("cashier: base_url is required"))
+		}
+		if g.Cashier.TokenTTL < 0 {
+			errs = append(errs, fmt.Errorf("cashier: token_ttl must not be negative"))
+		}
+	}
+	if g.Notifications.Enabled() {
+		if len(g.Notifications.Secret) < minSecretSize {
+			errs = append(errs, fmt.Errorf("notifications: secret must be at least %d bytes", minSecretSize))
+		}
+		for merchantID, secret := range g.Notifications.MerchantSecrets {
+			if len(secret) < minSecretSize {
+				errs = append(errs, fmt.Errorf("notifications: secret of merchant %s must be at least %d bytes", merchantID, minSecretSize))
+			}
+		}
+		for _, wait := range g.Notifications.Schedule {
+			if wait <= 0 {
+				errs = append(errs, fmt.Errorf("notifications: schedule must be positive durations"))
+				break
+			}
+		}
+		if g.Notifications.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("notifications: timeout must not be negative"))
+		}
+		if g.Notifications.Retention < 0 {
+			errs = append(errs, fmt.Errorf("notifications: retention must not be negative"))
+		}
+		if token := g.Notifications.AdminToken; token != "" && len(token) < minSecretSize {
+			errs = append(errs, fmt.Errorf("notifications: admin_token must be at least %d bytes", minSecretSize))
+		}
+	}
+	if g.Callbacks.TTL < 0 {
+		errs = append(errs, fmt.Errorf("callbacks: ttl must not be negative"))
+	}
+	callbackTTL := time.Duration(g.Callbacks.TTL)
+	if callbackTTL <= 0 {
+		callbackTTL = defaultCallbackTTL
+	}
+	if len(g.Channels) == 0 {
+		errs = append(errs, fmt.Errorf("at least one channel must be configured"))
+	}
+
+	seen := make(map[string]bool)
+	for i, ch := range g.Channels {
+		name := fmt.Sprintf("channels[%d]", i)
+		if ch.ID != "" {
+			name = fmt.Sprintf("channel %s", ch.ID)
+		}
+		if ch.ID == "" {
+			errs = append(errs, fmt.Errorf("%s: id is required", name))
+		} else if seen[ch.ID] {
+			errs = append(errs, fmt.Errorf("%s: duplicate channel id", name))
+		}
+		seen[ch.ID] = true
+
+		if ch.Plugin.count() != 1 {
+			errs = append(errs, fmt.Errorf("%s: plugin must set exactly one of path, static or command", name))
+		}
+		if !validEnvironment(ch.Environment) {
+			errs = append(errs, fmt.Errorf("%s: environment must be %q or %q, got %q", name, EnvSandbox, EnvProduction, ch.Environment))
+		}
+		if g.Environment == EnvProduction && ch.Environment == EnvSandbox {
+			errs = append(errs, fmt.Errorf("%s: sandbox channels cannot be served by a production gateway", name))
+		}
+		if ch.Policies.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("%s: policies.timeout must not be negative", name))
+		}
+		if ch.Policies.MaxConcurrent < 0 {
+			errs = append(errs, fmt.Errorf("%s: policies.max_concurrent must not be negative", name))
+		}
+		if ch.Polling.Initial < 0 || ch.Polling.MaxInterval < 0 || ch.Polling.MaxAge < 0 || ch.Polling.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("%s: polling durations must not be negative", name))
+		}
+		if ch.Callbacks.MaxAge < 0 {
+			errs = append(errs, fmt.Errorf("%s: callbacks.max_age must not be negative", name))
+		}
+		if ch.Callbacks.MaxAge == 0 && len(ch.Callbacks.AllowedIPs) > 0 {
+			// Replays older than callbacks.ttl would otherwise be processed
+			errs = append(errs, fmt.Errorf("%s: callbacks.max_age is required with callbacks.allowed_ips", name))
+		}
+		if time.Duration(ch.Callbacks.MaxAge) > callbackTTL {
+			// A replay would be forgotten while still fresh enough to accept
+			errs = append(errs, fmt.Errorf("%s: callbacks.max_age must not exceed callbacks.ttl of %s", name, callbackTTL))
+		}
+		if _, err := ch.Callbacks.Sources(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: callbacks.allowed_ips: %w", name, err))
+		}
+	}
+
+	if _, err := routing.New(g.Routes); err != nil {
+		errs = append(errs, fmt.Errorf("routes: %w", err))
+	}
+	for _, route := range g.Routes {
+		if seen[route.ID] {
+			errs = append(errs, fmt.Errorf("route %s: id is already used by a channel", route.ID))
+		}
+		for _, target := range route.Channels {
+			if target.ChannelID != "" && !seen[target.ChannelID] {
+				errs = append(errs, fmt.Errorf("route %s: channel %s is not configured", route.ID, target.ChannelID))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func validEnvironment(env string) bool {
+	return env == EnvSandbox || env == EnvProduction
+}
+
+func expandValue(value interface{}, lookup func(string) (string, bool), errs *[]error) interface{} {
+	switch v := value.(type) {
+	case string:
+		expanded, err := Expand(v, lookup)
+		if err != nil {
+			*errs = append(*errs, err)
+		}
+		return expanded
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = expandValue(item, lookup, errs)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = expandValue(item, lookup, errs)
+		}
+		return v
+	}
+	return value
+}
+
+// Expand replaces ${NAME} and ${NAME:-default} references in s. A reference
+// to an unset variable without a default is an error; "$$" is a literal "$".
+func Expand(s string, lookup func(string) (string, bool)) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' {
+			out.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == '$' {
+			out.WriteByte('$')
+			i++
+			continue
+		}
+		if i+1 >= len(s) || s[i+1] != '{' {
+			out.WriteByte('$')
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated variable reference in %q", s)
+		}
+		ref := s[i+2 : i+end]
+		name, fallback, hasDefault := strings.Cut(ref, ":-")
+		if name == "" {
+			return "", fmt.Errorf("empty variable reference in %q", s)
+		}
+		value, ok := lookup(name)
+		switch {
+		case ok:
+			out.WriteString(value)
+		case hasDefault:
+			out.WriteString(fallback)
+		default:
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		i += end
+	}
+	return out.String(), nil
+}
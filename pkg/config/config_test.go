@@ -0,0 +1,164 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"payment_go/pkg/logging"
+)
+
+func lookupFrom(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+func TestExpand(t *testing.T) {
+	lookup := lookupFrom(map[string]string{"APP_ID": "2021", "EMPTY": ""})
+
+	testCases := []struct {
+		input    string
+		expected string
+		err      bool
+	}{
+		{"${APP_ID}", "2021", false},
+		{"id-${APP_ID}-x", "id-2021-x", false},
+		{"${MISSING:-fallback}", "fallback", false},
+		{"${EMPTY:-fallback}", "", false},
+		{"cost: $$5", "cost: $5", false},
+		{"plain $ sign", "plain $ sign", false},
+		{"${MISSING}", "", true},
+		{"${APP_ID", "", true},
+	}
+
+	for _, tc := range testCases {
+		got, err := Expand(tc.input, lookup)
+		if tc.err {
+			if err == nil {
+				t.Errorf("Expand(%q): expected error", tc.input)
+			}
+			continue
+		}
+		if err != nil || got != tc.expected {
+			t.Errorf("Expand(%q) = %q, %v; expected %q", tc.input, got, err, tc.expected)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	data := []byte(`{
+		"environment": "sandbox",
+		"channels": [
+			{
+				"id": "alipay",
+				"plugin": {"path": "${PLUGIN_DIR}/alipay.so"},
+				"config": {"app_id": "${ALIPAY_APP_ID}", "private_key": "${ALIPAY_KEY:-}"},
+				"egress": {"allowed_hosts": ["openapi.alipay.com"]},
+				"policies": {"timeout": "3s", "max_concurrent": 50},
+				"callbacks": {"max_age": "25h", "allowed_ips": ["110.75.0.0/16", "203.0.113.7"]}
+			},
+			{
+				"id": "mock",
+				"plugin": {"command": ["./mock-plugin", "--stdio"]}
+			}
+		]
+	}`)
+
+	cfg, err := Parse(data, lookupFrom(map[string]string{
+		"PLUGIN_DIR":    "/opt/plugins",
+		"ALIPAY_APP_ID": "2021000000000000",
+	}))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if cfg.Listen != ":8080" {
+		t.Errorf("expected default listen address, got %q", cfg.Listen)
+	}
+	if cfg.Logging.Mode != logging.ModeSandbox {
+		t.Errorf("sandbox gateways should default to sandbox logging, got %q", cfg.Logging.Mode)
+	}
+
+	alipay := cfg.Channels[0]
+	if alipay.Plugin.Path != "/opt/plugins/alipay.so" || alipay.Plugin.Kind() != "path" {
+		t.Errorf("unexpected plugin source: %+v", alipay.Plugin)
+	}
+	if alipay.Config["app_id"] != "2021000000000000" {
+		t.Errorf("app_id not interpolated: %v", alipay.Config["app_id"])
+	}
+	if time.Duration(alipay.Policies.Timeout) != 3*time.Second || alipay.Policies.MaxConcurrent != 50 {
+		t.Errorf("unexpected policies: %+v", alipay.Policies)
+	}
+	sources, err := alipay.Callbacks.Sources()
+	if err != nil || len(sources) != 2 || sources[1].String() != "203.0.113.7/32" || time.Duration(alipay.Callbacks.MaxAge) != 25*time.Hour {
+		t.Errorf("unexpected callback policy: %+v, %v, %v", alipay.Callbacks, sources, err)
+	}
+	if alipay.Environment != EnvSandbox {
+		t.Errorf("channel should inherit the gateway environment, got %q", alipay.Environment)
+	}
+
+	mock := cfg.Channels[1]
+	if mock.Plugin.Kind() != "command" || mock.Config == nil {
+		t.Errorf("unexpected mock channel: %+v", mock)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	testCases := map[string]string{
+		"unset variable":               `{"channels":[{"id":"a","plugin":{"path":"${NOPE}"}}]}`,
+		"unknown field":                `{"channels":[{"id":"a","plugin":{"path":"a.so"},"polices":{}}]}`,
+		"no channels":                  `{"channels":[]}`,
+		"two sources":                  `{"channels":[{"id":"a","plugin":{"path":"a.so","static":"mock"}}]}`,
+		"duplicate id":                 `{"channels":[{"id":"a","plugin":{"path":"a.so"}},{"id":"a","plugin":{"path":"b.so"}}]}`,
+		"bad environment":              `{"environment":"staging","channels":[{"id":"a","plugin":{"path":"a.so"}}]}`,
+		"sandbox in prod":              `{"environment":"production","channels":[{"id":"a","environment":"sandbox","plugin":{"path":"a.so"}}]}`,
+		"bad duration":                 `{"channels":[{"id":"a","plugin":{"path":"a.so"},"policies":{"timeout":"soon"}}]}`,
+		"keystore without key":         `{"secrets":{"keystore":"s.keystore"},"channels":[{"id":"a","plugin":{"path":"a.so"}}]}`,
+		"negative concurrent":          `{"channels":[{"id":"a","plugin":{"path":"a.so"},"policies":{"max_concurrent":-1}}]}`,
+		"unknown route channel":        `{"routes":[{"id":"r","strategy":"cost","channels":[{"channel_id":"b"}]}],"channels":[{"id":"a","plugin":{"path":"a.so"}}]}`,
+		"route shadows channel":        `{"routes":[{"id":"a","strategy":"cost","channels":[{"channel_id":"a"}]}],"channels":[{"id":"a","plugin":{"path":"a.so"}}]}`,
+		"bad fee rule":                 `{"fees":[{"id":"f","version":1,"side":"buyer"}],"channels":[{"id":"a","plugin":{"path":"a.so"}}]}`,
+		"bad qr level":                 `{"qr_code":{"level":"X"},"channels":[{"id":"a","plugin":{"path":"a.so"}}]}`,
+		"logo at low qr level":         `{"qr_code":{"level":"M","logo":"logo.png"},"channels":[{"id":"a","plugin":{"path":"a.so"}}]}`,
+		"short cashier secret":         `{"cashier":{"base_url":"https://pay.example.com","secret":"short"},"channels":[{"id":"a","plugin":{"path":"a.so"}}]}`,
+		"cashier without url":          `{"cashier":{"secret":"0123456789abcdef0123456789abcdef"},"channels":[{"id":"a","plugin":{"path":"a.so"}}]}`,
+		"notifications without secret": `{"notifications":{"path":"queue.jsonl"},"channels":[{"id":"a","plugin":{"path":"a.so"}}]}`,
+		"short merchant secret":        `{"notifications":{"secret":"0123456789abcdef0123456789abcdef","merchant_secrets":{"M1":"short"}},"channels":[{"id":"a","plugin":{"path":"a.so"}}]}`,
+		"bad retry schedule":           `{"notifications":{"secret":"0123456789abcdef0123456789abcdef","schedule":["15s","0s"]},"channels":[{"id":"a","plugin":{"path":"a.so"}}]}`,
+		"negative polling":             `{"channels":[{"id":"a","plugin":{"path":"a.so"},"polling":{"max_age":"-1h"}}]}`,
+		"bad callback source":          `{"channels":[{"id":"a","plugin":{"path":"a.so"},"callbacks":{"max_age":"25h","allowed_ips":["110.75.0.0/99"]}}]}`,
+		"negative callback ttl":        `{"callbacks":{"ttl":"-1h"},"channels":[{"id":"a","plugin":{"path":"a.so"}}]}`,
+		"callback age beyond ttl":      `{"callbacks":{"ttl":"24h"},"channels":[{"id":"a","plugin":{"path":"a.so"},"callbacks":{"max_age":"25h"}}]}`,
+		"callback sources without age": `{"channels":[{"id":"a","plugin":{"path":"a.so"},"callbacks":{"allowed_ips":["110.75.0.0/16"]}}]}`,
+	}
+
+	for name, data := range testCases {
+		if _, err := Parse([]byte(data), lookupFrom(nil)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadProductionForcesRedaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gateway.json")
+	data := `{"environment":"production","logging":{"mode":"development","allowlist":["phone"]},"channels":[{"id":"a","plugin":{"static":"mock"}}]}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Logging.Mode != logging.ModeProduction {
+		t.Errorf("production gateways must log in production mode, got %q", cfg.Logging.Mode)
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil || !strings.Contains(err.Error(), "missing.json") {
+		t.Errorf("expected error naming the missing file, got %v", err)
+	}
+}
@@ -0,0 +1,269 @@
+// Package fees computes what a transaction costs: the fee the gateway
+// charges the merchant and the cost the upstream channel charges the
+// gateway. Both come from versioned rules selected by channel, merchant,
+// operation and currency.
+package fees
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Sides of a fee
+const (
+	// SideMerchant rules price what merchants pay the gateway
+	SideMerchant = "merchant"
+	// SideChannel rules price what the channel charges the gateway
+	SideChannel = "channel"
+)
+
+// Operations fees are charged for. The first two match the gateway's
+// operation names.
+const (
+	OpCollect = "collect_order"
+	OpPayout  = "payout_order"
+	OpRefund  = "refund"
+)
+
+// Selector picks the transactions a rule applies to. Empty fields match
+// anything; a rule setting more fields wins over one setting fewer.
+type Selector struct {
+	ChannelID  string `json:"channel_id,omitempty"`
+	MerchantID string `json:"merchant_id,omitempty"`
+	Operation  string `json:"operation,omitempty"`
+	Currency   string `json:"currency,omitempty"`
+}
+
+func (s Selector) matches(q *Query) bool {
+	return (s.ChannelID == "" || s.ChannelID == q.ChannelID) &&
+		(s.MerchantID == "" || s.MerchantID == q.MerchantID) &&
+		(s.Operation == "" || s.Operation == q.Operation) &&
+		(s.Currency == "" || s.Currency == q.Currency)
+}
+
+func (s Selector) specificity() int {
+	n := 0
+	for _, field := range []string{s.ChannelID, s.MerchantID, s.Operation, s.Currency} {
+		if field != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// Tier prices amounts up to UpTo minor units; the last tier may leave
+// UpTo zero to cover everything above the previous tier
+type Tier struct {
+	UpTo    int64   `json:"up_to,omitempty"`
+	Percent float64 `json:"percent,omitempty"`
+	Fixed   int64   `json:"fixed,omitempty"`
+}
+
+// Formula prices a transaction. Percent is a percentage of the amount and
+// Fixed a flat charge in minor units; both may be combined. With Tiers the
+// tier the amount falls into supplies the percent and fixed parts instead.
+// Min and Max, when set, clamp the result.
+type Formula struct {
+	Percent float64 `json:"percent,omitempty"`
+	Fixed   int64   `json:"fixed,omitempty"`
+	Tiers   []Tier  `json:"tiers,omitempty"`
+	Min     int64   `json:"min,omitempty"`
+	Max     int64   `json:"max,omitempty"`
+}
+
+// Rule is one version of a fee rule. Versions of a rule share its ID; the
+// version in effect is the one with the latest EffectiveFrom not after the
+// transaction, unless it has expired.
+type Rule struct {
+	ID      string `json:"id"`
+	Version int    `json:"version"`
+	// Side is SideMerchant or SideChannel
+	Side          string    `json:"side"`
+	Selector      Selector  `json:"selector"`
+	Formula       Formula   `json:"formula"`
+	EffectiveFrom time.Time `json:"effective_from"`
+	// EffectiveTo ends the rule without a replacement version; zero means open
+	EffectiveTo time.Time `json:"effective_to,omitempty"`
+}
+
+// Name identifies the rule version, e.g. "standard@2"
+func (r *Rule) Name() string {
+	return fmt.Sprintf("%s@%d", r.ID, r.Version)
+}
+
+// Validate checks the rule's fields
+func (r *Rule) Validate() error {
+	if r.ID == "" {
+		return errors.New("fee rule id is required")
+	}
+	if r.Side != SideMerchant && r.Side != SideChannel {
+		return fmt.Errorf("fee rule %s: side must be %q or %q", r.Name(), SideMerchant, SideChannel)
+	}
+	if !r.EffectiveTo.IsZero() && !r.EffectiveTo.After(r.EffectiveFrom) {
+		return fmt.Errorf("fee rule %s: effective_to must be after effective_from", r.Name())
+	}
+
+	f := &r.Formula
+	if f.Percent < 0 || f.Fixed < 0 || f.Min < 0 || f.Max < 0 {
+		return fmt.Errorf("fee rule %s: fees cannot be negative", r.Name())
+	}
+	if f.Max != 0 && f.Max < f.Min {
+		return fmt.Errorf("fee rule %s: max is below min", r.Name())
+	}
+	if len(f.Tiers) > 0 && (f.Percent != 0 || f.Fixed != 0) {
+		return fmt.Errorf("fee rule %s: tiers replace percent and fixed", r.Name())
+	}
+	for i, tier := range f.Tiers {
+		if tier.Percent < 0 || tier.Fixed < 0 {
+			return fmt.Errorf("fee rule %s: tier %d cannot be negative", r.Name(), i+1)
+		}
+		last := i == len(f.Tiers)-1
+		if tier.UpTo == 0 && !last {
+			return fmt.Errorf("fee rule %s: only the last tier may be unbounded", r.Name())
+		}
+		if i > 0 && tier.UpTo != 0 && tier.UpTo <= f.Tiers[i-1].UpTo {
+			return fmt.Errorf("fee rule %s: tier bounds must increase", r.Name())
+		}
+	}
+	return nil
+}
+
+// Apply computes the rule's fee on amount minor units
+func (f *Formula) Apply(amount int64) int64 {
+	percent, fixed := f.Percent, f.Fixed
+	if len(f.Tiers) > 0 {
+		tier := f.Tiers[len(f.Tiers)-1]
+		for _, t := range f.Tiers {
+			if t.UpTo == 0 || amount <= t.UpTo {
+				tier = t
+				break
+			}
+		}
+		percent, fixed = tier.Percent, tier.Fixed
+	}
+
+	// Rates are fixed to millionths of a percent so results never depend on
+	// float error; fractions of a minor unit round half up. The amount is
+	// split so the multiplication cannot overflow.
+	const scale = 100_000_000
+	micros := int64(math.Round(percent * 1e6))
+	fee := fixed + amount/scale*micros + (amount%scale*micros+scale/2)/scale
+
+	if f.Min != 0 && fee < f.Min {
+		fee = f.Min
+	}
+	if f.Max != 0 && fee > f.Max {
+		fee = f.Max
+	}
+	return fee
+}
+
+// Query describes the transaction to price
+type Query struct {
+	ChannelID  string
+	MerchantID string
+	Operation  string
+	Currency   string
+	// Amount is in minor units of Currency
+	Amount int64
+	// At selects the rule versions in effect
+	At time.Time
+}
+
+// Quote is the price of a transaction. Rules are empty when no rule
+// applied and the fee is zero.
+type Quote struct {
+	MerchantFee  int64  `json:"merchant_fee"`
+	ChannelFee   int64  `json:"channel_fee"`
+	MerchantRule string `json:"merchant_rule,omitempty"`
+	ChannelRule  string `json:"channel_rule,omitempty"`
+}
+
+// Engine selects and applies fee rules. It is immutable and safe for
+// concurrent use; a nil *Engine charges nothing.
+type Engine struct {
+	// versions holds each rule ID's versions, latest first
+	versions map[string][]Rule
+	ids      []string
+}
+
+// New validates rules and builds an engine from them
+func New(rules []Rule) (*Engine, error) {
+	e := &Engine{versions: make(map[string][]Rule)}
+	var errs []error
+	seen := make(map[string]bool)
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if seen[rule.Name()] {
+			errs = append(errs, fmt.Errorf("fee rule %s is defined twice", rule.Name()))
+			continue
+		}
+		seen[rule.Name()] = true
+		if len(e.versions[rule.ID]) == 0 {
+			e.ids = append(e.ids, rule.ID)
+		}
+		e.versions[rule.ID] = append(e.versions[rule.ID], rule)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	for _, versions := range e.versions {
+		sort.Slice(versions, func(i, j int) bool {
+			return versions[i].EffectiveFrom.After(versions[j].EffectiveFrom)
+		})
+	}
+	sort.Strings(e.ids)
+	return e, nil
+}
+
+// Quote prices a transaction with the most specific rule in effect on
+// each side. Equally specific rules are tried in ID order.
+func (e *Engine) Quote(q Query) Quote {
+	var quote Quote
+	if e == nil {
+		return quote
+	}
+	if rule := e.selectRule(SideMerchant, &q); rule != nil {
+		quote.MerchantFee, quote.MerchantRule = rule.Formula.Apply(q.Amount), rule.Name()
+	}
+	if rule := e.selectRule(SideChannel, &q); rule != nil {
+		quote.ChannelFee, quote.ChannelRule = rule.Formula.Apply(q.Amount), rule.Name()
+	}
+	return quote
+}
+
+func (e *Engine) selectRule(side string, q *Query) *Rule {
+	var best *Rule
+	for _, id := range e.ids {
+		rule := e.effective(id, q.At)
+		if rule == nil || rule.Side != side || !rule.Selector.matches(q) {
+			continue
+		}
+		if best == nil || rule.Selector.specificity() > best.Selector.specificity() {
+			best = rule
+		}
+	}
+	return best
+}
+
+// effective returns the version of rule id in effect at
+func (e *Engine) effective(id string, at time.Time) *Rule {
+	versions := e.versions[id]
+	for i := range versions {
+		if versions[i].EffectiveFrom.After(at) {
+			continue
+		}
+		if !versions[i].EffectiveTo.IsZero() && !at.Before(versions[i].EffectiveTo) {
+			return nil
+		}
+		return &versions[i]
+	}
+	return nil
+}
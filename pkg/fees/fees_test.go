@@ -0,0 +1,101 @@
+package fees
+
+import (
+	"testing"
+	"time"
+)
+
+var launch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFormulaApply(t *testing.T) {
+	cases := []struct {
+		name    string
+		formula Formula
+		amount  int64
+		want    int64
+	}{
+		{"percent", Formula{Percent: 0.6}, 10050, 60},
+		{"percent rounds half up", Formula{Percent: 0.5}, 100, 1},
+		{"percent plus fixed", Formula{Percent: 2.9, Fixed: 30}, 10000, 320},
+		{"min", Formula{Percent: 0.6, Min: 100}, 1000, 100},
+		{"max", Formula{Percent: 1, Max: 2500}, 1_000_000, 2500},
+		{"first tier", Formula{Tiers: []Tier{{UpTo: 100000, Percent: 1}, {Percent: 0.5}}}, 50000, 500},
+		{"last tier", Formula{Tiers: []Tier{{UpTo: 100000, Percent: 1}, {Percent: 0.5}}}, 200000, 1000},
+		{"large amount", Formula{Percent: 0.38}, 9_000_000_000_000_000, 34_200_000_000_000},
+	}
+	for _, c := range cases {
+		if got := c.formula.Apply(c.amount); got != c.want {
+			t.Errorf("%s: expected %d, got %d", c.name, c.want, got)
+		}
+	}
+}
+
+func TestQuoteSelectsRules(t *testing.T) {
+	engine, err := New([]Rule{
+		{ID: "default", Version: 1, Side: SideMerchant, Formula: Formula{Percent: 1}, EffectiveFrom: launch},
+		{ID: "default", Version: 2, Side: SideMerchant, Formula: Formula{Percent: 0.8}, EffectiveFrom: launch.AddDate(0, 6, 0)},
+		{ID: "vip", Version: 1, Side: SideMerchant, Selector: Selector{MerchantID: "VIP"}, Formula: Formula{Percent: 0.3}, EffectiveFrom: launch},
+		{ID: "promo", Version: 1, Side: SideMerchant, Selector: Selector{MerchantID: "M1", Operation: OpPayout},
+			Formula: Formula{Fixed: 0}, EffectiveFrom: launch, EffectiveTo: launch.AddDate(0, 1, 0)},
+		{ID: "alipay-cost", Version: 1, Side: SideChannel, Selector: Selector{ChannelID: "alipay"}, Formula: Formula{Percent: 0.6}, EffectiveFrom: launch},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	query := Query{ChannelID: "alipay", MerchantID: "M1", Operation: OpCollect, Currency: "CNY", Amount: 100000, At: launch.AddDate(0, 1, 0)}
+	quote := engine.Quote(query)
+	if quote.MerchantFee != 1000 || quote.MerchantRule != "default@1" || quote.ChannelFee != 600 {
+		t.Errorf("Expected default@1 and channel cost, got %+v", quote)
+	}
+
+	query.At = launch.AddDate(0, 7, 0)
+	if quote := engine.Quote(query); quote.MerchantRule != "default@2" || quote.MerchantFee != 800 {
+		t.Errorf("Expected the later version once effective, got %+v", quote)
+	}
+
+	query.MerchantID = "VIP"
+	if quote := engine.Quote(query); quote.MerchantRule != "vip@1" {
+		t.Errorf("Expected the merchant rule to win, got %+v", quote)
+	}
+
+	query.MerchantID, query.Operation, query.At = "M1", OpPayout, launch.AddDate(0, 0, 10)
+	if quote := engine.Quote(query); quote.MerchantRule != "promo@1" || quote.MerchantFee != 0 {
+		t.Errorf("Expected the promotion while it runs, got %+v", quote)
+	}
+	query.At = launch.AddDate(0, 2, 0)
+	if quote := engine.Quote(query); quote.MerchantRule != "default@1" {
+		t.Errorf("Expected the promotion to expire, got %+v", quote)
+	}
+
+	query.ChannelID = "wechat"
+	if quote := engine.Quote(query); quote.ChannelFee != 0 || quote.ChannelRule != "" {
+		t.Errorf("Expected no channel cost without a rule, got %+v", quote)
+	}
+
+	var none *Engine
+	if quote := none.Quote(query); quote != (Quote{}) {
+		t.Errorf("Expected a nil engine to charge nothing, got %+v", quote)
+	}
+}
+
+func TestRuleValidation(t *testing.T) {
+	invalid := []Rule{
+		{Side: SideMerchant},
+		{ID: "r", Side: "payer"},
+		{ID: "r", Side: SideMerchant, Formula: Formula{Min: 100, Max: 50}},
+		{ID: "r", Side: SideMerchant, Formula: Formula{Percent: 1, Tiers: []Tier{{Percent: 1}}}},
+		{ID: "r", Side: SideMerchant, Formula: Formula{Tiers: []Tier{{Percent: 1}, {UpTo: 100, Percent: 1}}}},
+		{ID: "r", Side: SideMerchant, EffectiveFrom: launch, EffectiveTo: launch},
+	}
+	for i, rule := range invalid {
+		if err := rule.Validate(); err == nil {
+			t.Errorf("Expected error for invalid rule %d: %+v", i, rule)
+		}
+	}
+
+	duplicate := Rule{ID: "r", Version: 1, Side: SideMerchant, EffectiveFrom: launch}
+	if _, err := New([]Rule{duplicate, duplicate}); err == nil {
+		t.Error("Expected error when a rule version is defined twice")
+	}
+}
@@ -0,0 +1,677 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"payment_go/pkg/fees"
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/ledger"
+	"payment_go/pkg/money"
+	"payment_go/pkg/order"
+	"payment_go/pkg/routing"
+)
+
+// maxUpdateAttempts bounds retries of an order update that lost a race
+const maxUpdateAttempts = 5
+
+// WithOrderStore sets where the gateway tracks orders. The default is an
+// in-memory store.
+func WithOrderStore(store order.Store) Option {
+	return func(g *Gateway) {
+		g.orders = store
+	}
+}
+
+// WithLedger sets the ledger order transitions are posted to. The default
+// is an in-memory ledger.
+func WithLedger(l *ledger.Ledger) Option {
+	return func(g *Gateway) {
+		g.ledger = l
+	}
+}
+
+// WithFees sets the engine pricing orders. Without one, orders carry no fees.
+func WithFees(engine *fees.Engine) Option {
+	return func(g *Gateway) {
+		g.fees = engine
+	}
+}
+
+// WithClock sets the clock that dates orders, ledger entries and fee
+// quotes. The default is the system clock.
+func WithClock(clock interfaces.Clock) Option {
+	return func(g *Gateway) {
+		g.clock = clock
+	}
+}
+
+// WithLogger sets the logger for problems the gateway handles itself
+func WithLogger(logger *slog.Logger) Option {
+	return func(g *Gateway) {
+		g.logger = logger
+	}
+}
+
+// Orders returns the store the gateway tracks orders in
+func (g *Gateway) Orders() order.Store {
+	return g.orders
+}
+
+// Ledger returns the ledger order transitions are posted to
+func (g *Gateway) Ledger() *ledger.Ledger {
+	return g.ledger
+}
+
+// observation is what a call's response says about an order
+type observation struct {
+	kind           order.Kind
+	merchantID     string
+	channelID      string
+	orderID        string
+	channelOrderID string
+	amount         float64
+	currency       string
+	// upstream is the channel's raw status, status the normalized one when
+	// the response says it rather than NormalizeStatus
+	upstream string
+	status   order.Status
+	// created is set for the response to placing the order
+	created bool
+	// at is when the upstream says the order completed, if it says
+	at *time.Time
+	// route is the routing decision that placed the order, if any
+	route *routing.Decision
+	// upstreamOrderID is the order ID the channel was given, if not orderID
+	upstreamOrderID string
+	// attempts are the channels tried for a routed order, this one last
+	attempts []order.Attempt
+	// description, returnURL and action are what the payer of a new
+	// collection sees
+	description string
+	returnURL   string
+	action      *interfaces.PaymentAction
+	// notifyURL is where the merchant is told about a new order
+	notifyURL string
+	// callback is set for an upstream notification, which names the order
+	// by upstream ID and merchantID unknown until it is resolved;
+	// occurredAt is when the upstream says the change happened, if it says.
+	// Its amount and currency are the event's, zero when it leaves them out.
+	callback   bool
+	occurredAt time.Time
+	// refundID identifies the refund a refund event reports, refundedTotal
+	// the total refunded so far when the event reports that instead of an
+	// amount
+	refundID      string
+	refundedTotal float64
+}
+
+// observe extracts the order observation from a successful plugin call
+func (g *Gateway) observe(call *Call, resp interface{}) (observation, bool) {
+	obs := observation{
+		merchantID:      call.Base.MerchantID,
+		channelID:       call.Base.ChannelID,
+		route:           call.Route,
+		upstreamOrderID: call.UpstreamOrderID,
+	}
+
+	switch r := resp.(type) {
+	case *interfaces.CollectOrderResponse:
+		req := call.Request.(*interfaces.CollectOrderRequest)
+		obs.kind, obs.orderID, obs.created = order.KindCollect, req.OrderID, true
+		obs.amount, obs.currency = req.Amount, req.Currency
+		obs.channelOrderID, obs.upstream = r.ChannelOrderID, createdStatus(r.BaseResponse, r.NotCreated, r.Status)
+		obs.description, obs.returnURL, obs.action = req.Description, req.ReturnURL, paymentAction(r)
+		obs.notifyURL = req.NotifyURL
+	case *interfaces.PayoutOrderResponse:
+		req := call.Request.(*interfaces.PayoutOrderRequest)
+		obs.kind, obs.orderID, obs.created = order.KindPayout, req.OrderID, true
+		obs.amount, obs.currency = req.Amount, req.Currency
+		obs.channelOrderID, obs.upstream = r.ChannelOrderID, createdStatus(r.BaseResponse, r.NotCreated, r.Status)
+		obs.notifyURL = req.NotifyURL
+	case *interfaces.CollectQueryResponse:
+		if !r.Success {
+			return obs, false
+		}
+		obs.kind, obs.orderID = order.KindCollect, firstNonEmpty(call.Request.(*interfaces.CollectQueryRequest).OrderID, r.OrderID)
+		obs.amount, obs.currency = r.Amount, r.Currency
+		obs.channelOrderID, obs.upstream, obs.at = r.ChannelOrderID, r.Status, r.PaidAt
+	case *interfaces.PayoutQueryResponse:
+		if !r.Success {
+			return obs, false
+		}
+		obs.kind, obs.orderID = order.KindPayout, firstNonEmpty(call.Request.(*interfaces.PayoutQueryRequest).OrderID, r.OrderID)
+		obs.amount, obs.currency = r.Amount, r.Currency
+		obs.channelOrderID, obs.upstream, obs.at = r.ChannelOrderID, r.Status, r.CompletedAt
+	case *interfaces.CallbackResponse:
+		if !r.Success || !r.Processed || r.Event == nil {
+			return obs, false
+		}
+		transition, known := callbackTransitions[r.Event.Type]
+		if !known {
+			return obs, false
+		}
+		obs.kind, obs.status, obs.callback = transition.kind, transition.status, true
+		obs.orderID, obs.upstreamOrderID = r.Event.OrderID, r.Event.OrderID
+		obs.channelOrderID, obs.upstream, obs.occurredAt = r.Event.ChannelOrderID, r.Event.Type, r.Event.OccurredAt
+		obs.amount, obs.currency, obs.refundID = r.Event.Amount, r.Event.Currency, firstNonEmpty(r.Event.RefundID, r.Event.ID)
+		obs.refundedTotal = r.Event.RefundedTotal
+		if !r.Event.OccurredAt.IsZero() {
+			obs.at = &obs.occurredAt
+		}
+	default:
+		return obs, false
+	}
+	if obs.created && call.Route != nil {
+		reason, _ := notCreated(resp, nil)
+		obs.attempts = append(append([]order.Attempt(nil), call.Attempts...), order.Attempt{
+			ChannelID:       obs.channelID,
+			UpstreamOrderID: firstNonEmpty(obs.upstreamOrderID, obs.orderID),
+			At:              g.clock.Now(),
+			Error:           reason,
+		})
+	}
+	return obs, obs.orderID != ""
+}
+
+// paymentAction returns the response's action, or one built from the
+// PaymentURL or QRCode of channels that do not set it
+func paymentAction(r *interfaces.CollectOrderResponse) *interfaces.PaymentAction {
+	switch {
+	case r.Action != nil:
+		return r.Action
+	case r.QRCode != "":
+		return &interfaces.PaymentAction{Type: interfaces.ActionQRCode, QRContent: r.QRCode}
+	case r.PaymentURL != "":
+		return &interfaces.PaymentAction{Type: interfaces.ActionRedirect, URL: r.PaymentURL}
+	}
+	return nil
+}
+
+// createdStatus is the status of a newly placed order. A channel refusing
+// the order is a definitive failure; any other failure leaves the order
+// pending until a query says what became of it.
+func createdStatus(base interfaces.BaseResponse, notCreated bool, status string) string {
+	switch {
+	case base.Success:
+		return status
+	case notCreated:
+		return string(order.StatusFailed)
+	}
+	return ""
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Bookkeeping records orders placed through the gateway and moves them
+// through their statuses as responses come back, posting each money
+// movement to the ledger. It runs innermost, so it sees every plugin
+// response even when an outer middleware has given up on the call.
+// Payouts are held against the merchant's available balance before the
+// plugin is called, and a payout whose call errored is recorded all the same
+// so its hold is settled; otherwise bookkeeping failures are logged and
+// never fail the call, since the upstream has already acted on it. A callback that
+// could not be recorded is left unprocessed instead, so the upstream sends
+// it again. Orders a channel did not create are not recorded while another
+// channel will be tried.
+func (g *Gateway) bookkeeping(next Handler) Handler {
+	return func(ctx context.Context, call *Call) (interface{}, error) {
+		if req, ok := call.Request.(*interfaces.PayoutOrderRequest); ok {
+			if err := g.hold(ctx, req); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := next(ctx, call)
+		observed := resp
+		if err != nil {
+			if _, held := call.Request.(*interfaces.PayoutOrderRequest); !held {
+				return resp, err
+			}
+			observed = erroredPayout(call, err)
+		}
+		if _, definitive := notCreated(observed, nil); definitive && call.failover {
+			// The order will be placed on another channel instead
+			return resp, err
+		}
+		if obs, ok := g.observe(call, observed); ok {
+			if obs.callback {
+				req := call.Request.(*interfaces.CallbackRequest)
+				found, ok := g.resolveCallback(ctx, req, &obs, resp.(*interfaces.CallbackResponse))
+				if !ok {
+					return resp, err
+				}
+				if mismatch := eventMismatch(found, obs); mismatch != "" {
+					return nil, g.rejectCallback(ctx, req, ReasonEventMismatch, mismatch)
+				}
+			}
+			if err := g.record(context.WithoutCancel(ctx), obs); err != nil {
+				g.logger.ErrorContext(ctx, "failed to record order",
+					"operation", string(call.Operation),
+					"channel_id", obs.channelID,
+					"merchant_id", obs.merchantID,
+					"order_id", obs.orderID,
+					"error", err)
+				if obs.callback {
+					// Not acknowledged, so the upstream sends it again
+					resp.(*interfaces.CallbackResponse).Processed = false
+				}
+			}
+		}
+		return resp, err
+	}
+}
+
+// resolveCallback finds the order a callback is about by its upstream ID.
+// A callback about an order the gateway does not know, perhaps because it
+// raced the response placing the order, is not acknowledged, so the
+// upstream sends it again. One about an earlier attempt at placing the
+// order is kept for reconciliation instead of changing the order.
+func (g *Gateway) resolveCallback(ctx context.Context, req *interfaces.CallbackRequest, obs *observation, resp *interfaces.CallbackResponse) (order.Order, bool) {
+	found, err := g.orders.FindUpstream(ctx, obs.kind, obs.channelID, obs.upstreamOrderID)
+	if err != nil {
+		g.logger.WarnContext(ctx, "callback is about an unknown order",
+			"channel_id", obs.channelID,
+			"order_kind", string(obs.kind),
+			"upstream_order_id", obs.upstreamOrderID,
+			"error", err)
+		resp.Processed = false
+		return order.Order{}, false
+	}
+	obs.merchantID, obs.orderID = found.MerchantID, found.ID
+	if found.EarlierAttempt(obs.channelID, obs.upstreamOrderID) >= 0 {
+		g.earlierAttempt(ctx, req, found, *obs, resp)
+		return order.Order{}, false
+	}
+	return found, true
+}
+
+// earlierAttempt keeps a callback about an earlier attempt at placing o on
+// that attempt and audits it. The order itself lives on another channel
+// now and is left alone, so money the earlier channel moved is settled by
+// hand. The callback is acknowledged once kept, so the upstream stops
+// sending it.
+func (g *Gateway) earlierAttempt(ctx context.Context, req *interfaces.CallbackRequest, o order.Order, obs observation, resp *interfaces.CallbackResponse) {
+	ctx = context.WithoutCancel(ctx)
+	at := obs.occurredAt
+	if at.IsZero() {
+		at = g.clock.Now()
+	}
+	for attempt := 1; ; attempt++ {
+		i := o.EarlierAttempt(obs.channelID, obs.upstreamOrderID)
+		o.Attempts[i].Event, o.Attempts[i].EventAt = obs.upstream, at
+		err := g.orders.Update(ctx, o)
+		if errors.Is(err, order.ErrVersionConflict) && attempt < maxUpdateAttempts {
+			if o, err = g.orders.Get(ctx, o.Kind, o.MerchantID, o.ID); err == nil {
+				continue
+			}
+		}
+		if err != nil {
+			g.logger.ErrorContext(ctx, "failed to record callback about an earlier attempt",
+				"channel_id", obs.channelID,
+				"merchant_id", o.MerchantID,
+				"order_id", o.ID,
+				"error", err)
+			resp.Processed = false
+			return
+		}
+		break
+	}
+	g.auditCallback(ctx, req, ActionEarlierAttempt, obs.upstream,
+		fmt.Sprintf("%s order %s of merchant %s was placed on %s as %s, but is now on %s as %s",
+			o.Kind, o.ID, o.MerchantID, obs.channelID, obs.upstreamOrderID, o.ChannelID, o.UpstreamID()))
+}
+
+// eventMismatch says how a callback event disagrees with the order it is
+// about, or returns "" when it agrees. Payments and payouts must be for the
+// order's amount, refunds for no more than is left to refund and refunded
+// totals for no more than the order's amount; events that leave out the
+// amount or currency are taken to be about the whole order.
+func eventMismatch(o order.Order, obs observation) string {
+	if obs.currency != "" && !strings.EqualFold(obs.currency, o.Currency) {
+		return fmt.Sprintf("event currency %s differs from order currency %s", obs.currency, o.Currency)
+	}
+	if obs.status == order.StatusRefunded && obs.refundedTotal != 0 {
+		total, err := money.ToMinor(obs.refundedTotal, o.Currency)
+		if err != nil {
+			return fmt.Sprintf("invalid refunded total: %v", err)
+		}
+		if total < 0 || total > o.Amount {
+			return fmt.Sprintf("refunded total %s is outside the order amount %s", money.Format(total, o.Currency), money.Format(o.Amount, o.Currency))
+		}
+		return ""
+	}
+	if obs.amount == 0 {
+		return ""
+	}
+	amount, err := money.ToMinor(obs.amount, o.Currency)
+	if err != nil {
+		return fmt.Sprintf("invalid event amount: %v", err)
+	}
+	if obs.status == order.StatusRefunded {
+		if o.HasRefund(obs.refundID) {
+			return ""
+		}
+		if left := o.Amount - o.Refunded(); amount > left {
+			return fmt.Sprintf("refund of %s exceeds the %s left to refund", money.Format(amount, o.Currency), money.Format(left, o.Currency))
+		}
+		return ""
+	}
+	if amount != o.Amount {
+		return fmt.Sprintf("event amount %s differs from order amount %s", money.Format(amount, o.Currency), money.Format(o.Amount, o.Currency))
+	}
+	return ""
+}
+
+// stale reports whether an observation says less than the order already
+// knows: the upstream dates it before the change that caused the order's
+// latest transition
+func stale(current order.Order, obs observation) bool {
+	if obs.occurredAt.IsZero() || len(current.History) == 0 {
+		return false
+	}
+	return current.History[len(current.History)-1].UpstreamAt.After(obs.occurredAt)
+}
+
+// record applies an observation to the order it describes. Statuses only
+// move forward, so a callback reporting a status the order has moved past,
+// or dated before its latest transition, leaves it unchanged.
+func (g *Gateway) record(ctx context.Context, obs observation) error {
+	status := obs.status
+	if status == "" {
+		status = order.NormalizeStatus(obs.upstream)
+	}
+
+	for attempt := 1; ; attempt++ {
+		current, err := g.orders.Get(ctx, obs.kind, obs.merchantID, obs.orderID)
+		if errors.Is(err, order.ErrNotFound) {
+			// Queries may find orders placed before the gateway tracked them
+			current, err = g.createOrder(ctx, obs)
+		}
+		if err != nil {
+			return err
+		}
+		changed, transitioned := false, false
+		if current.ChannelOrderID == "" && obs.channelOrderID != "" {
+			current.ChannelOrderID = obs.channelOrderID
+			changed = true
+		}
+		switch {
+		case status == order.StatusRefunded && current.Kind == order.KindCollect:
+			changed, transitioned, err = g.refund(ctx, &current, obs)
+			if err != nil {
+				return err
+			}
+		case status == "" || status == current.Status:
+		case stale(current, obs) || !order.CanTransition(current.Status, status):
+			if obs.callback {
+				g.logger.InfoContext(ctx, "ignored stale callback",
+					"channel_id", obs.channelID,
+					"merchant_id", obs.merchantID,
+					"order_id", obs.orderID,
+					"status", string(current.Status),
+					"upstream", obs.upstream,
+					"version", current.Version)
+			}
+		default:
+			if err := g.post(ctx, &current, status, obs.at); err != nil {
+				return err
+			}
+			if err := current.Transition(status, obs.upstream, g.clock.Now()); err != nil {
+				return err
+			}
+			current.History[len(current.History)-1].UpstreamAt = obs.occurredAt
+			changed, transitioned = true, true
+		}
+		if !changed {
+			return nil
+		}
+
+		err = g.orders.Update(ctx, current)
+		if err == nil && transitioned {
+			g.notify(ctx, current)
+		}
+		if !errors.Is(err, order.ErrVersionConflict) || attempt == maxUpdateAttempts {
+			return err
+		}
+	}
+}
+
+// createOrder stores a new pending order for an observation, tolerating a
+// concurrent call having created it first
+func (g *Gateway) createOrder(ctx context.Context, obs observation) (order.Order, error) {
+	amount, err := money.ToMinor(obs.amount, obs.currency)
+	if err != nil {
+		return order.Order{}, err
+	}
+	now := g.clock.Now()
+	quote := g.fees.Quote(fees.Query{
+		ChannelID:  obs.channelID,
+		MerchantID: obs.merchantID,
+		Operation:  feeOperation(obs.kind),
+		Currency:   obs.currency,
+		Amount:     amount,
+		At:         now,
+	})
+	created := order.Order{
+		ID:              obs.orderID,
+		Kind:            obs.kind,
+		MerchantID:      obs.merchantID,
+		ChannelID:       obs.channelID,
+		ChannelOrderID:  obs.channelOrderID,
+		Amount:          amount,
+		Currency:        obs.currency,
+		Status:          order.StatusPending,
+		MerchantFee:     quote.MerchantFee,
+		ChannelFee:      quote.ChannelFee,
+		MerchantFeeRule: quote.MerchantRule,
+		ChannelFeeRule:  quote.ChannelRule,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		History:         []order.Transition{{To: order.StatusPending, At: now}},
+	}
+	if obs.route != nil {
+		created.Route, created.RouteReason = obs.route.RouteID, obs.route.Reason
+		created.UpstreamOrderID, created.Attempts = obs.upstreamOrderID, obs.attempts
+	}
+	if obs.created {
+		created.Description, created.ReturnURL, created.Action = obs.description, obs.returnURL, obs.action
+		created.NotifyURL = obs.notifyURL
+	}
+	if err := g.orders.Create(ctx, created); err != nil && !errors.Is(err, order.ErrExists) {
+		return order.Order{}, err
+	}
+	return g.orders.Get(ctx, obs.kind, obs.merchantID, obs.orderID)
+}
+
+// refund applies a refund of a paid collection: it is posted with its fees
+// and kept on the order, which moves to refunded once its refunds add up to
+// its amount. Observations without an amount, such as a query finding the
+// order refunded, refund whatever is left. Events reporting the total
+// refunded so far refund the part of it not yet recorded. A refund already
+// applied, a total already covered, or a refund reported before the payment
+// it undoes, changes nothing.
+func (g *Gateway) refund(ctx context.Context, o *order.Order, obs observation) (changed, transitioned bool, err error) {
+	left := o.Amount - o.Refunded()
+	amount := left
+	if obs.callback {
+		switch {
+		case obs.refundedTotal != 0:
+			total, err := money.ToMinor(obs.refundedTotal, o.Currency)
+			if err != nil {
+				return false, false, err
+			}
+			amount = total - o.Refunded()
+		case obs.amount != 0:
+			if amount, err = money.ToMinor(obs.amount, o.Currency); err != nil {
+				return false, false, err
+			}
+		}
+	}
+	covered := obs.refundedTotal != 0 && amount <= 0
+	refundID := firstNonEmpty(obs.refundID, strconv.Itoa(len(o.Refunds)+1))
+	if o.Status != order.StatusSucceeded || stale(*o, obs) || o.HasRefund(refundID) || left == 0 || covered {
+		if obs.callback {
+			g.logger.InfoContext(ctx, "ignored stale callback",
+				"channel_id", obs.channelID,
+				"merchant_id", obs.merchantID,
+				"order_id", obs.orderID,
+				"status", string(o.Status),
+				"upstream", obs.upstream,
+				"refund_id", refundID,
+				"version", o.Version)
+		}
+		return false, false, nil
+	}
+	if amount <= 0 || amount > left {
+		return false, false, fmt.Errorf("refund %s of order %s is %s with %s left to refund",
+			refundID, o.ID, money.Format(amount, o.Currency), money.Format(left, o.Currency))
+	}
+
+	now := g.clock.Now()
+	quote := g.fees.Quote(fees.Query{
+		ChannelID:  o.ChannelID,
+		MerchantID: o.MerchantID,
+		Operation:  fees.OpRefund,
+		Currency:   o.Currency,
+		Amount:     amount,
+		At:         now,
+	})
+	effective := now
+	if obs.at != nil && !obs.at.IsZero() {
+		effective = *obs.at
+	}
+	err = g.postOnce(ctx, ledger.Entry{
+		ID:          o.Key() + ":refund:" + refundID,
+		Time:        effective,
+		Description: string(o.Kind) + " refund " + refundID,
+		Reference:   o.Key(),
+		Postings: append(ledger.RefundPostings(o.MerchantID, o.ChannelID, o.Currency, amount),
+			ledger.FeePostings(o.MerchantID, o.ChannelID, o.Currency, quote.MerchantFee, quote.ChannelFee)...),
+	})
+	if err != nil {
+		return false, false, err
+	}
+	o.Refunds = append(o.Refunds, order.Refund{ID: refundID, Amount: amount, At: effective})
+	o.RefundMerchantFee += quote.MerchantFee
+	o.RefundChannelFee += quote.ChannelFee
+	o.UpdatedAt = now
+	if amount < left {
+		return true, false, nil
+	}
+	if err := o.Transition(order.StatusRefunded, obs.upstream, now); err != nil {
+		return false, false, err
+	}
+	o.History[len(o.History)-1].UpstreamAt = obs.occurredAt
+	return true, true, nil
+}
+
+// postings returns the ledger postings for moving o to status
+func (g *Gateway) postings(ctx context.Context, o *order.Order, status order.Status) ([]ledger.Posting, error) {
+	switch o.Kind {
+	case order.KindCollect:
+		switch status {
+		case order.StatusSucceeded:
+			return append(ledger.CollectionPostings(o.MerchantID, o.ChannelID, o.Currency, o.Amount),
+				ledger.FeePostings(o.MerchantID, o.ChannelID, o.Currency, o.MerchantFee, o.ChannelFee)...), nil
+		}
+
+	case order.KindPayout:
+		held, err := g.heldAmount(ctx, o)
+		if err != nil {
+			return nil, err
+		}
+		switch status {
+		case order.StatusSucceeded:
+			if held == 0 {
+				// Payouts placed before the gateway tracked them were never held
+				return append(ledger.PayoutPostings(o.MerchantID, o.ChannelID, o.Currency, o.Amount),
+					ledger.FeePostings(o.MerchantID, o.ChannelID, o.Currency, o.MerchantFee, o.ChannelFee)...), nil
+			}
+			return capturePostings(o, held), nil
+		case order.StatusFailed, order.StatusClosed:
+			if held != 0 {
+				return ledger.ReleasePostings(o.MerchantID, o.Currency, held), nil
+			}
+		case order.StatusReturned:
+			if o.Status == order.StatusSucceeded {
+				return ledger.ReturnPostings(o.MerchantID, o.ChannelID, o.Currency, o.Amount), nil
+			}
+			// Returned before it was seen to succeed, so never captured
+			if held != 0 {
+				return ledger.ReleasePostings(o.MerchantID, o.Currency, held), nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// capturePostings settles a held payout: the amount goes to the channel and
+// the merchant fee to revenue, both out of the hold. The hold was priced
+// when the payout was submitted, so whatever the final fee leaves over is
+// released and any shortfall is charged to the available balance.
+func capturePostings(o *order.Order, held int64) []ledger.Posting {
+	feeFromHeld := min(o.MerchantFee, held-o.Amount)
+	postings := ledger.CapturePostings(o.MerchantID, o.ChannelID, o.Currency, o.Amount)
+	postings = append(postings, ledger.HeldFeePostings(o.MerchantID, o.Currency, feeFromHeld)...)
+	postings = append(postings, ledger.FeePostings(o.MerchantID, o.ChannelID, o.Currency, o.MerchantFee-feeFromHeld, o.ChannelFee)...)
+	if leftover := held - o.Amount - feeFromHeld; leftover > 0 {
+		postings = append(postings, ledger.ReleasePostings(o.MerchantID, o.Currency, leftover)...)
+	}
+	return postings
+}
+
+// feeOperation is the fee operation for placing an order of kind
+func feeOperation(kind order.Kind) string {
+	if kind == order.KindPayout {
+		return fees.OpPayout
+	}
+	return fees.OpCollect
+}
+
+// post records the money movement of moving o to status. Entry IDs derive
+// from the order and status, so a retried or repeated transition posts once.
+func (g *Gateway) post(ctx context.Context, o *order.Order, status order.Status, at *time.Time) error {
+	postings, err := g.postings(ctx, o, status)
+	if err != nil || len(postings) == 0 {
+		return err
+	}
+
+	effective := g.clock.Now()
+	if at != nil && !at.IsZero() {
+		effective = *at
+	}
+	return g.postOnce(ctx, ledger.Entry{
+		ID:          o.Key() + ":" + string(status),
+		Time:        effective,
+		Description: string(o.Kind) + " " + string(status),
+		Reference:   o.Key(),
+		Postings:    postings,
+	})
+}
+
+// postOnce posts entry, keeping the time of an entry with its ID that an
+// earlier attempt posted before failing to update the order, so that the
+// retried transition is not a conflict
+func (g *Gateway) postOnce(ctx context.Context, entry ledger.Entry) error {
+	posted, found, err := g.ledger.Get(ctx, entry.ID)
+	if err != nil {
+		return err
+	}
+	if found {
+		entry.Time = posted.Time
+	}
+	return g.ledger.Post(ctx, entry)
+}
@@ -0,0 +1,114 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/ledger"
+	"payment_go/pkg/order"
+)
+
+func queryCollect(t *testing.T, g *Gateway, orderID string) {
+	t.Helper()
+	req := &interfaces.CollectQueryRequest{
+		BaseRequest: interfaces.BaseRequest{MerchantID: "MERCHANT_001", ChannelID: "stub", RequestID: "Q_" + orderID},
+		OrderID:     orderID,
+	}
+	if _, err := g.CollectQuery(context.Background(), req); err != nil {
+		t.Fatalf("CollectQuery failed: %v", err)
+	}
+}
+
+func TestCollectionPostsToLedger(t *testing.T) {
+	ctx := context.Background()
+	paidAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	status := "WAIT_BUYER_PAY"
+
+	stub := newStubPlugin()
+	stub.collectQuery = func(ctx context.Context, req *interfaces.CollectQueryRequest) (*interfaces.CollectQueryResponse, error) {
+		return &interfaces.CollectQueryResponse{
+			BaseResponse:   interfaces.BaseResponse{Success: true},
+			OrderID:        req.OrderID,
+			ChannelOrderID: "UP_" + req.OrderID,
+			Amount:         100.50,
+			Currency:       "CNY",
+			Status:         status,
+			PaidAt:         &paidAt,
+		}, nil
+	}
+	g := newTestGateway(t, stub)
+
+	if _, err := g.CollectOrder(ctx, collectRequest("ORDER_1")); err != nil {
+		t.Fatalf("CollectOrder failed: %v", err)
+	}
+	placed, err := g.Orders().Get(ctx, order.KindCollect, "MERCHANT_001", "ORDER_1")
+	if err != nil {
+		t.Fatalf("Expected order to be tracked: %v", err)
+	}
+	if placed.Status != order.StatusPending || placed.Amount != 10050 {
+		t.Errorf("Expected pending order of 10050, got %s %d", placed.Status, placed.Amount)
+	}
+
+	queryCollect(t, g, "ORDER_1")
+	balance, _ := g.Ledger().Balance(ctx, ledger.MerchantAccount("MERCHANT_001"), "CNY")
+	if balance != 0 {
+		t.Errorf("Expected no balance while unpaid, got %d", balance)
+	}
+
+	status = "TRADE_SUCCESS"
+	queryCollect(t, g, "ORDER_1")
+	queryCollect(t, g, "ORDER_1")
+
+	paid, _ := g.Orders().Get(ctx, order.KindCollect, "MERCHANT_001", "ORDER_1")
+	if paid.Status != order.StatusSucceeded || paid.ChannelOrderID != "UP_ORDER_1" {
+		t.Errorf("Expected succeeded order with channel order ID, got %s %q", paid.Status, paid.ChannelOrderID)
+	}
+
+	merchant, _ := g.Ledger().Balance(ctx, ledger.MerchantAccount("MERCHANT_001"), "CNY")
+	channel, _ := g.Ledger().Balance(ctx, ledger.ChannelAccount("stub"), "CNY")
+	if merchant != 10050 || channel != 10050 {
+		t.Errorf("Expected one posting of 10050, got merchant %d channel %d", merchant, channel)
+	}
+	before, _ := g.Ledger().BalanceAt(ctx, ledger.MerchantAccount("MERCHANT_001"), "CNY", paidAt.Add(-time.Second))
+	if before != 0 {
+		t.Errorf("Expected entry to take effect when paid, got %d before", before)
+	}
+
+	status = "REFUNDED"
+	queryCollect(t, g, "ORDER_1")
+	merchant, _ = g.Ledger().Balance(ctx, ledger.MerchantAccount("MERCHANT_001"), "CNY")
+	if merchant != 0 {
+		t.Errorf("Expected refund to reverse the collection, got %d", merchant)
+	}
+}
+
+func TestRejectedOrderIsFailed(t *testing.T) {
+	ctx := context.Background()
+	stub := newStubPlugin()
+	stub.collect = func(ctx context.Context, req *interfaces.CollectOrderRequest) (*interfaces.CollectOrderResponse, error) {
+		return &interfaces.CollectOrderResponse{
+			BaseResponse: interfaces.BaseResponse{Success: false, Code: "INVALID_ACCOUNT"},
+			OrderID:      req.OrderID,
+			NotCreated:   true,
+		}, nil
+	}
+	g := newTestGateway(t, stub)
+
+	if _, err := g.CollectOrder(ctx, collectRequest("ORDER_2")); err != nil {
+		t.Fatalf("CollectOrder failed: %v", err)
+	}
+	rejected, err := g.Orders().Get(ctx, order.KindCollect, "MERCHANT_001", "ORDER_2")
+	if err != nil {
+		t.Fatalf("Expected rejected order to be tracked: %v", err)
+	}
+	if rejected.Status != order.StatusFailed {
+		t.Errorf("Expected failed status, got %s", rejected.Status)
+	}
+
+	entries, _ := g.Ledger().Entries(ctx, "")
+	if len(entries) != 0 {
+		t.Errorf("Expected no ledger entries, got %d", len(entries))
+	}
+}
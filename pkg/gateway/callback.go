@@ -0,0 +1,247 @@
+package gateway
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/order"
+)
+
+const (
+	// DefaultCallbackTTL is how long a processed callback is remembered, so
+	// the upstream resending it within that time is acknowledged again
+	// without processing it twice
+	DefaultCallbackTTL = 7 * 24 * time.Hour
+	// callbackClaimTTL bounds how long an instance processing a callback
+	// keeps others from processing the same one
+	callbackClaimTTL = 30 * time.Second
+	// maxCallbackSize bounds the body of an upstream notification
+	maxCallbackSize = 64 << 10
+	// callbackAckDefault and callbackNack reply to upstreams whose plugin
+	// does not say what they expect
+	callbackAckDefault = "success"
+	callbackNack       = "fail"
+)
+
+// callbackIDFields are the CallbackData fields upstreams put a unique
+// notification ID in; callbacks without one are told apart by their payload
+var callbackIDFields = []string{"notify_id", "notification_id", "event_id"}
+
+// callbackTransitions is the order kind each callback event is about and
+// the status it moves the order to
+var callbackTransitions = map[string]struct {
+	kind   order.Kind
+	status order.Status
+}{
+	interfaces.EventPaymentSucceeded: {order.KindCollect, order.StatusSucceeded},
+	interfaces.EventPaymentClosed:    {order.KindCollect, order.StatusClosed},
+	interfaces.EventPayoutCompleted:  {order.KindPayout, order.StatusSucceeded},
+	interfaces.EventPayoutFailed:     {order.KindPayout, order.StatusFailed},
+	interfaces.EventPayoutReturned:   {order.KindPayout, order.StatusReturned},
+	interfaces.EventRefundSucceeded:  {order.KindCollect, order.StatusRefunded},
+}
+
+// WithCallbackStore sets where processed callbacks are remembered, and for
+// how long. Instances sharing a store acknowledge each other's duplicates.
+// The default is an in-memory store keeping them for DefaultCallbackTTL; a
+// nil store or zero ttl keeps the default.
+func WithCallbackStore(store interfaces.KVStore, ttl time.Duration) Option {
+	return func(g *Gateway) {
+		g.callbacks, g.callbackTTL = store, ttl
+	}
+}
+
+// callbackFingerprint identifies an upstream notification: the channel
+// and the notification ID it carries, or else a hash of its payload
+func callbackFingerprint(req *interfaces.CallbackRequest) string {
+	identity := ""
+	for _, field := range callbackIDFields {
+		if value, ok := req.CallbackData[field]; ok && value != nil && fmt.Sprint(value) != "" {
+			identity = field + "=" + fmt.Sprint(value)
+			break
+		}
+	}
+	if identity == "" {
+		// Map keys marshal sorted, so equal payloads hash equally
+		payload, _ := json.Marshal(req.CallbackData)
+		identity = "payload=" + string(payload)
+	}
+	sum := sha256.Sum256([]byte(req.ChannelID + "\x00" + identity))
+	return hex.EncodeToString(sum[:])
+}
+
+// deduplicate acknowledges callbacks the gateway has already processed
+// without passing them to the plugin again, auditing them as duplicates, and
+// keeps instances from processing the same callback at once. A callback is
+// remembered once its plugin reports it processed.
+func (g *Gateway) deduplicate(next Handler) Handler {
+	return func(ctx context.Context, call *Call) (interface{}, error) {
+		req, ok := call.Request.(*interfaces.CallbackRequest)
+		if !ok {
+			return next(ctx, call)
+		}
+		fingerprint := callbackFingerprint(req)
+		key := "callbacks/" + fingerprint
+
+		if resp, seen, err := g.seenCallback(ctx, req, key); err != nil || seen {
+			return resp, err
+		}
+		acquired, err := g.leases.Acquire(ctx, "callback:"+fingerprint, g.leaseOwner, callbackClaimTTL)
+		if err != nil {
+			return nil, err
+		}
+		if !acquired {
+			// Another instance is processing it; the upstream resends
+			return &interfaces.CallbackResponse{
+				BaseResponse: interfaces.BaseResponse{
+					Code:      "IN_PROGRESS",
+					Message:   "callback is being processed",
+					RequestID: req.RequestID,
+					Timestamp: g.clock.Now(),
+				},
+			}, nil
+		}
+		defer g.leases.Release(context.WithoutCancel(ctx), "callback:"+fingerprint, g.leaseOwner)
+
+		// It may have been processed between the check and the lease
+		if resp, seen, err := g.seenCallback(ctx, req, key); err != nil || seen {
+			return resp, err
+		}
+		resp, err := next(ctx, call)
+		if r, ok := resp.(*interfaces.CallbackResponse); ok && err == nil && r.Success && r.Processed {
+			if err := g.callbacks.Set(context.WithoutCancel(ctx), key, []byte(r.Ack), g.callbackTTL); err != nil {
+				g.logger.ErrorContext(ctx, "failed to remember processed callback",
+					"channel_id", req.ChannelID,
+					"request_id", req.RequestID,
+					"error", err)
+			}
+		}
+		return resp, err
+	}
+}
+
+// seenCallback returns the acknowledgement of a callback already processed
+func (g *Gateway) seenCallback(ctx context.Context, req *interfaces.CallbackRequest, key string) (*interfaces.CallbackResponse, bool, error) {
+	ack, seen, err := g.callbacks.Get(ctx, key)
+	if err != nil || !seen {
+		return nil, false, err
+	}
+	g.auditCallback(ctx, req, ActionCallbackDuplicate, ReasonProcessed, "acknowledged without processing")
+	return &interfaces.CallbackResponse{
+		BaseResponse: interfaces.BaseResponse{
+			Success:   true,
+			Code:      "DUPLICATE",
+			Message:   "callback was already processed",
+			RequestID: req.RequestID,
+			Timestamp: g.clock.Now(),
+		},
+		Processed: true,
+		Ack:       string(ack),
+		Duplicate: true,
+	}, true, nil
+}
+
+// handleCallback receives upstream notifications at
+// POST /callback/{channel_id}, as a form or a JSON object, and replies with
+// the body the upstream expects: the plugin's Ack once the callback is
+// processed, or "fail" so the upstream sends it again. Callbacks rejected
+// as possible replays get a 403.
+func (g *Gateway) handleCallback(w http.ResponseWriter, r *http.Request) {
+	channelID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/callback"), "/")
+	if channelID == "" || strings.Contains(channelID, "/") {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	data, err := callbackData(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnsupportedMediaType, map[string]string{"error": err.Error()})
+		return
+	}
+	req := &interfaces.CallbackRequest{
+		BaseRequest: interfaces.BaseRequest{
+			ChannelID: channelID,
+			Timestamp: g.clock.Now(),
+		},
+		CallbackData: data,
+		SourceIP:     sourceIP(r),
+	}
+	req.CallbackType, _ = data["notify_type"].(string)
+	req.Signature, _ = data["sign"].(string)
+	req.RequestID = "callback-" + callbackFingerprint(req)[:16]
+
+	resp, err := g.Callback(r.Context(), req)
+	switch {
+	case ErrorCode(err) == CodeCallbackRejected:
+		writeCallbackAck(w, http.StatusForbidden, callbackNack)
+	case err != nil:
+		g.logger.WarnContext(r.Context(), "callback failed",
+			"channel_id", channelID,
+			"request_id", req.RequestID,
+			"error", err)
+		writeCallbackAck(w, http.StatusInternalServerError, callbackNack)
+	case !resp.Success || !resp.Processed:
+		writeCallbackAck(w, http.StatusInternalServerError, callbackNack)
+	default:
+		writeCallbackAck(w, http.StatusOK, firstNonEmpty(resp.Ack, callbackAckDefault))
+	}
+}
+
+// callbackData parses a form or JSON object notification
+func callbackData(r *http.Request) (map[string]interface{}, error) {
+	r.Body = http.MaxBytesReader(nil, r.Body, maxCallbackSize)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	data := make(map[string]interface{})
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			return nil, fmt.Errorf("invalid form: %w", err)
+		}
+		for name, values := range r.PostForm {
+			data[name] = values[0]
+		}
+	case "application/json":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body: %w", err)
+		}
+		if err := json.Unmarshal(body, &data); err != nil {
+			return nil, fmt.Errorf("invalid JSON object: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("callbacks must be a form or a JSON object")
+	}
+	return data, nil
+}
+
+// sourceIP is the address a request came from. Forwarding headers are
+// ignored, so behind a proxy this is the proxy's address.
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func writeCallbackAck(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, body)
+}
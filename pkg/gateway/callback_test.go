@@ -0,0 +1,421 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"payment_go/pkg/host"
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/ledger"
+	"payment_go/pkg/order"
+)
+
+// callbackStub returns a stub plugin whose callbacks report the event,
+// order_id, occurred_at, amount, currency, refund_id and refunded_total of
+// their data,
+// counting the calls
+func callbackStub(calls *atomic.Int32) *stubPlugin {
+	stub := newStubPlugin()
+	stub.callback = func(ctx context.Context, req *interfaces.CallbackRequest) (*interfaces.CallbackResponse, error) {
+		calls.Add(1)
+		resp := &interfaces.CallbackResponse{
+			BaseResponse: interfaces.BaseResponse{Success: true, Code: "SUCCESS", RequestID: req.RequestID},
+			Processed:    true,
+			Ack:          "OK",
+		}
+		if eventType, ok := req.CallbackData["event"].(string); ok {
+			resp.Event = &interfaces.CallbackEvent{Type: eventType}
+			resp.Event.OrderID, _ = req.CallbackData["order_id"].(string)
+			if at, ok := req.CallbackData["occurred_at"].(string); ok {
+				resp.Event.OccurredAt, _ = time.Parse(time.RFC3339, at)
+			}
+			resp.Event.Amount, _ = req.CallbackData["amount"].(float64)
+			resp.Event.Currency, _ = req.CallbackData["currency"].(string)
+			resp.Event.RefundID, _ = req.CallbackData["refund_id"].(string)
+			resp.Event.RefundedTotal, _ = req.CallbackData["refunded_total"].(float64)
+		}
+		return resp, nil
+	}
+	return stub
+}
+
+func callbackRequest(data map[string]interface{}) *interfaces.CallbackRequest {
+	return &interfaces.CallbackRequest{
+		BaseRequest:  interfaces.BaseRequest{ChannelID: "stub", RequestID: "CALLBACK", Timestamp: time.Now()},
+		CallbackData: data,
+	}
+}
+
+func TestCallbackDeduplication(t *testing.T) {
+	ctx := context.Background()
+	var calls atomic.Int32
+	gw := newTestGateway(t, callbackStub(&calls))
+	if _, err := gw.CollectOrder(ctx, collectRequest("ORDER_001")); err != nil {
+		t.Fatalf("CollectOrder failed: %v", err)
+	}
+
+	paid := map[string]interface{}{"notify_id": "N1", "order_id": "ORDER_001", "event": interfaces.EventPaymentSucceeded}
+	first, err := gw.Callback(ctx, callbackRequest(paid))
+	if err != nil || !first.Processed || first.Duplicate {
+		t.Fatalf("Expected the callback to be processed, got %+v, %v", first, err)
+	}
+	o, _ := gw.Orders().Get(ctx, order.KindCollect, "MERCHANT_001", "ORDER_001")
+	if o.Status != order.StatusSucceeded {
+		t.Errorf("Expected the callback to complete the order, got %s", o.Status)
+	}
+
+	// A resend carries the same notify ID, whatever else changed
+	resent := map[string]interface{}{"notify_id": "N1", "order_id": "ORDER_001", "event": interfaces.EventPaymentSucceeded, "sign": "other"}
+	second, err := gw.Callback(ctx, callbackRequest(resent))
+	if err != nil || !second.Success || !second.Processed || !second.Duplicate || second.Ack != "OK" {
+		t.Errorf("Expected the resend to be acknowledged as a duplicate, got %+v, %v", second, err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected the plugin to process the callback once, got %d", calls.Load())
+	}
+
+	// Without a notify ID, callbacks are told apart by their payload
+	refunded := map[string]interface{}{"order_id": "ORDER_001", "event": interfaces.EventRefundSucceeded}
+	gw.Callback(ctx, callbackRequest(refunded))
+	if third, _ := gw.Callback(ctx, callbackRequest(refunded)); !third.Duplicate || calls.Load() != 2 {
+		t.Errorf("Expected an identical payload to be a duplicate, got %+v after %d calls", third, calls.Load())
+	}
+
+	// The same notify ID on another channel is another notification
+	if callbackFingerprint(callbackRequest(paid)) == callbackFingerprint(&interfaces.CallbackRequest{
+		BaseRequest: interfaces.BaseRequest{ChannelID: "other"}, CallbackData: paid,
+	}) {
+		t.Error("Expected fingerprints to differ between channels")
+	}
+}
+
+func TestCallbackConcurrentDelivery(t *testing.T) {
+	ctx := context.Background()
+	var calls atomic.Int32
+	stub := callbackStub(&calls)
+	process := stub.callback
+	started, release := make(chan struct{}), make(chan struct{})
+	stub.callback = func(ctx context.Context, req *interfaces.CallbackRequest) (*interfaces.CallbackResponse, error) {
+		close(started)
+		<-release
+		return process(ctx, req)
+	}
+	gw := newTestGateway(t, stub)
+	gw.CollectOrder(ctx, collectRequest("ORDER_001"))
+
+	paid := map[string]interface{}{"notify_id": "N1", "order_id": "ORDER_001", "event": interfaces.EventPaymentSucceeded}
+	done := make(chan *interfaces.CallbackResponse)
+	go func() {
+		resp, _ := gw.Callback(ctx, callbackRequest(paid))
+		done <- resp
+	}()
+	<-started
+
+	busy, err := gw.Callback(ctx, callbackRequest(paid))
+	if err != nil || busy.Processed {
+		t.Errorf("Expected a callback being processed elsewhere not to be acknowledged, got %+v, %v", busy, err)
+	}
+	close(release)
+	if first := <-done; !first.Processed || first.Duplicate {
+		t.Errorf("Expected the first delivery to be processed, got %+v", first)
+	}
+	if again, _ := gw.Callback(ctx, callbackRequest(paid)); !again.Duplicate {
+		t.Errorf("Expected a later delivery to be a duplicate, got %+v", again)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected one call to the plugin, got %d", calls.Load())
+	}
+}
+
+func TestCallbackStaleStatus(t *testing.T) {
+	ctx := context.Background()
+	var calls atomic.Int32
+	gw := newTestGateway(t, callbackStub(&calls))
+	gw.CollectOrder(ctx, collectRequest("ORDER_001"))
+	paidAt := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+
+	callbacks := []map[string]interface{}{
+		{"notify_id": "N1", "order_id": "ORDER_001", "event": interfaces.EventPaymentSucceeded, "occurred_at": paidAt.Format(time.RFC3339)},
+		{"notify_id": "N2", "order_id": "ORDER_001", "event": interfaces.EventRefundSucceeded, "occurred_at": paidAt.Add(time.Minute).Format(time.RFC3339)},
+		// A resent payment notification arriving after the refund
+		{"notify_id": "N3", "order_id": "ORDER_001", "event": interfaces.EventPaymentSucceeded, "occurred_at": paidAt.Format(time.RFC3339)},
+	}
+	for _, data := range callbacks {
+		if resp, err := gw.Callback(ctx, callbackRequest(data)); err != nil || !resp.Processed {
+			t.Fatalf("Expected callback %v to be acknowledged, got %+v, %v", data["notify_id"], resp, err)
+		}
+	}
+	o, _ := gw.Orders().Get(ctx, order.KindCollect, "MERCHANT_001", "ORDER_001")
+	if o.Status != order.StatusRefunded || len(o.History) != 3 {
+		t.Errorf("Expected the order to stay refunded after pending, paid and refunded, got %s with %d transitions", o.Status, len(o.History))
+	}
+	if !o.History[1].UpstreamAt.Equal(paidAt) {
+		t.Errorf("Expected the payment's upstream time %s, got %s", paidAt, o.History[1].UpstreamAt)
+	}
+
+	// A refund dated before the payment it would undo is out of order
+	gw.CollectOrder(ctx, collectRequest("ORDER_002"))
+	gw.Callback(ctx, callbackRequest(map[string]interface{}{"notify_id": "N4", "order_id": "ORDER_002", "event": interfaces.EventPaymentSucceeded, "occurred_at": paidAt.Format(time.RFC3339)}))
+	gw.Callback(ctx, callbackRequest(map[string]interface{}{"notify_id": "N5", "order_id": "ORDER_002", "event": interfaces.EventRefundSucceeded, "occurred_at": paidAt.Add(-time.Minute).Format(time.RFC3339)}))
+	if o, _ := gw.Orders().Get(ctx, order.KindCollect, "MERCHANT_001", "ORDER_002"); o.Status != order.StatusSucceeded {
+		t.Errorf("Expected an out of order refund to be ignored, got %s", o.Status)
+	}
+}
+
+func TestCallbackUnknownOrder(t *testing.T) {
+	ctx := context.Background()
+	var calls atomic.Int32
+	gw := newTestGateway(t, callbackStub(&calls))
+
+	data := map[string]interface{}{"notify_id": "N1", "order_id": "MISSING", "event": interfaces.EventPaymentSucceeded}
+	for i := 0; i < 2; i++ {
+		if resp, _ := gw.Callback(ctx, callbackRequest(data)); resp.Processed {
+			t.Errorf("Expected a callback about an unknown order not to be acknowledged, got %+v", resp)
+		}
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected an unacknowledged callback to be processed again, got %d calls", calls.Load())
+	}
+	if orders, _ := gw.Orders().List(ctx, ""); len(orders) != 0 {
+		t.Errorf("Expected callbacks never to create orders, got %d", len(orders))
+	}
+}
+
+func TestCallbackEndpoint(t *testing.T) {
+	ctx := context.Background()
+	var calls atomic.Int32
+	gw := newTestGateway(t, callbackStub(&calls))
+	gw.CollectOrder(ctx, collectRequest("ORDER_001"))
+	handler := gw.Handler()
+
+	post := func(path, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	form := url.Values{"notify_id": {"N1"}, "order_id": {"ORDER_001"}, "event": {interfaces.EventPaymentSucceeded}}.Encode()
+	for i := 0; i < 2; i++ {
+		if rec := post("/callback/stub", "application/x-www-form-urlencoded", form); rec.Code != http.StatusOK || rec.Body.String() != "OK" {
+			t.Errorf("Expected the plugin's ack, got %d %q", rec.Code, rec.Body.String())
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected the resent form to be a duplicate, got %d calls", calls.Load())
+	}
+
+	rec := post("/callback/stub", "application/json", `{"notify_id":"N2","order_id":"MISSING","event":"payment.succeeded"}`)
+	if rec.Code != http.StatusInternalServerError || rec.Body.String() != "fail" {
+		t.Errorf("Expected an unprocessed callback to fail, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := post("/callback/stub", "text/xml", "<xml/>"); rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415 for XML, got %d", rec.Code)
+	}
+	if rec := post("/callback/", "application/json", "{}"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without a channel, got %d", rec.Code)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/callback/stub", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET, got %d", recorder.Code)
+	}
+}
+
+func TestCallbackEvents(t *testing.T) {
+	ctx := context.Background()
+	var calls atomic.Int32
+	stub := callbackStub(&calls)
+	stub.payout = func(ctx context.Context, req *interfaces.PayoutOrderRequest) (*interfaces.PayoutOrderResponse, error) {
+		return &interfaces.PayoutOrderResponse{BaseResponse: interfaces.BaseResponse{Success: true}, OrderID: req.OrderID, Status: "processing"}, nil
+	}
+	gw := newTestGateway(t, stub)
+	fund(t, gw, 10000)
+	gw.CollectOrder(ctx, collectRequest("ORDER_001"))
+	gw.CollectOrder(ctx, collectRequest("ORDER_002"))
+	if _, err := gw.PayoutOrder(ctx, payoutRequest("ORDER_001", 20)); err != nil {
+		t.Fatalf("PayoutOrder failed: %v", err)
+	}
+
+	tests := []struct {
+		event  string
+		kind   order.Kind
+		id     string
+		status order.Status
+	}{
+		{interfaces.EventPayoutCompleted, order.KindPayout, "ORDER_001", order.StatusSucceeded},
+		{interfaces.EventPayoutReturned, order.KindPayout, "ORDER_001", order.StatusReturned},
+		{interfaces.EventPaymentClosed, order.KindCollect, "ORDER_002", order.StatusClosed},
+		{"payment.disputed", order.KindCollect, "ORDER_001", order.StatusPending},
+	}
+	for _, tt := range tests {
+		data := map[string]interface{}{"event": tt.event, "order_id": tt.id}
+		resp, err := gw.Callback(ctx, callbackRequest(data))
+		if err != nil || !resp.Processed {
+			t.Fatalf("Expected %s to be processed, got %+v, %v", tt.event, resp, err)
+		}
+		if resp.Event.Raw["event"] != tt.event {
+			t.Errorf("Expected the raw payload on the %s event, got %v", tt.event, resp.Event.Raw)
+		}
+		if o, _ := gw.Orders().Get(ctx, tt.kind, "MERCHANT_001", tt.id); o.Status != tt.status {
+			t.Errorf("Expected %s to leave %s %s %s, got %s", tt.event, tt.kind, tt.id, tt.status, o.Status)
+		}
+	}
+}
+
+func TestCallbackEventMismatch(t *testing.T) {
+	ctx := context.Background()
+	var calls atomic.Int32
+	sink := &recordingSink{}
+	gw := newTestGateway(t, callbackStub(&calls), WithAuditSink(sink))
+	gw.CollectOrder(ctx, collectRequest("ORDER_001"))
+
+	for _, data := range []map[string]interface{}{
+		{"notify_id": "N1", "order_id": "ORDER_001", "event": interfaces.EventPaymentSucceeded, "amount": 0.01},
+		{"notify_id": "N2", "order_id": "ORDER_001", "event": interfaces.EventPaymentSucceeded, "amount": 100.50, "currency": "USD"},
+	} {
+		if _, err := gw.Callback(ctx, callbackRequest(data)); ErrorCode(err) != CodeCallbackRejected {
+			t.Errorf("Expected callback %v to be rejected, got %v", data["notify_id"], err)
+		}
+	}
+	if o, _ := gw.Orders().Get(ctx, order.KindCollect, "MERCHANT_001", "ORDER_001"); o.Status != order.StatusPending {
+		t.Errorf("Expected mismatched events to leave the order pending, got %s", o.Status)
+	}
+	if reasons := sink.reasons(); len(reasons) != 2 || reasons[0] != ReasonEventMismatch || reasons[1] != ReasonEventMismatch {
+		t.Errorf("Expected both mismatches audited, got %v", reasons)
+	}
+
+	paid := map[string]interface{}{"notify_id": "N3", "order_id": "ORDER_001", "event": interfaces.EventPaymentSucceeded, "amount": 100.50, "currency": "cny"}
+	if resp, err := gw.Callback(ctx, callbackRequest(paid)); err != nil || !resp.Processed {
+		t.Errorf("Expected a matching event to be processed, got %+v, %v", resp, err)
+	}
+}
+
+func TestCallbackPartialRefunds(t *testing.T) {
+	ctx := context.Background()
+	var calls atomic.Int32
+	clock := host.NewManualClock(time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC))
+	gw := newTestGateway(t, callbackStub(&calls), WithClock(clock))
+	gw.CollectOrder(ctx, collectRequest("ORDER_001"))
+	merchant := ledger.MerchantAccount("MERCHANT_001")
+
+	refund := func(notifyID, refundID string, amount float64) error {
+		_, err := gw.Callback(ctx, callbackRequest(map[string]interface{}{
+			"notify_id": notifyID, "order_id": "ORDER_001", "event": interfaces.EventRefundSucceeded, "refund_id": refundID, "amount": amount,
+		}))
+		return err
+	}
+	gw.Callback(ctx, callbackRequest(map[string]interface{}{"notify_id": "N1", "order_id": "ORDER_001", "event": interfaces.EventPaymentSucceeded}))
+
+	if err := refund("N2", "R1", 30); err != nil {
+		t.Fatalf("Expected a partial refund to be processed, got %v", err)
+	}
+	o, _ := gw.Orders().Get(ctx, order.KindCollect, "MERCHANT_001", "ORDER_001")
+	balance, _ := gw.Ledger().Balance(ctx, merchant, "CNY")
+	if o.Status != order.StatusSucceeded || o.Refunded() != 3000 || balance != 7050 {
+		t.Errorf("Expected 30.00 refunded of a succeeded order, got %s with %d refunded and balance %d", o.Status, o.Refunded(), balance)
+	}
+	if !o.Refunds[0].At.Equal(clock.Now()) || !o.UpdatedAt.Equal(clock.Now()) {
+		t.Errorf("Expected the refund dated by the gateway clock, got %+v", o.Refunds[0])
+	}
+
+	// The same refund sent again under another notification ID
+	if err := refund("N3", "R1", 30); err != nil {
+		t.Errorf("Expected a repeated refund to be acknowledged, got %v", err)
+	}
+	if err := refund("N4", "R2", 80); ErrorCode(err) != CodeCallbackRejected {
+		t.Errorf("Expected a refund of more than is left to be rejected, got %v", err)
+	}
+	if err := refund("N5", "R2", 70.50); err != nil {
+		t.Fatalf("Expected the rest to be refunded, got %v", err)
+	}
+	o, _ = gw.Orders().Get(ctx, order.KindCollect, "MERCHANT_001", "ORDER_001")
+	balance, _ = gw.Ledger().Balance(ctx, merchant, "CNY")
+	if o.Status != order.StatusRefunded || len(o.Refunds) != 2 || balance != 0 {
+		t.Errorf("Expected the order refunded in two parts, got %s with %+v and balance %d", o.Status, o.Refunds, balance)
+	}
+}
+
+func TestCallbackRefundedTotals(t *testing.T) {
+	ctx := context.Background()
+	var calls atomic.Int32
+	gw := newTestGateway(t, callbackStub(&calls))
+	gw.CollectOrder(ctx, collectRequest("ORDER_001"))
+	gw.Callback(ctx, callbackRequest(map[string]interface{}{"notify_id": "N1", "order_id": "ORDER_001", "event": interfaces.EventPaymentSucceeded}))
+
+	refunded := func(notifyID, refundID string, total float64) error {
+		_, err := gw.Callback(ctx, callbackRequest(map[string]interface{}{
+			"notify_id": notifyID, "order_id": "ORDER_001", "event": interfaces.EventRefundSucceeded, "refund_id": refundID, "refunded_total": total,
+		}))
+		return err
+	}
+	if err := refunded("N2", "R1", 30); err != nil {
+		t.Fatalf("Expected the first refund to be processed, got %v", err)
+	}
+	if err := refunded("N3", "R2", 50); err != nil {
+		t.Fatalf("Expected the second refund to be processed, got %v", err)
+	}
+	o, _ := gw.Orders().Get(ctx, order.KindCollect, "MERCHANT_001", "ORDER_001")
+	if o.Refunded() != 5000 || len(o.Refunds) != 2 || o.Refunds[1].Amount != 2000 {
+		t.Errorf("Expected the second refund to add 20.00 to a 50.00 total, got %+v", o.Refunds)
+	}
+
+	// A total already covered, e.g. the first refund notified late
+	if err := refunded("N4", "R0", 30); err != nil {
+		t.Errorf("Expected a covered total to be acknowledged, got %v", err)
+	}
+	if err := refunded("N5", "R3", 120); ErrorCode(err) != CodeCallbackRejected {
+		t.Errorf("Expected a total above the order amount to be rejected, got %v", err)
+	}
+	if err := refunded("N6", "R3", 100.50); err != nil {
+		t.Fatalf("Expected the rest to be refunded, got %v", err)
+	}
+	o, _ = gw.Orders().Get(ctx, order.KindCollect, "MERCHANT_001", "ORDER_001")
+	if o.Status != order.StatusRefunded || len(o.Refunds) != 3 || o.Refunded() != o.Amount {
+		t.Errorf("Expected the order refunded in three parts, got %s with %+v", o.Status, o.Refunds)
+	}
+}
+
+// failingUpdates is an order store whose updates fail while broken is set
+type failingUpdates struct {
+	*order.MemoryStore
+	broken atomic.Bool
+}
+
+func (fu *failingUpdates) Update(ctx context.Context, o order.Order) error {
+	if fu.broken.Load() {
+		return errors.New("store unavailable")
+	}
+	return fu.MemoryStore.Update(ctx, o)
+}
+
+func TestCallbackRecordFailure(t *testing.T) {
+	ctx := context.Background()
+	var calls atomic.Int32
+	store := &failingUpdates{MemoryStore: order.NewMemoryStore()}
+	gw := newTestGateway(t, callbackStub(&calls), WithOrderStore(store))
+	gw.CollectOrder(ctx, collectRequest("ORDER_001"))
+
+	store.broken.Store(true)
+	paid := map[string]interface{}{"notify_id": "N1", "order_id": "ORDER_001", "event": interfaces.EventPaymentSucceeded}
+	if resp, err := gw.Callback(ctx, callbackRequest(paid)); err != nil || resp.Processed {
+		t.Errorf("Expected a callback that could not be recorded not to be acknowledged, got %+v, %v", resp, err)
+	}
+
+	store.broken.Store(false)
+	if resp, err := gw.Callback(ctx, callbackRequest(paid)); err != nil || !resp.Processed || resp.Duplicate {
+		t.Errorf("Expected the resend to be processed, got %+v, %v", resp, err)
+	}
+	if o, _ := gw.Orders().Get(ctx, order.KindCollect, "MERCHANT_001", "ORDER_001"); o.Status != order.StatusSucceeded {
+		t.Errorf("Expected the resend to complete the order, got %s", o.Status)
+	}
+}
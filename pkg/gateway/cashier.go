@@ -0,0 +1,209 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"payment_go/pkg/cashier"
+	"payment_go/pkg/config"
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/money"
+	"payment_go/pkg/order"
+	"payment_go/pkg/qrcode"
+)
+
+// cashierQRSize is the size of the QR code on the cashier page, in pixels
+const cashierQRSize = 240
+
+// cashierSettings enable the hosted cashier
+type cashierSettings struct {
+	signer *cashier.Signer
+	// baseURL is the gateway's public address the cashier links point at
+	baseURL string
+}
+
+// WithCashier enables the hosted cashier at /pay/{token}. Successful
+// collections get a CashierURL under baseURL, the gateway's public
+// address, carrying a token issued by signer.
+func WithCashier(signer *cashier.Signer, baseURL string) Option {
+	return func(g *Gateway) {
+		g.cashier = &cashierSettings{signer: signer, baseURL: strings.TrimSuffix(baseURL, "/")}
+	}
+}
+
+// cashierOption builds the WithCashier option for cfg
+func cashierOption(cfg config.Cashier) (Option, error) {
+	signer, err := cashier.NewSigner([]byte(cfg.Secret), time.Duration(cfg.TokenTTL))
+	if err != nil {
+		return nil, fmt.Errorf("cashier: %w", err)
+	}
+	return WithCashier(signer, cfg.BaseURL), nil
+}
+
+// CashierURL returns the hosted cashier link for a merchant's collection,
+// or "" when the cashier is not enabled
+func (g *Gateway) CashierURL(merchantID, orderID string) string {
+	if g.cashier == nil {
+		return ""
+	}
+	return g.cashier.baseURL + "/pay/" + g.cashier.signer.Sign(merchantID, orderID)
+}
+
+// cashierStatusView is the body of /pay/{token}/status
+type cashierStatusView struct {
+	Status string `json:"status"`
+	Final  bool   `json:"final"`
+	// RedirectURL is where the page sends the payer once final
+	RedirectURL string `json:"redirect_url,omitempty"`
+}
+
+// handleCashier serves the hosted cashier: /pay/{token} is the payment
+// page, /pay/{token}/status answers its polls and /pay/{token}/qrcode is
+// the order's QR code. The page language comes from the lang query
+// parameter or Accept-Language.
+func (g *Gateway) handleCashier(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	// The token grants access to the order, so it must not leak through
+	// caches or the Referer of links on the page
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	token, resource, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/pay/"), "/")
+	lang := cashier.Language(r.URL.Query().Get("lang"), r.Header.Get("Accept-Language"))
+	o, expired, err := g.cashierOrder(r.Context(), token)
+	if err != nil {
+		if !errors.Is(err, cashier.ErrInvalidToken) && !errors.Is(err, order.ErrNotFound) {
+			g.logger.ErrorContext(r.Context(), "failed to load cashier order", "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		if resource != "" {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+			return
+		}
+		g.renderCashier(w, r, http.StatusNotFound, cashier.Page{Lang: lang, Invalid: true})
+		return
+	}
+
+	// Orders placed before return URLs were validated may hold any URL
+	returnURL := o.ReturnURL
+	if validateHTTPURL(OpCollectOrder, "return_url", returnURL) != nil {
+		returnURL = ""
+	}
+
+	status, final := cashierStatus(o, expired, g.clock.Now())
+	switch resource {
+	case "":
+		if final && returnURL != "" {
+			http.Redirect(w, r, returnURL, http.StatusSeeOther)
+			return
+		}
+		base := "/pay/" + token
+		g.renderCashier(w, r, http.StatusOK, cashier.Page{
+			Lang:        lang,
+			OrderID:     o.ID,
+			Description: o.Description,
+			Amount:      money.Format(o.Amount, o.Currency),
+			Currency:    o.Currency,
+			Status:      status,
+			Final:       final,
+			Action:      o.Action,
+			QRCodeURL:   base + "/qrcode",
+			StatusURL:   base + "/status",
+			ReturnURL:   returnURL,
+		})
+	case "status":
+		if !final {
+			o = g.refreshCollection(r.Context(), o)
+			status, final = cashierStatus(o, expired, g.clock.Now())
+		}
+		view := cashierStatusView{Status: status, Final: final}
+		if final {
+			view.RedirectURL = returnURL
+		}
+		writeJSON(w, http.StatusOK, view)
+	case "qrcode":
+		if o.Action == nil || o.Action.Type != interfaces.ActionQRCode || o.Action.QRContent == "" {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "order has no QR code"})
+			return
+		}
+		code, err := qrcode.Encode(o.Action.QRContent, g.qr.level)
+		if err != nil {
+			g.logger.ErrorContext(r.Context(), "failed to encode cashier QR code", "order_id", o.ID, "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			return
+		}
+		opts := qrcode.Options{Size: cashierQRSize, Logo: g.qr.logo}
+		if g.qr.level < qrcode.LevelQ {
+			opts.Logo = nil
+		}
+		w.Header().Set("Content-Type", "image/png")
+		if err := qrcode.PNG(w, code, opts); err != nil {
+			g.logger.ErrorContext(r.Context(), "failed to render QR code", "error", err)
+		}
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+}
+
+// cashierOrder loads the collection token grants access to, and whether
+// the token has expired
+func (g *Gateway) cashierOrder(ctx context.Context, token string) (order.Order, bool, error) {
+	claims, err := g.cashier.signer.Verify(token)
+	expired := errors.Is(err, cashier.ErrTokenExpired)
+	if err != nil && !expired {
+		return order.Order{}, false, err
+	}
+	o, err := g.orders.Get(ctx, order.KindCollect, claims.MerchantID, claims.OrderID)
+	return o, expired, err
+}
+
+// cashierStatus is what the cashier shows for o, and whether the payer is
+// done with the page: the order is paid or failed, or can no longer be paid
+// because it, its payment action or the link expired
+func cashierStatus(o order.Order, expired bool, now time.Time) (string, bool) {
+	switch o.Status {
+	case order.StatusSucceeded, order.StatusRefunded:
+		return string(order.StatusSucceeded), true
+	case order.StatusFailed, order.StatusClosed:
+		return string(o.Status), true
+	}
+	if expired || (o.Action != nil && o.Action.ExpiresAt != nil && !now.Before(*o.Action.ExpiresAt)) {
+		return string(order.StatusClosed), true
+	}
+	return string(order.StatusPending), false
+}
+
+// refreshCollection queries the channel for an order the payer is waiting
+// on. Bookkeeping records any new status, so the order is reloaded after;
+// on failure the order is returned as it was.
+func (g *Gateway) refreshCollection(ctx context.Context, o order.Order) order.Order {
+	if err := g.queryOrder(ctx, o, "cashier-"); err != nil {
+		g.logger.WarnContext(ctx, "cashier status query failed", "order_id", o.ID, "error", err)
+		return o
+	}
+	fresh, err := g.orders.Get(ctx, order.KindCollect, o.MerchantID, o.ID)
+	if err != nil {
+		return o
+	}
+	return fresh
+}
+
+// renderCashier writes the cashier page with status
+func (g *Gateway) renderCashier(w http.ResponseWriter, r *http.Request, status int, page cashier.Page) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Language", page.Lang.String())
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(status)
+	if err := cashier.Render(w, page); err != nil {
+		g.logger.ErrorContext(r.Context(), "failed to render cashier page", "error", err)
+	}
+}
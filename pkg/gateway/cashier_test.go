@@ -0,0 +1,154 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"payment_go/pkg/cashier"
+	"payment_go/pkg/interfaces"
+)
+
+func newTestCashier(t *testing.T, ttl time.Duration) Option {
+	t.Helper()
+	signer, err := cashier.NewSigner([]byte("0123456789abcdef0123456789abcdef"), ttl)
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+	return WithCashier(signer, "https://pay.example.com/")
+}
+
+func TestCashier(t *testing.T) {
+	stub := newStubPlugin()
+	stub.collect = func(ctx context.Context, req *interfaces.CollectOrderRequest) (*interfaces.CollectOrderResponse, error) {
+		return &interfaces.CollectOrderResponse{
+			BaseResponse: interfaces.BaseResponse{Success: true, Code: "SUCCESS"},
+			OrderID:      req.OrderID,
+			Amount:       req.Amount,
+			Currency:     req.Currency,
+			QRCode:       "https://qr.example.com/" + req.OrderID,
+			Status:       "pending",
+		}, nil
+	}
+	paid := false
+	stub.collectQuery = func(ctx context.Context, req *interfaces.CollectQueryRequest) (*interfaces.CollectQueryResponse, error) {
+		status := "pending"
+		if paid {
+			status = "paid"
+		}
+		return &interfaces.CollectQueryResponse{BaseResponse: interfaces.BaseResponse{Success: true}, OrderID: req.OrderID, Status: status}, nil
+	}
+	gw := newTestGateway(t, stub, newTestCashier(t, time.Minute))
+	handler := gw.Handler()
+
+	req := collectRequest("ORDER_001")
+	req.Description = "Coffee"
+	req.ReturnURL = "https://shop.example.com/done"
+	resp, err := gw.CollectOrder(context.Background(), req)
+	if err != nil {
+		t.Fatalf("CollectOrder failed: %v", err)
+	}
+	if !strings.HasPrefix(resp.CashierURL, "https://pay.example.com/pay/") || strings.Contains(resp.CashierURL, "ORDER_001") {
+		t.Fatalf("Expected an opaque cashier URL, got %q", resp.CashierURL)
+	}
+	path := strings.TrimPrefix(resp.CashierURL, "https://pay.example.com")
+
+	get := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder
+	}
+	status := func() cashierStatusView {
+		recorder := get(path + "/status")
+		var view cashierStatusView
+		if err := json.NewDecoder(recorder.Body).Decode(&view); err != nil {
+			t.Fatalf("Expected a status, got %d: %v", recorder.Code, err)
+		}
+		return view
+	}
+
+	recorder := get(path)
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("Expected an uncached page, got %d %v", recorder.Code, recorder.Header())
+	}
+	if body := recorder.Body.String(); !strings.Contains(body, "100.50 CNY") || !strings.Contains(body, "Coffee") || !strings.Contains(body, path+"/qrcode") {
+		t.Errorf("Expected the order and its QR code on the page, got %s", body)
+	}
+
+	recorder = get(path + "/qrcode")
+	if _, err := png.Decode(recorder.Body); recorder.Code != http.StatusOK || err != nil {
+		t.Errorf("Expected a PNG QR code, got %d: %v", recorder.Code, err)
+	}
+
+	if view := status(); view.Final || view.Status != "pending" || view.RedirectURL != "" {
+		t.Errorf("Expected the order to be pending, got %+v", view)
+	}
+	paid = true
+	if view := status(); !view.Final || view.Status != "succeeded" || view.RedirectURL != req.ReturnURL {
+		t.Errorf("Expected the query to find the order paid, got %+v", view)
+	}
+
+	recorder = get(path)
+	if recorder.Code != http.StatusSeeOther || recorder.Header().Get("Location") != req.ReturnURL {
+		t.Errorf("Expected a paid order to return to the merchant, got %d %v", recorder.Code, recorder.Header())
+	}
+}
+
+func TestCashierExpired(t *testing.T) {
+	gw := newTestGateway(t, newStubPlugin(), newTestCashier(t, time.Millisecond))
+	req := collectRequest("ORDER_001")
+	req.ReturnURL = "https://shop.example.com/done"
+	resp, err := gw.CollectOrder(context.Background(), req)
+	if err != nil {
+		t.Fatalf("CollectOrder failed: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	recorder := httptest.NewRecorder()
+	gw.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, strings.TrimPrefix(resp.CashierURL, "https://pay.example.com"), nil))
+	if recorder.Code != http.StatusSeeOther || recorder.Header().Get("Location") != req.ReturnURL {
+		t.Errorf("Expected an expired link to return to the merchant, got %d %v", recorder.Code, recorder.Header())
+	}
+}
+
+func TestCashierInvalidLinks(t *testing.T) {
+	gw := newTestGateway(t, newStubPlugin(), newTestCashier(t, time.Minute))
+	resp, err := gw.CollectOrder(context.Background(), collectRequest("ORDER_001"))
+	if err != nil {
+		t.Fatalf("CollectOrder failed: %v", err)
+	}
+	path := strings.TrimPrefix(resp.CashierURL, "https://pay.example.com")
+	tampered := path[:len(path)-4] + "AAAA"
+	unknown := "/pay/" + strings.TrimPrefix(gw.CashierURL("MERCHANT_001", "ORDER_404"), "https://pay.example.com/pay/")
+
+	handler := gw.Handler()
+	for _, path := range []string{"/pay/", "/pay/garbage", tampered, unknown, tampered + "/status", path + "/qrcode", path + "/other"} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Code != http.StatusNotFound {
+			t.Errorf("%s: expected %d, got %d", path, http.StatusNotFound, recorder.Code)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	newTestGateway(t, newStubPlugin()).Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected no cashier unless enabled, got %d", recorder.Code)
+	}
+}
+
+func TestCashierReturnURLValidation(t *testing.T) {
+	gw := newTestGateway(t, newStubPlugin(), newTestCashier(t, time.Minute))
+	for _, returnURL := range []string{"javascript:alert(document.cookie)", "//evil.example.com", "/done", "data:text/html,hi"} {
+		req := collectRequest("ORDER_001")
+		req.ReturnURL = returnURL
+		if _, err := gw.CollectOrder(context.Background(), req); ErrorCode(err) != CodeInvalidRequest {
+			t.Errorf("%q: expected %s, got %v", returnURL, CodeInvalidRequest, err)
+		}
+	}
+}
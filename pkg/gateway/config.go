@@ -0,0 +1,281 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"payment_go/pkg/audit"
+	"payment_go/pkg/config"
+	"payment_go/pkg/fees"
+	"payment_go/pkg/host"
+	"payment_go/pkg/ledger"
+	"payment_go/pkg/logging"
+	"payment_go/pkg/plugin"
+	"payment_go/pkg/routing"
+	"payment_go/pkg/secrets"
+)
+
+// Build creates a gateway whose plugin loader state comes entirely from cfg:
+// every channel's plugin is loaded from its source and initialized with its
+// config, the channel policies are installed as middleware, and the fee
+// rules, routes, QR code settings, cashier, notifications, status polling,
+// callback policies and ledger are set up.
+func Build(cfg *config.Gateway, opts ...Option) (*Gateway, error) {
+	loader, err := loadChannels(cfg)
+	if err != nil {
+		return nil, err
+	}
+	// closers are the files opened so far, closed again if Build fails
+	var closers []io.Closer
+	fail := func(err error) (*Gateway, error) {
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i].Close()
+		}
+		loader.Close()
+		return nil, err
+	}
+
+	for _, ch := range cfg.Channels {
+		if err := loader.InitializePlugin(ch.ID, channelConfig(loader, ch)); err != nil {
+			return fail(err)
+		}
+	}
+
+	loader.SetHealthOptions(plugin.HealthOptions{
+		Timeout:         time.Duration(cfg.Health.Timeout),
+		UnhealthyAfter:  cfg.Health.UnhealthyAfter,
+		DegradedLatency: time.Duration(cfg.Health.DegradedLatency),
+	})
+
+	engine, err := fees.New(cfg.Fees)
+	if err != nil {
+		return fail(err)
+	}
+	opts = append([]Option{WithFees(engine)}, opts...)
+	if len(cfg.Routes) > 0 {
+		router, err := routing.New(cfg.Routes)
+		if err != nil {
+			return fail(err)
+		}
+		opts = append([]Option{WithRouter(router)}, opts...)
+	}
+
+	if cfg.QRCode != (config.QRCode{}) {
+		qr, err := qrCodes(cfg.QRCode)
+		if err != nil {
+			return fail(err)
+		}
+		opts = append([]Option{qr}, opts...)
+	}
+
+	if cfg.Cashier != (config.Cashier{}) {
+		hosted, err := cashierOption(cfg.Cashier)
+		if err != nil {
+			return fail(err)
+		}
+		opts = append([]Option{hosted}, opts...)
+	}
+
+	if cfg.Notifications.Enabled() {
+		dispatcher, store, err := notifications(cfg.Notifications)
+		if err != nil {
+			return fail(err)
+		}
+		if closer, ok := store.(io.Closer); ok {
+			closers = append(closers, closer)
+		}
+		opts = append([]Option{WithNotifier(dispatcher), WithNotificationsToken(cfg.Notifications.AdminToken)}, opts...)
+	}
+
+	if cfg.Callbacks.AuditPath != "" {
+		sink, err := audit.OpenFileSink(cfg.Callbacks.AuditPath)
+		if err != nil {
+			return fail(err)
+		}
+		closers = append(closers, sink)
+		opts = append([]Option{WithAuditSink(sink)}, opts...)
+	}
+	if cfg.Callbacks.Path != "" {
+		store, err := host.OpenFileKV(cfg.Callbacks.Path, nil)
+		if err != nil {
+			return fail(err)
+		}
+		closers = append(closers, store)
+		opts = append([]Option{WithCallbackStore(store, time.Duration(cfg.Callbacks.TTL))}, opts...)
+	}
+	callbacks, err := callbackPolicies(cfg.Channels)
+	if err != nil {
+		return fail(err)
+	}
+
+	if cfg.Ledger.Path != "" {
+		store, err := ledger.OpenFileStore(cfg.Ledger.Path)
+		if err != nil {
+			return fail(err)
+		}
+		closers = append(closers, store)
+		opts = append([]Option{WithLedger(ledger.New(store, nil))}, opts...)
+	}
+
+	policies := make(map[string]config.Policies, len(cfg.Channels))
+	for _, ch := range cfg.Channels {
+		policies[ch.ID] = ch.Policies
+	}
+	opts = append([]Option{
+		WithLogger(logging.New(os.Stderr, slog.LevelInfo, cfg.Logging)),
+		WithMiddleware(ChannelPolicies(policies)),
+		WithPolling(pollPolicies(cfg.Channels)),
+		WithCallbackPolicies(callbacks),
+		WithCallbackStore(nil, time.Duration(cfg.Callbacks.TTL)),
+	}, opts...)
+
+	return New(loader, opts...), nil
+}
+
+// Check loads every plugin in cfg and validates its config without
+// initializing it or starting the gateway, and runs the builders for fee
+// rules, routes, QR codes, the cashier and notifications, so a bad secret,
+// a missing logo or an unwritable queue file is found too. All problems are
+// reported together.
+func Check(cfg *config.Gateway) error {
+	var errs []error
+	loader, err := loadChannels(cfg)
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		defer loader.Close()
+		for _, ch := range cfg.Channels {
+			if _, err := loader.ValidatePluginConfig(ch.ID, channelConfig(loader, ch)); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(append(errs, checkBuilders(cfg)...)...)
+}
+
+// checkBuilders runs the builders Build uses for the parts of cfg other than
+// channels, closing whatever they open
+func checkBuilders(cfg *config.Gateway) []error {
+	var errs []error
+	if _, err := fees.New(cfg.Fees); err != nil {
+		errs = append(errs, err)
+	}
+	if len(cfg.Routes) > 0 {
+		if _, err := routing.New(cfg.Routes); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.QRCode != (config.QRCode{}) {
+		if _, err := qrCodes(cfg.QRCode); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.Cashier != (config.Cashier{}) {
+		if _, err := cashierOption(cfg.Cashier); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.Notifications.Enabled() {
+		_, store, err := notifications(cfg.Notifications)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("notifications: %w", err))
+		} else if closer, ok := store.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+	return errs
+}
+
+// loadChannels creates a loader and loads the plugin for every channel
+func loadChannels(cfg *config.Gateway) (*plugin.PluginLoader, error) {
+	loader := plugin.NewPluginLoader()
+	loader.SetLogger(logging.New(os.Stderr, slog.LevelInfo, cfg.Logging))
+
+	egress := make(map[string]host.EgressPolicy, len(cfg.Channels))
+	for _, ch := range cfg.Channels {
+		egress[ch.ID] = ch.Egress
+	}
+	provider, err := secretsProvider(cfg.Secrets)
+	if err != nil {
+		return nil, err
+	}
+	loader.SetHost(host.New(host.Config{Secrets: provider, ChannelEgress: egress}))
+
+	var errs []error
+	for _, ch := range cfg.Channels {
+		if err := loadChannel(loader, ch); err != nil {
+			errs = append(errs, fmt.Errorf("channel %s: %w", ch.ID, err))
+		}
+	}
+	if len(errs) > 0 {
+		loader.Close()
+		return nil, errors.Join(errs...)
+	}
+	return loader, nil
+}
+
+// secretsProvider chains the secret backends enabled in cfg. It returns nil,
+// leaving the host without secrets, when none is configured.
+func secretsProvider(cfg config.Secrets) (secrets.Provider, error) {
+	var providers []secrets.Provider
+	if cfg.Keystore != "" {
+		key, err := secrets.ParseKey(cfg.KeystoreKey)
+		if err != nil {
+			return nil, fmt.Errorf("secrets: %w", err)
+		}
+		keystore, err := secrets.OpenKeystore(cfg.Keystore, key)
+		if err != nil {
+			return nil, fmt.Errorf("secrets: %w", err)
+		}
+		providers = append(providers, keystore)
+	}
+	if cfg.Dir != "" {
+		providers = append(providers, secrets.NewFileProvider(cfg.Dir))
+	}
+	if cfg.EnvPrefix != "" {
+		providers = append(providers, secrets.NewEnvProvider(cfg.EnvPrefix))
+	}
+	if len(providers) == 0 {
+		return nil, nil
+	}
+	return secrets.Chain(providers...), nil
+}
+
+func loadChannel(loader *plugin.PluginLoader, ch config.Channel) error {
+	switch ch.Plugin.Kind() {
+	case "path":
+		return loader.LoadPlugin(ch.Plugin.Path, ch.ID)
+	case "static":
+		return loader.LoadStaticPlugin(ch.Plugin.Static, ch.ID)
+	case "command":
+		return loader.LoadSubprocessPlugin(ch.Plugin.Command, ch.ID)
+	}
+	return fmt.Errorf("no plugin source configured")
+}
+
+// channelConfig returns the channel's plugin config. Plugins whose schema
+// declares an "environment" field are told which environment they run in
+// unless the config sets it explicitly.
+func channelConfig(loader *plugin.PluginLoader, ch config.Channel) map[string]interface{} {
+	loaded, exists := loader.ListPlugins()[ch.ID]
+	if !exists || loaded.Schema == nil {
+		return ch.Config
+	}
+	if _, declared := loaded.Schema.Properties["environment"]; !declared {
+		return ch.Config
+	}
+	if _, set := ch.Config["environment"]; set {
+		return ch.Config
+	}
+
+	result := make(map[string]interface{}, len(ch.Config)+1)
+	for k, v := range ch.Config {
+		result[k] = v
+	}
+	result["environment"] = ch.Environment
+	return result
+}
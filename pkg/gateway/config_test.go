@@ -0,0 +1,238 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"payment_go/pkg/config"
+	"payment_go/pkg/host"
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/plugin"
+)
+
+var registerConfigPlugins sync.Once
+
+// configuredStub records the config it receives and can block collect orders
+type configuredStub struct {
+	*stubPlugin
+	config  map[string]interface{}
+	release chan struct{}
+}
+
+func (cs *configuredStub) Initialize(config map[string]interface{}) error {
+	cs.config = config
+	return nil
+}
+
+func newConfiguredStub() *configuredStub {
+	cs := &configuredStub{stubPlugin: newStubPlugin(), release: make(chan struct{})}
+	cs.info.ConfigSchema = map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"app_id"},
+		"properties": map[string]interface{}{
+			"app_id":      map[string]interface{}{"type": "string"},
+			"environment": map[string]interface{}{"type": "string"},
+		},
+	}
+	cs.collect = func(ctx context.Context, req *interfaces.CollectOrderRequest) (*interfaces.CollectOrderResponse, error) {
+		select {
+		case <-cs.release:
+			return &interfaces.CollectOrderResponse{OrderID: req.OrderID, Status: "pending"}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return cs
+}
+
+var lastConfiguredStub *configuredStub
+
+func registerTestPlugins() {
+	registerConfigPlugins.Do(func() {
+		plugin.RegisterStatic("configured_stub", func() interfaces.Plugin {
+			lastConfiguredStub = newConfiguredStub()
+			return lastConfiguredStub
+		})
+	})
+}
+
+func TestBuildFromConfig(t *testing.T) {
+	registerTestPlugins()
+
+	cfg, err := config.Parse([]byte(`{
+		"environment": "sandbox",
+		"channels": [{
+			"id": "stub",
+			"plugin": {"static": "configured_stub"},
+			"config": {"app_id": "2021"},
+			"policies": {"timeout": "50ms", "max_concurrent": 1}
+		}]
+	}`), func(string) (string, bool) { return "", false })
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if err := Check(cfg); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if lastConfiguredStub.config != nil {
+		t.Error("Check must not initialize plugins")
+	}
+
+	gw, err := Build(cfg)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	stub := lastConfiguredStub
+	if stub.config["environment"] != "sandbox" {
+		t.Errorf("plugins declaring an environment field should receive it, got %v", stub.config["environment"])
+	}
+
+	// The first call occupies the only slot until it times out
+	firstDone := make(chan error, 1)
+	go func() {
+		_, err := gw.CollectOrder(context.Background(), collectRequest("ORDER_SLOW"))
+		firstDone <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	if _, err := gw.CollectOrder(context.Background(), collectRequest("ORDER_BUSY")); ErrorCode(err) != CodeChannelBusy {
+		t.Errorf("expected %s, got %v", CodeChannelBusy, err)
+	}
+	if err := <-firstDone; ErrorCode(err) != CodeTimeout {
+		t.Errorf("expected %s, got %v", CodeTimeout, err)
+	}
+
+	close(stub.release)
+	if _, err := gw.CollectOrder(context.Background(), collectRequest("ORDER_OK")); err != nil {
+		t.Errorf("CollectOrder failed after slot was released: %v", err)
+	}
+}
+
+func TestCheckReportsAllChannels(t *testing.T) {
+	registerTestPlugins()
+
+	cfg, err := config.Parse([]byte(`{
+		"channels": [
+			{"id": "no_app_id", "plugin": {"static": "configured_stub"}},
+			{"id": "missing", "plugin": {"static": "not_registered"}},
+			{"id": "bad_path", "plugin": {"path": "/nonexistent/plugin.so"}}
+		]
+	}`), func(string) (string, bool) { return "", false })
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	err = Check(cfg)
+	if err == nil {
+		t.Fatal("expected Check to fail")
+	}
+	for _, channel := range []string{"missing", "bad_path"} {
+		if !strings.Contains(err.Error(), "channel "+channel) {
+			t.Errorf("error should mention channel %s: %v", channel, err)
+		}
+	}
+
+	var gwErr *Error
+	if errors.As(err, &gwErr) {
+		t.Error("load failures are not gateway request errors")
+	}
+}
+
+func TestCheckRunsBuilders(t *testing.T) {
+	registerTestPlugins()
+
+	dir := t.TempDir()
+	cfg, err := config.Parse([]byte(`{
+		"channels": [{"id": "stub", "plugin": {"static": "configured_stub"}, "config": {"app_id": "2021"}}],
+		"qr_code": {"logo": "${DIR}/missing.png"},
+		"notifications": {"secret": "0123456789abcdef0123456789abcdef", "path": "${DIR}/missing/queue.jsonl"}
+	}`), func(name string) (string, bool) { return dir, name == "DIR" })
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	err = Check(cfg)
+	if err == nil {
+		t.Fatal("expected Check to fail")
+	}
+	for _, section := range []string{"qr_code", "notifications"} {
+		if !strings.Contains(err.Error(), section) {
+			t.Errorf("error should mention %s: %v", section, err)
+		}
+	}
+}
+
+func TestBuildResolvesSecrets(t *testing.T) {
+	registerTestPlugins()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "stub.app_id"), []byte("2021-from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Parse([]byte(`{
+		"secrets": {"dir": "${SECRETS_DIR}"},
+		"channels": [{"id": "stub", "plugin": {"static": "configured_stub"}, "config": {"app_id": "secret://stub.app_id"}}]
+	}`), func(name string) (string, bool) { return dir, name == "SECRETS_DIR" })
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	gw, err := Build(cfg)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	defer gw.Loader().Close()
+	if lastConfiguredStub.config["app_id"] != "2021-from-file" {
+		t.Errorf("plugin should be initialized with the secret value, got %v", lastConfiguredStub.config["app_id"])
+	}
+
+	recorder := httptest.NewRecorder()
+	gw.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/channels", nil))
+	body := recorder.Body.String()
+	if strings.Contains(body, "2021-from-file") || !strings.Contains(body, "secret://stub.app_id") {
+		t.Errorf("/channels must show the reference, not the secret: %s", body)
+	}
+}
+
+func TestBuildAuditsRejectedCallbacks(t *testing.T) {
+	registerTestPlugins()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.jsonl")
+	cfg, err := config.Parse([]byte(`{
+		"callbacks": {"ttl": "48h", "path": "`+filepath.ToSlash(filepath.Join(dir, "callbacks.jsonl"))+`", "audit_path": "${AUDIT_PATH}"},
+		"channels": [{"id": "stub", "plugin": {"static": "configured_stub"}, "config": {"app_id": "2021"}, "callbacks": {"max_age": "25h", "allowed_ips": ["10.0.0.0/8"]}}]
+	}`), func(name string) (string, bool) { return path, name == "AUDIT_PATH" })
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	gw, err := Build(cfg)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	defer gw.Loader().Close()
+	if gw.callbackTTL != 48*time.Hour || gw.callbackPolicies["stub"].MaxAge != 25*time.Hour {
+		t.Errorf("Expected the configured ttl and max age, got %s and %+v", gw.callbackTTL, gw.callbackPolicies["stub"])
+	}
+	if _, ok := gw.callbacks.(*host.FileKV); !ok {
+		t.Errorf("Expected processed callbacks to be remembered in the configured file, got %T", gw.callbacks)
+	}
+
+	req := &interfaces.CallbackRequest{BaseRequest: interfaces.BaseRequest{ChannelID: "stub", RequestID: "CALLBACK"}, SourceIP: "192.0.2.1"}
+	if _, err := gw.Callback(context.Background(), req); ErrorCode(err) != CodeCallbackRejected {
+		t.Fatalf("Expected %s, got %v", CodeCallbackRejected, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(data), `"reason":"source_not_allowed"`) || !strings.Contains(string(data), `"source_ip":"192.0.2.1"`) {
+		t.Errorf("Expected the rejection in the audit file, got %q, %v", data, err)
+	}
+}
@@ -0,0 +1,47 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error codes returned by the gateway itself, as opposed to codes reported by upstream channels
+const (
+	CodeInvalidRequest = "INVALID_REQUEST"
+	CodeChannelBusy    = "CHANNEL_BUSY"
+	CodeTimeout        = "TIMEOUT"
+	// CodeInsufficientBalance rejects a payout larger than the merchant's available balance
+	CodeInsufficientBalance = "INSUFFICIENT_BALANCE"
+	// CodeNoRoute means no channel of the addressed route can take the order
+	CodeNoRoute = "NO_ROUTE"
+	// CodeOutOfLimits rejects an order outside the channel's declared
+	// currencies, amounts or operating hours
+	CodeOutOfLimits = "OUT_OF_LIMITS"
+	// CodeCallbackRejected refuses a callback that may be a replay, see
+	// CallbackPolicy
+	CodeCallbackRejected = "CALLBACK_REJECTED"
+)
+
+// Error is a gateway-level rejection with a stable code callers can act on
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// newError creates an *Error with a formatted message
+func newError(code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// ErrorCode returns the gateway code carried by err, or "" if there is none
+func ErrorCode(err error) string {
+	var gwErr *Error
+	if errors.As(err, &gwErr) {
+		return gwErr.Code
+	}
+	return ""
+}
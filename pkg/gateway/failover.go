@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+
+	"payment_go/pkg/interfaces"
+)
+
+// attemptSeparator joins an order ID and an attempt number. Merchant order
+// IDs may not contain it, so no attempt's ID is another order's.
+const attemptSeparator = "__"
+
+// attemptOrderID is the upstream order ID of the nth attempt at placing an
+// order. The first attempt keeps the merchant's ID.
+func attemptOrderID(orderID string, n int) string {
+	if n <= 1 {
+		return orderID
+	}
+	return fmt.Sprintf("%s%s%d", orderID, attemptSeparator, n)
+}
+
+// notCreated reports whether the result of placing an order proves the
+// channel did not create it, and why. Only responses the plugin marks
+// NotCreated prove it; errors that may have reached the upstream, timeouts
+// included, and other failed responses are ambiguous and never reported.
+func notCreated(resp interface{}, err error) (string, bool) {
+	if err != nil {
+		code := ErrorCode(err)
+		if code == CodeChannelBusy || code == CodeOutOfLimits || errors.Is(err, interfaces.ErrOrderNotCreated) {
+			return err.Error(), true
+		}
+		return "", false
+	}
+	if base := responseBase(resp); base != nil && !base.Success && responseNotCreated(resp) {
+		return fmt.Sprintf("rejected: %s %s", base.Code, base.Message), true
+	}
+	return "", false
+}
+
+// responseNotCreated reports whether a response to placing an order says
+// the channel certainly did not create it
+func responseNotCreated(resp interface{}) bool {
+	switch r := resp.(type) {
+	case *interfaces.CollectOrderResponse:
+		return r.NotCreated
+	case *interfaces.PayoutOrderResponse:
+		return r.NotCreated
+	}
+	return false
+}
+
+// withOrderID returns a copy of an order request carrying orderID
+func withOrderID(request interface{}, orderID string) interface{} {
+	switch req := request.(type) {
+	case *interfaces.CollectOrderRequest:
+		upstream := *req
+		upstream.OrderID = orderID
+		return &upstream
+	case *interfaces.PayoutOrderRequest:
+		upstream := *req
+		upstream.OrderID = orderID
+		return &upstream
+	case *interfaces.CollectQueryRequest:
+		upstream := *req
+		upstream.OrderID = orderID
+		return &upstream
+	case *interfaces.PayoutQueryRequest:
+		upstream := *req
+		upstream.OrderID = orderID
+		return &upstream
+	}
+	return request
+}
+
+// requestOrderID returns the merchant order ID of an order request
+func requestOrderID(request interface{}) string {
+	switch req := request.(type) {
+	case *interfaces.CollectOrderRequest:
+		return req.OrderID
+	case *interfaces.PayoutOrderRequest:
+		return req.OrderID
+	case *interfaces.CollectQueryRequest:
+		return req.OrderID
+	case *interfaces.PayoutQueryRequest:
+		return req.OrderID
+	}
+	return ""
+}
+
+// setResponseOrderID puts the merchant's order ID back into a response to
+// a request sent with an upstream order ID
+func setResponseOrderID(resp interface{}, orderID string) {
+	switch r := resp.(type) {
+	case *interfaces.CollectOrderResponse:
+		r.OrderID = orderID
+	case *interfaces.PayoutOrderResponse:
+		r.OrderID = orderID
+	case *interfaces.CollectQueryResponse:
+		r.OrderID = orderID
+	case *interfaces.PayoutQueryResponse:
+		r.OrderID = orderID
+	}
+}
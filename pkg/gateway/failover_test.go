@@ -0,0 +1,248 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/order"
+	"payment_go/pkg/routing"
+)
+
+// failingStub answers CollectOrder with result and records the order IDs it saw
+func failingStub(result func(req *interfaces.CollectOrderRequest) (*interfaces.CollectOrderResponse, error), seen *[]string) *stubPlugin {
+	stub := newStubPlugin()
+	stub.collect = func(ctx context.Context, req *interfaces.CollectOrderRequest) (*interfaces.CollectOrderResponse, error) {
+		*seen = append(*seen, req.OrderID)
+		return result(req)
+	}
+	return stub
+}
+
+func rejected(req *interfaces.CollectOrderRequest) (*interfaces.CollectOrderResponse, error) {
+	return &interfaces.CollectOrderResponse{
+		BaseResponse: interfaces.BaseResponse{Success: false, Code: "CHANNEL_DISABLED", Message: "merchant not enabled"},
+		OrderID:      req.OrderID,
+		NotCreated:   true,
+	}, nil
+}
+
+func created(req *interfaces.CollectOrderRequest) (*interfaces.CollectOrderResponse, error) {
+	return &interfaces.CollectOrderResponse{
+		BaseResponse:   interfaces.BaseResponse{Success: true},
+		OrderID:        req.OrderID,
+		ChannelOrderID: "UP_" + req.OrderID,
+		Status:         "pending",
+	}, nil
+}
+
+func failoverRoute() routing.Route {
+	return routing.Route{
+		ID: "cny", Strategy: routing.StrategyCost,
+		Channels:         []routing.Target{{ChannelID: "cheap"}, {ChannelID: "dear"}},
+		Failover:         routing.Failover{Enabled: true},
+		MerchantFailover: map[string]routing.Failover{"MERCHANT_002": {Enabled: false}},
+	}
+}
+
+func TestFailoverOnDefinitiveFailure(t *testing.T) {
+	ctx := context.Background()
+	for name, primary := range map[string]func(*interfaces.CollectOrderRequest) (*interfaces.CollectOrderResponse, error){
+		"rejected": rejected,
+		"not created error": func(req *interfaces.CollectOrderRequest) (*interfaces.CollectOrderResponse, error) {
+			return nil, fmt.Errorf("connect: connection refused: %w", interfaces.ErrOrderNotCreated)
+		},
+	} {
+		var cheapSeen, dearSeen []string
+		g := newRoutedGateway(t, map[string]*stubPlugin{
+			"cheap": failingStub(primary, &cheapSeen),
+			"dear":  failingStub(created, &dearSeen),
+		}, failoverRoute())
+
+		req := collectRequest("ORDER_1")
+		req.ChannelID = "cny"
+		resp, err := g.CollectOrder(ctx, req)
+		if err != nil {
+			t.Fatalf("%s: CollectOrder failed: %v", name, err)
+		}
+		if resp.OrderID != "ORDER_1" || resp.ChannelOrderID != "UP_ORDER_1__2" {
+			t.Errorf("%s: Expected the merchant's order ID in the response, got %q and %q", name, resp.OrderID, resp.ChannelOrderID)
+		}
+		if len(cheapSeen) != 1 || cheapSeen[0] != "ORDER_1" || len(dearSeen) != 1 || dearSeen[0] != "ORDER_1__2" {
+			t.Errorf("%s: Expected one attempt per channel with its own ID, got %v and %v", name, cheapSeen, dearSeen)
+		}
+
+		placed, err := g.Orders().Get(ctx, order.KindCollect, "MERCHANT_001", "ORDER_1")
+		if err != nil {
+			t.Fatalf("%s: Expected order to be tracked: %v", name, err)
+		}
+		if placed.ChannelID != "dear" || placed.Status != order.StatusPending || placed.UpstreamOrderID != "ORDER_1__2" {
+			t.Errorf("%s: Expected pending order on dear, got %+v", name, placed)
+		}
+		if len(placed.Attempts) != 2 || placed.Attempts[0].ChannelID != "cheap" || placed.Attempts[0].Error == "" ||
+			placed.Attempts[1].ChannelID != "dear" || placed.Attempts[1].Error != "" {
+			t.Errorf("%s: Expected the attempt chain cheap then dear, got %+v", name, placed.Attempts)
+		}
+
+		query := &interfaces.CollectQueryRequest{
+			BaseRequest: interfaces.BaseRequest{MerchantID: "MERCHANT_001", ChannelID: "cny"},
+			OrderID:     "ORDER_1",
+		}
+		var queried string
+		stub, _ := g.loader.GetPlugin("dear")
+		stub.(*stubPlugin).collectQuery = func(ctx context.Context, req *interfaces.CollectQueryRequest) (*interfaces.CollectQueryResponse, error) {
+			queried = req.OrderID
+			return &interfaces.CollectQueryResponse{BaseResponse: interfaces.BaseResponse{Success: true}, OrderID: req.OrderID}, nil
+		}
+		if resp, err := g.CollectQuery(ctx, query); err != nil || queried != "ORDER_1__2" || resp.OrderID != "ORDER_1" {
+			t.Errorf("%s: Expected the query to use the upstream order ID, got %q and %v", name, queried, err)
+		}
+	}
+}
+
+func TestNoFailoverWhenAmbiguous(t *testing.T) {
+	ctx := context.Background()
+	var cheapSeen, dearSeen []string
+	timeout := func(req *interfaces.CollectOrderRequest) (*interfaces.CollectOrderResponse, error) {
+		return nil, errors.New("read: connection reset by peer")
+	}
+	g := newRoutedGateway(t, map[string]*stubPlugin{
+		"cheap": failingStub(timeout, &cheapSeen),
+		"dear":  failingStub(created, &dearSeen),
+	}, failoverRoute())
+
+	req := collectRequest("ORDER_1")
+	req.ChannelID = "cny"
+	if _, err := g.CollectOrder(ctx, req); err == nil {
+		t.Error("Expected the ambiguous error to be returned")
+	}
+	if len(dearSeen) != 0 {
+		t.Errorf("Expected no failover when the outcome is unknown, got %v", dearSeen)
+	}
+}
+
+func TestNoFailoverOnUnmarkedFailure(t *testing.T) {
+	ctx := context.Background()
+	var cheapSeen, dearSeen []string
+	systemError := func(req *interfaces.CollectOrderRequest) (*interfaces.CollectOrderResponse, error) {
+		return &interfaces.CollectOrderResponse{
+			BaseResponse: interfaces.BaseResponse{Success: false, Code: "SYSTEM_ERROR", Message: "try again later"},
+			OrderID:      req.OrderID,
+			Status:       "failed",
+		}, nil
+	}
+	g := newRoutedGateway(t, map[string]*stubPlugin{
+		"cheap": failingStub(systemError, &cheapSeen),
+		"dear":  failingStub(created, &dearSeen),
+	}, failoverRoute())
+
+	req := collectRequest("ORDER_1")
+	req.ChannelID = "cny"
+	if resp, err := g.CollectOrder(ctx, req); err != nil || resp.Success {
+		t.Fatalf("Expected the failure to be returned, got %+v and %v", resp, err)
+	}
+	if len(dearSeen) != 0 {
+		t.Errorf("Expected no failover on a failure not marked NotCreated, got %v", dearSeen)
+	}
+	// The upstream may have created it, so a query decides
+	if o, _ := g.Orders().Get(ctx, order.KindCollect, "MERCHANT_001", "ORDER_1"); o.Status != order.StatusPending || o.ChannelID != "cheap" {
+		t.Errorf("Expected the order left pending on cheap, got %s on %s", o.Status, o.ChannelID)
+	}
+}
+
+func TestOrderIDsCannotLookLikeAttempts(t *testing.T) {
+	g := newTestGateway(t, newStubPlugin())
+	if _, err := g.CollectOrder(context.Background(), collectRequest("ORDER_1"+attemptSeparator+"2")); ErrorCode(err) != CodeInvalidRequest {
+		t.Errorf("Expected %s for an order ID containing the attempt separator, got %v", CodeInvalidRequest, err)
+	}
+}
+
+func TestFailoverDisabledForMerchant(t *testing.T) {
+	ctx := context.Background()
+	var cheapSeen, dearSeen []string
+	g := newRoutedGateway(t, map[string]*stubPlugin{
+		"cheap": failingStub(rejected, &cheapSeen),
+		"dear":  failingStub(created, &dearSeen),
+	}, failoverRoute())
+
+	req := collectRequest("ORDER_1")
+	req.ChannelID, req.MerchantID = "cny", "MERCHANT_002"
+	resp, err := g.CollectOrder(ctx, req)
+	if err != nil || resp.Success {
+		t.Fatalf("Expected the rejection to be returned, got %+v and %v", resp, err)
+	}
+	if len(dearSeen) != 0 {
+		t.Errorf("Expected no failover for MERCHANT_002, got %v", dearSeen)
+	}
+	failed, _ := g.Orders().Get(ctx, order.KindCollect, "MERCHANT_002", "ORDER_1")
+	if failed.Status != order.StatusFailed || len(failed.Attempts) != 1 || failed.Attempts[0].Error == "" {
+		t.Errorf("Expected a failed order with one attempt, got %+v", failed)
+	}
+}
+
+func TestCallbackForEarlierAttempt(t *testing.T) {
+	ctx := context.Background()
+	var calls atomic.Int32
+	var cheapSeen, dearSeen []string
+	cheap := callbackStub(&calls)
+	cheap.collect = failingStub(rejected, &cheapSeen).collect
+	sink := &recordingSink{}
+	g := newRoutedGateway(t, map[string]*stubPlugin{
+		"cheap": cheap,
+		"dear":  failingStub(created, &dearSeen),
+	}, failoverRoute(), WithAuditSink(sink))
+
+	req := collectRequest("ORDER_1")
+	req.ChannelID = "cny"
+	if _, err := g.CollectOrder(ctx, req); err != nil {
+		t.Fatalf("CollectOrder failed: %v", err)
+	}
+
+	// The channel that refused the order says it was paid after all
+	late := callbackRequest(map[string]interface{}{"notify_id": "N1", "order_id": "ORDER_1", "event": interfaces.EventPaymentSucceeded})
+	late.ChannelID = "cheap"
+	if resp, err := g.Callback(ctx, late); err != nil || !resp.Processed {
+		t.Fatalf("Expected a callback about an earlier attempt to be acknowledged, got %+v, %v", resp, err)
+	}
+	o, _ := g.Orders().Get(ctx, order.KindCollect, "MERCHANT_001", "ORDER_1")
+	if o.Status != order.StatusPending || o.ChannelID != "dear" {
+		t.Errorf("Expected the order left pending on dear, got %s on %s", o.Status, o.ChannelID)
+	}
+	if o.Attempts[0].Event != interfaces.EventPaymentSucceeded || o.Attempts[0].EventAt.IsZero() {
+		t.Errorf("Expected the event kept on the first attempt, got %+v", o.Attempts[0])
+	}
+	if len(sink.entries) != 1 || sink.entries[0].Action != ActionEarlierAttempt {
+		t.Errorf("Expected the callback audited for reconciliation, got %+v", sink.entries)
+	}
+}
+
+func TestRetriedOrderStaysOnItsChannel(t *testing.T) {
+	ctx := context.Background()
+	var cheapSeen, dearSeen []string
+	g := newRoutedGateway(t, map[string]*stubPlugin{
+		"cheap": failingStub(rejected, &cheapSeen),
+		"dear":  failingStub(created, &dearSeen),
+	}, failoverRoute())
+
+	for i := 0; i < 2; i++ {
+		req := collectRequest("ORDER_1")
+		req.ChannelID = "cny"
+		if _, err := g.CollectOrder(ctx, req); err != nil {
+			t.Fatalf("CollectOrder failed: %v", err)
+		}
+		if req.ChannelID != "cny" {
+			t.Errorf("Expected the caller's request to keep the route ID, got %q", req.ChannelID)
+		}
+	}
+	// cheap would be ranked first again, but the order is on dear
+	if len(cheapSeen) != 1 || len(dearSeen) != 2 || dearSeen[1] != "ORDER_1__2" {
+		t.Errorf("Expected the retry sent to dear under the same upstream ID, got %v and %v", cheapSeen, dearSeen)
+	}
+	placed, _ := g.Orders().Get(ctx, order.KindCollect, "MERCHANT_001", "ORDER_1")
+	if placed.ChannelID != "dear" || len(placed.Attempts) != 2 {
+		t.Errorf("Expected the order to stay on dear with its two attempts, got %+v", placed)
+	}
+}
@@ -0,0 +1,102 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"payment_go/pkg/fees"
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/ledger"
+	"payment_go/pkg/order"
+)
+
+func testFees(t *testing.T) *fees.Engine {
+	t.Helper()
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	engine, err := fees.New([]fees.Rule{
+		{ID: "collect", Version: 1, Side: fees.SideMerchant, Selector: fees.Selector{Operation: fees.OpCollect},
+			Formula: fees.Formula{Percent: 1}, EffectiveFrom: from},
+		{ID: "payout", Version: 1, Side: fees.SideMerchant, Selector: fees.Selector{Operation: fees.OpPayout},
+			Formula: fees.Formula{Fixed: 200}, EffectiveFrom: from},
+		{ID: "refund", Version: 1, Side: fees.SideMerchant, Selector: fees.Selector{Operation: fees.OpRefund},
+			Formula: fees.Formula{Fixed: 100}, EffectiveFrom: from},
+		{ID: "cost", Version: 1, Side: fees.SideChannel, Selector: fees.Selector{ChannelID: "stub"},
+			Formula: fees.Formula{Percent: 0.6}, EffectiveFrom: from},
+	})
+	if err != nil {
+		t.Fatalf("fees.New failed: %v", err)
+	}
+	return engine
+}
+
+func TestCollectionFees(t *testing.T) {
+	ctx := context.Background()
+	status := "TRADE_SUCCESS"
+	stub := newStubPlugin()
+	stub.collectQuery = func(ctx context.Context, req *interfaces.CollectQueryRequest) (*interfaces.CollectQueryResponse, error) {
+		return &interfaces.CollectQueryResponse{
+			BaseResponse: interfaces.BaseResponse{Success: true},
+			OrderID:      req.OrderID,
+			Amount:       100.50,
+			Currency:     "CNY",
+			Status:       status,
+		}, nil
+	}
+	g := newTestGateway(t, stub, WithFees(testFees(t)))
+
+	if _, err := g.CollectOrder(ctx, collectRequest("ORDER_1")); err != nil {
+		t.Fatalf("CollectOrder failed: %v", err)
+	}
+	placed, _ := g.Orders().Get(ctx, order.KindCollect, "MERCHANT_001", "ORDER_1")
+	if placed.MerchantFee != 101 || placed.ChannelFee != 60 || placed.MerchantFeeRule != "collect@1" || placed.ChannelFeeRule != "cost@1" {
+		t.Errorf("Expected fees priced when the order is placed, got %+v", placed)
+	}
+
+	queryCollect(t, g, "ORDER_1")
+	merchant, _ := g.Ledger().Balance(ctx, ledger.MerchantAccount("MERCHANT_001"), "CNY")
+	revenue, _ := g.Ledger().Balance(ctx, ledger.FeeRevenueAccount(), "CNY")
+	cost, _ := g.Ledger().Balance(ctx, ledger.ChannelFeeAccount("stub"), "CNY")
+	if merchant != 10050-101 || revenue != 101 || cost != 60 {
+		t.Errorf("Expected both fees in the ledger, got merchant %d revenue %d cost %d", merchant, revenue, cost)
+	}
+
+	status = "REFUNDED"
+	queryCollect(t, g, "ORDER_1")
+	refunded, _ := g.Orders().Get(ctx, order.KindCollect, "MERCHANT_001", "ORDER_1")
+	if refunded.RefundMerchantFee != 100 || refunded.RefundChannelFee != 60 {
+		t.Errorf("Expected refund fees on the order, got %d and %d", refunded.RefundMerchantFee, refunded.RefundChannelFee)
+	}
+	merchant, _ = g.Ledger().Balance(ctx, ledger.MerchantAccount("MERCHANT_001"), "CNY")
+	if merchant != -101-100 {
+		t.Errorf("Expected the merchant to bear both fees after the refund, got %d", merchant)
+	}
+}
+
+func TestPayoutHoldsFee(t *testing.T) {
+	ctx := context.Background()
+	stub := newStubPlugin()
+	stub.payout = func(ctx context.Context, req *interfaces.PayoutOrderRequest) (*interfaces.PayoutOrderResponse, error) {
+		return &interfaces.PayoutOrderResponse{
+			BaseResponse: interfaces.BaseResponse{Success: true},
+			OrderID:      req.OrderID,
+			Status:       "completed",
+		}, nil
+	}
+	g := newTestGateway(t, stub, WithFees(testFees(t)))
+	fund(t, g, 3100)
+
+	_, err := g.PayoutOrder(ctx, payoutRequest("P1", 30))
+	if code := ErrorCode(err); code != CodeInsufficientBalance {
+		t.Errorf("Expected %s when the fee does not fit, got %v", CodeInsufficientBalance, err)
+	}
+
+	fund(t, g, 100)
+	if _, err := g.PayoutOrder(ctx, payoutRequest("P1", 30)); err != nil {
+		t.Fatalf("PayoutOrder failed: %v", err)
+	}
+	revenue, _ := g.Ledger().Balance(ctx, ledger.FeeRevenueAccount(), "CNY")
+	if available, held := balances(t, g); available != 0 || held != 0 || revenue != 200 {
+		t.Errorf("Expected amount and fee captured from the hold, got %d available, %d held, %d revenue", available, held, revenue)
+	}
+}
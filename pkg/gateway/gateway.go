@@ -0,0 +1,312 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"payment_go/pkg/audit"
+	"payment_go/pkg/fees"
+	"payment_go/pkg/host"
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/lease"
+	"payment_go/pkg/ledger"
+	"payment_go/pkg/logging"
+	"payment_go/pkg/notify"
+	"payment_go/pkg/order"
+	"payment_go/pkg/plugin"
+	"payment_go/pkg/qrcode"
+	"payment_go/pkg/routing"
+	"payment_go/pkg/tracing"
+)
+
+// Operation identifies a gateway operation. The values match the capability
+// names plugins declare in PluginInfo.Capabilities.
+type Operation string
+
+const (
+	OpCollectOrder   Operation = "collect_order"
+	OpPayoutOrder    Operation = "payout_order"
+	OpCollectQuery   Operation = "collect_query"
+	OpPayoutQuery    Operation = "payout_query"
+	OpBalanceInquiry Operation = "balance_inquiry"
+	OpCallback       Operation = "callback"
+)
+
+// Call describes a single operation as it flows through the middleware chain
+type Call struct {
+	Operation Operation
+	// Request is the typed request, e.g. *interfaces.CollectOrderRequest
+	Request interface{}
+	// Base points at the BaseRequest embedded in Request
+	Base *interfaces.BaseRequest
+	// Route is set when the call addressed a route; Base.ChannelID then
+	// names the channel chosen from it
+	Route *routing.Decision
+	// UpstreamOrderID replaces the request's order ID towards the channel
+	// when set, so each attempt at placing an order has its own upstream ID
+	UpstreamOrderID string
+	// Attempts are the earlier attempts at placing this call's order
+	Attempts []order.Attempt
+	// failover is set when a definitive failure of this attempt will be
+	// retried on another channel
+	failover bool
+	// dispatched is set once the plugin is called, so a failed call may
+	// have reached the upstream
+	dispatched bool
+}
+
+// Handler executes a call and returns the typed response
+type Handler func(ctx context.Context, call *Call) (interface{}, error)
+
+// Middleware wraps a Handler with additional behaviour
+type Middleware func(next Handler) Handler
+
+// Option configures a Gateway
+type Option func(*Gateway)
+
+// WithMiddleware appends middleware to the chain. Middleware runs in the order
+// given, after the built-in request validation and routing and before the
+// plugin is called.
+func WithMiddleware(mw ...Middleware) Option {
+	return func(g *Gateway) {
+		g.middleware = append(g.middleware, mw...)
+	}
+}
+
+// Gateway routes payment operations to the plugin loaded for each channel
+type Gateway struct {
+	loader     *plugin.PluginLoader
+	middleware []Middleware
+	handler    Handler
+	orders     order.Store
+	ledger     *ledger.Ledger
+	fees       *fees.Engine
+	router     *routing.Router
+	qr         qrSettings
+	cashier    *cashierSettings
+	notifier   *notify.Dispatcher
+	// notifyToken lets /notifications requests see every merchant
+	notifyToken string
+	polling     map[string]PollPolicy
+	leases      lease.Store
+	leaseOwner  string
+	// callbacks remembers processed callbacks for callbackTTL
+	callbacks        interfaces.KVStore
+	callbackTTL      time.Duration
+	callbackPolicies map[string]CallbackPolicy
+	audit            audit.Sink
+	clock            interfaces.Clock
+	logger           *slog.Logger
+}
+
+// New creates a gateway that dispatches calls to plugins held by loader
+func New(loader *plugin.PluginLoader, opts ...Option) *Gateway {
+	g := &Gateway{loader: loader, qr: qrSettings{level: qrcode.LevelM}}
+	for _, opt := range opts {
+		opt(g)
+	}
+	if g.clock == nil {
+		g.clock = host.SystemClock{}
+	}
+	if g.orders == nil {
+		g.orders = order.NewMemoryStore()
+	}
+	if g.ledger == nil {
+		g.ledger = ledger.New(ledger.NewMemoryStore(), g.clock)
+	}
+	if g.logger == nil {
+		g.logger = logging.Default()
+	}
+	if g.leases == nil {
+		g.leases, g.leaseOwner = lease.NewMemoryStore(), lease.Owner()
+	}
+	if g.callbacks == nil {
+		g.callbacks = host.NewMemoryKV(g.clock)
+	}
+	if g.callbackTTL <= 0 {
+		g.callbackTTL = DefaultCallbackTTL
+	}
+	if g.audit == nil {
+		g.audit = audit.NewLogSink(g.logger)
+	}
+
+	chain := append([]Middleware{ValidateRequests(), g.route, g.enforceLimits, g.screenSources, g.deduplicate}, g.middleware...)
+	handler := g.bookkeeping(g.checkFreshness(g.dispatch))
+	for i := len(chain) - 1; i >= 0; i-- {
+		handler = chain[i](handler)
+	}
+	g.handler = handler
+
+	return g
+}
+
+// Loader returns the plugin loader backing the gateway
+func (g *Gateway) Loader() *plugin.PluginLoader {
+	return g.loader
+}
+
+// CollectOrder creates a collection order on the request's channel
+func (g *Gateway) CollectOrder(ctx context.Context, req *interfaces.CollectOrderRequest) (*interfaces.CollectOrderResponse, error) {
+	resp, err := g.invoke(ctx, &Call{Operation: OpCollectOrder, Request: req, Base: &req.BaseRequest})
+	if err != nil {
+		return nil, err
+	}
+	collected := resp.(*interfaces.CollectOrderResponse)
+	if collected.Success {
+		collected.CashierURL = g.CashierURL(req.MerchantID, req.OrderID)
+	}
+	return collected, nil
+}
+
+// PayoutOrder creates a payout order on the request's channel
+func (g *Gateway) PayoutOrder(ctx context.Context, req *interfaces.PayoutOrderRequest) (*interfaces.PayoutOrderResponse, error) {
+	resp, err := g.invoke(ctx, &Call{Operation: OpPayoutOrder, Request: req, Base: &req.BaseRequest})
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*interfaces.PayoutOrderResponse), nil
+}
+
+// CollectQuery queries a collection order on the request's channel
+func (g *Gateway) CollectQuery(ctx context.Context, req *interfaces.CollectQueryRequest) (*interfaces.CollectQueryResponse, error) {
+	resp, err := g.invoke(ctx, &Call{Operation: OpCollectQuery, Request: req, Base: &req.BaseRequest})
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*interfaces.CollectQueryResponse), nil
+}
+
+// PayoutQuery queries a payout order on the request's channel
+func (g *Gateway) PayoutQuery(ctx context.Context, req *interfaces.PayoutQueryRequest) (*interfaces.PayoutQueryResponse, error) {
+	resp, err := g.invoke(ctx, &Call{Operation: OpPayoutQuery, Request: req, Base: &req.BaseRequest})
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*interfaces.PayoutQueryResponse), nil
+}
+
+// BalanceInquiry checks the account balance on the request's channel
+func (g *Gateway) BalanceInquiry(ctx context.Context, req *interfaces.BalanceInquiryRequest) (*interfaces.BalanceInquiryResponse, error) {
+	resp, err := g.invoke(ctx, &Call{Operation: OpBalanceInquiry, Request: req, Base: &req.BaseRequest})
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*interfaces.BalanceInquiryResponse), nil
+}
+
+// Callback passes an upstream notification to the request's channel
+func (g *Gateway) Callback(ctx context.Context, req *interfaces.CallbackRequest) (*interfaces.CallbackResponse, error) {
+	resp, err := g.invoke(ctx, &Call{Operation: OpCallback, Request: req, Base: &req.BaseRequest})
+	if err != nil {
+		return nil, err
+	}
+	callback := resp.(*interfaces.CallbackResponse)
+	if callback.Event != nil {
+		if callback.Event.Raw == nil {
+			callback.Event.Raw = req.CallbackData
+		}
+		if !interfaces.KnownCallbackEvent(callback.Event.Type) {
+			g.logger.WarnContext(ctx, "ignored callback event of unknown type",
+				"channel_id", req.ChannelID,
+				"request_id", req.RequestID,
+				"event_type", callback.Event.Type)
+		}
+	}
+	return callback, nil
+}
+
+// invoke runs a call through the middleware chain inside the operation's root span
+func (g *Gateway) invoke(ctx context.Context, call *Call) (interface{}, error) {
+	attrs := append(tracing.RequestAttributes(call.Base), tracing.AttrOperation.String(string(call.Operation)))
+	ctx, span := tracing.StartSpan(ctx, "gateway."+string(call.Operation), attrs...)
+	defer span.End()
+
+	resp, err := g.handler(ctx, call)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+	if base := responseBase(resp); base != nil {
+		span.SetAttributes(tracing.AttrSuccess.Bool(base.Success), tracing.AttrCode.String(base.Code))
+	}
+	return resp, nil
+}
+
+// dispatch is the innermost handler; it calls the plugin for the call's channel
+func (g *Gateway) dispatch(ctx context.Context, call *Call) (interface{}, error) {
+	// The call is tracked so unloading or replacing the plugin waits for it
+	instance, release, err := g.loader.Acquire(call.Base.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	attrs := tracing.RequestAttributes(call.Base)
+	if info := instance.GetInfo(); info != nil {
+		attrs = append(attrs,
+			attribute.String("plugin.name", info.Name),
+			attribute.String("plugin.version", info.Version),
+		)
+	}
+	ctx, span := tracing.StartSpan(ctx, "plugin."+string(call.Operation), attrs...)
+	defer span.End()
+
+	call.dispatched = true
+	if call.UpstreamOrderID == "" {
+		resp, err := callPlugin(ctx, instance, call)
+		tracing.RecordError(span, err)
+		return resp, err
+	}
+	span.SetAttributes(attribute.String("upstream.order_id", call.UpstreamOrderID))
+	upstream := *call
+	upstream.Request = withOrderID(call.Request, call.UpstreamOrderID)
+	resp, err := callPlugin(ctx, instance, &upstream)
+	tracing.RecordError(span, err)
+	if err == nil {
+		setResponseOrderID(resp, requestOrderID(call.Request))
+	}
+	return resp, err
+}
+
+// callPlugin invokes the plugin method matching the call's operation
+func callPlugin(ctx context.Context, instance interfaces.Plugin, call *Call) (interface{}, error) {
+	switch req := call.Request.(type) {
+	case *interfaces.CollectOrderRequest:
+		return instance.CollectOrder(ctx, req)
+	case *interfaces.PayoutOrderRequest:
+		return instance.PayoutOrder(ctx, req)
+	case *interfaces.CollectQueryRequest:
+		return instance.CollectQuery(ctx, req)
+	case *interfaces.PayoutQueryRequest:
+		return instance.PayoutQuery(ctx, req)
+	case *interfaces.BalanceInquiryRequest:
+		return instance.BalanceInquiry(ctx, req)
+	case *interfaces.CallbackRequest:
+		return instance.Callback(ctx, req)
+	default:
+		return nil, fmt.Errorf("unsupported request type %T for operation %s", call.Request, call.Operation)
+	}
+}
+
+// responseBase extracts the BaseResponse embedded in a typed response
+func responseBase(resp interface{}) *interfaces.BaseResponse {
+	switch r := resp.(type) {
+	case *interfaces.CollectOrderResponse:
+		return &r.BaseResponse
+	case *interfaces.PayoutOrderResponse:
+		return &r.BaseResponse
+	case *interfaces.CollectQueryResponse:
+		return &r.BaseResponse
+	case *interfaces.PayoutQueryResponse:
+		return &r.BaseResponse
+	case *interfaces.BalanceInquiryResponse:
+		return &r.BaseResponse
+	case *interfaces.CallbackResponse:
+		return &r.BaseResponse
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/plugin"
+	"payment_go/pkg/tracing"
+)
+
+// stubPlugin implements interfaces.Plugin with overridable operations
+type stubPlugin struct {
+	info         *interfaces.PluginInfo
+	collect      func(ctx context.Context, req *interfaces.CollectOrderRequest) (*interfaces.CollectOrderResponse, error)
+	payout       func(ctx context.Context, req *interfaces.PayoutOrderRequest) (*interfaces.PayoutOrderResponse, error)
+	collectQuery func(ctx context.Context, req *interfaces.CollectQueryRequest) (*interfaces.CollectQueryResponse, error)
+	payoutQuery  func(ctx context.Context, req *interfaces.PayoutQueryRequest) (*interfaces.PayoutQueryResponse, error)
+	callback     func(ctx context.Context, req *interfaces.CallbackRequest) (*interfaces.CallbackResponse, error)
+}
+
+func newStubPlugin() *stubPlugin {
+	return &stubPlugin{
+		info: &interfaces.PluginInfo{
+			Name:         "Stub Channel",
+			Version:      "1.0.0",
+			ChannelType:  "stub",
+			Capabilities: []string{"collect_order", "payout_order", "collect_query", "payout_query", "balance_inquiry", "callback"},
+		},
+	}
+}
+
+func (sp *stubPlugin) GetInfo() *interfaces.PluginInfo                    { return sp.info }
+func (sp *stubPlugin) Initialize(config map[string]interface{}) error     { return nil }
+func (sp *stubPlugin) ValidateConfig(config map[string]interface{}) error { return nil }
+
+func (sp *stubPlugin) CollectOrder(ctx context.Context, req *interfaces.CollectOrderRequest) (*interfaces.CollectOrderResponse, error) {
+	if sp.collect != nil {
+		return sp.collect(ctx, req)
+	}
+	return &interfaces.CollectOrderResponse{
+		BaseResponse: interfaces.BaseResponse{Success: true, Code: "SUCCESS", RequestID: req.RequestID, Timestamp: time.Now()},
+		OrderID:      req.OrderID,
+		Amount:       req.Amount,
+		Currency:     req.Currency,
+		Status:       "pending",
+	}, nil
+}
+
+func (sp *stubPlugin) PayoutOrder(ctx context.Context, req *interfaces.PayoutOrderRequest) (*interfaces.PayoutOrderResponse, error) {
+	if sp.payout != nil {
+		return sp.payout(ctx, req)
+	}
+	return &interfaces.PayoutOrderResponse{OrderID: req.OrderID, Status: "processing"}, nil
+}
+
+func (sp *stubPlugin) CollectQuery(ctx context.Context, req *interfaces.CollectQueryRequest) (*interfaces.CollectQueryResponse, error) {
+	if sp.collectQuery != nil {
+		return sp.collectQuery(ctx, req)
+	}
+	return &interfaces.CollectQueryResponse{OrderID: req.OrderID, Status: "pending"}, nil
+}
+
+func (sp *stubPlugin) PayoutQuery(ctx context.Context, req *interfaces.PayoutQueryRequest) (*interfaces.PayoutQueryResponse, error) {
+	if sp.payoutQuery != nil {
+		return sp.payoutQuery(ctx, req)
+	}
+	return &interfaces.PayoutQueryResponse{OrderID: req.OrderID, Status: "processing"}, nil
+}
+
+func (sp *stubPlugin) BalanceInquiry(ctx context.Context, req *interfaces.BalanceInquiryRequest) (*interfaces.BalanceInquiryResponse, error) {
+	return &interfaces.BalanceInquiryResponse{Balance: 100, Currency: "CNY"}, nil
+}
+
+func (sp *stubPlugin) Callback(ctx context.Context, req *interfaces.CallbackRequest) (*interfaces.CallbackResponse, error) {
+	if sp.callback != nil {
+		return sp.callback(ctx, req)
+	}
+	return &interfaces.CallbackResponse{Processed: true}, nil
+}
+
+func newTestGateway(t *testing.T, instance interfaces.Plugin, opts ...Option) *Gateway {
+	t.Helper()
+	loader := plugin.NewPluginLoader()
+	if err := loader.RegisterPlugin("stub", instance); err != nil {
+		t.Fatalf("RegisterPlugin failed: %v", err)
+	}
+	return New(loader, opts...)
+}
+
+func collectRequest(orderID string) *interfaces.CollectOrderRequest {
+	return &interfaces.CollectOrderRequest{
+		BaseRequest: interfaces.BaseRequest{
+			MerchantID: "MERCHANT_001",
+			ChannelID:  "stub",
+			RequestID:  "REQ_" + orderID,
+			Timestamp:  time.Now(),
+		},
+		OrderID:  orderID,
+		Amount:   100.50,
+		Currency: "CNY",
+	}
+}
+
+func setupTracing(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	tracing.SetupPropagation()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		_ = tp.Shutdown(context.Background())
+	})
+	return exporter
+}
+
+func findSpan(spans tracetest.SpanStubs, name string) *tracetest.SpanStub {
+	for i := range spans {
+		if spans[i].Name == name {
+			return &spans[i]
+		}
+	}
+	return nil
+}
+
+func hasAttribute(span *tracetest.SpanStub, kv attribute.KeyValue) bool {
+	for _, attr := range span.Attributes {
+		if attr == kv {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCollectOrderTracing(t *testing.T) {
+	exporter := setupTracing(t)
+
+	var upstreamTraceParent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamTraceParent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	stub := newStubPlugin()
+	client := tracing.WrapClient(upstream.Client())
+	stub.collect = func(ctx context.Context, req *interfaces.CollectOrderRequest) (*interfaces.CollectOrderResponse, error) {
+		ctx, span := tracing.StartSpan(ctx, "stub.sign")
+		span.End()
+
+		httpReq, _ := http.NewRequestWithContext(ctx, http.MethodPost, upstream.URL+"/gateway.do", nil)
+		resp, err := client.Do(httpReq)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		return &interfaces.CollectOrderResponse{
+			BaseResponse: interfaces.BaseResponse{Success: true, Code: "SUCCESS"},
+			OrderID:      req.OrderID,
+			Status:       "pending",
+		}, nil
+	}
+
+	gw := newTestGateway(t, stub)
+	if _, err := gw.CollectOrder(context.Background(), collectRequest("ORDER_001")); err != nil {
+		t.Fatalf("CollectOrder failed: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	root := findSpan(spans, "gateway.collect_order")
+	if root == nil {
+		t.Fatalf("gateway.collect_order span not recorded, got %d spans", len(spans))
+	}
+	for _, kv := range []attribute.KeyValue{
+		tracing.AttrRequestID.String("REQ_ORDER_001"),
+		tracing.AttrMerchantID.String("MERCHANT_001"),
+		tracing.AttrChannelID.String("stub"),
+		tracing.AttrSuccess.Bool(true),
+	} {
+		if !hasAttribute(root, kv) {
+			t.Errorf("root span missing attribute %s=%s", kv.Key, kv.Value.Emit())
+		}
+	}
+
+	traceID := root.SpanContext.TraceID()
+	for _, name := range []string{"gateway.validate", "plugin.collect_order", "stub.sign", "HTTP POST"} {
+		span := findSpan(spans, name)
+		if span == nil {
+			t.Errorf("span %s not recorded", name)
+			continue
+		}
+		if span.SpanContext.TraceID() != traceID {
+			t.Errorf("span %s is not part of the operation trace", name)
+		}
+	}
+
+	pluginSpan := findSpan(spans, "plugin.collect_order")
+	if sign := findSpan(spans, "stub.sign"); sign != nil && pluginSpan != nil && sign.Parent.SpanID() != pluginSpan.SpanContext.SpanID() {
+		t.Error("plugin span should be the parent of spans created inside the plugin")
+	}
+
+	if upstreamTraceParent == "" {
+		t.Error("traceparent header was not propagated to the upstream request")
+	}
+}
+
+func TestValidationErrorIsTraced(t *testing.T) {
+	exporter := setupTracing(t)
+	gw := newTestGateway(t, newStubPlugin())
+
+	req := collectRequest("ORDER_002")
+	req.Amount = 0
+	if _, err := gw.CollectOrder(context.Background(), req); err == nil {
+		t.Fatal("expected validation error for zero amount")
+	}
+
+	spans := exporter.GetSpans()
+	if findSpan(spans, "plugin.collect_order") != nil {
+		t.Error("plugin should not be called when validation fails")
+	}
+	validate := findSpan(spans, "gateway.validate")
+	if validate == nil || len(validate.Events) == 0 {
+		t.Error("validation span should record the error")
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	var order []string
+	record := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, call *Call) (interface{}, error) {
+				order = append(order, name)
+				return next(ctx, call)
+			}
+		}
+	}
+
+	gw := newTestGateway(t, newStubPlugin(), WithMiddleware(record("first"), record("second")))
+	if _, err := gw.CollectOrder(context.Background(), collectRequest("ORDER_003")); err != nil {
+		t.Fatalf("CollectOrder failed: %v", err)
+	}
+	if len(order) != 2 || order[0] != "first" || order[1] != "second" {
+		t.Errorf("unexpected middleware order: %v", order)
+	}
+}
+
+func TestUnknownChannel(t *testing.T) {
+	gw := newTestGateway(t, newStubPlugin())
+	req := collectRequest("ORDER_004")
+	req.ChannelID = "missing"
+	if _, err := gw.CollectOrder(context.Background(), req); err == nil {
+		t.Error("expected error for unknown channel")
+	}
+}
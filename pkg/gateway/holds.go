@@ -0,0 +1,116 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+
+	"payment_go/pkg/fees"
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/ledger"
+	"payment_go/pkg/money"
+	"payment_go/pkg/order"
+)
+
+// holdEntryID is the ledger entry reserving funds for a payout
+func holdEntryID(merchantID, orderID string) string {
+	return order.Key(order.KindPayout, merchantID, orderID) + ":held"
+}
+
+// hold moves a payout's amount and fee from the merchant's available balance to
+// their held balance, rejecting the payout with CodeInsufficientBalance when
+// the available balance does not cover it. The ledger checks and posts
+// atomically, so concurrent payouts cannot overdraw the merchant.
+//
+// The hold is captured when the payout succeeds and released when it fails,
+// is closed or is returned before it was seen to succeed. A payout whose
+// call errored is recorded as erroredPayout describes: failed, releasing
+// the hold, or pending and held until polling settles it. Resubmitting an open order reuses the existing hold;
+// resubmitting a settled one is refused, since its hold is gone.
+func (g *Gateway) hold(ctx context.Context, req *interfaces.PayoutOrderRequest) error {
+	amount, err := money.ToMinor(req.Amount, req.Currency)
+	if err != nil {
+		return newError(CodeInvalidRequest, "%s: %v", OpPayoutOrder, err)
+	}
+	id := holdEntryID(req.MerchantID, req.OrderID)
+	if _, found, err := g.ledger.Get(ctx, id); err != nil || found {
+		if err != nil {
+			return err
+		}
+		return g.reuseHold(ctx, req)
+	}
+
+	now := g.clock.Now()
+	quote := g.fees.Quote(fees.Query{
+		ChannelID:  req.ChannelID,
+		MerchantID: req.MerchantID,
+		Operation:  fees.OpPayout,
+		Currency:   req.Currency,
+		Amount:     amount,
+		At:         now,
+	})
+	total := amount + quote.MerchantFee
+
+	entry := ledger.Entry{
+		ID:          id,
+		Time:        now,
+		Description: "payout held",
+		Reference:   order.Key(order.KindPayout, req.MerchantID, req.OrderID),
+		Postings:    ledger.HoldPostings(req.MerchantID, req.Currency, total),
+	}
+	err = g.ledger.PostCovered(ctx, entry, ledger.MerchantAccount(req.MerchantID))
+	if errors.Is(err, ledger.ErrEntryConflict) {
+		// A concurrent submission of the same order held it first
+		return g.reuseHold(ctx, req)
+	}
+	if errors.Is(err, ledger.ErrInsufficientFunds) {
+		return newError(CodeInsufficientBalance, "payout %s of %s %s with fee %s exceeds the available balance of merchant %s",
+			req.OrderID, money.Format(amount, req.Currency), req.Currency, money.Format(quote.MerchantFee, req.Currency), req.MerchantID)
+	}
+	return err
+}
+
+// erroredPayout stands in for the response to a payout whose call errored.
+// The payout was not created when the call never reached the plugin, e.g.
+// its channel is not loaded, or the channel says so; any other error leaves
+// its outcome unknown.
+func erroredPayout(call *Call, err error) *interfaces.PayoutOrderResponse {
+	req := call.Request.(*interfaces.PayoutOrderRequest)
+	return &interfaces.PayoutOrderResponse{
+		BaseResponse: interfaces.BaseResponse{Code: ErrorCode(err), Message: err.Error(), RequestID: req.RequestID},
+		OrderID:      req.OrderID,
+		Amount:       req.Amount,
+		Currency:     req.Currency,
+		NotCreated:   !call.dispatched || errors.Is(err, interfaces.ErrOrderNotCreated),
+	}
+}
+
+// reuseHold accepts a resubmitted payout whose hold is already posted,
+// unless the payout has settled and the hold with it
+func (g *Gateway) reuseHold(ctx context.Context, req *interfaces.PayoutOrderRequest) error {
+	o, err := g.orders.Get(ctx, order.KindPayout, req.MerchantID, req.OrderID)
+	if errors.Is(err, order.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !o.Status.Open() {
+		return newError(CodeInvalidRequest, "%s: payout %s is already %s", OpPayoutOrder, req.OrderID, o.Status)
+	}
+	return nil
+}
+
+// heldAmount returns the amount held for a payout, or zero if it was not held
+func (g *Gateway) heldAmount(ctx context.Context, o *order.Order) (int64, error) {
+	entry, found, err := g.ledger.Get(ctx, holdEntryID(o.MerchantID, o.ID))
+	if err != nil || !found {
+		return 0, err
+	}
+	held := ledger.HeldAccount(o.MerchantID)
+	for _, p := range entry.Postings {
+		if p.Account == held {
+			return -p.Amount, nil
+		}
+	}
+	return 0, nil
+}
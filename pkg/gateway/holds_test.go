@@ -0,0 +1,225 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/ledger"
+	"payment_go/pkg/order"
+)
+
+func payoutRequest(orderID string, amount float64) *interfaces.PayoutOrderRequest {
+	return &interfaces.PayoutOrderRequest{
+		BaseRequest:   interfaces.BaseRequest{MerchantID: "MERCHANT_001", ChannelID: "stub", RequestID: "REQ_" + orderID},
+		OrderID:       orderID,
+		Amount:        amount,
+		Currency:      "CNY",
+		RecipientInfo: &interfaces.RecipientInfo{},
+	}
+}
+
+// fund credits the test merchant's available balance as if collected
+func fund(t *testing.T, g *Gateway, amount int64) {
+	t.Helper()
+	err := g.Ledger().Post(context.Background(), ledger.Entry{
+		ID:       fmt.Sprintf("fund:%d", amount),
+		Time:     time.Now(),
+		Postings: ledger.CollectionPostings("MERCHANT_001", "stub", "CNY", amount),
+	})
+	if err != nil {
+		t.Fatalf("Post failed: %v", err)
+	}
+}
+
+func balances(t *testing.T, g *Gateway) (available, held int64) {
+	t.Helper()
+	ctx := context.Background()
+	available, _ = g.Ledger().Balance(ctx, ledger.MerchantAccount("MERCHANT_001"), "CNY")
+	held, _ = g.Ledger().Balance(ctx, ledger.HeldAccount("MERCHANT_001"), "CNY")
+	return available, held
+}
+
+func TestPayoutHolds(t *testing.T) {
+	ctx := context.Background()
+	statuses := map[string]string{}
+	var mutex sync.Mutex
+
+	stub := newStubPlugin()
+	stub.payout = func(ctx context.Context, req *interfaces.PayoutOrderRequest) (*interfaces.PayoutOrderResponse, error) {
+		return &interfaces.PayoutOrderResponse{
+			BaseResponse: interfaces.BaseResponse{Success: true},
+			OrderID:      req.OrderID,
+			Status:       "processing",
+		}, nil
+	}
+	stub.payoutQuery = func(ctx context.Context, req *interfaces.PayoutQueryRequest) (*interfaces.PayoutQueryResponse, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return &interfaces.PayoutQueryResponse{
+			BaseResponse: interfaces.BaseResponse{Success: true},
+			OrderID:      req.OrderID,
+			Amount:       30,
+			Currency:     "CNY",
+			Status:       statuses[req.OrderID],
+		}, nil
+	}
+	g := newTestGateway(t, stub)
+	fund(t, g, 5000)
+
+	query := func(orderID, status string) {
+		mutex.Lock()
+		statuses[orderID] = status
+		mutex.Unlock()
+		req := &interfaces.PayoutQueryRequest{
+			BaseRequest: interfaces.BaseRequest{MerchantID: "MERCHANT_001", ChannelID: "stub"},
+			OrderID:     orderID,
+		}
+		if _, err := g.PayoutQuery(ctx, req); err != nil {
+			t.Fatalf("PayoutQuery failed: %v", err)
+		}
+	}
+
+	if _, err := g.PayoutOrder(ctx, payoutRequest("P1", 30)); err != nil {
+		t.Fatalf("PayoutOrder failed: %v", err)
+	}
+	if available, held := balances(t, g); available != 2000 || held != 3000 {
+		t.Errorf("Expected 2000 available and 3000 held, got %d and %d", available, held)
+	}
+
+	_, err := g.PayoutOrder(ctx, payoutRequest("P2", 30))
+	if code := ErrorCode(err); code != CodeInsufficientBalance {
+		t.Errorf("Expected %s when payout exceeds available funds, got %v", CodeInsufficientBalance, err)
+	}
+
+	query("P1", "failed")
+	if available, held := balances(t, g); available != 5000 || held != 0 {
+		t.Errorf("Expected failed payout to release its hold, got %d available and %d held", available, held)
+	}
+
+	if _, err := g.PayoutOrder(ctx, payoutRequest("P2", 30)); err != nil {
+		t.Fatalf("Expected payout to fit after release: %v", err)
+	}
+	query("P2", "completed")
+	channel, _ := g.Ledger().Balance(ctx, ledger.ChannelAccount("stub"), "CNY")
+	if available, held := balances(t, g); available != 2000 || held != 0 || channel != 2000 {
+		t.Errorf("Expected captured payout, got %d available, %d held, %d at channel", available, held, channel)
+	}
+
+	query("P2", "returned")
+	if available, _ := balances(t, g); available != 5000 {
+		t.Errorf("Expected returned payout to restore available funds, got %d", available)
+	}
+
+	// Resubmitting an open payout reuses its hold
+	for i := 0; i < 2; i++ {
+		if _, err := g.PayoutOrder(ctx, payoutRequest("P3", 30)); err != nil {
+			t.Fatalf("Expected resubmission %d to reuse the hold: %v", i, err)
+		}
+	}
+	if available, held := balances(t, g); available != 2000 || held != 3000 {
+		t.Errorf("Expected a single hold, got %d available and %d held", available, held)
+	}
+	query("P3", "returned")
+	if available, held := balances(t, g); available != 5000 || held != 0 {
+		t.Errorf("Expected a payout returned while processing to release its hold, got %d available and %d held", available, held)
+	}
+	if _, err := g.PayoutOrder(ctx, payoutRequest("P1", 30)); ErrorCode(err) != CodeInvalidRequest {
+		t.Errorf("Expected resubmitting a settled payout to be refused, got %v", err)
+	}
+}
+
+func TestErroredPayoutHolds(t *testing.T) {
+	ctx := context.Background()
+	stub := newStubPlugin()
+	stub.payout = func(ctx context.Context, req *interfaces.PayoutOrderRequest) (*interfaces.PayoutOrderResponse, error) {
+		if req.OrderID == "REFUSED" {
+			return nil, fmt.Errorf("account frozen: %w", interfaces.ErrOrderNotCreated)
+		}
+		return nil, errors.New("connection reset")
+	}
+	var unload atomic.Bool
+	var g *Gateway
+	g = newTestGateway(t, stub, WithMiddleware(func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (interface{}, error) {
+			if unload.Load() {
+				// Unloaded after the limits check, so the call never reaches it
+				_ = g.Loader().UnloadPlugin("stub")
+			}
+			return next(ctx, call)
+		}
+	}))
+	fund(t, g, 5000)
+
+	if _, err := g.PayoutOrder(ctx, payoutRequest("UNKNOWN", 30)); err == nil {
+		t.Fatal("Expected the payout to fail")
+	}
+	o, err := g.Orders().Get(ctx, order.KindPayout, "MERCHANT_001", "UNKNOWN")
+	if err != nil || o.Status != order.StatusPending {
+		t.Fatalf("Expected a payout of unknown outcome recorded pending, got %+v, %v", o, err)
+	}
+	if available, held := balances(t, g); available != 2000 || held != 3000 {
+		t.Errorf("Expected a payout of unknown outcome to stay held, got %d available and %d held", available, held)
+	}
+
+	if _, err := g.PayoutOrder(ctx, payoutRequest("REFUSED", 20)); err == nil {
+		t.Fatal("Expected the payout to fail")
+	}
+	if o, _ := g.Orders().Get(ctx, order.KindPayout, "MERCHANT_001", "REFUSED"); o.Status != order.StatusFailed {
+		t.Errorf("Expected a payout the channel did not create recorded failed, got %s", o.Status)
+	}
+	if available, held := balances(t, g); available != 2000 || held != 3000 {
+		t.Errorf("Expected the refused payout's hold released, got %d available and %d held", available, held)
+	}
+
+	unload.Store(true)
+	if _, err := g.PayoutOrder(ctx, payoutRequest("UNLOADED", 20)); err == nil {
+		t.Fatal("Expected the payout to fail")
+	}
+	if o, _ := g.Orders().Get(ctx, order.KindPayout, "MERCHANT_001", "UNLOADED"); o.Status != order.StatusFailed {
+		t.Errorf("Expected a payout that never reached its channel recorded failed, got %s", o.Status)
+	}
+	if available, held := balances(t, g); available != 2000 || held != 3000 {
+		t.Errorf("Expected the unsent payout's hold released, got %d available and %d held", available, held)
+	}
+}
+
+func TestConcurrentPayoutsCannotOverdraw(t *testing.T) {
+	stub := newStubPlugin()
+	stub.payout = func(ctx context.Context, req *interfaces.PayoutOrderRequest) (*interfaces.PayoutOrderResponse, error) {
+		return &interfaces.PayoutOrderResponse{BaseResponse: interfaces.BaseResponse{Success: true}, OrderID: req.OrderID, Status: "processing"}, nil
+	}
+	g := newTestGateway(t, stub)
+	fund(t, g, 1000)
+
+	var accepted, rejected atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := g.PayoutOrder(context.Background(), payoutRequest(fmt.Sprintf("P%d", i), 1))
+			switch {
+			case err == nil:
+				accepted.Add(1)
+			case ErrorCode(err) == CodeInsufficientBalance:
+				rejected.Add(1)
+			default:
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if accepted.Load() != 10 || rejected.Load() != 40 {
+		t.Errorf("Expected 10 accepted and 40 rejected payouts, got %d and %d", accepted.Load(), rejected.Load())
+	}
+	if available, held := balances(t, g); available != 0 || held != 1000 {
+		t.Errorf("Expected all funds held, got %d available and %d held", available, held)
+	}
+}
@@ -0,0 +1,107 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"payment_go/pkg/plugin"
+)
+
+// Handler returns the gateway's HTTP API
+func (g *Gateway) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/channels", g.handleChannels)
+	mux.HandleFunc("/healthz", g.handleHealthz)
+	mux.HandleFunc("/readyz", g.handleReadyz)
+	mux.HandleFunc("/qrcode", g.handleQRCode)
+	mux.HandleFunc("/callback/", g.handleCallback)
+	if g.cashier != nil {
+		mux.HandleFunc("/pay/", g.handleCashier)
+	}
+	if g.notifier != nil {
+		mux.HandleFunc("/notifications", g.handleNotifications)
+		mux.HandleFunc("/notifications/", g.handleNotifications)
+	}
+	return mux
+}
+
+// healthView is the body of /healthz and /readyz
+type healthView struct {
+	Status   string                         `json:"status"`
+	Channels map[string]plugin.HealthRecord `json:"channels"`
+}
+
+// handleHealthz reports liveness: the gateway answers as long as it runs.
+// Channel records are included for diagnosis but never fail the check, so
+// an upstream outage does not get the gateway restarted.
+func (g *Gateway) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, healthView{Status: "ok", Channels: g.loader.Health()})
+}
+
+// handleReadyz reports readiness: every channel must be ready, see
+// plugin.HealthRecord.Ready, and at least one channel must be loaded
+func (g *Gateway) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	health := g.loader.Health()
+	ready := len(health) > 0
+	for _, record := range health {
+		if !record.Ready() {
+			ready = false
+		}
+	}
+
+	if !ready {
+		writeJSON(w, http.StatusServiceUnavailable, healthView{Status: "not ready", Channels: health})
+		return
+	}
+	writeJSON(w, http.StatusOK, healthView{Status: "ready", Channels: health})
+}
+
+// channelView is the public description of a loaded channel
+type channelView struct {
+	ChannelID    string              `json:"channel_id"`
+	Name         string              `json:"name"`
+	Version      string              `json:"version"`
+	ChannelType  string              `json:"channel_type"`
+	Capabilities []string            `json:"capabilities"`
+	LoadedAt     time.Time           `json:"loaded_at"`
+	UsageCount   int64               `json:"usage_count"`
+	InFlight     int64               `json:"in_flight"`
+	Health       plugin.HealthStatus `json:"health"`
+	// Config comes from ListPlugins, so secrets are already redacted
+	Config map[string]interface{} `json:"config,omitempty"`
+}
+
+func (g *Gateway) handleChannels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	var channels []channelView
+	for channelID, loaded := range g.loader.ListPlugins() {
+		channels = append(channels, channelView{
+			ChannelID:    channelID,
+			Name:         loaded.Info.Name,
+			Version:      loaded.Info.Version,
+			ChannelType:  loaded.Info.ChannelType,
+			Capabilities: loaded.Info.Capabilities,
+			LoadedAt:     loaded.LoadedAt,
+			UsageCount:   loaded.UsageCount,
+			InFlight:     loaded.InFlight,
+			Health:       loaded.Health.Status,
+			Config:       loaded.Config,
+		})
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].ChannelID < channels[j].ChannelID })
+
+	writeJSON(w, http.StatusOK, channels)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,59 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// probedStub is a stub plugin with a controllable health probe
+type probedStub struct {
+	*stubPlugin
+	err error
+}
+
+func (ps *probedStub) Probe(ctx context.Context) error {
+	return ps.err
+}
+
+func getJSON(t *testing.T, handler http.Handler, path string) (int, healthView) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var body healthView
+	if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+		t.Fatalf("%s returned invalid JSON: %v", path, err)
+	}
+	return recorder.Code, body
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	stub := &probedStub{stubPlugin: newStubPlugin()}
+	gw := newTestGateway(t, stub)
+	handler := gw.Handler()
+
+	if code, body := getJSON(t, handler, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("gateway should not be ready before channels are probed: %d %+v", code, body)
+	}
+
+	gw.Loader().ProbeAll(context.Background())
+	code, body := getJSON(t, handler, "/readyz")
+	if code != http.StatusOK || body.Status != "ready" || body.Channels["stub"].Status != "healthy" {
+		t.Errorf("expected ready gateway, got %d %+v", code, body)
+	}
+
+	stub.err = errors.New("upstream down")
+	for i := 0; i < 3; i++ {
+		gw.Loader().ProbeAll(context.Background())
+	}
+	if code, body := getJSON(t, handler, "/readyz"); code != http.StatusServiceUnavailable || body.Channels["stub"].LastError != "upstream down" {
+		t.Errorf("unhealthy channel should fail readiness, got %d %+v", code, body)
+	}
+	if code, body := getJSON(t, handler, "/healthz"); code != http.StatusOK || body.Channels["stub"].Status != "unhealthy" {
+		t.Errorf("liveness should pass and report channel health, got %d %+v", code, body)
+	}
+}
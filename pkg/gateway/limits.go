@@ -0,0 +1,35 @@
+package gateway
+
+import (
+	"context"
+
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/money"
+)
+
+// enforceLimits rejects orders outside the operating limits the channel's
+// plugin declares. It runs after routing, which already skips channels
+// whose limits rule an order out, and before payouts are held.
+func (g *Gateway) enforceLimits(next Handler) Handler {
+	return func(ctx context.Context, call *Call) (interface{}, error) {
+		var amount float64
+		var currency, method string
+		switch req := call.Request.(type) {
+		case *interfaces.CollectOrderRequest:
+			amount, currency, method = req.Amount, req.Currency, req.PaymentMethod
+		case *interfaces.PayoutOrderRequest:
+			amount, currency = req.Amount, req.Currency
+		default:
+			return next(ctx, call)
+		}
+
+		minor, err := money.ToMinor(amount, currency)
+		if err != nil {
+			return nil, newError(CodeInvalidRequest, "%s: %v", call.Operation, err)
+		}
+		if err := g.loader.CheckOrder(call.Base.ChannelID, string(call.Operation), method, currency, minor, g.clock.Now()); err != nil {
+			return nil, newError(CodeOutOfLimits, "%s: channel %s %v", call.Operation, call.Base.ChannelID, err)
+		}
+		return next(ctx, call)
+	}
+}
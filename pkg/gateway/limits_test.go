@@ -0,0 +1,95 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/order"
+	"payment_go/pkg/routing"
+)
+
+func TestOrdersOutsideLimitsAreRejected(t *testing.T) {
+	ctx := context.Background()
+	called := false
+	stub := newStubPlugin()
+	stub.info.OperatingLimits = interfaces.OperatingLimits{
+		Currencies: []string{"CNY"},
+		Limits:     []interfaces.AmountLimit{{Operation: "payout_order", Max: 20}},
+	}
+	stub.payout = func(ctx context.Context, req *interfaces.PayoutOrderRequest) (*interfaces.PayoutOrderResponse, error) {
+		called = true
+		return &interfaces.PayoutOrderResponse{BaseResponse: interfaces.BaseResponse{Success: true}, OrderID: req.OrderID}, nil
+	}
+	g := newTestGateway(t, stub)
+	fund(t, g, 5000)
+
+	usd := collectRequest("ORDER_1")
+	usd.Currency = "USD"
+	if _, err := g.CollectOrder(ctx, usd); ErrorCode(err) != CodeOutOfLimits {
+		t.Errorf("Expected %s for an unsupported currency, got %v", CodeOutOfLimits, err)
+	}
+
+	if _, err := g.PayoutOrder(ctx, payoutRequest("P1", 30)); ErrorCode(err) != CodeOutOfLimits {
+		t.Errorf("Expected %s for a payout above the limit, got %v", CodeOutOfLimits, err)
+	}
+	if available, held := balances(t, g); called || available != 5000 || held != 0 {
+		t.Errorf("Expected the payout to be rejected before the hold and the plugin, got %d available, %d held", available, held)
+	}
+	if _, err := g.PayoutOrder(ctx, payoutRequest("P2", 20)); err != nil || !called {
+		t.Errorf("Expected a payout within the limit to reach the plugin, got %v", err)
+	}
+}
+
+func TestRoutingSkipsChannelsOutsideLimits(t *testing.T) {
+	ctx := context.Background()
+	cheap, dear := newStubPlugin(), newStubPlugin()
+	cheap.info.OperatingLimits = interfaces.OperatingLimits{
+		Limits: []interfaces.AmountLimit{{Operation: "collect_order", Max: 50}},
+	}
+	g := newRoutedGateway(t, map[string]*stubPlugin{"cheap": cheap, "dear": dear}, routing.Route{
+		ID: "cny", Strategy: routing.StrategyCost,
+		Channels: []routing.Target{{ChannelID: "cheap"}, {ChannelID: "dear"}},
+	})
+
+	req := collectRequest("ORDER_1")
+	req.ChannelID = "cny"
+	if _, err := g.CollectOrder(ctx, req); err != nil {
+		t.Fatalf("CollectOrder failed: %v", err)
+	}
+	if placed, _ := g.Orders().Get(ctx, order.KindCollect, "MERCHANT_001", "ORDER_1"); placed.ChannelID != "dear" {
+		t.Errorf("Expected the order to be routed around cheap's limit, got %s", placed.ChannelID)
+	}
+}
+
+func TestPaymentMethods(t *testing.T) {
+	ctx := context.Background()
+	qr, wap := newStubPlugin(), newStubPlugin()
+	qr.info.OperatingLimits = interfaces.OperatingLimits{PaymentMethods: []string{interfaces.PaymentMethodQRCode}}
+	wap.info.OperatingLimits = interfaces.OperatingLimits{PaymentMethods: []string{interfaces.PaymentMethodWAP}}
+	g := newRoutedGateway(t, map[string]*stubPlugin{"cheap": qr, "dear": wap}, routing.Route{
+		ID: "cny", Strategy: routing.StrategyCost,
+		Channels: []routing.Target{{ChannelID: "cheap"}, {ChannelID: "dear"}},
+	})
+
+	unknown := collectRequest("ORDER_1")
+	unknown.ChannelID, unknown.PaymentMethod = "cheap", "cash"
+	if _, err := g.CollectOrder(ctx, unknown); ErrorCode(err) != CodeInvalidRequest {
+		t.Errorf("Expected %s for an unknown payment method, got %v", CodeInvalidRequest, err)
+	}
+
+	direct := collectRequest("ORDER_2")
+	direct.ChannelID, direct.PaymentMethod = "cheap", interfaces.PaymentMethodWAP
+	if _, err := g.CollectOrder(ctx, direct); ErrorCode(err) != CodeOutOfLimits {
+		t.Errorf("Expected %s for a payment method the channel does not support, got %v", CodeOutOfLimits, err)
+	}
+
+	routed := collectRequest("ORDER_3")
+	routed.ChannelID, routed.PaymentMethod = "cny", interfaces.PaymentMethodWAP
+	if _, err := g.CollectOrder(ctx, routed); err != nil {
+		t.Fatalf("CollectOrder failed: %v", err)
+	}
+	if placed, _ := g.Orders().Get(ctx, order.KindCollect, "MERCHANT_001", "ORDER_3"); placed.ChannelID != "dear" {
+		t.Errorf("Expected the order to be routed to the channel supporting wap, got %s", placed.ChannelID)
+	}
+}
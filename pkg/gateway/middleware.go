@@ -0,0 +1,161 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"payment_go/pkg/config"
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/notify"
+	"payment_go/pkg/tracing"
+)
+
+// ValidateRequests rejects malformed requests before they reach a plugin.
+// It is always installed as the first middleware in the chain.
+func ValidateRequests() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (interface{}, error) {
+			_, span := tracing.StartSpan(ctx, "gateway.validate", tracing.RequestAttributes(call.Base)...)
+			err := validateCall(call)
+			tracing.RecordError(span, err)
+			span.End()
+			if err != nil {
+				return nil, err
+			}
+			return next(ctx, call)
+		}
+	}
+}
+
+// validateCall checks the fields every plugin relies on
+func validateCall(call *Call) error {
+	if call.Base == nil {
+		return newError(CodeInvalidRequest, "%s: missing base request", call.Operation)
+	}
+	if call.Base.ChannelID == "" {
+		return newError(CodeInvalidRequest, "%s: channel_id is required", call.Operation)
+	}
+	// Upstreams do not know merchants; callbacks find theirs by order
+	if call.Base.MerchantID == "" && call.Operation != OpCallback {
+		return newError(CodeInvalidRequest, "%s: merchant_id is required", call.Operation)
+	}
+
+	switch req := call.Request.(type) {
+	case *interfaces.CollectOrderRequest:
+		if err := validateOrder(call.Operation, req.OrderID, req.Amount, req.Currency); err != nil {
+			return err
+		}
+		if req.PaymentMethod != "" && !interfaces.KnownPaymentMethod(req.PaymentMethod) {
+			return newError(CodeInvalidRequest, "%s: unknown payment_method %q", call.Operation, req.PaymentMethod)
+		}
+		if err := validateNotifyURL(call.Operation, req.NotifyURL); err != nil {
+			return err
+		}
+		// The cashier redirects the payer to it
+		if err := validateHTTPURL(call.Operation, "return_url", req.ReturnURL); err != nil {
+			return err
+		}
+	case *interfaces.PayoutOrderRequest:
+		if err := validateOrder(call.Operation, req.OrderID, req.Amount, req.Currency); err != nil {
+			return err
+		}
+		if req.RecipientInfo == nil {
+			return newError(CodeInvalidRequest, "%s: recipient_info is required", call.Operation)
+		}
+		if err := validateNotifyURL(call.Operation, req.NotifyURL); err != nil {
+			return err
+		}
+	case *interfaces.CollectQueryRequest:
+		if req.OrderID == "" && req.ChannelOrderID == "" {
+			return newError(CodeInvalidRequest, "%s: order_id or channel_order_id is required", call.Operation)
+		}
+	case *interfaces.PayoutQueryRequest:
+		if req.OrderID == "" && req.ChannelOrderID == "" {
+			return newError(CodeInvalidRequest, "%s: order_id or channel_order_id is required", call.Operation)
+		}
+	}
+	return nil
+}
+
+// validateNotifyURL accepts an empty notify URL or an absolute HTTP(S) one
+// that is not a private IP address. Host names are checked by the
+// dispatcher when it connects.
+func validateNotifyURL(op Operation, notifyURL string) error {
+	if err := validateHTTPURL(op, "notify_url", notifyURL); err != nil || notifyURL == "" {
+		return err
+	}
+	parsed, _ := url.Parse(notifyURL)
+	if addr, err := netip.ParseAddr(parsed.Hostname()); err == nil && !notify.PublicAddr(addr) {
+		return newError(CodeInvalidRequest, "%s: notify_url must not point to a private address", op)
+	}
+	return nil
+}
+
+// validateHTTPURL accepts an empty URL or an absolute HTTP(S) one in field
+func validateHTTPURL(op Operation, field, rawURL string) error {
+	if rawURL == "" {
+		return nil
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return newError(CodeInvalidRequest, "%s: %s must be an absolute http or https URL", op, field)
+	}
+	return nil
+}
+
+func validateOrder(op Operation, orderID string, amount float64, currency string) error {
+	if orderID == "" {
+		return newError(CodeInvalidRequest, "%s: order_id is required", op)
+	}
+	if strings.Contains(orderID, attemptSeparator) {
+		return newError(CodeInvalidRequest, "%s: order_id may not contain %q", op, attemptSeparator)
+	}
+	if amount <= 0 {
+		return newError(CodeInvalidRequest, "%s: amount must be positive", op)
+	}
+	if currency == "" {
+		return newError(CodeInvalidRequest, "%s: currency is required", op)
+	}
+	return nil
+}
+
+// ChannelPolicies applies per-channel timeout and concurrency limits
+func ChannelPolicies(policies map[string]config.Policies) Middleware {
+	slots := make(map[string]chan struct{})
+	for channelID, policy := range policies {
+		if policy.MaxConcurrent > 0 {
+			slots[channelID] = make(chan struct{}, policy.MaxConcurrent)
+		}
+	}
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (interface{}, error) {
+			policy := policies[call.Base.ChannelID]
+
+			if slot := slots[call.Base.ChannelID]; slot != nil {
+				select {
+				case slot <- struct{}{}:
+					defer func() { <-slot }()
+				default:
+					return nil, newError(CodeChannelBusy, "channel %s has %d calls in flight", call.Base.ChannelID, policy.MaxConcurrent)
+				}
+			}
+
+			if policy.Timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, time.Duration(policy.Timeout))
+				defer cancel()
+			}
+
+			resp, err := next(ctx, call)
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+				return nil, newError(CodeTimeout, "channel %s did not answer within %s", call.Base.ChannelID, time.Duration(policy.Timeout))
+			}
+			return resp, err
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package gateway
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"payment_go/pkg/config"
+	"payment_go/pkg/notify"
+	"payment_go/pkg/order"
+)
+
+// WithNotifier sets the dispatcher that tells merchants about their orders.
+// Every transition of an order with a notify URL is queued on it; the
+// dispatcher's Run must be started to deliver them. Without this option
+// notify URLs are ignored.
+func WithNotifier(d *notify.Dispatcher) Option {
+	return func(g *Gateway) {
+		g.notifier = d
+	}
+}
+
+// WithNotificationsToken sets the bearer token every /notifications request
+// must carry. Without it the endpoint refuses all requests.
+func WithNotificationsToken(token string) Option {
+	return func(g *Gateway) {
+		g.notifyToken = token
+	}
+}
+
+// Notifier returns the merchant notification dispatcher, or nil
+func (g *Gateway) Notifier() *notify.Dispatcher {
+	return g.notifier
+}
+
+// notifications builds the merchant notification dispatcher for cfg,
+// opening its queue file if one is set
+func notifications(cfg config.Notifications) (*notify.Dispatcher, notify.Store, error) {
+	var store notify.Store = notify.NewMemoryStore()
+	if cfg.Path != "" {
+		file, err := notify.OpenFileStore(cfg.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		store = file
+	}
+
+	opts := notify.Options{
+		Secret:          []byte(cfg.Secret),
+		MerchantSecrets: make(map[string][]byte, len(cfg.MerchantSecrets)),
+		Timeout:         time.Duration(cfg.Timeout),
+		Retention:       time.Duration(cfg.Retention),
+
+		AllowPrivateNetworks: cfg.AllowPrivateNetworks,
+	}
+	for merchantID, secret := range cfg.MerchantSecrets {
+		opts.MerchantSecrets[merchantID] = []byte(secret)
+	}
+	for _, wait := range cfg.Schedule {
+		opts.Schedule = append(opts.Schedule, time.Duration(wait))
+	}
+	return notify.New(store, opts), store, nil
+}
+
+// notify queues an event for the order's latest transition. Failing to
+// queue it is logged; the transition itself has already been recorded.
+func (g *Gateway) notify(ctx context.Context, o order.Order) {
+	if g.notifier == nil || o.NotifyURL == "" {
+		return
+	}
+	if err := g.notifier.Notify(ctx, o.NotifyURL, notify.OrderEvent(o, g.clock.Now())); err != nil {
+		g.logger.ErrorContext(ctx, "failed to queue merchant notification",
+			"merchant_id", o.MerchantID,
+			"order_id", o.ID,
+			"status", string(o.Status),
+			"error", err)
+	}
+}
+
+// handleNotifications serves the notification deliveries:
+// GET /notifications lists them, filtered by the merchant_id, order_id and
+// status query parameters, GET /notifications/{id} returns one and
+// POST /notifications/{id}/redeliver sends it again now. Deliveries carry
+// signed payloads, so every request needs the admin token.
+func (g *Gateway) handleNotifications(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/notifications"), "/")
+	id, action, _ := strings.Cut(path, "/")
+	query := r.URL.Query()
+
+	switch {
+	case !g.notificationsAdmin(r):
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "admin token required"})
+	case id == "" && r.Method == http.MethodGet:
+		deliveries, err := g.notifier.Deliveries(r.Context(), notify.Filter{
+			MerchantID: query.Get("merchant_id"),
+			OrderID:    query.Get("order_id"),
+			Status:     notify.Status(query.Get("status")),
+		})
+		if err != nil {
+			g.writeDeliveryError(w, r, err)
+			return
+		}
+		if deliveries == nil {
+			deliveries = []notify.Delivery{}
+		}
+		writeJSON(w, http.StatusOK, deliveries)
+	case id != "" && action == "" && r.Method == http.MethodGet:
+		delivery, err := g.notifier.Delivery(r.Context(), id)
+		if err != nil {
+			g.writeDeliveryError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, delivery)
+	case id != "" && action == "redeliver" && r.Method == http.MethodPost:
+		delivery, err := g.notifier.Redeliver(r.Context(), id)
+		if err != nil {
+			g.writeDeliveryError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, delivery)
+	case id == "" || action == "" || action == "redeliver":
+		allow := http.MethodGet
+		if action == "redeliver" {
+			allow = http.MethodPost
+		}
+		w.Header().Set("Allow", allow)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+}
+
+// notificationsAdmin reports whether r carries the admin bearer token
+func (g *Gateway) notificationsAdmin(r *http.Request) bool {
+	if g.notifyToken == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(g.notifyToken)) == 1
+}
+
+func (g *Gateway) writeDeliveryError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, notify.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+	g.logger.ErrorContext(r.Context(), "notification request failed", "error", err)
+	writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+}
@@ -0,0 +1,143 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/notify"
+)
+
+func TestNotifications(t *testing.T) {
+	ctx := context.Background()
+	events := make(chan notify.Event, 10)
+	merchant := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event notify.Event
+		json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+		io.WriteString(w, "success")
+	}))
+	defer merchant.Close()
+
+	stub := newStubPlugin()
+	stub.collectQuery = func(ctx context.Context, req *interfaces.CollectQueryRequest) (*interfaces.CollectQueryResponse, error) {
+		return &interfaces.CollectQueryResponse{BaseResponse: interfaces.BaseResponse{Success: true}, OrderID: req.OrderID, Status: "paid"}, nil
+	}
+	// The merchant listens on loopback, which notify URLs may only name
+	// by host name and dispatchers only reach when allowed to
+	dispatcher := notify.New(notify.NewMemoryStore(), notify.Options{Secret: []byte("0123456789abcdef0123456789abcdef"), AllowPrivateNetworks: true})
+	token := "0123456789abcdef0123456789abcdef"
+	gw := newTestGateway(t, stub, WithNotifier(dispatcher), WithNotificationsToken(token))
+
+	req := collectRequest("ORDER_001")
+	req.NotifyURL = strings.Replace(merchant.URL, "127.0.0.1", "localhost", 1)
+	if _, err := gw.CollectOrder(ctx, req); err != nil {
+		t.Fatalf("CollectOrder failed: %v", err)
+	}
+	if deliveries, _ := dispatcher.Deliveries(ctx, notify.Filter{}); len(deliveries) != 0 {
+		t.Fatalf("Expected no notification for a new pending order, got %d", len(deliveries))
+	}
+
+	query := &interfaces.CollectQueryRequest{BaseRequest: req.BaseRequest, OrderID: "ORDER_001"}
+	for i := 0; i < 2; i++ {
+		if _, err := gw.CollectQuery(ctx, query); err != nil {
+			t.Fatalf("CollectQuery failed: %v", err)
+		}
+	}
+	if delivered := dispatcher.Flush(ctx); delivered != 1 {
+		t.Fatalf("Expected one notification for the payment, got %d", delivered)
+	}
+	event := <-events
+	if event.Type != "collect.succeeded" || event.Data.OrderID != "ORDER_001" || event.Data.Amount != 100.50 || event.Data.PreviousStatus != "pending" {
+		t.Errorf("Expected the payment event, got %+v", event)
+	}
+
+	handler := gw.Handler()
+	serveAs := func(authorization, method, path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(method, path, nil)
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		return serveAs("Bearer "+token, method, path)
+	}
+
+	var listed []notify.Delivery
+	recorder := serve(http.MethodGet, "/notifications?merchant_id=MERCHANT_001&order_id=ORDER_001&status=delivered")
+	if err := json.NewDecoder(recorder.Body).Decode(&listed); err != nil || len(listed) != 1 || listed[0].ID != event.ID {
+		t.Fatalf("Expected the delivery listed, got %d %v", recorder.Code, listed)
+	}
+	recorder = serve(http.MethodGet, "/notifications?merchant_id=MERCHANT_002")
+	if err := json.NewDecoder(recorder.Body).Decode(&listed); err != nil || len(listed) != 0 {
+		t.Errorf("Expected merchant_id to filter the list, got %d %v", recorder.Code, listed)
+	}
+	if recorder := serve(http.MethodGet, "/notifications/"+event.ID); recorder.Code != http.StatusOK {
+		t.Errorf("Expected the delivery, got %d", recorder.Code)
+	}
+
+	recorder = serve(http.MethodPost, "/notifications/"+event.ID+"/redeliver")
+	var redelivered notify.Delivery
+	if err := json.NewDecoder(recorder.Body).Decode(&redelivered); err != nil || len(redelivered.Attempts) != 2 || !redelivered.Attempts[1].Manual {
+		t.Errorf("Expected a manual attempt, got %d %+v", recorder.Code, redelivered)
+	}
+	select {
+	case again := <-events:
+		if again.ID != event.ID {
+			t.Errorf("Expected the same event again, got %s", again.ID)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected the merchant to receive the event again")
+	}
+
+	testCases := map[string]struct {
+		method, path string
+		expected     int
+	}{
+		"unknown delivery":   {http.MethodGet, "/notifications/evt_unknown", http.StatusNotFound},
+		"redeliver unknown":  {http.MethodPost, "/notifications/evt_unknown/redeliver", http.StatusNotFound},
+		"redeliver with GET": {http.MethodGet, "/notifications/" + event.ID + "/redeliver", http.StatusMethodNotAllowed},
+		"list with POST":     {http.MethodPost, "/notifications", http.StatusMethodNotAllowed},
+		"unknown action":     {http.MethodPost, "/notifications/" + event.ID + "/cancel", http.StatusNotFound},
+	}
+	for name, tc := range testCases {
+		if recorder := serve(tc.method, tc.path); recorder.Code != tc.expected {
+			t.Errorf("%s: expected %d, got %d", name, tc.expected, recorder.Code)
+		}
+	}
+
+	// Naming a merchant is no credential
+	for _, authorization := range []string{"", "Bearer wrong"} {
+		for _, path := range []string{"/notifications?merchant_id=MERCHANT_001", "/notifications/" + event.ID + "?merchant_id=MERCHANT_001"} {
+			if recorder := serveAs(authorization, http.MethodGet, path); recorder.Code != http.StatusUnauthorized {
+				t.Errorf("Expected %s with authorization %q to be refused, got %d", path, authorization, recorder.Code)
+			}
+		}
+		if recorder := serveAs(authorization, http.MethodPost, "/notifications/"+event.ID+"/redeliver?merchant_id=MERCHANT_001"); recorder.Code != http.StatusUnauthorized {
+			t.Errorf("Expected redelivery with authorization %q to be refused, got %d", authorization, recorder.Code)
+		}
+	}
+}
+
+func TestNotifyURLValidation(t *testing.T) {
+	gw := newTestGateway(t, newStubPlugin())
+	for _, notifyURL := range []string{"/notify", "ftp://shop.example.com/notify", "https://", "::", "http://127.0.0.1:8080/notify", "http://169.254.169.254/latest/meta-data", "http://[::1]/notify", "http://10.0.0.5/notify"} {
+		req := collectRequest("ORDER_001")
+		req.NotifyURL = notifyURL
+		_, err := gw.CollectOrder(context.Background(), req)
+		var gwErr *Error
+		if !errors.As(err, &gwErr) || gwErr.Code != CodeInvalidRequest {
+			t.Errorf("%q: expected %s, got %v", notifyURL, CodeInvalidRequest, err)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package gateway
+
+import (
+	"context"
+	"time"
+
+	"payment_go/pkg/config"
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/lease"
+	"payment_go/pkg/order"
+)
+
+// Polling defaults
+const (
+	DefaultPollInitial     = 10 * time.Second
+	DefaultPollMaxInterval = 5 * time.Minute
+	DefaultPollMaxAge      = 24 * time.Hour
+	DefaultPollTimeout     = 15 * time.Second
+	// pollScanInterval is how often WatchOrders looks for orders to poll
+	pollScanInterval = 5 * time.Second
+)
+
+// PollPolicy says how a channel's orders stuck in pending or processing
+// are polled. An order is first queried once it is Initial old, and then
+// after waiting as long as its age, so the waits double, at least Initial
+// and at most MaxInterval apart. Orders older than MaxAge are left alone.
+// Each query is abandoned after Timeout.
+type PollPolicy struct {
+	Disabled    bool
+	Initial     time.Duration
+	MaxInterval time.Duration
+	MaxAge      time.Duration
+	Timeout     time.Duration
+}
+
+// wait returns how long after a poll at age the next one is due
+func (p PollPolicy) wait(age time.Duration) time.Duration {
+	return min(max(age, p.Initial), p.MaxInterval)
+}
+
+// withDefaults fills in the zero fields of p
+func (p PollPolicy) withDefaults() PollPolicy {
+	if p.Initial <= 0 {
+		p.Initial = DefaultPollInitial
+	}
+	if p.MaxInterval <= 0 {
+		p.MaxInterval = DefaultPollMaxInterval
+	}
+	if p.MaxAge <= 0 {
+		p.MaxAge = DefaultPollMaxAge
+	}
+	if p.Timeout <= 0 {
+		p.Timeout = DefaultPollTimeout
+	}
+	return p
+}
+
+// WithPolling enables status polling with a policy per channel ID; channels
+// without one use the defaults. WatchOrders must be started to poll.
+func WithPolling(policies map[string]PollPolicy) Option {
+	return func(g *Gateway) {
+		g.polling = make(map[string]PollPolicy, len(policies))
+		for channelID, policy := range policies {
+			g.polling[channelID] = policy.withDefaults()
+		}
+	}
+}
+
+// WithLeases sets the lease store gateway instances coordinate polling
+// through, and this instance's name in it. Instances sharing a store never
+// poll the same order at once. The default is an in-memory store, which
+// only suits a single instance; no shared store ships with the gateway, so
+// deployments running several instances over a shared order store pass
+// their own to Build.
+func WithLeases(store lease.Store, owner string) Option {
+	return func(g *Gateway) {
+		g.leases, g.leaseOwner = store, owner
+	}
+}
+
+// pollPolicies builds the per-channel policies of cfg
+func pollPolicies(channels []config.Channel) map[string]PollPolicy {
+	policies := make(map[string]PollPolicy, len(channels))
+	for _, ch := range channels {
+		policies[ch.ID] = PollPolicy{
+			Disabled:    ch.Polling.Disabled,
+			Initial:     time.Duration(ch.Polling.Initial),
+			MaxInterval: time.Duration(ch.Polling.MaxInterval),
+			MaxAge:      time.Duration(ch.Polling.MaxAge),
+			Timeout:     time.Duration(ch.Polling.Timeout),
+		}
+	}
+	return policies
+}
+
+// WatchOrders polls orders every few seconds until ctx is done. It returns
+// at once when polling is not enabled.
+func (g *Gateway) WatchOrders(ctx context.Context) {
+	if g.polling == nil {
+		return
+	}
+	ticker := time.NewTicker(pollScanInterval)
+	defer ticker.Stop()
+
+	for {
+		g.PollOrders(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PollOrders queries the channel of every pending or processing order
+// whose next poll is due, and returns how many were queried. The result
+// goes through bookkeeping like any query, so orders move on and merchants
+// are notified. The order's lease, held until the next poll is due, keeps
+// other instances from querying it meanwhile.
+func (g *Gateway) PollOrders(ctx context.Context) int {
+	if g.polling == nil {
+		return 0
+	}
+	orders, err := g.orders.ListOpen(ctx)
+	if err != nil {
+		g.logger.ErrorContext(ctx, "failed to list orders to poll", "error", err)
+		return 0
+	}
+
+	polled := 0
+	now := g.clock.Now()
+	for _, o := range orders {
+		if ctx.Err() != nil {
+			break
+		}
+		if !o.Status.Open() {
+			continue
+		}
+		policy, ok := g.polling[o.ChannelID]
+		if !ok {
+			policy = PollPolicy{}.withDefaults()
+		}
+		age := now.Sub(o.CreatedAt)
+		if policy.Disabled || age < policy.Initial || age > policy.MaxAge {
+			continue
+		}
+		acquired, err := g.leases.Acquire(ctx, "poll:"+o.Key(), g.leaseOwner, policy.wait(age))
+		if err != nil {
+			g.logger.ErrorContext(ctx, "failed to lease order for polling", "order_id", o.ID, "error", err)
+			continue
+		}
+		if !acquired {
+			continue
+		}
+		queryCtx, cancel := context.WithTimeout(ctx, policy.Timeout)
+		err = g.queryOrder(queryCtx, o, "poll-")
+		cancel()
+		if err != nil {
+			g.logger.WarnContext(ctx, "order status poll failed",
+				"channel_id", o.ChannelID,
+				"merchant_id", o.MerchantID,
+				"order_id", o.ID,
+				"error", err)
+		}
+		polled++
+	}
+	return polled
+}
+
+// queryOrder queries o's channel for its status, through the route it was
+// placed on if any, which resolves the channel and upstream order ID. The
+// request ID is requestPrefix followed by the order ID.
+func (g *Gateway) queryOrder(ctx context.Context, o order.Order, requestPrefix string) error {
+	channelID := o.ChannelID
+	if o.Route != "" {
+		channelID = o.Route
+	}
+	base := interfaces.BaseRequest{
+		MerchantID: o.MerchantID,
+		ChannelID:  channelID,
+		RequestID:  requestPrefix + o.ID,
+		Timestamp:  g.clock.Now(),
+	}
+
+	var err error
+	switch o.Kind {
+	case order.KindCollect:
+		_, err = g.CollectQuery(ctx, &interfaces.CollectQueryRequest{BaseRequest: base, OrderID: o.ID})
+	case order.KindPayout:
+		_, err = g.PayoutQuery(ctx, &interfaces.PayoutQueryRequest{BaseRequest: base, OrderID: o.ID})
+	}
+	return err
+}
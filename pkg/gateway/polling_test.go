@@ -0,0 +1,125 @@
+package gateway
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/lease"
+	"payment_go/pkg/order"
+)
+
+func TestPollOrders(t *testing.T) {
+	ctx := context.Background()
+	var collectQueries, payoutQueries atomic.Int32
+	paid := map[string]bool{}
+	stub := newStubPlugin()
+	stub.collectQuery = func(ctx context.Context, req *interfaces.CollectQueryRequest) (*interfaces.CollectQueryResponse, error) {
+		collectQueries.Add(1)
+		status := "pending"
+		if paid[req.OrderID] {
+			status = "paid"
+		}
+		return &interfaces.CollectQueryResponse{BaseResponse: interfaces.BaseResponse{Success: true}, OrderID: req.OrderID, Status: status}, nil
+	}
+	stub.payoutQuery = func(ctx context.Context, req *interfaces.PayoutQueryRequest) (*interfaces.PayoutQueryResponse, error) {
+		payoutQueries.Add(1)
+		return &interfaces.PayoutQueryResponse{BaseResponse: interfaces.BaseResponse{Success: true}, OrderID: req.OrderID, Status: "success"}, nil
+	}
+
+	store := order.NewMemoryStore()
+	leases := lease.NewMemoryStore()
+	policies := map[string]PollPolicy{"stub": {Initial: 10 * time.Second, MaxAge: time.Hour}}
+	first := newTestGateway(t, stub, WithOrderStore(store), WithPolling(policies), WithLeases(leases, "first"))
+	second := newTestGateway(t, stub, WithOrderStore(store), WithPolling(policies), WithLeases(leases, "second"))
+
+	now := time.Now()
+	for _, o := range []order.Order{
+		{ID: "STUCK", Kind: order.KindCollect, CreatedAt: now.Add(-time.Minute)},
+		{ID: "PAYOUT", Kind: order.KindPayout, Status: order.StatusProcessing, CreatedAt: now.Add(-time.Minute)},
+		{ID: "FRESH", Kind: order.KindCollect, CreatedAt: now},
+		{ID: "ANCIENT", Kind: order.KindCollect, CreatedAt: now.Add(-2 * time.Hour)},
+		{ID: "DONE", Kind: order.KindCollect, Status: order.StatusSucceeded, CreatedAt: now.Add(-time.Minute)},
+	} {
+		o.MerchantID, o.ChannelID, o.Currency, o.Amount = "MERCHANT_001", "stub", "CNY", 100
+		if o.Status == "" {
+			o.Status = order.StatusPending
+		}
+		if err := store.Create(ctx, o); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+
+	if polled := first.PollOrders(ctx) + second.PollOrders(ctx); polled != 2 {
+		t.Errorf("Expected the stuck collection and payout to be polled once between both instances, got %d", polled)
+	}
+	if collectQueries.Load() != 1 || payoutQueries.Load() != 1 {
+		t.Errorf("Expected one query of each kind, got %d and %d", collectQueries.Load(), payoutQueries.Load())
+	}
+	if payout, _ := store.Get(ctx, order.KindPayout, "MERCHANT_001", "PAYOUT"); payout.Status != order.StatusSucceeded {
+		t.Errorf("Expected the poll to complete the payout, got %s", payout.Status)
+	}
+
+	// The lease runs until the next poll is due, an order's age after it
+	if polled := first.PollOrders(ctx); polled != 0 {
+		t.Errorf("Expected no poll before the next one is due, got %d", polled)
+	}
+	leases.Release(ctx, "poll:"+order.Key(order.KindCollect, "MERCHANT_001", "STUCK"), "first")
+	paid["STUCK"] = true
+	if polled := second.PollOrders(ctx); polled != 1 {
+		t.Errorf("Expected the due order to be polled, got %d", polled)
+	}
+	if stuck, _ := store.Get(ctx, order.KindCollect, "MERCHANT_001", "STUCK"); stuck.Status != order.StatusSucceeded {
+		t.Errorf("Expected the poll to find the order paid, got %s", stuck.Status)
+	}
+
+	disabled := newTestGateway(t, stub, WithOrderStore(store), WithPolling(map[string]PollPolicy{"stub": {Disabled: true}}))
+	store.Create(ctx, order.Order{ID: "OTHER", Kind: order.KindCollect, MerchantID: "MERCHANT_001", ChannelID: "stub", Status: order.StatusPending, CreatedAt: now.Add(-time.Minute)})
+	if polled := disabled.PollOrders(ctx); polled != 0 {
+		t.Errorf("Expected no polling on a disabled channel, got %d", polled)
+	}
+	if polled := newTestGateway(t, stub, WithOrderStore(store)).PollOrders(ctx); polled != 0 {
+		t.Errorf("Expected no polling unless enabled, got %d", polled)
+	}
+}
+
+func TestPollTimeout(t *testing.T) {
+	ctx := context.Background()
+	stub := newStubPlugin()
+	stub.collectQuery = func(ctx context.Context, req *interfaces.CollectQueryRequest) (*interfaces.CollectQueryResponse, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	store := order.NewMemoryStore()
+	gw := newTestGateway(t, stub, WithOrderStore(store), WithPolling(map[string]PollPolicy{"stub": {Timeout: 20 * time.Millisecond}}))
+	for _, id := range []string{"HUNG_1", "HUNG_2"} {
+		store.Create(ctx, order.Order{ID: id, Kind: order.KindCollect, MerchantID: "MERCHANT_001", ChannelID: "stub", Currency: "CNY", Amount: 100, Status: order.StatusPending, CreatedAt: time.Now().Add(-time.Minute)})
+	}
+
+	start := time.Now()
+	if polled := gw.PollOrders(ctx); polled != 2 {
+		t.Errorf("Expected both orders polled, got %d", polled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected hung queries to be abandoned, took %v", elapsed)
+	}
+}
+
+func TestPollPolicyWait(t *testing.T) {
+	policy := PollPolicy{}.withDefaults()
+	testCases := []struct {
+		age, expected time.Duration
+	}{
+		{0, DefaultPollInitial},
+		{DefaultPollInitial, DefaultPollInitial},
+		{40 * time.Second, 40 * time.Second},
+		{time.Hour, DefaultPollMaxInterval},
+	}
+	for _, tc := range testCases {
+		if wait := policy.wait(tc.age); wait != tc.expected {
+			t.Errorf("wait(%v): expected %v, got %v", tc.age, tc.expected, wait)
+		}
+	}
+}
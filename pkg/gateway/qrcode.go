@@ -0,0 +1,126 @@
+package gateway
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"os"
+	"strconv"
+
+	"payment_go/pkg/config"
+	"payment_go/pkg/qrcode"
+)
+
+// Bounds of the /qrcode endpoint
+const (
+	defaultQRSize = 256
+	maxQRSize     = 2048
+)
+
+// qrSettings are the gateway-wide QR code rendering settings
+type qrSettings struct {
+	level qrcode.Level
+	logo  image.Image
+}
+
+// WithQRCodes sets the error correction level QR codes are rendered at,
+// and the logo drawn over them, if any. A logo needs level Q or H. Without
+// this option codes are rendered at level M without a logo.
+func WithQRCodes(level qrcode.Level, logo image.Image) Option {
+	return func(g *Gateway) {
+		g.qr = qrSettings{level: level, logo: logo}
+	}
+}
+
+// qrCodes builds the WithQRCodes option for cfg, loading the logo
+func qrCodes(cfg config.QRCode) (Option, error) {
+	level := qrcode.LevelM
+	if cfg.Logo != "" {
+		level = qrcode.LevelH
+	}
+	if cfg.Level != "" {
+		parsed, err := qrcode.ParseLevel(cfg.Level)
+		if err != nil {
+			return nil, fmt.Errorf("qr_code: %w", err)
+		}
+		level = parsed
+	}
+
+	var logo image.Image
+	if cfg.Logo != "" {
+		file, err := os.Open(cfg.Logo)
+		if err != nil {
+			return nil, fmt.Errorf("qr_code: %w", err)
+		}
+		defer file.Close()
+		if logo, err = png.Decode(file); err != nil {
+			return nil, fmt.Errorf("qr_code: logo %s: %w", cfg.Logo, err)
+		}
+	}
+	return WithQRCodes(level, logo), nil
+}
+
+// handleQRCode renders QR code content, such as the qr_code of a
+// collection, as an image. Query parameters: content (required), format
+// "png" (default) or "svg", size in pixels, default 256, and level, which
+// overrides the configured error correction level.
+func (g *Gateway) handleQRCode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	query := r.URL.Query()
+	content := query.Get("content")
+	if content == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "content is required"})
+		return
+	}
+	size := defaultQRSize
+	if s := query.Get("size"); s != "" {
+		parsed, err := strconv.Atoi(s)
+		if err != nil || parsed <= 0 || parsed > maxQRSize {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "size must be between 1 and " + strconv.Itoa(maxQRSize)})
+			return
+		}
+		size = parsed
+	}
+	level := g.qr.level
+	if l := query.Get("level"); l != "" {
+		parsed, err := qrcode.ParseLevel(l)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		level = parsed
+	}
+
+	code, err := qrcode.Encode(content, level)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	opts := qrcode.Options{Size: size, Logo: g.qr.logo}
+	if level < qrcode.LevelQ {
+		// Too little of the code could be recovered from under the logo
+		opts.Logo = nil
+	}
+
+	render, contentType := qrcode.PNG, "image/png"
+	switch query.Get("format") {
+	case "", "png":
+	case "svg":
+		render, contentType = qrcode.SVG, "image/svg+xml"
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "format must be png or svg"})
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	// The content is often a payment URL, so shared caches must not keep it
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	if err := render(w, code, opts); err != nil {
+		g.logger.ErrorContext(r.Context(), "failed to render QR code", "error", err)
+	}
+}
@@ -0,0 +1,59 @@
+package gateway
+
+import (
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	zxing "github.com/makiuchi-d/gozxing/qrcode"
+
+	"payment_go/pkg/qrcode"
+)
+
+func TestQRCodeEndpoint(t *testing.T) {
+	logo := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	handler := newTestGateway(t, newStubPlugin(), WithQRCodes(qrcode.LevelH, logo)).Handler()
+	content := "https://qr.alipay.com/bax08431pmxgbgwb4nja0060"
+
+	get := func(query string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/qrcode?"+query, nil))
+		return recorder
+	}
+
+	recorder := get("size=300&content=" + url.QueryEscape(content))
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("Expected a PNG, got %d %s", recorder.Code, recorder.Body)
+	}
+	img, err := png.Decode(recorder.Body)
+	if err != nil {
+		t.Fatalf("Expected a valid PNG: %v", err)
+	}
+	bitmap, _ := gozxing.NewBinaryBitmapFromImage(img)
+	result, err := zxing.NewQRCodeReader().Decode(bitmap, nil)
+	if err != nil || result.GetText() != content {
+		t.Errorf("Expected the image to decode to %q, got %v", content, err)
+	}
+	if level := result.GetResultMetadata()[gozxing.ResultMetadataType_ERROR_CORRECTION_LEVEL]; level != "H" {
+		t.Errorf("Expected the configured level H, got %v", level)
+	}
+
+	recorder = get("format=svg&level=L&content=" + url.QueryEscape(content))
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Errorf("Expected an SVG, got %d %s", recorder.Code, recorder.Body)
+	}
+	if strings.Contains(recorder.Body.String(), "<image") {
+		t.Error("Expected no logo on a code at level L")
+	}
+
+	for _, query := range []string{"", "content=x&size=0", "content=x&size=5000", "content=x&format=gif", "content=x&level=Z", "content=" + strings.Repeat("x", 3000)} {
+		if recorder := get(query); recorder.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected %d, got %d", query, http.StatusBadRequest, recorder.Code)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"payment_go/pkg/audit"
+	"payment_go/pkg/config"
+	"payment_go/pkg/interfaces"
+)
+
+// Actions audited for callbacks
+const (
+	// ActionCallbackRejected is a callback refused processing
+	ActionCallbackRejected = "callback.rejected"
+	// ActionCallbackDuplicate is a callback already processed, acknowledged
+	// again without processing; upstreams resend callbacks whose
+	// acknowledgement they missed, so it need not be a replay
+	ActionCallbackDuplicate = "callback.duplicate"
+	// ActionEarlierAttempt is a callback about an earlier attempt at placing
+	// an order that has since moved to another channel, kept for
+	// reconciliation
+	ActionEarlierAttempt = "callback.earlier_attempt"
+)
+
+// Reasons a callback is rejected, as audited
+const (
+	// ReasonSourceNotAllowed is a callback from outside the channel's
+	// allowed sources
+	ReasonSourceNotAllowed = "source_not_allowed"
+	// ReasonStale is an event dated further back than the channel's MaxAge
+	ReasonStale = "stale"
+	// ReasonFuture is an event dated ahead of the gateway's clock by more
+	// than callbackClockSkew
+	ReasonFuture = "dated_in_future"
+	// ReasonProcessed is a callback already processed, audited as
+	// ActionCallbackDuplicate
+	ReasonProcessed = "already_processed"
+	// ReasonEventMismatch is an event whose amount or currency disagrees
+	// with the order it is about
+	ReasonEventMismatch = "event_mismatch"
+)
+
+// callbackClockSkew is how far ahead of the gateway's clock an upstream may
+// date an event when the channel has a MaxAge
+const callbackClockSkew = 5 * time.Minute
+
+// CallbackPolicy says which of a channel's callbacks the gateway accepts,
+// beyond the plugin verifying their signature. Callbacks already processed
+// are never processed again while the callback store remembers them, see
+// WithCallbackStore; MaxAge should stay below its TTL so that a replay is
+// too old by the time it is forgotten.
+type CallbackPolicy struct {
+	// MaxAge rejects events the upstream dates more than this before they
+	// arrive; zero accepts any age. Undated events are not checked.
+	MaxAge time.Duration
+	// AllowedSources are the addresses callbacks may come from; empty
+	// allows any
+	AllowedSources []netip.Prefix
+}
+
+// allows reports whether a callback from source is allowed
+func (p CallbackPolicy) allows(source string) bool {
+	if len(p.AllowedSources) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(source)
+	if err != nil {
+		return false
+	}
+	for _, prefix := range p.AllowedSources {
+		if prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithCallbackPolicies sets the callback policy of each channel by ID;
+// other channels accept callbacks from anywhere, of any age
+func WithCallbackPolicies(policies map[string]CallbackPolicy) Option {
+	return func(g *Gateway) {
+		g.callbackPolicies = policies
+	}
+}
+
+// WithAuditSink sets where rejected callbacks are audited. The default
+// logs them as warnings.
+func WithAuditSink(sink audit.Sink) Option {
+	return func(g *Gateway) {
+		g.audit = sink
+	}
+}
+
+// callbackPolicies builds the per-channel callback policies of cfg
+func callbackPolicies(channels []config.Channel) (map[string]CallbackPolicy, error) {
+	policies := make(map[string]CallbackPolicy, len(channels))
+	for _, ch := range channels {
+		sources, err := ch.Callbacks.Sources()
+		if err != nil {
+			return nil, fmt.Errorf("channel %s: %w", ch.ID, err)
+		}
+		policies[ch.ID] = CallbackPolicy{MaxAge: time.Duration(ch.Callbacks.MaxAge), AllowedSources: sources}
+	}
+	return policies, nil
+}
+
+// screenSources rejects callbacks from sources their channel does not
+// allow, before the plugin sees them
+func (g *Gateway) screenSources(next Handler) Handler {
+	return func(ctx context.Context, call *Call) (interface{}, error) {
+		req, ok := call.Request.(*interfaces.CallbackRequest)
+		if !ok {
+			return next(ctx, call)
+		}
+		if !g.callbackPolicies[req.ChannelID].allows(req.SourceIP) {
+			return nil, g.rejectCallback(ctx, req, ReasonSourceNotAllowed,
+				fmt.Sprintf("source %q is not allowed", req.SourceIP))
+		}
+		return next(ctx, call)
+	}
+}
+
+// checkFreshness rejects events dated outside their channel's MaxAge once
+// the plugin has verified and parsed them, before they change any order.
+// Only the plugin knows where the upstream dates an event, so it runs after
+// the plugin's Callback; plugins must therefore leave applying the event to
+// the gateway rather than act on it themselves.
+func (g *Gateway) checkFreshness(next Handler) Handler {
+	return func(ctx context.Context, call *Call) (interface{}, error) {
+		resp, err := next(ctx, call)
+		callback, ok := resp.(*interfaces.CallbackResponse)
+		if err != nil || !ok || callback.Event == nil || callback.Event.OccurredAt.IsZero() {
+			return resp, err
+		}
+		req := call.Request.(*interfaces.CallbackRequest)
+		policy := g.callbackPolicies[req.ChannelID]
+		if policy.MaxAge <= 0 {
+			return resp, err
+		}
+
+		age := g.clock.Now().Sub(callback.Event.OccurredAt)
+		switch {
+		case age > policy.MaxAge:
+			return nil, g.rejectCallback(ctx, req, ReasonStale,
+				fmt.Sprintf("%s event is %s old, more than %s", callback.Event.Type, age.Round(time.Second), policy.MaxAge))
+		case -age > callbackClockSkew:
+			return nil, g.rejectCallback(ctx, req, ReasonFuture,
+				fmt.Sprintf("%s event is dated %s ahead", callback.Event.Type, (-age).Round(time.Second)))
+		}
+		return resp, err
+	}
+}
+
+// rejectCallback audits a rejected callback and returns the error for it
+func (g *Gateway) rejectCallback(ctx context.Context, req *interfaces.CallbackRequest, reason, detail string) error {
+	g.auditCallback(ctx, req, ActionCallbackRejected, reason, detail)
+	return newError(CodeCallbackRejected, "%s: %s", reason, detail)
+}
+
+// auditCallback records what the gateway decided about a callback
+func (g *Gateway) auditCallback(ctx context.Context, req *interfaces.CallbackRequest, action, reason, detail string) {
+	err := g.audit.Record(context.WithoutCancel(ctx), audit.Entry{
+		At:        g.clock.Now(),
+		Action:    action,
+		ChannelID: req.ChannelID,
+		RequestID: req.RequestID,
+		SourceIP:  req.SourceIP,
+		Reason:    reason,
+		Detail:    detail,
+	})
+	if err != nil {
+		g.logger.ErrorContext(ctx, "failed to audit callback",
+			"channel_id", req.ChannelID,
+			"request_id", req.RequestID,
+			"action", action,
+			"reason", reason,
+			"error", err)
+	}
+}
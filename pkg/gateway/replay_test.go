@@ -0,0 +1,170 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"payment_go/pkg/audit"
+	"payment_go/pkg/config"
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/order"
+)
+
+// recordingSink keeps audit entries in memory
+type recordingSink struct {
+	mutex   sync.Mutex
+	entries []audit.Entry
+}
+
+func (rs *recordingSink) Record(ctx context.Context, entry audit.Entry) error {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	rs.entries = append(rs.entries, entry)
+	return nil
+}
+
+func (rs *recordingSink) reasons() []string {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	var reasons []string
+	for _, entry := range rs.entries {
+		reasons = append(reasons, entry.Reason)
+	}
+	return reasons
+}
+
+func TestCallbackSourceAllowlist(t *testing.T) {
+	ctx := context.Background()
+	var calls atomic.Int32
+	sink := &recordingSink{}
+	policies := map[string]CallbackPolicy{"stub": {AllowedSources: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}}
+	gw := newTestGateway(t, callbackStub(&calls), WithCallbackPolicies(policies), WithAuditSink(sink))
+	gw.CollectOrder(ctx, collectRequest("ORDER_001"))
+
+	for _, source := range []string{"192.168.1.1", ""} {
+		req := callbackRequest(map[string]interface{}{"notify_id": "N1", "event": interfaces.EventPaymentSucceeded, "order_id": "ORDER_001"})
+		req.SourceIP = source
+		if _, err := gw.Callback(ctx, req); ErrorCode(err) != CodeCallbackRejected {
+			t.Errorf("Expected a callback from %q to be rejected, got %v", source, err)
+		}
+	}
+	if calls.Load() != 0 {
+		t.Errorf("Expected rejected callbacks never to reach the plugin, got %d calls", calls.Load())
+	}
+	if reasons := sink.reasons(); len(reasons) != 2 || reasons[0] != ReasonSourceNotAllowed || sink.entries[0].SourceIP != "192.168.1.1" {
+		t.Errorf("Expected both rejections audited with their source, got %+v", sink.entries)
+	}
+
+	req := callbackRequest(map[string]interface{}{"notify_id": "N1", "event": interfaces.EventPaymentSucceeded, "order_id": "ORDER_001"})
+	req.SourceIP = "10.1.2.3"
+	if resp, err := gw.Callback(ctx, req); err != nil || !resp.Processed {
+		t.Errorf("Expected a callback from an allowed source to be processed, got %+v, %v", resp, err)
+	}
+	if o, _ := gw.Orders().Get(ctx, order.KindCollect, "MERCHANT_001", "ORDER_001"); o.Status != order.StatusSucceeded {
+		t.Errorf("Expected the allowed callback to complete the order, got %s", o.Status)
+	}
+}
+
+func TestCallbackFreshness(t *testing.T) {
+	ctx := context.Background()
+	var calls atomic.Int32
+	sink := &recordingSink{}
+	gw := newTestGateway(t, callbackStub(&calls), WithCallbackPolicies(map[string]CallbackPolicy{"stub": {MaxAge: time.Hour}}), WithAuditSink(sink))
+	gw.CollectOrder(ctx, collectRequest("ORDER_001"))
+
+	callback := func(notifyID string, at time.Time) (*interfaces.CallbackResponse, error) {
+		data := map[string]interface{}{"notify_id": notifyID, "event": interfaces.EventPaymentSucceeded, "order_id": "ORDER_001"}
+		if !at.IsZero() {
+			data["occurred_at"] = at.Format(time.RFC3339)
+		}
+		return gw.Callback(ctx, callbackRequest(data))
+	}
+
+	now := time.Now()
+	for _, at := range []time.Time{now.Add(-2 * time.Hour), now.Add(time.Hour)} {
+		if _, err := callback("N1", at); ErrorCode(err) != CodeCallbackRejected {
+			t.Errorf("Expected an event dated %s to be rejected, got %v", at, err)
+		}
+	}
+	if o, _ := gw.Orders().Get(ctx, order.KindCollect, "MERCHANT_001", "ORDER_001"); o.Status != order.StatusPending {
+		t.Errorf("Expected rejected events to leave the order pending, got %s", o.Status)
+	}
+	if reasons := sink.reasons(); len(reasons) != 2 || reasons[0] != ReasonStale || reasons[1] != ReasonFuture {
+		t.Errorf("Expected stale and future rejections, got %v", reasons)
+	}
+
+	// A rejected callback is not remembered, so a fresh resend is processed
+	if resp, err := callback("N1", now.Add(-10*time.Minute)); err != nil || !resp.Processed || resp.Duplicate {
+		t.Errorf("Expected a fresh event to be processed, got %+v, %v", resp, err)
+	}
+	if resp, err := callback("N1", now.Add(-10*time.Minute)); err != nil || !resp.Duplicate {
+		t.Errorf("Expected the replay to be acknowledged as a duplicate, got %+v, %v", resp, err)
+	}
+	if reasons := sink.reasons(); len(reasons) != 3 || reasons[2] != ReasonProcessed || sink.entries[2].Action != ActionCallbackDuplicate {
+		t.Errorf("Expected the replay to be audited as a duplicate, got %v", reasons)
+	}
+
+	gw.CollectOrder(ctx, collectRequest("ORDER_002"))
+	undated := map[string]interface{}{"notify_id": "N2", "event": interfaces.EventPaymentSucceeded, "order_id": "ORDER_002"}
+	if resp, err := gw.Callback(ctx, callbackRequest(undated)); err != nil || !resp.Processed {
+		t.Errorf("Expected an undated event to be processed, got %+v, %v", resp, err)
+	}
+}
+
+func TestCallbackEndpointRejectsSource(t *testing.T) {
+	var calls atomic.Int32
+	sink := &recordingSink{}
+	policies := map[string]CallbackPolicy{"stub": {AllowedSources: []netip.Prefix{netip.MustParsePrefix("10.0.0.1/32")}}}
+	gw := newTestGateway(t, callbackStub(&calls), WithCallbackPolicies(policies), WithAuditSink(sink))
+
+	req := httptest.NewRequest(http.MethodPost, "/callback/stub", strings.NewReader(`{"notify_id":"N1"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = "203.0.113.9:4321"
+	recorder := httptest.NewRecorder()
+	gw.Handler().ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusForbidden || recorder.Body.String() != "fail" {
+		t.Errorf("Expected 403 fail, got %d %q", recorder.Code, recorder.Body.String())
+	}
+	if len(sink.entries) != 1 || sink.entries[0].SourceIP != "203.0.113.9" || !strings.HasPrefix(sink.entries[0].RequestID, "callback-") {
+		t.Errorf("Expected the rejection audited with the remote address, got %+v", sink.entries)
+	}
+}
+
+func TestCallbackPolicies(t *testing.T) {
+	policies, err := callbackPolicies([]config.Channel{{
+		ID:        "alipay",
+		Callbacks: config.CallbackPolicy{MaxAge: config.Duration(25 * time.Hour), AllowedIPs: []string{"110.75.0.0/16", "203.0.113.7", "::ffff:198.51.100.1"}},
+	}})
+	if err != nil {
+		t.Fatalf("callbackPolicies failed: %v", err)
+	}
+	policy := policies["alipay"]
+	if policy.MaxAge != 25*time.Hour {
+		t.Errorf("Expected max age 25h, got %s", policy.MaxAge)
+	}
+	for source, allowed := range map[string]bool{
+		"110.75.3.4":         true,
+		"203.0.113.7":        true,
+		"198.51.100.1":       true,
+		"::ffff:110.75.3.4":  true,
+		"203.0.113.8":        false,
+		"not an address":     false,
+		"2001:db8::1":        false,
+		"::ffff:203.0.113.8": false,
+	} {
+		if policy.allows(source) != allowed {
+			t.Errorf("Expected allows(%q) to be %v", source, allowed)
+		}
+	}
+
+	if _, err := callbackPolicies([]config.Channel{{ID: "alipay", Callbacks: config.CallbackPolicy{AllowedIPs: []string{"110.75.0.0/33"}}}}); err == nil {
+		t.Error("Expected an invalid range to be an error")
+	}
+}
@@ -0,0 +1,242 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"payment_go/pkg/fees"
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/money"
+	"payment_go/pkg/order"
+	"payment_go/pkg/routing"
+)
+
+// WithRouter enables routing: a call whose channel_id names one of the
+// router's routes is sent to the channel the router picks for it
+func WithRouter(router *routing.Router) Option {
+	return func(g *Gateway) {
+		g.router = router
+	}
+}
+
+// Router returns the gateway's router, or nil when routing is disabled
+func (g *Gateway) Router() *routing.Router {
+	return g.router
+}
+
+// route resolves calls addressing a route to a channel. It runs right after
+// validation, so every later middleware sees the chosen channel; the
+// caller's request keeps the route ID. An order submitted again goes to the
+// channel it was placed on, under the same upstream ID, rather than being
+// routed anew. It also feeds the router the outcome of every order placed.
+func (g *Gateway) route(next Handler) Handler {
+	return func(ctx context.Context, call *Call) (interface{}, error) {
+		if g.router == nil {
+			return next(ctx, call)
+		}
+		route, ok := g.router.Route(call.Base.ChannelID)
+		if !ok {
+			return g.place(ctx, call, next)
+		}
+		ownRequest(call)
+		placed, found, err := g.placedOrder(ctx, call)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			call.Base.ChannelID, call.UpstreamOrderID = placed.ChannelID, placed.UpstreamOrderID
+			call.Route = &routing.Decision{RouteID: firstNonEmpty(placed.Route, route.ID), ChannelID: placed.ChannelID, Reason: placed.RouteReason}
+			return g.place(ctx, call, next)
+		}
+		if req, ok := call.Request.(*interfaces.CollectOrderRequest); ok {
+			return g.placeCollection(ctx, call, route, req, next)
+		}
+		if err := g.resolveRoute(ctx, call, route); err != nil {
+			return nil, err
+		}
+		return g.place(ctx, call, next)
+	}
+}
+
+// placedOrder returns the order a call placing an order submits again, if
+// the gateway already tracks it
+func (g *Gateway) placedOrder(ctx context.Context, call *Call) (order.Order, bool, error) {
+	kind := order.KindCollect
+	switch call.Operation {
+	case OpCollectOrder:
+	case OpPayoutOrder:
+		kind = order.KindPayout
+	default:
+		return order.Order{}, false, nil
+	}
+	o, err := g.orders.Get(ctx, kind, call.Base.MerchantID, requestOrderID(call.Request))
+	if errors.Is(err, order.ErrNotFound) {
+		return order.Order{}, false, nil
+	}
+	return o, err == nil, err
+}
+
+// ownRequest gives call its own copy of the caller's request, so that
+// pointing it at a channel leaves the caller's channel_id alone
+func ownRequest(call *Call) {
+	switch req := call.Request.(type) {
+	case *interfaces.CollectOrderRequest:
+		own := *req
+		call.Request, call.Base = &own, &own.BaseRequest
+	case *interfaces.PayoutOrderRequest:
+		own := *req
+		call.Request, call.Base = &own, &own.BaseRequest
+	case *interfaces.CollectQueryRequest:
+		own := *req
+		call.Request, call.Base = &own, &own.BaseRequest
+	case *interfaces.PayoutQueryRequest:
+		own := *req
+		call.Request, call.Base = &own, &own.BaseRequest
+	}
+}
+
+// place runs a call, recording the outcome of placing an order for routing
+func (g *Gateway) place(ctx context.Context, call *Call, next Handler) (interface{}, error) {
+	if call.Operation != OpCollectOrder && call.Operation != OpPayoutOrder {
+		return next(ctx, call)
+	}
+	start := time.Now()
+	resp, err := next(ctx, call)
+	success := err == nil && responseBase(resp).Success
+	g.router.Stats().Record(call.Base.ChannelID, success, time.Since(start))
+	return resp, err
+}
+
+// placeCollection places a collection on the ranked channels of route in
+// turn. It moves on to the next channel only when one definitively did not
+// create the order and the route allows failover for the merchant; each
+// attempt has its own upstream order ID.
+func (g *Gateway) placeCollection(ctx context.Context, call *Call, route routing.Route, req *interfaces.CollectOrderRequest, next Handler) (interface{}, error) {
+	decisions, err := g.rank(call, route, req.Amount, req.Currency, req.PaymentMethod)
+	if err != nil {
+		return nil, err
+	}
+	attempts := route.FailoverFor(call.Base.MerchantID).Attempts(len(decisions))
+
+	for i := 0; ; i++ {
+		call.Route = &decisions[i]
+		call.Base.ChannelID = decisions[i].ChannelID
+		if i > 0 {
+			call.UpstreamOrderID = attemptOrderID(req.OrderID, i+1)
+		}
+		call.failover = i+1 < attempts
+
+		at := g.clock.Now()
+		resp, err := g.place(ctx, call, next)
+		reason, definitive := notCreated(resp, err)
+		if !definitive || !call.failover {
+			return resp, err
+		}
+
+		call.Attempts = append(call.Attempts, order.Attempt{
+			ChannelID:       call.Base.ChannelID,
+			UpstreamOrderID: attemptOrderID(req.OrderID, i+1),
+			At:              at,
+			Error:           reason,
+		})
+		g.logger.WarnContext(ctx, "order not created, failing over",
+			"route", route.ID,
+			"channel_id", call.Base.ChannelID,
+			"next_channel_id", decisions[i+1].ChannelID,
+			"merchant_id", call.Base.MerchantID,
+			"order_id", req.OrderID,
+			"reason", reason)
+	}
+}
+
+// resolveRoute points call at a channel of route. Payouts go to the best
+// ranked channel; queries go to the channel the order was placed on.
+func (g *Gateway) resolveRoute(ctx context.Context, call *Call, route routing.Route) error {
+	switch req := call.Request.(type) {
+	case *interfaces.PayoutOrderRequest:
+		decisions, err := g.rank(call, route, req.Amount, req.Currency, "")
+		if err != nil {
+			return err
+		}
+		call.Route = &decisions[0]
+		call.Base.ChannelID = decisions[0].ChannelID
+		return nil
+	case *interfaces.CollectQueryRequest:
+		return g.routedChannel(ctx, call, route, order.KindCollect, req.OrderID)
+	case *interfaces.PayoutQueryRequest:
+		return g.routedChannel(ctx, call, route, order.KindPayout, req.OrderID)
+	}
+	return newError(CodeInvalidRequest, "%s: route %s can only place and query orders", call.Operation, route.ID)
+}
+
+// rank orders the channels of route that can take an order, best first
+func (g *Gateway) rank(call *Call, route routing.Route, amount float64, currency, method string) ([]routing.Decision, error) {
+	minor, err := money.ToMinor(amount, currency)
+	if err != nil {
+		return nil, newError(CodeInvalidRequest, "%s: %v", call.Operation, err)
+	}
+	req := routing.Request{
+		Operation:     string(call.Operation),
+		MerchantID:    call.Base.MerchantID,
+		Currency:      currency,
+		Amount:        minor,
+		PaymentMethod: method,
+	}
+	decisions, err := g.router.Rank(route, req, g.candidates(route, req))
+	if err != nil {
+		return nil, newError(CodeNoRoute, "%s: %v", call.Operation, err)
+	}
+	return decisions, nil
+}
+
+// candidates gathers what the gateway knows about each channel of route
+func (g *Gateway) candidates(route routing.Route, req routing.Request) map[string]routing.Candidate {
+	now := g.clock.Now()
+	health := g.loader.Health()
+	candidates := make(map[string]routing.Candidate, len(route.Channels))
+	for _, target := range route.Channels {
+		info, err := g.loader.GetPluginInfo(target.ChannelID)
+		if err != nil {
+			candidates[target.ChannelID] = routing.Candidate{}
+			continue
+		}
+		record, probed := health[target.ChannelID]
+		candidate := routing.Candidate{
+			Loaded:       true,
+			Capabilities: info.Capabilities,
+			Ready:        !probed || record.Ready(),
+			Cost: g.fees.Quote(fees.Query{
+				ChannelID:  target.ChannelID,
+				MerchantID: req.MerchantID,
+				Operation:  req.Operation,
+				Currency:   req.Currency,
+				Amount:     req.Amount,
+				At:         now,
+			}).ChannelFee,
+		}
+		if err := g.loader.CheckOrder(target.ChannelID, req.Operation, req.PaymentMethod, req.Currency, req.Amount, now); err != nil {
+			candidate.Refusal = err.Error()
+		}
+		candidates[target.ChannelID] = candidate
+	}
+	return candidates
+}
+
+// routedChannel points a query through route at the channel the order was
+// placed on, under the order ID that channel knows
+func (g *Gateway) routedChannel(ctx context.Context, call *Call, route routing.Route, kind order.Kind, orderID string) error {
+	if orderID == "" {
+		return newError(CodeInvalidRequest, "%s: order_id is required to query through route %s", call.Operation, route.ID)
+	}
+	o, err := g.orders.Get(ctx, kind, call.Base.MerchantID, orderID)
+	if errors.Is(err, order.ErrNotFound) {
+		return newError(CodeInvalidRequest, "%s: order %s was not placed through route %s", call.Operation, orderID, route.ID)
+	}
+	if err != nil {
+		return err
+	}
+	call.Base.ChannelID = o.ChannelID
+	call.UpstreamOrderID = o.UpstreamOrderID
+	return nil
+}
@@ -0,0 +1,106 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"payment_go/pkg/fees"
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/order"
+	"payment_go/pkg/plugin"
+	"payment_go/pkg/routing"
+)
+
+// newRoutedGateway serves each stub on its channel under route, with
+// "cheap" costing less than "dear"
+func newRoutedGateway(t *testing.T, stubs map[string]*stubPlugin, route routing.Route, opts ...Option) *Gateway {
+	t.Helper()
+	loader := plugin.NewPluginLoader()
+	for channelID, stub := range stubs {
+		if err := loader.RegisterPlugin(channelID, stub); err != nil {
+			t.Fatalf("RegisterPlugin failed: %v", err)
+		}
+	}
+	router, err := routing.New([]routing.Route{route})
+	if err != nil {
+		t.Fatalf("routing.New failed: %v", err)
+	}
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	engine, err := fees.New([]fees.Rule{
+		{ID: "cheap", Version: 1, Side: fees.SideChannel, Selector: fees.Selector{ChannelID: "cheap"}, Formula: fees.Formula{Percent: 0.3}, EffectiveFrom: from},
+		{ID: "dear", Version: 1, Side: fees.SideChannel, Selector: fees.Selector{ChannelID: "dear"}, Formula: fees.Formula{Percent: 0.6}, EffectiveFrom: from},
+	})
+	if err != nil {
+		t.Fatalf("fees.New failed: %v", err)
+	}
+	return New(loader, append([]Option{WithRouter(router), WithFees(engine)}, opts...)...)
+}
+
+func TestRoutedCollectOrder(t *testing.T) {
+	ctx := context.Background()
+	queried := ""
+	cheap, dear := newStubPlugin(), newStubPlugin()
+	cheap.collectQuery = func(ctx context.Context, req *interfaces.CollectQueryRequest) (*interfaces.CollectQueryResponse, error) {
+		queried = req.ChannelID
+		return &interfaces.CollectQueryResponse{BaseResponse: interfaces.BaseResponse{Success: true}, OrderID: req.OrderID, Status: "pending"}, nil
+	}
+	g := newRoutedGateway(t, map[string]*stubPlugin{"cheap": cheap, "dear": dear}, routing.Route{
+		ID: "cny", Strategy: routing.StrategyCost,
+		Channels: []routing.Target{{ChannelID: "dear"}, {ChannelID: "cheap", MaxAmount: 50000}},
+	})
+
+	req := collectRequest("ORDER_1")
+	req.ChannelID = "cny"
+	if _, err := g.CollectOrder(ctx, req); err != nil {
+		t.Fatalf("CollectOrder failed: %v", err)
+	}
+	placed, err := g.Orders().Get(ctx, order.KindCollect, "MERCHANT_001", "ORDER_1")
+	if err != nil {
+		t.Fatalf("Expected order to be tracked: %v", err)
+	}
+	if placed.ChannelID != "cheap" || placed.Route != "cny" || placed.RouteReason != "cost: cost 30" || placed.ChannelFee != 30 {
+		t.Errorf("Expected order routed to the cheapest channel, got %+v", placed)
+	}
+	if snapshot := g.Router().Stats().Snapshot("cheap"); snapshot.Calls != 1 || snapshot.Successes != 1 {
+		t.Errorf("Expected the call to be recorded for routing, got %+v", snapshot)
+	}
+
+	query := &interfaces.CollectQueryRequest{
+		BaseRequest: interfaces.BaseRequest{MerchantID: "MERCHANT_001", ChannelID: "cny"},
+		OrderID:     "ORDER_1",
+	}
+	if _, err := g.CollectQuery(ctx, query); err != nil || queried != "cheap" {
+		t.Errorf("Expected query through the route to reach cheap, got %q and %v", queried, err)
+	}
+
+	large := collectRequest("ORDER_2")
+	large.ChannelID, large.Amount = "cny", 1000
+	if _, err := g.CollectOrder(ctx, large); err != nil {
+		t.Fatalf("CollectOrder failed: %v", err)
+	}
+	if placed, _ := g.Orders().Get(ctx, order.KindCollect, "MERCHANT_001", "ORDER_2"); placed.ChannelID != "dear" {
+		t.Errorf("Expected amount above cheap's limit to go to dear, got %s", placed.ChannelID)
+	}
+}
+
+func TestNoRoute(t *testing.T) {
+	stub := newStubPlugin()
+	stub.info.Capabilities = []string{"collect_query"}
+	g := newRoutedGateway(t, map[string]*stubPlugin{"cheap": stub}, routing.Route{
+		ID: "cny", Strategy: routing.StrategyCost,
+		Channels: []routing.Target{{ChannelID: "cheap"}, {ChannelID: "missing"}},
+	})
+
+	req := collectRequest("ORDER_1")
+	req.ChannelID = "cny"
+	_, err := g.CollectOrder(context.Background(), req)
+	if code := ErrorCode(err); code != CodeNoRoute {
+		t.Errorf("Expected %s when no channel can take the order, got %v", CodeNoRoute, err)
+	}
+
+	balance := &interfaces.BalanceInquiryRequest{BaseRequest: interfaces.BaseRequest{MerchantID: "MERCHANT_001", ChannelID: "cny"}}
+	if _, err := g.BalanceInquiry(context.Background(), balance); ErrorCode(err) != CodeInvalidRequest {
+		t.Errorf("Expected %s for a balance inquiry on a route, got %v", CodeInvalidRequest, err)
+	}
+}
@@ -0,0 +1,48 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/tracing"
+)
+
+// DownloadStatement fetches a channel's statement through its plugin. The
+// plugin counts as in use until the returned stream is closed.
+func (g *Gateway) DownloadStatement(ctx context.Context, channelID string, req *interfaces.StatementRequest) (interfaces.StatementStream, error) {
+	ctx, span := tracing.StartSpan(ctx, "gateway.download_statement", tracing.AttrChannelID.String(channelID))
+	defer span.End()
+
+	instance, release, err := g.loader.Acquire(channelID)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+	downloader, ok := instance.(interfaces.StatementDownloader)
+	if !ok {
+		release()
+		err := fmt.Errorf("channel %s does not support statement download", channelID)
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+
+	stream, err := downloader.DownloadStatement(ctx, req)
+	if err != nil {
+		release()
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+	return &releasingStream{StatementStream: stream, release: release}, nil
+}
+
+// releasingStream releases the plugin when the stream is closed
+type releasingStream struct {
+	interfaces.StatementStream
+	release func()
+}
+
+func (rs *releasingStream) Close() error {
+	defer rs.release()
+	return rs.StatementStream.Close()
+}
@@ -0,0 +1,57 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/reconcile"
+)
+
+// billingStub serves a fixed statement
+type billingStub struct {
+	*stubPlugin
+	lines []interfaces.StatementLine
+}
+
+func (bs *billingStub) DownloadStatement(ctx context.Context, req *interfaces.StatementRequest) (interfaces.StatementStream, error) {
+	return interfaces.NewStatementStream(bs.lines), nil
+}
+
+func TestDownloadStatement(t *testing.T) {
+	ctx := context.Background()
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	stub := &billingStub{stubPlugin: newStubPlugin(), lines: []interfaces.StatementLine{
+		{Type: interfaces.StatementCollect, OrderID: "ORDER_1", Amount: 100.50, Currency: "CNY", CompletedAt: day},
+	}}
+	g := newTestGateway(t, stub)
+
+	if _, err := g.CollectOrder(ctx, collectRequest("ORDER_1")); err != nil {
+		t.Fatalf("CollectOrder failed: %v", err)
+	}
+
+	stream, err := g.DownloadStatement(ctx, "stub", &interfaces.StatementRequest{Date: day})
+	if err != nil {
+		t.Fatalf("DownloadStatement failed: %v", err)
+	}
+	if inFlight := g.Loader().ListPlugins()["stub"].InFlight; inFlight != 1 {
+		t.Errorf("Expected the plugin to be in use while the stream is open, got %d calls", inFlight)
+	}
+
+	report, err := reconcile.New(g.Orders()).ReconcileStream(ctx, "stub", stream, reconcile.Period{})
+	if err != nil {
+		t.Fatalf("ReconcileStream failed: %v", err)
+	}
+	if inFlight := g.Loader().ListPlugins()["stub"].InFlight; inFlight != 0 {
+		t.Errorf("Expected closing the stream to release the plugin, got %d calls", inFlight)
+	}
+	if report.Summary()[reconcile.StatusMismatch] != 1 {
+		t.Errorf("Expected the pending order to mismatch the paid line, got %+v", report.Discrepancies)
+	}
+
+	plain := newTestGateway(t, newStubPlugin())
+	if _, err := plain.DownloadStatement(ctx, "stub", &interfaces.StatementRequest{Date: day}); err == nil {
+		t.Error("Expected error when the plugin cannot download statements")
+	}
+}
@@ -0,0 +1,49 @@
+package host
+
+import (
+	"sync"
+	"time"
+)
+
+// SystemClock reads the wall clock
+type SystemClock struct{}
+
+// Now implements interfaces.Clock
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ManualClock is a clock that only moves when told to, for tests
+type ManualClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+// NewManualClock creates a manual clock set to start
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{now: start}
+}
+
+// Now implements interfaces.Clock
+func (mc *ManualClock) Now() time.Time {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	return mc.now
+}
+
+// Advance moves the clock forward by d
+func (mc *ManualClock) Advance(d time.Duration) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	mc.now = mc.now.Add(d)
+}
+
+// Set moves the clock to t
+func (mc *ManualClock) Set(t time.Time) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	mc.now = t
+}
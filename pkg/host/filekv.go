@@ -0,0 +1,239 @@
+package host
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"payment_go/pkg/interfaces"
+)
+
+// fileKVCompactLines is the fewest journal lines worth compacting while the
+// store is open
+const fileKVCompactLines = 1024
+
+// FileKV is a durable interfaces.KVStore that appends every Set and Delete
+// as one JSON line to a file and syncs it before returning. Entries are
+// read back into memory when the store is opened, and the file is
+// rewritten without expired and overwritten ones when it holds more than
+// twice as many lines as live entries.
+type FileKV struct {
+	mutex  sync.Mutex
+	path   string
+	file   *os.File
+	lines  int
+	memory *MemoryKV
+}
+
+// kvRecord is one journal line; a zero ExpiresAt never expires
+type kvRecord struct {
+	Key       string    `json:"key"`
+	Value     []byte    `json:"value,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	Deleted   bool      `json:"deleted,omitempty"`
+}
+
+// OpenFileKV opens or creates the journal file at path; clock decides when
+// entries expire. A final line without its newline is the remains of a
+// write interrupted by a crash; it was never acknowledged, so it is dropped.
+func OpenFileKV(path string, clock interfaces.Clock) (*FileKV, error) {
+	file, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to open key-value store %s: %w", path, err)
+	}
+
+	kv := &FileKV{path: path, memory: NewMemoryKV(clock)}
+	if file != nil {
+		err = kv.load(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("key-value store %s: %w", path, err)
+		}
+	}
+	if err := kv.compact(); err != nil {
+		return nil, fmt.Errorf("key-value store %s: %w", path, err)
+	}
+	return kv, nil
+}
+
+// load reads complete lines into memory
+func (kv *FileKV) load(r io.Reader) error {
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var record kvRecord
+		if err := json.Unmarshal(bytes.TrimSpace(data), &record); err != nil {
+			return fmt.Errorf("line %d is corrupted: %w", line, err)
+		}
+		if record.Deleted {
+			delete(kv.memory.entries, record.Key)
+			continue
+		}
+		kv.memory.entries[record.Key] = kvEntry{value: record.Value, expiresAt: record.ExpiresAt}
+	}
+}
+
+// Get implements interfaces.KVStore
+func (kv *FileKV) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return kv.memory.Get(ctx, key)
+}
+
+// Set implements interfaces.KVStore
+func (kv *FileKV) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	kv.mutex.Lock()
+	defer kv.mutex.Unlock()
+
+	record := kvRecord{Key: key, Value: value}
+	if ttl > 0 {
+		record.ExpiresAt = kv.memory.clock.Now().Add(ttl)
+	}
+	if err := kv.write(record); err != nil {
+		return err
+	}
+	kv.memory.mutex.Lock()
+	kv.memory.entries[key] = kvEntry{value: append([]byte(nil), value...), expiresAt: record.ExpiresAt}
+	kv.memory.mutex.Unlock()
+	kv.maybeCompact()
+	return nil
+}
+
+// Delete implements interfaces.KVStore
+func (kv *FileKV) Delete(ctx context.Context, key string) error {
+	kv.mutex.Lock()
+	defer kv.mutex.Unlock()
+
+	if _, exists, _ := kv.memory.Get(ctx, key); !exists {
+		return nil
+	}
+	if err := kv.write(kvRecord{Key: key, Deleted: true}); err != nil {
+		return err
+	}
+	if err := kv.memory.Delete(ctx, key); err != nil {
+		return err
+	}
+	kv.maybeCompact()
+	return nil
+}
+
+// List implements interfaces.KVStore
+func (kv *FileKV) List(ctx context.Context, prefix string) ([]string, error) {
+	return kv.memory.List(ctx, prefix)
+}
+
+// Close closes the journal file
+func (kv *FileKV) Close() error {
+	kv.mutex.Lock()
+	defer kv.mutex.Unlock()
+
+	return kv.file.Close()
+}
+
+func (kv *FileKV) write(record kvRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	offset, err := kv.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to write key %s: %w", record.Key, err)
+	}
+	if _, err := kv.file.Write(append(data, '\n')); err != nil {
+		return errors.Join(fmt.Errorf("failed to write key %s: %w", record.Key, err), kv.truncate(offset))
+	}
+	if err := kv.file.Sync(); err != nil {
+		return errors.Join(fmt.Errorf("failed to sync key %s: %w", record.Key, err), kv.truncate(offset))
+	}
+	kv.lines++
+	return nil
+}
+
+// truncate drops a partly written line after offset, so the next record
+// does not land after it and corrupt the journal
+func (kv *FileKV) truncate(offset int64) error {
+	if err := kv.file.Truncate(offset); err != nil {
+		return fmt.Errorf("failed to truncate key-value store: %w", err)
+	}
+	if _, err := kv.file.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to truncate key-value store: %w", err)
+	}
+	return nil
+}
+
+// maybeCompact compacts the journal once it is mostly dead lines. A failed
+// compaction leaves the journal as it was, to be tried on a later write.
+func (kv *FileKV) maybeCompact() {
+	if kv.lines < fileKVCompactLines {
+		return
+	}
+	// List drops expired entries
+	_, _ = kv.memory.List(context.Background(), "")
+	kv.memory.mutex.RLock()
+	live := len(kv.memory.entries)
+	kv.memory.mutex.RUnlock()
+	if kv.lines > 2*live {
+		_ = kv.compact()
+	}
+}
+
+// compact replaces the journal with one line per live entry. The new
+// journal is written beside the old one and renamed over it, so a crash
+// leaves one or the other.
+func (kv *FileKV) compact() error {
+	kv.memory.mutex.RLock()
+	records := make([]kvRecord, 0, len(kv.memory.entries))
+	for key, entry := range kv.memory.entries {
+		if !kv.memory.expired(entry) {
+			records = append(records, kvRecord{Key: key, Value: entry.value, ExpiresAt: entry.expiresAt})
+		}
+	}
+	kv.memory.mutex.RUnlock()
+
+	tmp, err := os.OpenFile(kv.path+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to compact key-value store: %w", err)
+	}
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for _, record := range records {
+		if err = encoder.Encode(record); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), kv.path)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to compact key-value store: %w", err)
+	}
+
+	if kv.file != nil {
+		kv.file.Close()
+	}
+	kv.file, kv.lines = tmp, len(records)
+	if _, err := tmp.Seek(0, io.SeekEnd); err != nil {
+		return fmt.Errorf("failed to compact key-value store: %w", err)
+	}
+	return nil
+}
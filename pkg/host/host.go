@@ -0,0 +1,88 @@
+package host
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"payment_go/pkg/interfaces"
+)
+
+// ErrNoSecrets is returned by the default secrets accessor
+var ErrNoSecrets = errors.New("no secrets provider configured")
+
+// DefaultHTTPTimeout bounds upstream calls made through the host client
+const DefaultHTTPTimeout = 30 * time.Second
+
+// Config describes the services a Host hands out
+type Config struct {
+	Clock   interfaces.Clock
+	KV      interfaces.KVStore
+	Secrets interfaces.SecretsAccessor
+	// Egress applies to channels without an entry in ChannelEgress
+	Egress        EgressPolicy
+	ChannelEgress map[string]EgressPolicy
+	HTTPTimeout   time.Duration
+}
+
+// Host builds per-channel HostServices from shared infrastructure
+type Host struct {
+	config Config
+}
+
+// New creates a host, filling unset services with in-process defaults
+func New(config Config) *Host {
+	if config.Clock == nil {
+		config.Clock = SystemClock{}
+	}
+	if config.KV == nil {
+		config.KV = NewMemoryKV(config.Clock)
+	}
+	if config.Secrets == nil {
+		config.Secrets = noSecrets{}
+	}
+	if config.HTTPTimeout <= 0 {
+		config.HTTPTimeout = DefaultHTTPTimeout
+	}
+	return &Host{config: config}
+}
+
+// ForChannel returns the services for the plugin serving channelID.
+// The logger is scoped by the caller and passed through unchanged.
+func (h *Host) ForChannel(channelID string, logger *slog.Logger) interfaces.HostServices {
+	policy, ok := h.config.ChannelEgress[channelID]
+	if !ok {
+		policy = h.config.Egress
+	}
+	return interfaces.HostServices{
+		Logger:     logger,
+		HTTPClient: NewHTTPClient(policy, h.config.HTTPTimeout),
+		Clock:      h.config.Clock,
+		KV:         Namespace(h.config.KV, "channel/"+channelID),
+		Secrets:    h.config.Secrets,
+	}
+}
+
+// Secrets returns the host's secrets accessor
+func (h *Host) Secrets() interfaces.SecretsAccessor {
+	return h.config.Secrets
+}
+
+// Defaults returns standalone services for plugins initialized without a host
+func Defaults() interfaces.HostServices {
+	clock := SystemClock{}
+	return interfaces.HostServices{
+		Logger:     slog.Default(),
+		HTTPClient: NewHTTPClient(EgressPolicy{}, DefaultHTTPTimeout),
+		Clock:      clock,
+		KV:         NewMemoryKV(clock),
+		Secrets:    noSecrets{},
+	}
+}
+
+type noSecrets struct{}
+
+func (noSecrets) GetSecret(ctx context.Context, name string) (string, error) {
+	return "", ErrNoSecrets
+}
@@ -0,0 +1,158 @@
+package host
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryKVExpiry(t *testing.T) {
+	ctx := context.Background()
+	clock := NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	kv := NewMemoryKV(clock)
+
+	if err := kv.Set(ctx, "session", []byte("abc"), time.Minute); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := kv.Set(ctx, "permanent", []byte("xyz"), 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	if value, ok, _ := kv.Get(ctx, "session"); !ok || string(value) != "abc" {
+		t.Errorf("expected session value before expiry, got %q %v", value, ok)
+	}
+
+	clock.Advance(time.Minute)
+	if _, ok, _ := kv.Get(ctx, "session"); ok {
+		t.Error("session value should expire after its ttl")
+	}
+	if _, ok, _ := kv.Get(ctx, "permanent"); !ok {
+		t.Error("values without ttl should not expire")
+	}
+
+	keys, _ := kv.List(ctx, "")
+	if len(keys) != 1 || keys[0] != "permanent" {
+		t.Errorf("expired keys should not be listed, got %v", keys)
+	}
+}
+
+func TestNamespaceIsolation(t *testing.T) {
+	ctx := context.Background()
+	shared := NewMemoryKV(nil)
+	alipay := Namespace(shared, "channel/alipay")
+	mock := Namespace(shared, "channel/mock")
+
+	_ = alipay.Set(ctx, "orders/1", []byte("alipay"), 0)
+	_ = mock.Set(ctx, "orders/1", []byte("mock"), 0)
+
+	if value, _, _ := alipay.Get(ctx, "orders/1"); string(value) != "alipay" {
+		t.Errorf("namespaces should not share keys, got %q", value)
+	}
+
+	keys, _ := mock.List(ctx, "orders/")
+	if len(keys) != 1 || keys[0] != "orders/1" {
+		t.Errorf("List should return keys relative to the namespace, got %v", keys)
+	}
+}
+
+func TestEgressPolicy(t *testing.T) {
+	policy := EgressPolicy{AllowedHosts: []string{"openapi.alipay.com", "*.alipaydev.com"}}
+
+	testCases := map[string]bool{
+		"openapi.alipay.com":            true,
+		"OPENAPI.ALIPAY.COM":            true,
+		"openapi-sandbox.alipaydev.com": true,
+		"evil.com":                      false,
+		"alipay.com":                    false,
+	}
+	for hostname, expected := range testCases {
+		if got := policy.Allows(hostname); got != expected {
+			t.Errorf("Allows(%q) = %v, expected %v", hostname, got, expected)
+		}
+	}
+
+	if !(EgressPolicy{}).Allows("anything.example") {
+		t.Error("an empty policy should allow every host")
+	}
+}
+
+func TestForChannelHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	h := New(Config{
+		Egress:        EgressPolicy{AllowedHosts: []string{"127.0.0.1"}},
+		ChannelEgress: map[string]EgressPolicy{"locked": {AllowedHosts: []string{"openapi.alipay.com"}}},
+	})
+
+	open := h.ForChannel("open", slog.Default())
+	resp, err := open.HTTPClient.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request within policy failed: %v", err)
+	}
+	resp.Body.Close()
+
+	locked := h.ForChannel("locked", slog.Default())
+	if _, err := locked.HTTPClient.Get(server.URL); !errors.Is(err, ErrEgressDenied) {
+		t.Errorf("expected egress denial, got %v", err)
+	}
+
+	if _, err := open.Secrets.GetSecret(context.Background(), "private_key"); !errors.Is(err, ErrNoSecrets) {
+		t.Errorf("expected ErrNoSecrets from default accessor, got %v", err)
+	}
+}
+
+func TestFileKVReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "kv.jsonl")
+	clock := NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	kv, err := OpenFileKV(path, clock)
+	if err != nil {
+		t.Fatalf("OpenFileKV failed: %v", err)
+	}
+	_ = kv.Set(ctx, "session", []byte("abc"), time.Minute)
+	_ = kv.Set(ctx, "permanent", []byte("xyz"), 0)
+	_ = kv.Set(ctx, "removed", []byte("gone"), 0)
+	_ = kv.Delete(ctx, "removed")
+	kv.Close()
+
+	// A write interrupted by a crash leaves a line without its newline
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	file.WriteString(`{"key":"torn"`)
+	file.Close()
+
+	kv, err = OpenFileKV(path, clock)
+	if err != nil {
+		t.Fatalf("reopening failed: %v", err)
+	}
+	if value, ok, _ := kv.Get(ctx, "session"); !ok || string(value) != "abc" {
+		t.Errorf("expected session value to survive a restart, got %q %v", value, ok)
+	}
+	if keys, _ := kv.List(ctx, ""); len(keys) != 2 || keys[0] != "permanent" || keys[1] != "session" {
+		t.Errorf("expected deleted and torn keys to be dropped, got %v", keys)
+	}
+
+	clock.Advance(time.Minute)
+	kv.Close()
+	kv, err = OpenFileKV(path, clock)
+	if err != nil {
+		t.Fatalf("reopening failed: %v", err)
+	}
+	defer kv.Close()
+	if _, ok, _ := kv.Get(ctx, "session"); ok {
+		t.Error("session value should expire after its ttl across restarts")
+	}
+	data, _ := os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines != 1 {
+		t.Errorf("expected the journal to be compacted to 1 line, got %d", lines)
+	}
+}
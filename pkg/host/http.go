@@ -0,0 +1,64 @@
+package host
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"payment_go/pkg/tracing"
+)
+
+// ErrEgressDenied is returned when a plugin calls a host outside its egress policy
+var ErrEgressDenied = errors.New("egress denied")
+
+// EgressPolicy restricts which upstream hosts a plugin may call
+type EgressPolicy struct {
+	// AllowedHosts lists host names the plugin may reach. A leading "*."
+	// matches any subdomain. An empty list allows every host.
+	AllowedHosts []string `json:"allowed_hosts,omitempty"`
+}
+
+// Allows reports whether the policy permits requests to hostname
+func (p EgressPolicy) Allows(hostname string) bool {
+	if len(p.AllowedHosts) == 0 {
+		return true
+	}
+	hostname = strings.ToLower(hostname)
+	for _, allowed := range p.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if strings.HasPrefix(allowed, "*.") {
+			if strings.HasSuffix(hostname, allowed[1:]) {
+				return true
+			}
+		} else if hostname == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// egressTransport rejects requests to hosts outside the policy before they leave the process
+type egressTransport struct {
+	policy EgressPolicy
+	base   http.RoundTripper
+}
+
+func (t *egressTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.policy.Allows(req.URL.Hostname()) {
+		return nil, fmt.Errorf("%w: %s is not an allowed host", ErrEgressDenied, req.URL.Hostname())
+	}
+	return t.base.RoundTrip(req)
+}
+
+// NewHTTPClient returns a traced client that enforces policy
+func NewHTTPClient(policy EgressPolicy, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &egressTransport{
+			policy: policy,
+			base:   &tracing.Transport{Base: http.DefaultTransport},
+		},
+	}
+}
@@ -0,0 +1,125 @@
+package host
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"payment_go/pkg/interfaces"
+)
+
+// MemoryKV is an in-process interfaces.KVStore
+type MemoryKV struct {
+	mutex   sync.RWMutex
+	clock   interfaces.Clock
+	entries map[string]kvEntry
+}
+
+type kvEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewMemoryKV creates an empty store; clock decides when entries expire
+func NewMemoryKV(clock interfaces.Clock) *MemoryKV {
+	if clock == nil {
+		clock = SystemClock{}
+	}
+	return &MemoryKV{
+		clock:   clock,
+		entries: make(map[string]kvEntry),
+	}
+}
+
+// Get implements interfaces.KVStore
+func (kv *MemoryKV) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	kv.mutex.RLock()
+	defer kv.mutex.RUnlock()
+
+	entry, exists := kv.entries[key]
+	if !exists || kv.expired(entry) {
+		return nil, false, nil
+	}
+	return append([]byte(nil), entry.value...), true, nil
+}
+
+// Set implements interfaces.KVStore
+func (kv *MemoryKV) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	kv.mutex.Lock()
+	defer kv.mutex.Unlock()
+
+	entry := kvEntry{value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		entry.expiresAt = kv.clock.Now().Add(ttl)
+	}
+	kv.entries[key] = entry
+	return nil
+}
+
+// Delete implements interfaces.KVStore
+func (kv *MemoryKV) Delete(ctx context.Context, key string) error {
+	kv.mutex.Lock()
+	defer kv.mutex.Unlock()
+
+	delete(kv.entries, key)
+	return nil
+}
+
+// List implements interfaces.KVStore
+func (kv *MemoryKV) List(ctx context.Context, prefix string) ([]string, error) {
+	kv.mutex.Lock()
+	defer kv.mutex.Unlock()
+
+	var keys []string
+	for key, entry := range kv.entries {
+		if kv.expired(entry) {
+			delete(kv.entries, key)
+			continue
+		}
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (kv *MemoryKV) expired(entry kvEntry) bool {
+	return !entry.expiresAt.IsZero() && !kv.clock.Now().Before(entry.expiresAt)
+}
+
+// namespacedKV prefixes every key so plugins sharing a store cannot see each other's data
+type namespacedKV struct {
+	store  interfaces.KVStore
+	prefix string
+}
+
+// Namespace returns a view of store restricted to keys under namespace
+func Namespace(store interfaces.KVStore, namespace string) interfaces.KVStore {
+	return &namespacedKV{store: store, prefix: namespace + "/"}
+}
+
+func (n *namespacedKV) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return n.store.Get(ctx, n.prefix+key)
+}
+
+func (n *namespacedKV) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return n.store.Set(ctx, n.prefix+key, value, ttl)
+}
+
+func (n *namespacedKV) Delete(ctx context.Context, key string) error {
+	return n.store.Delete(ctx, n.prefix+key)
+}
+
+func (n *namespacedKV) List(ctx context.Context, prefix string) ([]string, error) {
+	keys, err := n.store.List(ctx, n.prefix+prefix)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, n.prefix)
+	}
+	return keys, nil
+}
@@ -0,0 +1,66 @@
+package interfaces
+
+import "time"
+
+// Callback event types. Plugins translate each upstream notification into
+// one of them, so the gateway acts on callbacks without knowing channels.
+const (
+	// EventPaymentSucceeded is a collection the payer paid
+	EventPaymentSucceeded = "payment.succeeded"
+	// EventPaymentClosed is a collection closed unpaid, by the merchant or
+	// because it expired
+	EventPaymentClosed = "payment.closed"
+	// EventPayoutCompleted is a payout the recipient was paid
+	EventPayoutCompleted = "payout.completed"
+	// EventPayoutFailed is a payout the channel could not make
+	EventPayoutFailed = "payout.failed"
+	// EventPayoutReturned is a completed payout the recipient's bank sent back
+	EventPayoutReturned = "payout.returned"
+	// EventRefundSucceeded is a paid collection refunded to the payer
+	EventRefundSucceeded = "refund.succeeded"
+)
+
+// CallbackEvents lists every callback event type, in the order above
+var CallbackEvents = []string{
+	EventPaymentSucceeded,
+	EventPaymentClosed,
+	EventPayoutCompleted,
+	EventPayoutFailed,
+	EventPayoutReturned,
+	EventRefundSucceeded,
+}
+
+// KnownCallbackEvent reports whether eventType is one of CallbackEvents
+func KnownCallbackEvent(eventType string) bool {
+	for _, known := range CallbackEvents {
+		if eventType == known {
+			return true
+		}
+	}
+	return false
+}
+
+// CallbackEvent is what an upstream notification says happened to an order
+type CallbackEvent struct {
+	Type string `json:"type"`
+	// ID is the upstream's ID for the notification, if it has one
+	ID string `json:"id,omitempty"`
+	// OrderID is the order ID the channel was given, ChannelOrderID the
+	// channel's own
+	OrderID        string `json:"order_id"`
+	ChannelOrderID string `json:"channel_order_id,omitempty"`
+	// RefundID is the merchant's refund request, for refund events
+	RefundID string `json:"refund_id,omitempty"`
+	// Amount is the amount paid, paid out or refunded, in major units
+	Amount   float64 `json:"amount,omitempty"`
+	Currency string  `json:"currency,omitempty"`
+	// RefundedTotal is, for refund events from upstreams that report how
+	// much of the order has been refunded so far instead of this refund's
+	// amount, that total in major units; the gateway refunds the part of it
+	// not yet recorded on the order. Amount is then left zero.
+	RefundedTotal float64 `json:"refunded_total,omitempty"`
+	// OccurredAt is when the upstream says it happened, if it says
+	OccurredAt time.Time `json:"occurred_at,omitempty"`
+	// Raw is the notification as the upstream sent it
+	Raw map[string]interface{} `json:"raw,omitempty"`
+}
@@ -0,0 +1,10 @@
+package interfaces
+
+import "errors"
+
+// ErrOrderNotCreated is wrapped by plugins returning an error from
+// CollectOrder or PayoutOrder when they know the upstream did not create the
+// order, e.g. because the request was refused before it was sent. The
+// gateway may then place the order on another channel; any other error
+// leaves the outcome unknown.
+var ErrOrderNotCreated = errors.New("order was not created upstream")
@@ -0,0 +1,51 @@
+package interfaces
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Clock abstracts the current time so plugins can be tested deterministically
+type Clock interface {
+	Now() time.Time
+}
+
+// KVStore is a key-value store provided by the host. Each plugin receives a
+// store namespaced to its channel, so keys never collide between plugins.
+type KVStore interface {
+	// Get returns the value for key and whether it exists
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value under key; a zero ttl means the value never expires
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes key; deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+	// List returns the keys starting with prefix in lexical order
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// SecretsAccessor resolves named secrets such as API keys and private keys
+type SecretsAccessor interface {
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+// HostServices bundles the facilities the host offers to a plugin
+type HostServices struct {
+	// Logger is a redacting logger scoped to the plugin's channel
+	Logger *slog.Logger
+	// HTTPClient is traced and restricted to the channel's allowed egress hosts
+	HTTPClient *http.Client
+	// Clock should be used instead of time.Now
+	Clock Clock
+	// KV is a key-value store namespaced to the plugin's channel
+	KV KVStore
+	// Secrets resolves credentials without placing them in the config map
+	Secrets SecretsAccessor
+}
+
+// HostAware is implemented by plugins that want host services. When a plugin
+// implements it, the loader calls InitializeWithHost instead of Initialize.
+type HostAware interface {
+	InitializeWithHost(config map[string]interface{}, host HostServices) error
+}
@@ -0,0 +1,41 @@
+package interfaces
+
+// OperatingLimits declare which orders a channel can take and when. The
+// loader validates them when the plugin is loaded, and the gateway rejects,
+// or routes elsewhere, orders outside them before calling the plugin.
+type OperatingLimits struct {
+	// Currencies the channel accepts; empty accepts any
+	Currencies []string `json:"currencies,omitempty"`
+	// Limits bound order amounts per operation
+	Limits []AmountLimit `json:"limits,omitempty"`
+	// PaymentMethods the channel supports, e.g. "qr_code" or "wap"
+	PaymentMethods []string `json:"payment_methods,omitempty"`
+	// Timezone is the IANA zone MaintenanceWindows and PayoutCutoff are
+	// given in, default UTC
+	Timezone string `json:"timezone,omitempty"`
+	// MaintenanceWindows are daily periods the channel takes no orders
+	MaintenanceWindows []DailyWindow `json:"maintenance_windows,omitempty"`
+	// PayoutCutoff is the time of day, "15:04", after which the channel
+	// takes no more payouts until midnight
+	PayoutCutoff string `json:"payout_cutoff,omitempty"`
+}
+
+// AmountLimit bounds the amount of one operation, like the request's
+// amount in major units. The gateway checks it in the currency's minor
+// units, so bounds must not have more decimal places than the currency
+// allows. Zero leaves a bound open.
+type AmountLimit struct {
+	// Operation is a capability such as "collect_order"
+	Operation string `json:"operation"`
+	// Currency limits the bound to one currency; empty applies to all
+	Currency string  `json:"currency,omitempty"`
+	Min      float64 `json:"min,omitempty"`
+	Max      float64 `json:"max,omitempty"`
+}
+
+// DailyWindow is a period of every day from Start up to End, both "15:04".
+// A window ending before it starts runs past midnight.
+type DailyWindow struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
@@ -0,0 +1,62 @@
+package interfaces
+
+import "time"
+
+// Payment methods a collection can ask for. They say how the payer pays,
+// which decides the kind of PaymentAction the channel returns.
+const (
+	// PaymentMethodQRCode is a QR code the payer scans with the wallet app
+	PaymentMethodQRCode = "qr_code"
+	// PaymentMethodWAP is a mobile browser (H5) page the payer is sent to
+	PaymentMethodWAP = "wap"
+	// PaymentMethodWeb is a desktop web cashier the payer is sent to
+	PaymentMethodWeb = "web"
+	// PaymentMethodApp is an order string the merchant's app hands the
+	// wallet SDK
+	PaymentMethodApp = "app"
+	// PaymentMethodMiniProgram is a payment inside the wallet's mini-program
+	PaymentMethodMiniProgram = "mini_program"
+)
+
+// PaymentMethods lists every payment method, in the order above
+var PaymentMethods = []string{
+	PaymentMethodQRCode,
+	PaymentMethodWAP,
+	PaymentMethodWeb,
+	PaymentMethodApp,
+	PaymentMethodMiniProgram,
+}
+
+// KnownPaymentMethod reports whether method is one of PaymentMethods
+func KnownPaymentMethod(method string) bool {
+	for _, known := range PaymentMethods {
+		if method == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Payment action types
+const (
+	// ActionRedirect sends the payer's browser to URL
+	ActionRedirect = "redirect"
+	// ActionForm renders HTML, a form that submits itself
+	ActionForm = "form"
+	// ActionQRCode shows QRContent as a QR code
+	ActionQRCode = "qr_code"
+	// ActionSDK passes SDKPayload to the wallet's app or mini-program SDK
+	ActionSDK = "sdk"
+)
+
+// PaymentAction tells the merchant what to do with the payer to complete
+// a collection. Type says which of the other fields is set.
+type PaymentAction struct {
+	Type       string `json:"type"`
+	URL        string `json:"url,omitempty"`
+	HTML       string `json:"html,omitempty"`
+	QRContent  string `json:"qr_content,omitempty"`
+	SDKPayload string `json:"sdk_payload,omitempty"`
+	// ExpiresAt is when the action stops working, if the channel says
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
@@ -2,6 +2,7 @@ package interfaces
 
 import (
 	"context"
+	"log/slog"
 	"time"
 )
 
@@ -26,6 +27,9 @@ type PaymentChannel interface {
 	BalanceInquiry(ctx context.Context, req *BalanceInquiryRequest) (*BalanceInquiryResponse, error)
 	
 	// Callback processes incoming messages from upstream providers (消息回调)
+	// and reports what they say happened as a CallbackEvent. The gateway
+	// screens the event for replays and applies it, so Callback should not
+	// act on it itself.
 	Callback(ctx context.Context, req *CallbackRequest) (*CallbackResponse, error)
 }
 
@@ -57,6 +61,9 @@ type CollectOrderRequest struct {
 	ReturnURL    string  `json:"return_url"`
 	NotifyURL    string  `json:"notify_url"`
 	CustomerInfo *CustomerInfo `json:"customer_info,omitempty"`
+	// PaymentMethod is how the payer pays, one of PaymentMethods; empty
+	// leaves it to the channel
+	PaymentMethod string `json:"payment_method,omitempty"`
 }
 
 type CollectOrderResponse struct {
@@ -68,6 +75,15 @@ type CollectOrderResponse struct {
 	PaymentURL   string  `json:"payment_url,omitempty"`
 	QRCode       string  `json:"qr_code,omitempty"`
 	Status       string  `json:"status"`
+	// Action is what the payer must do next for the requested payment method
+	Action       *PaymentAction `json:"action,omitempty"`
+	// CashierURL is the gateway-hosted payment page for the order, set
+	// by the gateway when its cashier is enabled
+	CashierURL   string `json:"cashier_url,omitempty"`
+	// NotCreated is set with Success false when the channel certainly did
+	// not create the order, e.g. it refused the request; other failures
+	// leave the outcome unknown until the order is queried
+	NotCreated   bool   `json:"not_created,omitempty"`
 }
 
 // Payout Order (代付下单)
@@ -88,6 +104,8 @@ type PayoutOrderResponse struct {
 	Amount       float64 `json:"amount"`
 	Currency     string  `json:"currency"`
 	Status       string  `json:"status"`
+	// NotCreated is as for CollectOrderResponse
+	NotCreated   bool    `json:"not_created,omitempty"`
 }
 
 // Query Requests
@@ -143,12 +161,23 @@ type CallbackRequest struct {
 	CallbackType string            `json:"callback_type"`
 	CallbackData map[string]interface{} `json:"callback_data"`
 	Signature    string            `json:"signature"`
+	// SourceIP is the address the notification came from, set by the
+	// gateway's callback endpoint
+	SourceIP     string            `json:"source_ip,omitempty"`
 }
 
 type CallbackResponse struct {
 	BaseResponse
 	Processed    bool   `json:"processed"`
 	Message      string `json:"message"`
+	// Event is what the notification says happened, or nil when it says
+	// nothing the gateway acts on
+	Event        *CallbackEvent `json:"event,omitempty"`
+	// Ack is the body the upstream expects in reply, e.g. "success"
+	Ack          string `json:"ack,omitempty"`
+	// Duplicate is set by the gateway when it acknowledged a callback it
+	// had already processed without passing it to the plugin again
+	Duplicate    bool   `json:"duplicate,omitempty"`
 }
 
 // Supporting structures
@@ -177,6 +206,8 @@ type PluginInfo struct {
 	ChannelType string            `json:"channel_type"`
 	Capabilities []string         `json:"capabilities"`
 	ConfigSchema map[string]interface{} `json:"config_schema"`
+	// Operating limits, all optional; see OperatingLimits
+	OperatingLimits
 }
 
 // Plugin interface for metadata
@@ -186,3 +217,35 @@ type Plugin interface {
 	Initialize(config map[string]interface{}) error
 	ValidateConfig(config map[string]interface{}) error
 }
+
+// LoggerAware is implemented by plugins that accept a host-provided logger.
+// The loader injects a redacting logger scoped to the plugin's channel, so
+// plugins can log requests without leaking customer or recipient details.
+type LoggerAware interface {
+	SetLogger(logger *slog.Logger)
+}
+
+// Reconfigurable is implemented by plugins that can apply a new config while
+// serving traffic. The loader validates config before calling Reconfigure.
+// Calls already in flight must complete with the old config, so plugins
+// should build the new state fully and then swap it in atomically. On error
+// the plugin must keep using its previous config.
+// Plugins without Reconfigure are replaced by a freshly initialized instance.
+type Reconfigurable interface {
+	Reconfigure(config map[string]interface{}) error
+}
+
+// Shutdowner is implemented by plugins that hold resources such as upstream
+// connections or buffered state. The loader calls Shutdown once the plugin no
+// longer receives calls and its in-flight calls have finished, or ctx's
+// deadline has passed. Shutdown should flush what it can before ctx is done.
+type Shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// HealthProber is implemented by plugins that can check their upstream
+// cheaply, e.g. with a ping or a balance inquiry. The loader calls Probe
+// periodically with a timeout; a nil error means the channel can serve calls.
+type HealthProber interface {
+	Probe(ctx context.Context) error
+}
@@ -0,0 +1,82 @@
+package interfaces
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Statement line types
+const (
+	StatementCollect = "collect"
+	StatementPayout  = "payout"
+	StatementRefund  = "refund"
+)
+
+// StatementLine is one transaction from an upstream statement (bill file),
+// normalized so statements from every channel can be reconciled alike
+type StatementLine struct {
+	// Type is StatementCollect, StatementPayout or StatementRefund
+	Type string `json:"type"`
+	// OrderID is the merchant order ID passed to the channel, if the
+	// statement carries it
+	OrderID        string `json:"order_id,omitempty"`
+	ChannelOrderID string `json:"channel_order_id,omitempty"`
+	// MerchantID is set when the channel echoes it back, e.g. in passback params
+	MerchantID string  `json:"merchant_id,omitempty"`
+	Amount     float64 `json:"amount"`
+	Currency   string  `json:"currency"`
+	// Fee is what the channel charged for the transaction
+	Fee float64 `json:"fee,omitempty"`
+	// Status is the channel's raw status; statements usually list only
+	// settled transactions, so an empty status means succeeded
+	Status      string    `json:"status,omitempty"`
+	CreatedAt   time.Time `json:"created_at,omitempty"`
+	CompletedAt time.Time `json:"completed_at,omitempty"`
+}
+
+// BillTrade is the conventional bill type for payments and refunds
+const BillTrade = "trade"
+
+// StatementRequest selects the statement to download
+type StatementRequest struct {
+	// Date is the day the statement covers, in the channel's time zone
+	Date time.Time `json:"date"`
+	// BillType is channel specific; an empty type means BillTrade
+	BillType string `json:"bill_type,omitempty"`
+}
+
+// StatementStream yields statement lines one at a time. Next returns io.EOF
+// after the last line. Close must always be called.
+type StatementStream interface {
+	Next() (*StatementLine, error)
+	Close() error
+}
+
+// StatementDownloader is implemented by plugins that can fetch the
+// channel's statement (bill file) for a day
+type StatementDownloader interface {
+	DownloadStatement(ctx context.Context, req *StatementRequest) (StatementStream, error)
+}
+
+// NewStatementStream returns a stream over lines already in memory
+func NewStatementStream(lines []StatementLine) StatementStream {
+	return &sliceStream{lines: lines}
+}
+
+type sliceStream struct {
+	lines []StatementLine
+	next  int
+}
+
+func (s *sliceStream) Next() (*StatementLine, error) {
+	if s.next >= len(s.lines) {
+		return nil, io.EOF
+	}
+	s.next++
+	return &s.lines[s.next-1], nil
+}
+
+func (s *sliceStream) Close() error {
+	return nil
+}
@@ -0,0 +1,89 @@
+// Package lease hands out short, expiring claims on named pieces of work,
+// so gateway instances sharing a lease store never do the same work at
+// once. Leases are not renewed; a holder that needs longer takes a new one
+// once its lease has expired.
+package lease
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Store grants leases. Instances coordinate only through a shared store;
+// MemoryStore coordinates goroutines of one process.
+type Store interface {
+	// Acquire takes the lease on key for owner until ttl has passed and
+	// reports true, or reports false while anyone, owner included, holds it
+	Acquire(ctx context.Context, key, owner string, ttl time.Duration) (bool, error)
+	// Release gives up owner's lease on key before it expires; releasing a
+	// lease owner does not hold is a no-op
+	Release(ctx context.Context, key, owner string) error
+}
+
+// Owner returns an owner name for this process, unique among the
+// instances on a network: the host name and process ID
+func Owner() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// sweepEvery is how many acquisitions pass between removing expired
+// leases from a MemoryStore
+const sweepEvery = 1024
+
+// MemoryStore keeps leases in memory
+type MemoryStore struct {
+	mutex    sync.Mutex
+	leases   map[string]lease
+	acquired int
+	now      func() time.Time
+}
+
+type lease struct {
+	owner     string
+	expiresAt time.Time
+}
+
+// NewMemoryStore creates an empty in-memory lease store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{leases: make(map[string]lease), now: time.Now}
+}
+
+// Acquire implements Store
+func (ms *MemoryStore) Acquire(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	now := ms.now()
+	if current, held := ms.leases[key]; held && now.Before(current.expiresAt) {
+		return false, nil
+	}
+	ms.leases[key] = lease{owner: owner, expiresAt: now.Add(ttl)}
+
+	ms.acquired++
+	if ms.acquired%sweepEvery == 0 {
+		for key, l := range ms.leases {
+			if !now.Before(l.expiresAt) {
+				delete(ms.leases, key)
+			}
+		}
+	}
+	return true, nil
+}
+
+// Release implements Store
+func (ms *MemoryStore) Release(ctx context.Context, key, owner string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if current, held := ms.leases[key]; held && current.owner == owner {
+		delete(ms.leases, key)
+	}
+	return nil
+}
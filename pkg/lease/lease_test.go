@@ -0,0 +1,54 @@
+package lease
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	acquire := func(owner string) bool {
+		t.Helper()
+		ok, err := store.Acquire(ctx, "poll:ORDER_001", owner, time.Minute)
+		if err != nil {
+			t.Fatalf("Acquire failed: %v", err)
+		}
+		return ok
+	}
+
+	if !acquire("a") {
+		t.Fatal("Expected a free lease to be granted")
+	}
+	if acquire("b") || acquire("a") {
+		t.Error("Expected a held lease to be refused to everyone")
+	}
+	now = now.Add(time.Minute)
+	if !acquire("b") {
+		t.Error("Expected an expired lease to be granted")
+	}
+
+	store.Release(ctx, "poll:ORDER_001", "a")
+	if acquire("a") {
+		t.Error("Expected releasing someone else's lease to be a no-op")
+	}
+	store.Release(ctx, "poll:ORDER_001", "b")
+	if !acquire("a") {
+		t.Error("Expected a released lease to be granted")
+	}
+}
+
+func TestMemoryStoreSweeps(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for i := 0; i < sweepEvery; i++ {
+		store.Acquire(ctx, time.Duration(i).String(), "a", -time.Second)
+	}
+	if len(store.leases) != 0 {
+		t.Errorf("Expected expired leases to be swept, got %d", len(store.leases))
+	}
+}
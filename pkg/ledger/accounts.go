@@ -0,0 +1,73 @@
+package ledger
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AccountType decides an account's normal balance side
+type AccountType string
+
+// Account types. Asset and expense accounts grow with debits; liability,
+// equity and revenue accounts grow with credits.
+const (
+	Asset     AccountType = "asset"
+	Liability AccountType = "liability"
+	Equity    AccountType = "equity"
+	Revenue   AccountType = "revenue"
+	Expense   AccountType = "expense"
+)
+
+// Account IDs are "<type>:<name>", so every posting carries its account's
+// type and no chart of accounts has to be set up before posting.
+//
+// The gateway's books use these accounts:
+//
+//	asset:channel:<channel_id>          funds held for us by the channel
+//	liability:merchant:<merchant_id>    what we owe the merchant, available to pay out
+//	liability:merchant_held:<merchant_id>  funds reserved for payouts in flight
+//	revenue:fees                        fees charged to merchants
+//	expense:channel_fees:<channel_id>   fees charged to us by the channel
+
+// MerchantAccount is the amount owed to a merchant
+func MerchantAccount(merchantID string) string {
+	return string(Liability) + ":merchant:" + merchantID
+}
+
+// HeldAccount holds a merchant's funds reserved for payouts not yet settled
+func HeldAccount(merchantID string) string {
+	return string(Liability) + ":merchant_held:" + merchantID
+}
+
+// ChannelAccount is the position held at an upstream channel
+func ChannelAccount(channelID string) string {
+	return string(Asset) + ":channel:" + channelID
+}
+
+// FeeRevenueAccount collects the fees charged to merchants
+func FeeRevenueAccount() string {
+	return string(Revenue) + ":fees"
+}
+
+// ChannelFeeAccount records the fees a channel charges us
+func ChannelFeeAccount(channelID string) string {
+	return string(Expense) + ":channel_fees:" + channelID
+}
+
+// TypeOf returns the type encoded in an account ID
+func TypeOf(account string) (AccountType, error) {
+	prefix, name, ok := strings.Cut(account, ":")
+	if !ok || name == "" {
+		return "", fmt.Errorf("account %q must have the form <type>:<name>", account)
+	}
+	switch t := AccountType(prefix); t {
+	case Asset, Liability, Equity, Revenue, Expense:
+		return t, nil
+	}
+	return "", fmt.Errorf("account %q has unknown type %q", account, prefix)
+}
+
+// debitNormal reports whether debits increase the account type's balance
+func debitNormal(t AccountType) bool {
+	return t == Asset || t == Expense
+}
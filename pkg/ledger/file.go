@@ -0,0 +1,129 @@
+package ledger
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// FileStore is a durable store that appends one JSON entry per line to a
+// file and syncs it before Append returns. The file is read back into an
+// in-memory index when the store is opened.
+type FileStore struct {
+	mutex  sync.Mutex
+	file   *os.File
+	memory *MemoryStore
+}
+
+// OpenFileStore opens or creates the journal file at path. A final line
+// without its newline is the remains of a write interrupted by a crash; it
+// was never acknowledged, so it is truncated away.
+func OpenFileStore(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ledger %s: %w", path, err)
+	}
+
+	memory := NewMemoryStore()
+	valid, err := loadJournal(file, memory)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("ledger %s: %w", path, err)
+	}
+	if err := file.Truncate(valid); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("ledger %s: %w", path, err)
+	}
+	if _, err := file.Seek(valid, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("ledger %s: %w", path, err)
+	}
+	return &FileStore{file: file, memory: memory}, nil
+}
+
+// loadJournal reads complete lines into memory and returns the length of
+// the valid prefix of the file
+func loadJournal(r io.Reader, memory *MemoryStore) (int64, error) {
+	reader := bufio.NewReader(r)
+	var offset int64
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return offset, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(bytes.TrimSpace(data), &entry); err != nil {
+			return 0, fmt.Errorf("line %d is corrupted: %w", line, err)
+		}
+		if err := memory.appendLocked(entry); err != nil {
+			return 0, fmt.Errorf("line %d: %w", line, err)
+		}
+		offset += int64(len(data))
+	}
+}
+
+// Append implements Store
+func (fs *FileStore) Append(ctx context.Context, entry Entry) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	if _, exists, _ := fs.memory.Get(ctx, entry.ID); exists {
+		return fmt.Errorf("%w: %s", ErrDuplicateEntry, entry.ID)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	offset, err := fs.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to write ledger entry %s: %w", entry.ID, err)
+	}
+	if _, err := fs.file.Write(append(data, '\n')); err != nil {
+		return errors.Join(fmt.Errorf("failed to write ledger entry %s: %w", entry.ID, err), fs.truncate(offset))
+	}
+	if err := fs.file.Sync(); err != nil {
+		return errors.Join(fmt.Errorf("failed to sync ledger entry %s: %w", entry.ID, err), fs.truncate(offset))
+	}
+	return fs.memory.Append(ctx, entry)
+}
+
+// truncate drops a partly written entry after offset, so the next entry
+// does not land after it and corrupt the journal
+func (fs *FileStore) truncate(offset int64) error {
+	if err := fs.file.Truncate(offset); err != nil {
+		return fmt.Errorf("failed to truncate ledger: %w", err)
+	}
+	if _, err := fs.file.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to truncate ledger: %w", err)
+	}
+	return nil
+}
+
+// Get implements Store
+func (fs *FileStore) Get(ctx context.Context, id string) (Entry, bool, error) {
+	return fs.memory.Get(ctx, id)
+}
+
+// Entries implements Store
+func (fs *FileStore) Entries(ctx context.Context, account string) ([]Entry, error) {
+	return fs.memory.Entries(ctx, account)
+}
+
+// Close closes the journal file
+func (fs *FileStore) Close() error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	return fs.file.Close()
+}
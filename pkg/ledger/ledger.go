@@ -0,0 +1,281 @@
+// Package ledger is the gateway's double-entry book of merchant balances and
+// channel positions. Entries are immutable and balanced per currency;
+// mistakes are corrected by posting a reversal, never by editing.
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"payment_go/pkg/interfaces"
+)
+
+// Errors returned by the ledger
+var (
+	// ErrDuplicateEntry is returned by stores for an entry ID already used
+	ErrDuplicateEntry = errors.New("duplicate ledger entry")
+	// ErrEntryConflict means an entry ID was reused for different postings
+	ErrEntryConflict = errors.New("ledger entry conflicts with an existing entry")
+	// ErrEntryNotFound is returned when reversing an unknown entry
+	ErrEntryNotFound = errors.New("ledger entry not found")
+	// ErrInsufficientFunds is returned by PostCovered
+	ErrInsufficientFunds = errors.New("insufficient funds")
+)
+
+// Posting is one side of an entry. Amount is in minor units of Currency;
+// debits are positive and credits negative.
+type Posting struct {
+	Account  string `json:"account"`
+	Currency string `json:"currency"`
+	Amount   int64  `json:"amount"`
+}
+
+// Entry is an immutable journal entry
+type Entry struct {
+	// ID makes posting idempotent: posting the same entry twice is a no-op
+	ID string `json:"id"`
+	// Time is when the entry takes effect, e.g. when the upstream paid
+	Time time.Time `json:"time"`
+	// PostedAt is when the ledger recorded the entry
+	PostedAt    time.Time `json:"posted_at"`
+	Description string    `json:"description,omitempty"`
+	// Reference links the entry to its source, e.g. an order key
+	Reference string    `json:"reference,omitempty"`
+	Postings  []Posting `json:"postings"`
+}
+
+// Validate checks that the entry is well formed and balanced per currency
+func (e *Entry) Validate() error {
+	if e.ID == "" {
+		return errors.New("ledger entry id is required")
+	}
+	if e.Time.IsZero() {
+		return fmt.Errorf("ledger entry %s: time is required", e.ID)
+	}
+	if len(e.Postings) < 2 {
+		return fmt.Errorf("ledger entry %s: at least two postings are required", e.ID)
+	}
+
+	sums := make(map[string]int64)
+	for _, p := range e.Postings {
+		if _, err := TypeOf(p.Account); err != nil {
+			return fmt.Errorf("ledger entry %s: %w", e.ID, err)
+		}
+		if len(p.Currency) != 3 {
+			return fmt.Errorf("ledger entry %s: invalid currency %q", e.ID, p.Currency)
+		}
+		if p.Amount == 0 {
+			return fmt.Errorf("ledger entry %s: posting to %s has zero amount", e.ID, p.Account)
+		}
+		sums[p.Currency] += p.Amount
+	}
+	for currency, sum := range sums {
+		if sum != 0 {
+			return fmt.Errorf("ledger entry %s: %s postings do not balance (off by %d)", e.ID, currency, sum)
+		}
+	}
+	return nil
+}
+
+// samePostings reports whether two entries move the same amounts, which is
+// what makes re-posting an entry ID harmless
+func samePostings(a, b *Entry) bool {
+	if len(a.Postings) != len(b.Postings) || !a.Time.Equal(b.Time) {
+		return false
+	}
+	for i := range a.Postings {
+		if a.Postings[i] != b.Postings[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Store persists entries. Implementations must reject duplicate IDs with
+// ErrDuplicateEntry atomically and return copies, never shared slices.
+type Store interface {
+	Append(ctx context.Context, entry Entry) error
+	Get(ctx context.Context, id string) (Entry, bool, error)
+	// Entries returns the entries with a posting to account, or all entries
+	// when account is empty, in the order they were appended
+	Entries(ctx context.Context, account string) ([]Entry, error)
+}
+
+// Ledger posts entries to a store and computes balances from them
+type Ledger struct {
+	// mutex serializes posting so PostCovered's balance check cannot race
+	// with another entry touching the same account
+	mutex sync.Mutex
+	store Store
+	clock interfaces.Clock
+}
+
+// New creates a ledger backed by store. A nil clock uses the system clock.
+func New(store Store, clock interfaces.Clock) *Ledger {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return &Ledger{store: store, clock: clock}
+}
+
+// Post validates and records entry. Posting an entry whose ID is already
+// recorded with the same postings succeeds without recording it again;
+// reusing the ID for different postings fails with ErrEntryConflict.
+func (l *Ledger) Post(ctx context.Context, entry Entry) error {
+	return l.PostCovered(ctx, entry, "")
+}
+
+// PostCovered is Post, except that the entry is rejected with
+// ErrInsufficientFunds if it would leave account with a negative balance in
+// any currency. The check and the append are atomic with respect to other
+// posts. An empty account skips the check.
+func (l *Ledger) PostCovered(ctx context.Context, entry Entry, account string) error {
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+	entry.Postings = append([]Posting(nil), entry.Postings...)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	existing, found, err := l.store.Get(ctx, entry.ID)
+	if err != nil {
+		return err
+	}
+	if found {
+		if samePostings(&existing, &entry) {
+			return nil
+		}
+		return fmt.Errorf("%w: %s", ErrEntryConflict, entry.ID)
+	}
+
+	if account != "" {
+		if err := l.checkCovered(ctx, &entry, account); err != nil {
+			return err
+		}
+	}
+
+	entry.PostedAt = l.clock.Now()
+	return l.store.Append(ctx, entry)
+}
+
+// checkCovered fails if entry would overdraw account
+func (l *Ledger) checkCovered(ctx context.Context, entry *Entry, account string) error {
+	accountType, err := TypeOf(account)
+	if err != nil {
+		return err
+	}
+	balances, err := l.BalancesAt(ctx, account, time.Time{})
+	if err != nil {
+		return err
+	}
+	changes := make(map[string]int64)
+	for _, p := range entry.Postings {
+		if p.Account == account {
+			changes[p.Currency] += p.Amount
+		}
+	}
+	for currency, change := range changes {
+		if !debitNormal(accountType) {
+			change = -change
+		}
+		if change < 0 && balances[currency]+change < 0 {
+			return fmt.Errorf("%w: %s has %d %s available, %d required",
+				ErrInsufficientFunds, account, balances[currency], currency, -change)
+		}
+	}
+	return nil
+}
+
+// Get returns the entry with the given ID
+func (l *Ledger) Get(ctx context.Context, id string) (Entry, bool, error) {
+	return l.store.Get(ctx, id)
+}
+
+// Reverse posts an entry undoing the entry with the given ID, effective at
+func (l *Ledger) Reverse(ctx context.Context, id, reversalID string, at time.Time) error {
+	original, found, err := l.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", ErrEntryNotFound, id)
+	}
+
+	postings := make([]Posting, len(original.Postings))
+	for i, p := range original.Postings {
+		postings[i] = Posting{Account: p.Account, Currency: p.Currency, Amount: -p.Amount}
+	}
+	return l.Post(ctx, Entry{
+		ID:          reversalID,
+		Time:        at,
+		Description: "reversal of " + id,
+		Reference:   id,
+		Postings:    postings,
+	})
+}
+
+// Balance returns the current balance of account in currency
+func (l *Ledger) Balance(ctx context.Context, account, currency string) (int64, error) {
+	return l.BalanceAt(ctx, account, currency, time.Time{})
+}
+
+// BalanceAt returns the balance of account in currency counting entries
+// effective at or before at; a zero at counts every entry. Balances are
+// signed by the account's normal side, so a merchant with funds to withdraw
+// has a positive balance even though its liability account is credited.
+func (l *Ledger) BalanceAt(ctx context.Context, account, currency string, at time.Time) (int64, error) {
+	balances, err := l.BalancesAt(ctx, account, at)
+	if err != nil {
+		return 0, err
+	}
+	return balances[currency], nil
+}
+
+// BalancesAt returns the balance of account in every currency it holds
+func (l *Ledger) BalancesAt(ctx context.Context, account string, at time.Time) (map[string]int64, error) {
+	accountType, err := TypeOf(account)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := l.store.Entries(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	balances := make(map[string]int64)
+	for _, entry := range entries {
+		if !at.IsZero() && entry.Time.After(at) {
+			continue
+		}
+		for _, p := range entry.Postings {
+			if p.Account == account {
+				balances[p.Currency] += p.Amount
+			}
+		}
+	}
+	if !debitNormal(accountType) {
+		for currency, amount := range balances {
+			balances[currency] = -amount
+		}
+	}
+	return balances, nil
+}
+
+// Entries returns the entries touching account ordered by effective time
+func (l *Ledger) Entries(ctx context.Context, account string) ([]Entry, error) {
+	entries, err := l.store.Entries(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries, nil
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
@@ -0,0 +1,186 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var day = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+func collection(id string, amount int64, at time.Time) Entry {
+	return Entry{ID: id, Time: at, Postings: CollectionPostings("M1", "alipay", "CNY", amount)}
+}
+
+func TestEntryValidation(t *testing.T) {
+	cases := map[string]Entry{
+		"unbalanced": {ID: "e1", Time: day, Postings: []Posting{
+			{Account: ChannelAccount("alipay"), Currency: "CNY", Amount: 100},
+			{Account: MerchantAccount("M1"), Currency: "CNY", Amount: -99},
+		}},
+		"balanced across currencies only": {ID: "e2", Time: day, Postings: []Posting{
+			{Account: ChannelAccount("alipay"), Currency: "CNY", Amount: 100},
+			{Account: MerchantAccount("M1"), Currency: "USD", Amount: -100},
+		}},
+		"single posting": {ID: "e3", Time: day, Postings: []Posting{
+			{Account: ChannelAccount("alipay"), Currency: "CNY", Amount: 100},
+		}},
+		"unknown account type": {ID: "e4", Time: day, Postings: []Posting{
+			{Account: "wallet:M1", Currency: "CNY", Amount: 100},
+			{Account: MerchantAccount("M1"), Currency: "CNY", Amount: -100},
+		}},
+		"missing time": {ID: "e5", Postings: CollectionPostings("M1", "alipay", "CNY", 100)},
+	}
+	for name, entry := range cases {
+		if err := entry.Validate(); err == nil {
+			t.Errorf("Expected error when entry is %s", name)
+		}
+	}
+
+	valid := collection("e6", 100, day)
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Expected collection entry to be valid: %v", err)
+	}
+}
+
+func TestPostIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	l := New(NewMemoryStore(), nil)
+
+	if err := l.Post(ctx, collection("c1", 500, day)); err != nil {
+		t.Fatalf("Post failed: %v", err)
+	}
+	if err := l.Post(ctx, collection("c1", 500, day)); err != nil {
+		t.Errorf("Expected reposting the same entry to succeed: %v", err)
+	}
+	if err := l.Post(ctx, collection("c1", 600, day)); !errors.Is(err, ErrEntryConflict) {
+		t.Errorf("Expected ErrEntryConflict when reusing an ID, got %v", err)
+	}
+
+	balance, _ := l.Balance(ctx, MerchantAccount("M1"), "CNY")
+	if balance != 500 {
+		t.Errorf("Expected merchant balance 500, got %d", balance)
+	}
+}
+
+func TestBalances(t *testing.T) {
+	ctx := context.Background()
+	l := New(NewMemoryStore(), nil)
+
+	entries := []Entry{
+		collection("c1", 1000, day),
+		collection("c2", 2000, day.Add(48*time.Hour)),
+		{ID: "p1", Time: day.Add(24 * time.Hour), Postings: append(
+			PayoutPostings("M1", "alipay", "CNY", 300),
+			FeePostings("M1", "alipay", "CNY", 10, 4)...)},
+	}
+	for _, entry := range entries {
+		if err := l.Post(ctx, entry); err != nil {
+			t.Fatalf("Post %s failed: %v", entry.ID, err)
+		}
+	}
+
+	checks := []struct {
+		account string
+		at      time.Time
+		want    int64
+	}{
+		{MerchantAccount("M1"), time.Time{}, 1000 + 2000 - 300 - 10},
+		{MerchantAccount("M1"), day.Add(24 * time.Hour), 1000 - 300 - 10},
+		{MerchantAccount("M1"), day.Add(-time.Hour), 0},
+		{ChannelAccount("alipay"), time.Time{}, 1000 + 2000 - 300 - 4},
+		{FeeRevenueAccount(), time.Time{}, 10},
+		{ChannelFeeAccount("alipay"), time.Time{}, 4},
+	}
+	for _, check := range checks {
+		got, err := l.BalanceAt(ctx, check.account, "CNY", check.at)
+		if err != nil {
+			t.Fatalf("BalanceAt failed: %v", err)
+		}
+		if got != check.want {
+			t.Errorf("Expected %s balance %d at %v, got %d", check.account, check.want, check.at, got)
+		}
+	}
+
+	if err := l.Reverse(ctx, "c2", "c2:reversal", day.Add(72*time.Hour)); err != nil {
+		t.Fatalf("Reverse failed: %v", err)
+	}
+	balance, _ := l.Balance(ctx, MerchantAccount("M1"), "CNY")
+	if balance != 1000-300-10 {
+		t.Errorf("Expected reversal to cancel c2, got %d", balance)
+	}
+	if err := l.Reverse(ctx, "missing", "missing:reversal", day); !errors.Is(err, ErrEntryNotFound) {
+		t.Errorf("Expected ErrEntryNotFound when reversing an unknown entry, got %v", err)
+	}
+}
+
+func TestFileStoreSurvivesReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "ledger.jsonl")
+
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	l := New(store, nil)
+	for _, entry := range []Entry{collection("c1", 100, day), collection("c2", 200, day)} {
+		if err := l.Post(ctx, entry); err != nil {
+			t.Fatalf("Post failed: %v", err)
+		}
+	}
+	store.Close()
+
+	// Simulate a crash midway through writing a third entry
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	file.WriteString(`{"id":"c3","time":`)
+	file.Close()
+
+	store, err = OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("Expected torn final line to be discarded: %v", err)
+	}
+	defer store.Close()
+	l = New(store, nil)
+
+	balance, _ := l.Balance(ctx, MerchantAccount("M1"), "CNY")
+	if balance != 300 {
+		t.Errorf("Expected balance 300 after reopen, got %d", balance)
+	}
+	if err := l.Post(ctx, collection("c1", 100, day)); err != nil {
+		t.Errorf("Expected reposting a persisted entry to succeed: %v", err)
+	}
+	if err := l.Post(ctx, collection("c3", 50, day)); err != nil {
+		t.Fatalf("Post after reopen failed: %v", err)
+	}
+	entries, _ := l.Entries(ctx, "")
+	if len(entries) != 3 {
+		t.Errorf("Expected 3 entries, got %d", len(entries))
+	}
+}
+
+func TestPostCovered(t *testing.T) {
+	ctx := context.Background()
+	l := New(NewMemoryStore(), nil)
+	if err := l.Post(ctx, collection("c1", 100, day)); err != nil {
+		t.Fatalf("Post failed: %v", err)
+	}
+
+	hold := Entry{ID: "h1", Time: day, Postings: HoldPostings("M1", "CNY", 80)}
+	if err := l.PostCovered(ctx, hold, MerchantAccount("M1")); err != nil {
+		t.Fatalf("PostCovered failed: %v", err)
+	}
+	if err := l.PostCovered(ctx, hold, MerchantAccount("M1")); err != nil {
+		t.Errorf("Expected reposting a covered entry to succeed: %v", err)
+	}
+
+	overdraw := Entry{ID: "h2", Time: day, Postings: HoldPostings("M1", "CNY", 30)}
+	if err := l.PostCovered(ctx, overdraw, MerchantAccount("M1")); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("Expected ErrInsufficientFunds when overdrawing, got %v", err)
+	}
+	if _, found, _ := l.Get(ctx, "h2"); found {
+		t.Error("Expected rejected entry not to be recorded")
+	}
+}
@@ -0,0 +1,68 @@
+package ledger
+
+// Posting builders for the gateway's order events. Amounts are positive
+// minor units; the builders choose the debit and credit sides.
+
+// CollectionPostings records funds collected by a channel for a merchant
+func CollectionPostings(merchantID, channelID, currency string, amount int64) []Posting {
+	return transfer(ChannelAccount(channelID), MerchantAccount(merchantID), currency, amount)
+}
+
+// PayoutPostings records funds paid out through a channel for a merchant
+func PayoutPostings(merchantID, channelID, currency string, amount int64) []Posting {
+	return transfer(MerchantAccount(merchantID), ChannelAccount(channelID), currency, amount)
+}
+
+// HoldPostings reserves a merchant's available funds for a payout
+func HoldPostings(merchantID, currency string, amount int64) []Posting {
+	return transfer(MerchantAccount(merchantID), HeldAccount(merchantID), currency, amount)
+}
+
+// CapturePostings settles a held payout through a channel
+func CapturePostings(merchantID, channelID, currency string, amount int64) []Posting {
+	return transfer(HeldAccount(merchantID), ChannelAccount(channelID), currency, amount)
+}
+
+// HeldFeePostings charges a merchant's fee out of funds held for a payout
+func HeldFeePostings(merchantID, currency string, fee int64) []Posting {
+	if fee == 0 {
+		return nil
+	}
+	return transfer(HeldAccount(merchantID), FeeRevenueAccount(), currency, fee)
+}
+
+// ReleasePostings returns held funds to the merchant's available balance
+func ReleasePostings(merchantID, currency string, amount int64) []Posting {
+	return transfer(HeldAccount(merchantID), MerchantAccount(merchantID), currency, amount)
+}
+
+// RefundPostings returns collected funds from the merchant to the payer
+func RefundPostings(merchantID, channelID, currency string, amount int64) []Posting {
+	return PayoutPostings(merchantID, channelID, currency, amount)
+}
+
+// ReturnPostings records a payout the recipient's bank sent back
+func ReturnPostings(merchantID, channelID, currency string, amount int64) []Posting {
+	return CollectionPostings(merchantID, channelID, currency, amount)
+}
+
+// FeePostings charges the merchant's fee to the merchant and books the
+// channel's fee as an expense. Zero fees produce no postings.
+func FeePostings(merchantID, channelID, currency string, merchantFee, channelFee int64) []Posting {
+	var postings []Posting
+	if merchantFee != 0 {
+		postings = append(postings, transfer(MerchantAccount(merchantID), FeeRevenueAccount(), currency, merchantFee)...)
+	}
+	if channelFee != 0 {
+		postings = append(postings, transfer(ChannelFeeAccount(channelID), ChannelAccount(channelID), currency, channelFee)...)
+	}
+	return postings
+}
+
+// transfer debits one account and credits another by amount
+func transfer(debit, credit, currency string, amount int64) []Posting {
+	return []Posting{
+		{Account: debit, Currency: currency, Amount: amount},
+		{Account: credit, Currency: currency, Amount: -amount},
+	}
+}
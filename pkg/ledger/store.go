@@ -0,0 +1,87 @@
+package ledger
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// MemoryStore keeps entries in memory, indexed by account
+type MemoryStore struct {
+	mutex     sync.RWMutex
+	entries   []Entry
+	byID      map[string]int
+	byAccount map[string][]int
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		byID:      make(map[string]int),
+		byAccount: make(map[string][]int),
+	}
+}
+
+// Append implements Store
+func (ms *MemoryStore) Append(ctx context.Context, entry Entry) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	return ms.appendLocked(entry)
+}
+
+func (ms *MemoryStore) appendLocked(entry Entry) error {
+	if _, exists := ms.byID[entry.ID]; exists {
+		return fmt.Errorf("%w: %s", ErrDuplicateEntry, entry.ID)
+	}
+
+	index := len(ms.entries)
+	ms.entries = append(ms.entries, copyEntry(entry))
+	ms.byID[entry.ID] = index
+	seen := make(map[string]bool, len(entry.Postings))
+	for _, p := range entry.Postings {
+		if !seen[p.Account] {
+			seen[p.Account] = true
+			ms.byAccount[p.Account] = append(ms.byAccount[p.Account], index)
+		}
+	}
+	return nil
+}
+
+// Get implements Store
+func (ms *MemoryStore) Get(ctx context.Context, id string) (Entry, bool, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	index, exists := ms.byID[id]
+	if !exists {
+		return Entry{}, false, nil
+	}
+	return copyEntry(ms.entries[index]), true, nil
+}
+
+// Entries implements Store
+func (ms *MemoryStore) Entries(ctx context.Context, account string) ([]Entry, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	if account == "" {
+		result := make([]Entry, len(ms.entries))
+		for i, entry := range ms.entries {
+			result[i] = copyEntry(entry)
+		}
+		return result, nil
+	}
+
+	indexes := ms.byAccount[account]
+	result := make([]Entry, len(indexes))
+	for i, index := range indexes {
+		result[i] = copyEntry(ms.entries[index])
+	}
+	return result, nil
+}
+
+func copyEntry(entry Entry) Entry {
+	entry.Postings = append([]Posting(nil), entry.Postings...)
+	return entry
+}
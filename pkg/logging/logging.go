@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// Handler is a slog.Handler that redacts attributes before passing records
+// to the wrapped handler
+type Handler struct {
+	inner    slog.Handler
+	redactor *Redactor
+	groups   []string
+}
+
+// NewHandler wraps inner with the given redactor
+func NewHandler(inner slog.Handler, redactor *Redactor) *Handler {
+	return &Handler{inner: inner, redactor: redactor}
+}
+
+// Enabled implements slog.Handler
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler
+func (h *Handler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, scrubSecrets(record.Message), record.PC)
+	record.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(h.redactor.RedactAttr(h.groups, a))
+		return true
+	})
+	return h.inner.Handle(ctx, redacted)
+}
+
+// WithAttrs implements slog.Handler
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = h.redactor.RedactAttr(h.groups, a)
+	}
+	return &Handler{inner: h.inner.WithAttrs(redacted), redactor: h.redactor, groups: h.groups}
+}
+
+// WithGroup implements slog.Handler
+func (h *Handler) WithGroup(name string) slog.Handler {
+	groups := append(append([]string(nil), h.groups...), name)
+	return &Handler{inner: h.inner.WithGroup(name), redactor: h.redactor, groups: groups}
+}
+
+// New returns a JSON logger writing to w that redacts according to cfg
+func New(w io.Writer, level slog.Level, cfg Config) *slog.Logger {
+	inner := slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})
+	return slog.New(NewHandler(inner, NewRedactor(cfg)))
+}
+
+// Default returns a production-mode redacting logger writing to stderr
+func Default() *slog.Logger {
+	return New(os.Stderr, slog.LevelInfo, Config{Mode: ModeProduction})
+}
@@ -0,0 +1,198 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"payment_go/pkg/interfaces"
+)
+
+func decodeLine(t *testing.T, buf *bytes.Buffer) map[string]interface{} {
+	t.Helper()
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid log line %q: %v", buf.String(), err)
+	}
+	buf.Reset()
+	return entry
+}
+
+func lookup(entry map[string]interface{}, path ...string) interface{} {
+	var current interface{} = entry
+	for _, key := range path {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[key]
+	}
+	return current
+}
+
+func TestMask(t *testing.T) {
+	r := NewRedactor(Config{})
+
+	testCases := []struct {
+		kind     Kind
+		value    string
+		expected string
+	}{
+		{KindIDNumber, "110101199001011234", "**************1234"},
+		{KindBankAccount, "6222021234567890123", "6222***********0123"},
+		{KindPhone, "+86-138-0013-8000", "*************8000"},
+		{KindEmail, "john@example.com", "j***@example.com"},
+		{KindName, "张三丰", "张**"},
+		{KindSecret, "MIIEvQIBADANBg", "[REDACTED]"},
+		{KindPhone, "123", "***"},
+		{KindPhone, "", ""},
+	}
+
+	for _, tc := range testCases {
+		if got := r.Mask(tc.kind, tc.value); got != tc.expected {
+			t.Errorf("Mask(%s, %q) = %q, expected %q", tc.kind, tc.value, got, tc.expected)
+		}
+	}
+}
+
+func TestRedactsPaymentTypes(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelDebug, Config{})
+
+	logger.Info("payout", "request", &interfaces.PayoutOrderRequest{
+		OrderID: "PAYOUT_001",
+		Amount:  50,
+		RecipientInfo: &interfaces.RecipientInfo{
+			Name:        "Jane Smith",
+			BankAccount: "6222021234567890123",
+			BankName:    "ICBC",
+			IDNumber:    "110101199002021234",
+		},
+	})
+	entry := decodeLine(t, &buf)
+
+	if got := lookup(entry, "request", "recipient_info", "bank_account"); got != "6222***********0123" {
+		t.Errorf("bank account not masked: %v", got)
+	}
+	if got := lookup(entry, "request", "recipient_info", "id_number"); got != "**************1234" {
+		t.Errorf("id number not masked: %v", got)
+	}
+	if got := lookup(entry, "request", "recipient_info", "name"); got != "J*********" {
+		t.Errorf("recipient name not masked: %v", got)
+	}
+	if got := lookup(entry, "request", "recipient_info", "bank_name"); got != "ICBC" {
+		t.Errorf("bank name should be logged in clear: %v", got)
+	}
+	if got := lookup(entry, "request", "order_id"); got != "PAYOUT_001" {
+		t.Errorf("order id should be logged in clear: %v", got)
+	}
+
+	logger.Info("customer", "customer", interfaces.CustomerInfo{Name: "John Doe", Email: "john@example.com"})
+	entry = decodeLine(t, &buf)
+	if got := lookup(entry, "customer", "name"); got != "J*******" {
+		t.Errorf("customer name not masked: %v", got)
+	}
+	if got := lookup(entry, "customer", "email"); got != "j***@example.com" {
+		t.Errorf("customer email not masked: %v", got)
+	}
+}
+
+func TestRedactsConfigSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo, Config{}).With("private_key", "MIIEvQ")
+
+	logger.Info("configured", "config", map[string]interface{}{
+		"app_id":      "2021000000000000",
+		"private_key": "MIIEvQIBADANBg",
+		"timeout_ms":  3000,
+	})
+	line := buf.String()
+	entry := decodeLine(t, &buf)
+
+	if strings.Contains(line, "MIIEvQ") {
+		t.Errorf("secret leaked into log line: %s", line)
+	}
+	if got := lookup(entry, "config", "app_id"); got != "2021000000000000" {
+		t.Errorf("app_id should be logged in clear: %v", got)
+	}
+	if got := lookup(entry, "config", "timeout_ms"); got != float64(3000) {
+		t.Errorf("timeout_ms should be logged in clear: %v", got)
+	}
+}
+
+func TestSecretKey(t *testing.T) {
+	for key, want := range map[string]bool{
+		"private_key":          true,
+		"App_Secret":           true,
+		"merchant_private_key": true,
+		"notify_token":         true,
+		"app_id":               false,
+		"tokenizer":            false,
+	} {
+		if got := SecretKey(key); got != want {
+			t.Errorf("SecretKey(%q): expected %v, got %v", key, want, got)
+		}
+	}
+}
+
+func TestAllowlist(t *testing.T) {
+	customer := &interfaces.CustomerInfo{Phone: "13800138000", IDNumber: "110101199001011234"}
+	var buf bytes.Buffer
+
+	// The allowlist is ignored in production
+	New(&buf, slog.LevelInfo, Config{Mode: ModeProduction, Allowlist: []string{"phone"}}).Info("c", "c", customer)
+	if got := lookup(decodeLine(t, &buf), "c", "phone"); got != "*******8000" {
+		t.Errorf("production mode must ignore the allowlist: %v", got)
+	}
+
+	New(&buf, slog.LevelInfo, Config{Mode: ModeSandbox, Allowlist: []string{"customer_info.phone"}}).Info("c", "c", customer)
+	entry := decodeLine(t, &buf)
+	if got := lookup(entry, "c", "phone"); got != "13800138000" {
+		t.Errorf("allowlisted field should be logged in clear: %v", got)
+	}
+	if got := lookup(entry, "c", "id_number"); got != "**************1234" {
+		t.Errorf("fields outside the allowlist must stay masked: %v", got)
+	}
+}
+
+func TestGroupsAndCustomRules(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo, Config{
+		Rules:  map[Kind]Rule{KindPhone: {KeepPrefix: 3, KeepSuffix: 2}},
+		Fields: map[string]Kind{"contact": KindPhone},
+	})
+
+	logger.WithGroup("recipient_info").Info("grouped", "name", "Jane", "contact", "13900139000")
+	entry := decodeLine(t, &buf)
+	if got := lookup(entry, "recipient_info", "name"); got != "J***" {
+		t.Errorf("name inside recipient group not masked: %v", got)
+	}
+	if got := lookup(entry, "recipient_info", "contact"); got != "139******00" {
+		t.Errorf("custom field rule not applied: %v", got)
+	}
+}
+
+func TestRegisteredSecretsAreScrubbed(t *testing.T) {
+	RegisterSecrets("rotated-signing-key", "short")
+
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo, Config{Mode: ModeDevelopment})
+	logger.Info("signing with rotated-signing-key",
+		"note", "key=rotated-signing-key",
+		"err", errors.New("bad signature for rotated-signing-key"),
+		"word", "short")
+
+	line := buf.String()
+	if strings.Contains(line, "rotated-signing-key") {
+		t.Errorf("registered secret leaked into log: %s", line)
+	}
+	if !strings.Contains(line, `"note":"key=[REDACTED]"`) {
+		t.Errorf("expected secret replaced in place: %s", line)
+	}
+	if !strings.Contains(line, `"word":"short"`) {
+		t.Errorf("values shorter than MinSecretLength should not be registered: %s", line)
+	}
+}
@@ -0,0 +1,308 @@
+package logging
+
+import (
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"sort"
+	"strings"
+
+	"payment_go/pkg/interfaces"
+)
+
+// Mode controls how much the redaction layer may relax its rules
+type Mode string
+
+const (
+	// ModeProduction always redacts; the allowlist is ignored
+	ModeProduction Mode = "production"
+	// ModeSandbox honours the allowlist for debugging against sandbox channels
+	ModeSandbox Mode = "sandbox"
+	// ModeDevelopment honours the allowlist for local debugging
+	ModeDevelopment Mode = "development"
+)
+
+// Kind classifies a sensitive field
+type Kind string
+
+const (
+	KindIDNumber    Kind = "id_number"
+	KindBankAccount Kind = "bank_account"
+	KindPhone       Kind = "phone"
+	KindEmail       Kind = "email"
+	KindName        Kind = "name"
+	KindSecret      Kind = "secret"
+)
+
+// Rule describes how a sensitive value is masked. Characters outside the kept
+// prefix and suffix are replaced with '*'. A zero Rule masks the whole value.
+type Rule struct {
+	KeepPrefix int `json:"keep_prefix"`
+	KeepSuffix int `json:"keep_suffix"`
+}
+
+// redactedValue replaces values that must never be logged, even partially
+const redactedValue = "[REDACTED]"
+
+// DefaultRules returns the masking rules applied when Config.Rules is empty
+func DefaultRules() map[Kind]Rule {
+	return map[Kind]Rule{
+		KindIDNumber:    {KeepPrefix: 0, KeepSuffix: 4},
+		KindBankAccount: {KeepPrefix: 4, KeepSuffix: 4},
+		KindPhone:       {KeepPrefix: 0, KeepSuffix: 4},
+		KindEmail:       {KeepPrefix: 1, KeepSuffix: 0},
+		KindName:        {KeepPrefix: 1, KeepSuffix: 0},
+		KindSecret:      {},
+	}
+}
+
+// defaultFields maps field names (JSON tags and common config keys) to kinds.
+// "name" is deliberately absent: it is only sensitive inside customer and
+// recipient details, see personFields.
+var defaultFields = map[string]Kind{
+	"id_number":         KindIDNumber,
+	"id_card":           KindIDNumber,
+	"bank_account":      KindBankAccount,
+	"account_no":        KindBankAccount,
+	"card_no":           KindBankAccount,
+	"phone":             KindPhone,
+	"mobile":            KindPhone,
+	"email":             KindEmail,
+	"private_key":       KindSecret,
+	"alipay_public_key": KindSecret,
+	"app_secret":        KindSecret,
+	"api_key":           KindSecret,
+	"secret":            KindSecret,
+	"password":          KindSecret,
+	"token":             KindSecret,
+}
+
+// SecretKey reports whether a config key names a credential by default:
+// one of the secret fields, such as "private_key", or a key ending in one,
+// such as "merchant_private_key"
+func SecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for field, kind := range defaultFields {
+		if kind == KindSecret && (key == field || strings.HasSuffix(key, "_"+field)) {
+			return true
+		}
+	}
+	return false
+}
+
+// personFields are the objects whose "name" field identifies a person
+var personFields = map[string]bool{
+	"customer_info":  true,
+	"recipient_info": true,
+}
+
+// Config configures a Redactor
+type Config struct {
+	// Mode defaults to ModeProduction
+	Mode Mode `json:"mode"`
+	// Rules overrides the default masking rule per kind
+	Rules map[Kind]Rule `json:"rules,omitempty"`
+	// Fields adds or overrides field name classifications
+	Fields map[string]Kind `json:"fields,omitempty"`
+	// Allowlist names fields logged in clear outside production, either as a
+	// dotted path ("customer_info.phone") or a bare field name ("phone")
+	Allowlist []string `json:"allowlist,omitempty"`
+}
+
+// Redactor masks personal data and secrets in log attributes
+type Redactor struct {
+	rules  map[Kind]Rule
+	fields map[string]Kind
+	allow  map[string]bool
+}
+
+// NewRedactor creates a redactor from cfg
+func NewRedactor(cfg Config) *Redactor {
+	r := &Redactor{
+		rules:  DefaultRules(),
+		fields: make(map[string]Kind, len(defaultFields)+len(cfg.Fields)),
+		allow:  make(map[string]bool),
+	}
+	for kind, rule := range cfg.Rules {
+		r.rules[kind] = rule
+	}
+	for field, kind := range defaultFields {
+		r.fields[field] = kind
+	}
+	for field, kind := range cfg.Fields {
+		r.fields[strings.ToLower(field)] = kind
+	}
+	if cfg.Mode != "" && cfg.Mode != ModeProduction {
+		for _, field := range cfg.Allowlist {
+			r.allow[strings.ToLower(field)] = true
+		}
+	}
+	return r
+}
+
+// Mask applies the rule for kind to value
+func (r *Redactor) Mask(kind Kind, value string) string {
+	if value == "" {
+		return value
+	}
+	rule, ok := r.rules[kind]
+	if !ok || kind == KindSecret {
+		return redactedValue
+	}
+	if kind == KindEmail {
+		if at := strings.LastIndex(value, "@"); at > 0 {
+			return maskRunes(value[:at], rule) + value[at:]
+		}
+	}
+	return maskRunes(value, rule)
+}
+
+// maskRunes keeps the rule's prefix and suffix and stars the rest. When the
+// value is too short to hide anything, it is masked entirely.
+func maskRunes(value string, rule Rule) string {
+	runes := []rune(value)
+	if rule.KeepPrefix+rule.KeepSuffix >= len(runes) {
+		return strings.Repeat("*", len(runes))
+	}
+	masked := make([]rune, len(runes))
+	for i, c := range runes {
+		if i < rule.KeepPrefix || i >= len(runes)-rule.KeepSuffix {
+			masked[i] = c
+		} else {
+			masked[i] = '*'
+		}
+	}
+	return string(masked)
+}
+
+// RedactAttr returns a copy of a with sensitive data masked. groups is the
+// path of open groups the attribute is logged under.
+func (r *Redactor) RedactAttr(groups []string, a slog.Attr) slog.Attr {
+	path := append(append([]string(nil), groups...), strings.ToLower(a.Key))
+	return slog.Attr{Key: a.Key, Value: r.redactValue(path, a.Value.Resolve())}
+}
+
+func (r *Redactor) redactValue(path []string, v slog.Value) slog.Value {
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.StringValue(r.redactString(path, v.String()))
+	case slog.KindGroup:
+		attrs := v.Group()
+		redacted := make([]slog.Attr, len(attrs))
+		for i, a := range attrs {
+			redacted[i] = r.RedactAttr(path, a)
+		}
+		return slog.GroupValue(redacted...)
+	case slog.KindAny:
+		return r.redactAny(path, v.Any())
+	default:
+		if r.kindFor(path) == KindSecret && !r.allowed(path) {
+			return slog.StringValue(redactedValue)
+		}
+		return v
+	}
+}
+
+// redactAny handles structured values. Payment types and maps are flattened
+// through their JSON form so their field tags drive the redaction.
+func (r *Redactor) redactAny(path []string, value interface{}) slog.Value {
+	switch value.(type) {
+	case interfaces.CustomerInfo, *interfaces.CustomerInfo:
+		path = append(path[:len(path)-1:len(path)-1], "customer_info")
+	case interfaces.RecipientInfo, *interfaces.RecipientInfo:
+		path = append(path[:len(path)-1:len(path)-1], "recipient_info")
+	case error:
+		return slog.StringValue(r.redactString(path, value.(error).Error()))
+	}
+
+	if !isStructured(value) {
+		return slog.AnyValue(value)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return slog.StringValue(redactedValue)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return slog.StringValue(redactedValue)
+	}
+	return r.redactDecoded(path, decoded)
+}
+
+func (r *Redactor) redactDecoded(path []string, value interface{}) slog.Value {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		attrs := make([]slog.Attr, 0, len(keys))
+		for _, k := range keys {
+			child := append(append([]string(nil), path...), strings.ToLower(k))
+			attrs = append(attrs, slog.Attr{Key: k, Value: r.redactDecoded(child, v[k])})
+		}
+		return slog.GroupValue(attrs...)
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = r.redactDecoded(path, item).Any()
+		}
+		return slog.AnyValue(items)
+	case string:
+		return slog.StringValue(r.redactString(path, v))
+	case nil:
+		return slog.AnyValue(nil)
+	default:
+		if r.kindFor(path) == KindSecret && !r.allowed(path) {
+			return slog.StringValue(redactedValue)
+		}
+		return slog.AnyValue(v)
+	}
+}
+
+func (r *Redactor) redactString(path []string, value string) string {
+	kind := r.kindFor(path)
+	if kind == "" || r.allowed(path) {
+		return scrubSecrets(value)
+	}
+	return r.Mask(kind, value)
+}
+
+// kindFor classifies the field at the end of path
+func (r *Redactor) kindFor(path []string) Kind {
+	if len(path) == 0 {
+		return ""
+	}
+	field := path[len(path)-1]
+	if kind, ok := r.fields[field]; ok {
+		return kind
+	}
+	if field == "name" && len(path) > 1 && personFields[path[len(path)-2]] {
+		return KindName
+	}
+	return ""
+}
+
+func (r *Redactor) allowed(path []string) bool {
+	if len(r.allow) == 0 {
+		return false
+	}
+	return r.allow[path[len(path)-1]] || r.allow[strings.Join(path, ".")]
+}
+
+// isStructured reports whether value should be walked field by field
+func isStructured(value interface{}) bool {
+	t := reflect.TypeOf(value)
+	if t == nil {
+		return false
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		return true
+	}
+	return false
+}
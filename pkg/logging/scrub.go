@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// MinSecretLength is the shortest value RegisterSecrets will scrub. Shorter
+// values would match too much unrelated log text to be useful.
+const MinSecretLength = 6
+
+var (
+	secretsMutex sync.Mutex
+	secretValues = make(map[string]bool)
+	scrubber     atomic.Pointer[strings.Replacer]
+)
+
+// RegisterSecrets makes every redacting logger replace occurrences of the
+// given values with "[REDACTED]", wherever they appear in a record. The
+// gateway registers resolved channel credentials so they cannot leak through
+// a field that is not classified as secret, such as an error message.
+func RegisterSecrets(values ...string) {
+	secretsMutex.Lock()
+	defer secretsMutex.Unlock()
+
+	changed := false
+	for _, value := range values {
+		if len(value) >= MinSecretLength && !secretValues[value] {
+			secretValues[value] = true
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+
+	// Longer values first, so a secret containing another is replaced whole
+	sorted := make([]string, 0, len(secretValues))
+	for value := range secretValues {
+		sorted = append(sorted, value)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+
+	pairs := make([]string, 0, 2*len(sorted))
+	for _, value := range sorted {
+		pairs = append(pairs, value, redactedValue)
+	}
+	scrubber.Store(strings.NewReplacer(pairs...))
+}
+
+// scrubSecrets replaces registered secret values in s
+func scrubSecrets(s string) string {
+	replacer := scrubber.Load()
+	if replacer == nil {
+		return s
+	}
+	return replacer.Replace(s)
+}
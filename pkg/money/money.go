@@ -0,0 +1,54 @@
+// Package money converts between the decimal amounts used on the plugin
+// interface and integer minor units (cents, fen) used for bookkeeping.
+package money
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// exponents lists currencies whose minor unit is not 1/100 (ISO 4217)
+var exponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0,
+	"KRW": 0, "PYG": 0, "RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0,
+	"XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// Exponent returns the number of decimal places of currency's minor unit
+func Exponent(currency string) int {
+	if exp, ok := exponents[strings.ToUpper(currency)]; ok {
+		return exp
+	}
+	return 2
+}
+
+// ToMinor converts a decimal amount to minor units. Amounts with more
+// decimal places than the currency allows are rejected rather than rounded.
+func ToMinor(amount float64, currency string) (int64, error) {
+	if math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return 0, fmt.Errorf("invalid amount %v", amount)
+	}
+	scaled := amount * math.Pow10(Exponent(currency))
+	rounded := math.Round(scaled)
+	if math.Abs(rounded) > 1<<53 {
+		return 0, fmt.Errorf("amount %v %s is out of range", amount, currency)
+	}
+	// Decimal amounts are rarely exact in binary, so allow for float error
+	if math.Abs(scaled-rounded) > 1e-6 {
+		return 0, fmt.Errorf("amount %v has more decimal places than %s allows", amount, currency)
+	}
+	return int64(rounded), nil
+}
+
+// FromMinor converts minor units back to a decimal amount
+func FromMinor(minor int64, currency string) float64 {
+	return float64(minor) / math.Pow10(Exponent(currency))
+}
+
+// Format renders minor units as a decimal string, e.g. 1234 CNY as "12.34"
+func Format(minor int64, currency string) string {
+	return strconv.FormatFloat(FromMinor(minor, currency), 'f', Exponent(currency), 64)
+}
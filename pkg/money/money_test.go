@@ -0,0 +1,47 @@
+package money
+
+import "testing"
+
+func TestToMinor(t *testing.T) {
+	testCases := []struct {
+		amount   float64
+		currency string
+		expected int64
+		err      bool
+	}{
+		{100.00, "CNY", 10000, false},
+		{0.1 + 0.2, "CNY", 30, false},
+		{19.99, "usd", 1999, false},
+		{1500, "JPY", 1500, false},
+		{1.234, "KWD", 1234, false},
+		{-5.5, "CNY", -550, false},
+		{10.005, "CNY", 0, true},
+		{1.5, "JPY", 0, true},
+		{1e300, "CNY", 0, true},
+	}
+
+	for _, tc := range testCases {
+		got, err := ToMinor(tc.amount, tc.currency)
+		if tc.err {
+			if err == nil {
+				t.Errorf("ToMinor(%v, %s): expected error", tc.amount, tc.currency)
+			}
+			continue
+		}
+		if err != nil || got != tc.expected {
+			t.Errorf("ToMinor(%v, %s) = %d, %v; expected %d", tc.amount, tc.currency, got, err, tc.expected)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	if got := Format(1234, "CNY"); got != "12.34" {
+		t.Errorf("Format CNY = %s", got)
+	}
+	if got := Format(1500, "JPY"); got != "1500" {
+		t.Errorf("Format JPY = %s", got)
+	}
+	if got := FromMinor(-550, "CNY"); got != -5.5 {
+		t.Errorf("FromMinor = %v", got)
+	}
+}
@@ -0,0 +1,328 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"payment_go/pkg/logging"
+)
+
+// DefaultSchedule is the wait before each retry of an unacknowledged
+// notification; a delivery fails once the schedule runs out
+var DefaultSchedule = []time.Duration{
+	15 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+	30 * time.Minute,
+	time.Hour,
+	2 * time.Hour,
+	6 * time.Hour,
+	12 * time.Hour,
+}
+
+// DefaultTimeout bounds each POST when Options.Timeout is zero
+const DefaultTimeout = 10 * time.Second
+
+// DefaultRetention is how long finished deliveries are kept when
+// Options.Retention is zero
+const DefaultRetention = 30 * 24 * time.Hour
+
+// Ack is the body a merchant responds with, along with a 2xx status, to
+// acknowledge a notification. Case and surrounding space are ignored.
+const Ack = "success"
+
+const (
+	// pollInterval is how often Run looks for due deliveries
+	pollInterval = time.Second
+	// maxConcurrent bounds the deliveries attempted at once
+	maxConcurrent = 8
+	// maxAckSize bounds how much of the merchant's response is read
+	maxAckSize = 1024
+	// pruneInterval is how often Run drops deliveries past their retention
+	pruneInterval = time.Hour
+)
+
+// Options configure a Dispatcher
+type Options struct {
+	// Secret signs events for merchants without a secret of their own
+	Secret []byte
+	// MerchantSecrets are per-merchant signing secrets
+	MerchantSecrets map[string][]byte
+	// Schedule replaces DefaultSchedule
+	Schedule []time.Duration
+	// Timeout bounds each POST, default DefaultTimeout
+	Timeout time.Duration
+	// Client replaces the default HTTP client, which only connects to
+	// public addresses; Timeout and AllowPrivateNetworks are then ignored
+	Client *http.Client
+	// AllowPrivateNetworks lets the default client deliver to loopback,
+	// private and link-local addresses, for merchants on an internal network
+	AllowPrivateNetworks bool
+	// Retention is how long delivered and failed deliveries are kept after
+	// their last attempt, default DefaultRetention
+	Retention time.Duration
+	Logger    *slog.Logger
+}
+
+// Dispatcher queues events and delivers them to merchants
+type Dispatcher struct {
+	store     Store
+	secret    []byte
+	secrets   map[string][]byte
+	schedule  []time.Duration
+	client    *http.Client
+	retention time.Duration
+	logger    *slog.Logger
+	now       func() time.Time
+	// mutex serializes recording attempts, so a delivery re-sent by hand
+	// while it is being retried keeps both attempts
+	mutex sync.Mutex
+	wake  chan struct{}
+}
+
+// New creates a dispatcher queuing deliveries in store. Call Run to
+// deliver them.
+func New(store Store, opts Options) *Dispatcher {
+	d := &Dispatcher{
+		store:     store,
+		secret:    opts.Secret,
+		secrets:   opts.MerchantSecrets,
+		schedule:  opts.Schedule,
+		client:    opts.Client,
+		retention: opts.Retention,
+		logger:    opts.Logger,
+		now:       time.Now,
+		wake:      make(chan struct{}, 1),
+	}
+	if len(d.schedule) == 0 {
+		d.schedule = DefaultSchedule
+	}
+	if d.retention <= 0 {
+		d.retention = DefaultRetention
+	}
+	if d.client == nil {
+		timeout := opts.Timeout
+		if timeout == 0 {
+			timeout = DefaultTimeout
+		}
+		d.client = publicClient(timeout)
+		if opts.AllowPrivateNetworks {
+			d.client = &http.Client{Timeout: timeout}
+		}
+	}
+	if d.logger == nil {
+		d.logger = logging.Default()
+	}
+	return d
+}
+
+// Notify queues event for delivery to url. Queuing an event again is a
+// no-op, so an order transition recorded twice notifies once.
+func (d *Dispatcher) Notify(ctx context.Context, url string, event Event) error {
+	now := d.now()
+	err := d.store.Create(ctx, Delivery{
+		ID:            event.ID,
+		MerchantID:    event.Data.MerchantID,
+		OrderID:       event.Data.OrderID,
+		URL:           url,
+		Event:         event,
+		Status:        StatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	})
+	if errors.Is(err, ErrExists) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run delivers notifications as they fall due until ctx is done, and
+// drops finished deliveries once they are past their retention
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	var pruned time.Time
+	for {
+		d.Flush(ctx)
+		if now := d.now(); now.Sub(pruned) >= pruneInterval {
+			d.Prune(ctx)
+			pruned = now
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// Flush attempts every due delivery once and returns how many the
+// merchants acknowledged
+func (d *Dispatcher) Flush(ctx context.Context) int {
+	due, err := d.store.Due(ctx, d.now())
+	if err != nil {
+		d.logger.ErrorContext(ctx, "failed to read notification queue", "error", err)
+		return 0
+	}
+
+	var wg sync.WaitGroup
+	var delivered atomic.Int64
+	slots := make(chan struct{}, maxConcurrent)
+	for _, delivery := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(id string) {
+			defer func() { <-slots; wg.Done() }()
+			result, err := d.attempt(ctx, id, false)
+			if err != nil {
+				if ctx.Err() == nil {
+					d.logger.ErrorContext(ctx, "failed to record notification attempt", "delivery_id", id, "error", err)
+				}
+				return
+			}
+			if result.Status == StatusDelivered {
+				delivered.Add(1)
+			}
+		}(delivery.ID)
+	}
+	wg.Wait()
+	return int(delivered.Load())
+}
+
+// Prune drops delivered and failed deliveries whose last attempt is older
+// than the retention, and returns how many it dropped
+func (d *Dispatcher) Prune(ctx context.Context) int {
+	pruned, err := d.store.Prune(ctx, d.now().Add(-d.retention))
+	if err != nil {
+		d.logger.ErrorContext(ctx, "failed to prune notification queue", "error", err)
+	}
+	return pruned
+}
+
+// Deliveries lists the deliveries matching filter, oldest first
+func (d *Dispatcher) Deliveries(ctx context.Context, filter Filter) ([]Delivery, error) {
+	return d.store.List(ctx, filter)
+}
+
+// Delivery returns one delivery
+func (d *Dispatcher) Delivery(ctx context.Context, id string) (Delivery, error) {
+	return d.store.Get(ctx, id)
+}
+
+// Redeliver sends a delivery again now, whatever its status, and returns
+// it with the attempt recorded. A failed or pending delivery the merchant
+// acknowledges becomes delivered; otherwise its status and retry schedule
+// are unchanged.
+func (d *Dispatcher) Redeliver(ctx context.Context, id string) (Delivery, error) {
+	return d.attempt(ctx, id, true)
+}
+
+// attempt POSTs a delivery and records the outcome
+func (d *Dispatcher) attempt(ctx context.Context, id string, manual bool) (Delivery, error) {
+	delivery, err := d.store.Get(ctx, id)
+	if err != nil {
+		return Delivery{}, err
+	}
+	result := d.send(ctx, delivery)
+	if ctx.Err() != nil {
+		// Shutting down is not the merchant's failure
+		return Delivery{}, ctx.Err()
+	}
+	result.Manual = manual
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if delivery, err = d.store.Get(ctx, id); err != nil {
+		return Delivery{}, err
+	}
+	delivery.Attempts = append(delivery.Attempts, result)
+	delivery.UpdatedAt = result.At
+	switch {
+	case result.Error == "":
+		delivery.Status, delivery.NextAttemptAt = StatusDelivered, time.Time{}
+	case manual:
+	case delivery.scheduled() > len(d.schedule):
+		delivery.Status, delivery.NextAttemptAt = StatusFailed, time.Time{}
+		d.logger.WarnContext(ctx, "notification failed after all retries",
+			"delivery_id", delivery.ID,
+			"merchant_id", delivery.MerchantID,
+			"order_id", delivery.OrderID,
+			"error", result.Error)
+	default:
+		delivery.NextAttemptAt = result.At.Add(d.schedule[delivery.scheduled()-1])
+	}
+	if err := d.store.Update(ctx, delivery); err != nil {
+		return Delivery{}, err
+	}
+	return delivery, nil
+}
+
+// send POSTs the delivery's event and reports whether it was acknowledged
+func (d *Dispatcher) send(ctx context.Context, delivery Delivery) (attempt Attempt) {
+	attempt.At = d.now()
+	start := time.Now()
+	defer func() { attempt.DurationMS = time.Since(start).Milliseconds() }()
+
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEventID, delivery.Event.ID)
+	req.Header.Set(HeaderEventType, delivery.Event.Type)
+	req.Header.Set(HeaderVersion, delivery.Event.Version)
+	req.Header.Set(HeaderSignature, Sign(d.secretFor(delivery.MerchantID), attempt.At, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	attempt.StatusCode = resp.StatusCode
+	ack, _ := io.ReadAll(io.LimitReader(resp.Body, maxAckSize))
+	switch {
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		attempt.Error = fmt.Sprintf("merchant responded %s", resp.Status)
+	case !strings.EqualFold(strings.TrimSpace(string(ack)), Ack):
+		attempt.Error = fmt.Sprintf("merchant did not acknowledge the event with %q", Ack)
+	}
+	return attempt
+}
+
+// secretFor returns the secret events for a merchant are signed with
+func (d *Dispatcher) secretFor(merchantID string) []byte {
+	if secret, ok := d.secrets[merchantID]; ok {
+		return secret
+	}
+	return d.secret
+}
@@ -0,0 +1,215 @@
+package notify
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"payment_go/pkg/order"
+)
+
+// merchant records notifications and answers with the queued responses,
+// then with the ack
+type merchant struct {
+	mutex     sync.Mutex
+	responses []func(w http.ResponseWriter)
+	received  []*http.Request
+	bodies    [][]byte
+}
+
+func (m *merchant) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	m.received, m.bodies = append(m.received, r), append(m.bodies, body)
+	if len(m.responses) > 0 {
+		respond := m.responses[0]
+		m.responses = m.responses[1:]
+		respond(w)
+		return
+	}
+	io.WriteString(w, " SUCCESS\n")
+}
+
+func testEvent() Event {
+	o := order.Order{ID: "ORDER_001", Kind: order.KindCollect, MerchantID: "MERCHANT_001", Amount: 10050, Currency: "CNY", Status: order.StatusPending}
+	o.Transition(order.StatusSucceeded, "paid", time.Now())
+	return OrderEvent(o, time.Now())
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	ctx := context.Background()
+	m := &merchant{responses: []func(w http.ResponseWriter){
+		func(w http.ResponseWriter) { w.WriteHeader(http.StatusServiceUnavailable) },
+		func(w http.ResponseWriter) { io.WriteString(w, "ok") },
+	}}
+	server := httptest.NewServer(m)
+	defer server.Close()
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	d := New(NewMemoryStore(), Options{
+		Secret:          []byte("default secret"),
+		MerchantSecrets: map[string][]byte{"MERCHANT_001": secret},
+		Schedule:        []time.Duration{15 * time.Second, time.Minute},
+		// The test merchant listens on loopback
+		AllowPrivateNetworks: true,
+	})
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+
+	event := testEvent()
+	if err := d.Notify(ctx, server.URL, event); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	if err := d.Notify(ctx, server.URL, event); err != nil {
+		t.Fatalf("Notifying twice failed: %v", err)
+	}
+
+	if delivered := d.Flush(ctx); delivered != 0 {
+		t.Fatalf("Expected the merchant's 503 not to count, got %d delivered", delivered)
+	}
+	delivery, _ := d.Delivery(ctx, event.ID)
+	if delivery.Status != StatusPending || !delivery.NextAttemptAt.Equal(now.Add(15*time.Second)) || delivery.Attempts[0].StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected a retry in 15s, got %+v", delivery)
+	}
+
+	now = now.Add(10 * time.Second)
+	if d.Flush(ctx); len(m.received) != 1 {
+		t.Fatalf("Expected no attempt before the retry is due, got %d", len(m.received))
+	}
+	now = now.Add(5 * time.Second)
+	d.Flush(ctx)
+	delivery, _ = d.Delivery(ctx, event.ID)
+	if delivery.Status != StatusPending || !delivery.NextAttemptAt.Equal(now.Add(time.Minute)) || delivery.Attempts[1].Error == "" {
+		t.Fatalf("Expected a 200 without the ack to be retried in 1m, got %+v", delivery)
+	}
+
+	now = now.Add(time.Minute)
+	if delivered := d.Flush(ctx); delivered != 1 {
+		t.Fatalf("Expected the acknowledged event to be delivered, got %d", delivered)
+	}
+	delivery, _ = d.Delivery(ctx, event.ID)
+	if delivery.Status != StatusDelivered || len(delivery.Attempts) != 3 || !delivery.NextAttemptAt.IsZero() {
+		t.Errorf("Expected the delivery to be done, got %+v", delivery)
+	}
+
+	last := m.received[2]
+	if last.Header.Get(HeaderEventID) != event.ID || last.Header.Get(HeaderEventType) != "collect.succeeded" || last.Header.Get(HeaderVersion) != EventVersion {
+		t.Errorf("Expected the event headers, got %v", last.Header)
+	}
+	if err := Verify(secret, last.Header.Get(HeaderSignature), m.bodies[2], 5*time.Minute, now); err != nil {
+		t.Errorf("Expected the event signed with the merchant's secret: %v", err)
+	}
+}
+
+func TestDispatcherGivesUp(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	d := New(NewMemoryStore(), Options{Secret: []byte("secret"), Schedule: []time.Duration{time.Second}, AllowPrivateNetworks: true})
+	now := time.Now()
+	d.now = func() time.Time { return now }
+	event := testEvent()
+	d.Notify(ctx, server.URL, event)
+
+	d.Flush(ctx)
+	now = now.Add(time.Second)
+	d.Flush(ctx)
+	delivery, _ := d.Delivery(ctx, event.ID)
+	if delivery.Status != StatusFailed || len(delivery.Attempts) != 2 {
+		t.Fatalf("Expected the delivery to fail after the schedule, got %+v", delivery)
+	}
+	now = now.Add(time.Hour)
+	d.Flush(ctx)
+	if delivery, _ := d.Delivery(ctx, event.ID); len(delivery.Attempts) != 2 {
+		t.Errorf("Expected no attempts after failing, got %d", len(delivery.Attempts))
+	}
+
+	// The merchant fixed their endpoint and asks for the event again
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "success") })
+	delivery, err := d.Redeliver(ctx, event.ID)
+	if err != nil {
+		t.Fatalf("Redeliver failed: %v", err)
+	}
+	if delivery.Status != StatusDelivered || len(delivery.Attempts) != 3 || !delivery.Attempts[2].Manual {
+		t.Errorf("Expected the manual attempt to deliver the event, got %+v", delivery)
+	}
+
+	failed, _ := d.Deliveries(ctx, Filter{Status: StatusFailed})
+	delivered, _ := d.Deliveries(ctx, Filter{MerchantID: "MERCHANT_001", Status: StatusDelivered})
+	if len(failed) != 0 || len(delivered) != 1 {
+		t.Errorf("Expected the delivery listed as delivered, got %d failed and %d delivered", len(failed), len(delivered))
+	}
+}
+
+func TestDispatcherRun(t *testing.T) {
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "success")
+		received <- r.Header.Get(HeaderEventID)
+	}))
+	defer server.Close()
+
+	d := New(NewMemoryStore(), Options{Secret: []byte("secret"), AllowPrivateNetworks: true})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+
+	event := testEvent()
+	d.Notify(ctx, server.URL, event)
+	select {
+	case id := <-received:
+		if id != event.ID {
+			t.Errorf("Expected %s, got %s", event.ID, id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Run to deliver the queued event")
+	}
+}
+
+func TestDispatcherRefusesPrivateAddresses(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(&merchant{})
+	defer server.Close()
+
+	d := New(NewMemoryStore(), Options{Secret: []byte("secret")})
+	event := testEvent()
+	d.Notify(ctx, server.URL, event)
+	if delivered := d.Flush(ctx); delivered != 0 {
+		t.Fatalf("Expected no delivery to a loopback address, got %d", delivered)
+	}
+	delivery, _ := d.Delivery(ctx, event.ID)
+	if len(delivery.Attempts) != 1 || !strings.Contains(delivery.Attempts[0].Error, ErrPrivateAddress.Error()) {
+		t.Errorf("Expected the attempt refused, got %+v", delivery.Attempts)
+	}
+
+	testCases := map[string]bool{
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"::1":             false,
+		"fe80::1":         false,
+		"fd00::1":         false,
+		"::ffff:10.0.0.1": false,
+		"93.184.216.34":   true,
+		"2606:4700::1111": true,
+	}
+	for addr, public := range testCases {
+		if got := PublicAddr(netip.MustParseAddr(addr)); got != public {
+			t.Errorf("%s: expected public %v, got %v", addr, public, got)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"payment_go/pkg/order"
+)
+
+func TestOrderEvent(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	o := order.Order{ID: "ORDER_001", Kind: order.KindCollect, MerchantID: "MERCHANT_001", Amount: 10050, Currency: "CNY", Status: order.StatusPending, MerchantFee: 60}
+	if err := o.Transition(order.StatusSucceeded, "TRADE_SUCCESS", at); err != nil {
+		t.Fatalf("Transition failed: %v", err)
+	}
+
+	event := OrderEvent(o, at)
+	if event.Type != "collect.succeeded" || event.Version != EventVersion {
+		t.Errorf("Expected a version %s collect.succeeded event, got %s %s", EventVersion, event.Version, event.Type)
+	}
+	if event.Data.Amount != 100.50 || event.Data.MerchantFee != 0.60 || event.Data.PreviousStatus != "pending" || !event.Data.UpdatedAt.Equal(at) {
+		t.Errorf("Expected the order's amounts and transition, got %+v", event.Data)
+	}
+	if again := OrderEvent(o, at.Add(time.Minute)); again.ID != event.ID {
+		t.Errorf("Expected the same transition to have the same ID, got %s and %s", event.ID, again.ID)
+	}
+
+	if err := o.Transition(order.StatusRefunded, "REFUND", at); err != nil {
+		t.Fatalf("Transition failed: %v", err)
+	}
+	if refunded := OrderEvent(o, at); refunded.ID == event.ID || refunded.Type != "collect.refunded" {
+		t.Errorf("Expected a new event for the refund, got %s %s", refunded.ID, refunded.Type)
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	body := []byte(`{"id":"evt_1"}`)
+	header := Sign(secret, now, body)
+
+	if err := Verify(secret, header, body, 5*time.Minute, now.Add(time.Minute)); err != nil {
+		t.Errorf("Expected a valid signature, got %v", err)
+	}
+
+	testCases := map[string]struct {
+		secret []byte
+		header string
+		body   []byte
+		now    time.Time
+	}{
+		"other secret": {[]byte("another secret"), header, body, now},
+		"altered body": {secret, header, []byte(`{"id":"evt_2"}`), now},
+		"stale":        {secret, header, body, now.Add(10 * time.Minute)},
+		"no timestamp": {secret, "v1=00", body, now},
+		"no signature": {secret, "t=1714564800", body, now},
+		"empty header": {secret, "", body, now},
+	}
+	for name, tc := range testCases {
+		if err := Verify(tc.secret, tc.header, tc.body, 5*time.Minute, tc.now); !errors.Is(err, ErrBadSignature) {
+			t.Errorf("%s: expected %v, got %v", name, ErrBadSignature, err)
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package notify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Errors returned by delivery stores
+var (
+	ErrNotFound = errors.New("delivery not found")
+	ErrExists   = errors.New("delivery already exists")
+)
+
+// Status is where a delivery stands
+type Status string
+
+const (
+	// StatusPending deliveries are waiting for their next attempt
+	StatusPending Status = "pending"
+	// StatusDelivered deliveries were acknowledged by the merchant
+	StatusDelivered Status = "delivered"
+	// StatusFailed deliveries ran out of attempts; they are only sent again
+	// when re-sent by hand
+	StatusFailed Status = "failed"
+)
+
+// Attempt is one POST of an event
+type Attempt struct {
+	At time.Time `json:"at"`
+	// StatusCode is the merchant's HTTP status, zero when there was none
+	StatusCode int `json:"status_code,omitempty"`
+	// Error says why the attempt was not an acknowledgement
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+	// Manual attempts were re-sent by hand and do not count towards the
+	// retry schedule
+	Manual bool `json:"manual,omitempty"`
+}
+
+// Delivery is an event on its way to a merchant's notify URL
+type Delivery struct {
+	// ID is the event's ID
+	ID         string    `json:"id"`
+	MerchantID string    `json:"merchant_id"`
+	OrderID    string    `json:"order_id"`
+	URL        string    `json:"url"`
+	Event      Event     `json:"event"`
+	Status     Status    `json:"status"`
+	Attempts   []Attempt `json:"attempts,omitempty"`
+	// NextAttemptAt is when a pending delivery is tried next
+	NextAttemptAt time.Time `json:"next_attempt_at,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// scheduled counts the attempts made on the retry schedule
+func (d *Delivery) scheduled() int {
+	count := 0
+	for _, a := range d.Attempts {
+		if !a.Manual {
+			count++
+		}
+	}
+	return count
+}
+
+func (d Delivery) clone() Delivery {
+	d.Attempts = append([]Attempt(nil), d.Attempts...)
+	return d
+}
+
+// Filter selects deliveries; empty fields match everything
+type Filter struct {
+	MerchantID string
+	OrderID    string
+	Status     Status
+}
+
+func (f Filter) matches(d Delivery) bool {
+	return (f.MerchantID == "" || d.MerchantID == f.MerchantID) &&
+		(f.OrderID == "" || d.OrderID == f.OrderID) &&
+		(f.Status == "" || d.Status == f.Status)
+}
+
+// Store persists deliveries
+type Store interface {
+	// Create stores a new delivery, or returns ErrExists for a known ID
+	Create(ctx context.Context, d Delivery) error
+	Get(ctx context.Context, id string) (Delivery, error)
+	Update(ctx context.Context, d Delivery) error
+	// List returns the matching deliveries, oldest first
+	List(ctx context.Context, filter Filter) ([]Delivery, error)
+	// Due returns the pending deliveries to attempt at or before at,
+	// earliest first
+	Due(ctx context.Context, at time.Time) ([]Delivery, error)
+	// Prune removes the delivered and failed deliveries last updated
+	// before before and returns how many it removed
+	Prune(ctx context.Context, before time.Time) (int, error)
+}
+
+// MemoryStore keeps deliveries in memory
+type MemoryStore struct {
+	mutex      sync.RWMutex
+	deliveries map[string]Delivery
+}
+
+// NewMemoryStore creates an empty in-memory delivery store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{deliveries: make(map[string]Delivery)}
+}
+
+// Create implements Store
+func (ms *MemoryStore) Create(ctx context.Context, d Delivery) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if _, exists := ms.deliveries[d.ID]; exists {
+		return fmt.Errorf("%w: %s", ErrExists, d.ID)
+	}
+	ms.deliveries[d.ID] = d.clone()
+	return nil
+}
+
+// Get implements Store
+func (ms *MemoryStore) Get(ctx context.Context, id string) (Delivery, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	d, exists := ms.deliveries[id]
+	if !exists {
+		return Delivery{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return d.clone(), nil
+}
+
+// Update implements Store
+func (ms *MemoryStore) Update(ctx context.Context, d Delivery) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if _, exists := ms.deliveries[d.ID]; !exists {
+		return fmt.Errorf("%w: %s", ErrNotFound, d.ID)
+	}
+	ms.deliveries[d.ID] = d.clone()
+	return nil
+}
+
+// List implements Store
+func (ms *MemoryStore) List(ctx context.Context, filter Filter) ([]Delivery, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	var result []Delivery
+	for _, d := range ms.deliveries {
+		if filter.matches(d) {
+			result = append(result, d.clone())
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+// Due implements Store
+func (ms *MemoryStore) Due(ctx context.Context, at time.Time) ([]Delivery, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	var result []Delivery
+	for _, d := range ms.deliveries {
+		if d.Status == StatusPending && !d.NextAttemptAt.After(at) {
+			result = append(result, d.clone())
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].NextAttemptAt.Equal(result[j].NextAttemptAt) {
+			return result[i].NextAttemptAt.Before(result[j].NextAttemptAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+// Prune implements Store
+func (ms *MemoryStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	pruned := 0
+	for id, d := range ms.deliveries {
+		if d.Status != StatusPending && d.UpdatedAt.Before(before) {
+			delete(ms.deliveries, id)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+// FileStore is a durable store that appends every version of a delivery as
+// one JSON line to a file and syncs it before returning. The latest line
+// for each delivery is read back into memory when the store is opened, and
+// the file is rewritten with only those lines when it holds older ones or
+// deliveries are pruned.
+type FileStore struct {
+	mutex  sync.Mutex
+	path   string
+	file   *os.File
+	memory *MemoryStore
+}
+
+// OpenFileStore opens or creates the journal file at path. A final line
+// without its newline is the remains of a write interrupted by a crash; it
+// was never acknowledged, so it is truncated away.
+func OpenFileStore(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open notification queue %s: %w", path, err)
+	}
+
+	memory := NewMemoryStore()
+	valid, lines, err := loadJournal(file, memory)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("notification queue %s: %w", path, err)
+	}
+	if lines > len(memory.deliveries) {
+		file.Close()
+		fs := &FileStore{path: path, memory: memory}
+		if err := fs.compact(); err != nil {
+			return nil, fmt.Errorf("notification queue %s: %w", path, err)
+		}
+		return fs, nil
+	}
+	if err := file.Truncate(valid); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("notification queue %s: %w", path, err)
+	}
+	if _, err := file.Seek(valid, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("notification queue %s: %w", path, err)
+	}
+	return &FileStore{path: path, file: file, memory: memory}, nil
+}
+
+// loadJournal reads complete lines into memory and returns the length of
+// the valid prefix of the file and the number of lines in it
+func loadJournal(r io.Reader, memory *MemoryStore) (int64, int, error) {
+	reader := bufio.NewReader(r)
+	var offset int64
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return offset, line - 1, nil
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+
+		var d Delivery
+		if err := json.Unmarshal(bytes.TrimSpace(data), &d); err != nil {
+			return 0, 0, fmt.Errorf("line %d is corrupted: %w", line, err)
+		}
+		memory.deliveries[d.ID] = d
+		offset += int64(len(data))
+	}
+}
+
+// Create implements Store
+func (fs *FileStore) Create(ctx context.Context, d Delivery) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	if _, err := fs.memory.Get(ctx, d.ID); err == nil {
+		return fmt.Errorf("%w: %s", ErrExists, d.ID)
+	}
+	if err := fs.write(d); err != nil {
+		return err
+	}
+	return fs.memory.Create(ctx, d)
+}
+
+// Get implements Store
+func (fs *FileStore) Get(ctx context.Context, id string) (Delivery, error) {
+	return fs.memory.Get(ctx, id)
+}
+
+// Update implements Store
+func (fs *FileStore) Update(ctx context.Context, d Delivery) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	if _, err := fs.memory.Get(ctx, d.ID); err != nil {
+		return err
+	}
+	if err := fs.write(d); err != nil {
+		return err
+	}
+	return fs.memory.Update(ctx, d)
+}
+
+// List implements Store
+func (fs *FileStore) List(ctx context.Context, filter Filter) ([]Delivery, error) {
+	return fs.memory.List(ctx, filter)
+}
+
+// Due implements Store
+func (fs *FileStore) Due(ctx context.Context, at time.Time) ([]Delivery, error) {
+	return fs.memory.Due(ctx, at)
+}
+
+// Prune implements Store. The journal is rewritten without the pruned
+// deliveries.
+func (fs *FileStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	pruned, err := fs.memory.Prune(ctx, before)
+	if err != nil || pruned == 0 {
+		return pruned, err
+	}
+	return pruned, fs.compact()
+}
+
+// compact replaces the journal with one line per delivery in memory. The
+// new journal is written beside the old one and renamed over it, so a
+// crash leaves one or the other.
+func (fs *FileStore) compact() error {
+	deliveries, err := fs.memory.List(context.Background(), Filter{})
+	if err != nil {
+		return err
+	}
+	tmp, err := os.OpenFile(fs.path+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to compact notification queue: %w", err)
+	}
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for _, d := range deliveries {
+		if err = encoder.Encode(d); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), fs.path)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to compact notification queue: %w", err)
+	}
+
+	if fs.file != nil {
+		fs.file.Close()
+	}
+	fs.file = tmp
+	if _, err := tmp.Seek(0, io.SeekEnd); err != nil {
+		return fmt.Errorf("failed to compact notification queue: %w", err)
+	}
+	return nil
+}
+
+// Close closes the journal file
+func (fs *FileStore) Close() error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	return fs.file.Close()
+}
+
+func (fs *FileStore) write(d Delivery) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	if _, err := fs.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write delivery %s: %w", d.ID, err)
+	}
+	if err := fs.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync delivery %s: %w", d.ID, err)
+	}
+	return nil
+}
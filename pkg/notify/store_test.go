@@ -0,0 +1,123 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileStoreSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "notifications.jsonl")
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	pending := Delivery{ID: "evt_1", MerchantID: "MERCHANT_001", OrderID: "ORDER_001", URL: "https://shop.example.com/notify", Status: StatusPending, NextAttemptAt: now, CreatedAt: now}
+	done := Delivery{ID: "evt_2", MerchantID: "MERCHANT_001", OrderID: "ORDER_002", Status: StatusPending, NextAttemptAt: now, CreatedAt: now.Add(time.Second)}
+	for _, d := range []Delivery{pending, done} {
+		if err := store.Create(ctx, d); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+	if err := store.Create(ctx, pending); !errors.Is(err, ErrExists) {
+		t.Errorf("Expected %v, got %v", ErrExists, err)
+	}
+	done.Status, done.Attempts = StatusDelivered, []Attempt{{At: now, StatusCode: 200}}
+	if err := store.Update(ctx, done); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	store.Close()
+
+	// A crash mid-write leaves a partial last line
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	file.WriteString(`{"id":"evt_3","sta`)
+	file.Close()
+
+	store, err = OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("Reopening failed: %v", err)
+	}
+	defer store.Close()
+
+	due, _ := store.Due(ctx, now)
+	if len(due) != 1 || due[0].ID != "evt_1" || due[0].URL != pending.URL {
+		t.Errorf("Expected only the pending delivery to be due, got %+v", due)
+	}
+	got, err := store.Get(ctx, "evt_2")
+	if err != nil || got.Status != StatusDelivered || len(got.Attempts) != 1 {
+		t.Errorf("Expected the latest version of the delivered event, got %+v, %v", got, err)
+	}
+	if _, err := store.Get(ctx, "evt_3"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the partial line to be dropped, got %v", err)
+	}
+
+	listed, _ := store.List(ctx, Filter{OrderID: "ORDER_002"})
+	if len(listed) != 1 || listed[0].ID != "evt_2" {
+		t.Errorf("Expected the order's delivery, got %+v", listed)
+	}
+	if lines := journalLines(t, path); lines != 2 {
+		t.Errorf("Expected the journal compacted to a line per delivery, got %d lines", lines)
+	}
+}
+
+func journalLines(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	return strings.Count(string(data), "\n")
+}
+
+func TestFileStorePrune(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "notifications.jsonl")
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+
+	old := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	recent := old.Add(60 * 24 * time.Hour)
+	deliveries := []Delivery{
+		{ID: "evt_old_delivered", Status: StatusDelivered, CreatedAt: old, UpdatedAt: old},
+		{ID: "evt_old_failed", Status: StatusFailed, CreatedAt: old, UpdatedAt: old},
+		{ID: "evt_old_pending", Status: StatusPending, CreatedAt: old, UpdatedAt: old},
+		{ID: "evt_recent", Status: StatusDelivered, CreatedAt: recent, UpdatedAt: recent},
+	}
+	for _, d := range deliveries {
+		if err := store.Create(ctx, d); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+
+	pruned, err := store.Prune(ctx, recent.Add(-DefaultRetention))
+	if err != nil || pruned != 2 {
+		t.Fatalf("Expected the two finished old deliveries pruned, got %d, %v", pruned, err)
+	}
+	// Writes after compaction land in the new journal
+	if err := store.Create(ctx, Delivery{ID: "evt_new", Status: StatusPending, CreatedAt: recent}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	store.Close()
+
+	store, err = OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("Reopening failed: %v", err)
+	}
+	defer store.Close()
+	listed, _ := store.List(ctx, Filter{})
+	if len(listed) != 3 || journalLines(t, path) != 3 {
+		t.Errorf("Expected the pending, recent and new deliveries kept, got %+v", listed)
+	}
+	if _, err := store.Get(ctx, "evt_old_failed"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the old failed delivery pruned, got %v", err)
+	}
+}
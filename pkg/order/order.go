@@ -0,0 +1,262 @@
+// Package order tracks the gateway's view of each collection and payout
+// order: its normalized status, the amounts involved and how it got there.
+package order
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"payment_go/pkg/interfaces"
+)
+
+// Kind separates collection orders from payouts; order IDs are only unique
+// per merchant and kind
+type Kind string
+
+const (
+	KindCollect Kind = "collect"
+	KindPayout  Kind = "payout"
+)
+
+// Status is the gateway's normalized order status
+type Status string
+
+const (
+	StatusPending    Status = "pending"
+	StatusProcessing Status = "processing"
+	StatusSucceeded  Status = "succeeded"
+	StatusFailed     Status = "failed"
+	StatusClosed     Status = "closed"
+	// StatusRefunded is a collection whose funds went back to the payer
+	StatusRefunded Status = "refunded"
+	// StatusReturned is a payout the recipient's bank sent back
+	StatusReturned Status = "returned"
+)
+
+// Errors returned by order stores
+var (
+	ErrNotFound        = errors.New("order not found")
+	ErrExists          = errors.New("order already exists")
+	ErrVersionConflict = errors.New("order was modified concurrently")
+)
+
+// upstreamStatuses maps the statuses channels report, lower-cased, to the
+// normalized status
+var upstreamStatuses = map[string]Status{
+	"pending":        StatusPending,
+	"created":        StatusPending,
+	"wait_buyer_pay": StatusPending,
+	"processing":     StatusProcessing,
+	"in_progress":    StatusProcessing,
+	"dealing":        StatusProcessing,
+	"succeeded":      StatusSucceeded,
+	"success":        StatusSucceeded,
+	"completed":      StatusSucceeded,
+	"paid":           StatusSucceeded,
+	"trade_success":  StatusSucceeded,
+	"trade_finished": StatusSucceeded,
+	"failed":         StatusFailed,
+	"fail":           StatusFailed,
+	"closed":         StatusClosed,
+	"cancelled":      StatusClosed,
+	"canceled":       StatusClosed,
+	"expired":        StatusClosed,
+	"trade_closed":   StatusClosed,
+	"refunded":       StatusRefunded,
+	"refund":         StatusRefunded,
+	"returned":       StatusReturned,
+	"bounced":        StatusReturned,
+}
+
+// NormalizeStatus maps a channel's status string to a Status. Unknown
+// statuses return "" and should leave the order unchanged.
+func NormalizeStatus(raw string) Status {
+	return upstreamStatuses[strings.ToLower(strings.TrimSpace(raw))]
+}
+
+// transitions lists the statuses each status may move to. Succeeded orders
+// may still be refunded or returned; everything else final is terminal. A
+// payout may also be returned before the gateway learned it succeeded.
+var transitions = map[Status][]Status{
+	StatusPending:    {StatusProcessing, StatusSucceeded, StatusFailed, StatusClosed, StatusReturned},
+	StatusProcessing: {StatusSucceeded, StatusFailed, StatusClosed, StatusReturned},
+	StatusSucceeded:  {StatusRefunded, StatusReturned},
+}
+
+// CanTransition reports whether an order may move from one status to another
+func CanTransition(from, to Status) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Terminal reports whether no further transitions are possible
+func (s Status) Terminal() bool {
+	return len(transitions[s]) == 0
+}
+
+// Open reports whether an order in s still waits for the channel to settle
+// it, that is, it is pending or processing
+func (s Status) Open() bool {
+	return s == StatusPending || s == StatusProcessing
+}
+
+// Transition is one entry in an order's history
+type Transition struct {
+	From Status    `json:"from,omitempty"`
+	To   Status    `json:"to"`
+	At   time.Time `json:"at"`
+	// Upstream is the channel's raw status that caused the transition
+	Upstream string `json:"upstream,omitempty"`
+	// UpstreamAt is when the channel says the change happened, for
+	// transitions caused by a callback that says
+	UpstreamAt time.Time `json:"upstream_at,omitempty"`
+}
+
+// Attempt is one try at placing a routed order on a channel
+type Attempt struct {
+	ChannelID       string    `json:"channel_id"`
+	UpstreamOrderID string    `json:"upstream_order_id"`
+	At              time.Time `json:"at"`
+	// Error says why the channel did not create the order
+	Error string `json:"error,omitempty"`
+	// Event is a callback event the channel reported for this attempt
+	// after the order was placed elsewhere, such as a late payment, at
+	// EventAt; money it moved needs reconciling by hand
+	Event   string    `json:"event,omitempty"`
+	EventAt time.Time `json:"event_at,omitempty"`
+}
+
+// Refund is part or all of a collection given back to the payer
+type Refund struct {
+	// ID is the refund's ID at the channel, or its sequence number when the
+	// channel gives none
+	ID     string    `json:"refund_id"`
+	Amount int64     `json:"amount"`
+	At     time.Time `json:"at"`
+}
+
+// Order is a collection or payout as the gateway tracks it. Amounts are in
+// minor units of Currency.
+type Order struct {
+	ID             string `json:"order_id"`
+	Kind           Kind   `json:"kind"`
+	MerchantID     string `json:"merchant_id"`
+	ChannelID      string `json:"channel_id"`
+	ChannelOrderID string `json:"channel_order_id,omitempty"`
+	Amount         int64  `json:"amount"`
+	Currency       string `json:"currency"`
+	Status         Status `json:"status"`
+	// Route is the route the order was placed through, RouteReason why it
+	// went to ChannelID
+	Route       string `json:"route,omitempty"`
+	RouteReason string `json:"route_reason,omitempty"`
+	// UpstreamOrderID is the order ID sent to ChannelID when it differs
+	// from ID, after failing over from another channel
+	UpstreamOrderID string `json:"upstream_order_id,omitempty"`
+	// Attempts are the channels tried for a routed order, in order
+	Attempts []Attempt `json:"attempts,omitempty"`
+	// Description and ReturnURL come from a collection request, Action is
+	// what the channel told the payer to do; the hosted cashier shows them
+	Description string                    `json:"description,omitempty"`
+	ReturnURL   string                    `json:"return_url,omitempty"`
+	Action      *interfaces.PaymentAction `json:"action,omitempty"`
+	// NotifyURL is where the merchant is told about the order's transitions
+	NotifyURL string `json:"notify_url,omitempty"`
+	// MerchantFee is charged to the merchant, ChannelFee is charged to us
+	MerchantFee int64 `json:"merchant_fee,omitempty"`
+	ChannelFee  int64 `json:"channel_fee,omitempty"`
+	// The fee rules that priced the order, e.g. "standard@2"
+	MerchantFeeRule string `json:"merchant_fee_rule,omitempty"`
+	ChannelFeeRule  string `json:"channel_fee_rule,omitempty"`
+	// Refunds of a collection so far; it is refunded once they add up to
+	// Amount, and stays succeeded while partially refunded
+	Refunds []Refund `json:"refunds,omitempty"`
+	// Fees for refunding a collection, summed over its refunds
+	RefundMerchantFee int64 `json:"refund_merchant_fee,omitempty"`
+	RefundChannelFee  int64 `json:"refund_channel_fee,omitempty"`
+	// Version increases with every update and guards against lost updates
+	Version   int64        `json:"version"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	History   []Transition `json:"history,omitempty"`
+}
+
+// Key identifies the order within its store
+func (o *Order) Key() string {
+	return Key(o.Kind, o.MerchantID, o.ID)
+}
+
+// UpstreamID returns the order ID the channel knows the order by
+func (o *Order) UpstreamID() string {
+	if o.UpstreamOrderID != "" {
+		return o.UpstreamOrderID
+	}
+	return o.ID
+}
+
+// Refunded returns how much of the order has been refunded
+func (o *Order) Refunded() int64 {
+	var refunded int64
+	for _, refund := range o.Refunds {
+		refunded += refund.Amount
+	}
+	return refunded
+}
+
+// HasRefund reports whether the refund with id was already applied
+func (o *Order) HasRefund(id string) bool {
+	for _, refund := range o.Refunds {
+		if refund.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// EarlierAttempt returns the index in Attempts of an attempt that placed
+// the order on channelID as upstreamOrderID before it moved to another
+// channel, or -1 when that is not an earlier attempt
+func (o *Order) EarlierAttempt(channelID, upstreamOrderID string) int {
+	if channelID == o.ChannelID && upstreamOrderID == o.UpstreamID() {
+		return -1
+	}
+	for i, attempt := range o.Attempts {
+		if attempt.ChannelID == channelID && attempt.UpstreamOrderID == upstreamOrderID {
+			return i
+		}
+	}
+	return -1
+}
+
+// Key builds the store key for an order
+func Key(kind Kind, merchantID, orderID string) string {
+	return string(kind) + ":" + merchantID + ":" + orderID
+}
+
+// Transition moves the order to status, recording it in the history
+func (o *Order) Transition(to Status, upstream string, at time.Time) error {
+	if !CanTransition(o.Status, to) {
+		return fmt.Errorf("order %s cannot move from %s to %s", o.ID, o.Status, to)
+	}
+	o.History = append(o.History, Transition{From: o.Status, To: to, At: at, Upstream: upstream})
+	o.Status = to
+	o.UpdatedAt = at
+	return nil
+}
+
+func (o Order) clone() Order {
+	o.History = append([]Transition(nil), o.History...)
+	o.Attempts = append([]Attempt(nil), o.Attempts...)
+	o.Refunds = append([]Refund(nil), o.Refunds...)
+	if o.Action != nil {
+		action := *o.Action
+		o.Action = &action
+	}
+	return o
+}
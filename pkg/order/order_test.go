@@ -0,0 +1,131 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNormalizeStatus(t *testing.T) {
+	cases := map[string]Status{
+		"completed":      StatusSucceeded,
+		"TRADE_SUCCESS":  StatusSucceeded,
+		" Paid ":         StatusSucceeded,
+		"WAIT_BUYER_PAY": StatusPending,
+		"TRADE_CLOSED":   StatusClosed,
+		"processing":     StatusProcessing,
+		"something_new":  "",
+	}
+	for raw, want := range cases {
+		if got := NormalizeStatus(raw); got != want {
+			t.Errorf("Expected %q to normalize to %q, got %q", raw, want, got)
+		}
+	}
+}
+
+func TestTransitions(t *testing.T) {
+	o := Order{ID: "O1", Kind: KindCollect, Status: StatusPending}
+	now := time.Now()
+
+	if err := o.Transition(StatusSucceeded, "paid", now); err != nil {
+		t.Fatalf("Transition failed: %v", err)
+	}
+	if err := o.Transition(StatusFailed, "failed", now); err == nil {
+		t.Error("Expected error when a succeeded order fails")
+	}
+	if err := o.Transition(StatusRefunded, "refunded", now); err != nil {
+		t.Fatalf("Expected succeeded order to be refundable: %v", err)
+	}
+	if !o.Status.Terminal() {
+		t.Error("Expected refunded to be terminal")
+	}
+	if len(o.History) != 2 || o.History[0].From != StatusPending {
+		t.Errorf("Expected two transitions in history, got %+v", o.History)
+	}
+}
+
+func TestMemoryStoreVersioning(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	o := Order{ID: "O1", Kind: KindPayout, MerchantID: "M1", Status: StatusPending}
+
+	if err := store.Create(ctx, o); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := store.Create(ctx, o); !errors.Is(err, ErrExists) {
+		t.Errorf("Expected ErrExists when creating twice, got %v", err)
+	}
+	if _, err := store.Get(ctx, KindCollect, "M1", "O1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected collect and payout orders to be separate, got %v", err)
+	}
+
+	first, _ := store.Get(ctx, KindPayout, "M1", "O1")
+	second, _ := store.Get(ctx, KindPayout, "M1", "O1")
+
+	first.Status = StatusProcessing
+	if err := store.Update(ctx, first); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	second.Status = StatusFailed
+	if err := store.Update(ctx, second); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict for a stale update, got %v", err)
+	}
+
+	current, _ := store.Get(ctx, KindPayout, "M1", "O1")
+	if current.Status != StatusProcessing || current.Version != 2 {
+		t.Errorf("Expected processing at version 2, got %s at %d", current.Status, current.Version)
+	}
+
+	if open, _ := store.ListOpen(ctx); len(open) != 1 || open[0].ID != "O1" {
+		t.Errorf("Expected the processing order listed as open, got %+v", open)
+	}
+	current.Status = StatusSucceeded
+	if err := store.Update(ctx, current); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if open, _ := store.ListOpen(ctx); len(open) != 0 {
+		t.Errorf("Expected no open orders once settled, got %+v", open)
+	}
+}
+
+func TestMemoryStoreFindUpstream(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for _, o := range []Order{
+		{ID: "O1", Kind: KindCollect, MerchantID: "M1", ChannelID: "alipay"},
+		{ID: "O1", Kind: KindPayout, MerchantID: "M1", ChannelID: "alipay"},
+		{ID: "O2", Kind: KindCollect, MerchantID: "M2", ChannelID: "wechat", UpstreamOrderID: "O2-1"},
+		{ID: "O3", Kind: KindCollect, MerchantID: "M2", ChannelID: "wechat", UpstreamOrderID: "O3__2", Attempts: []Attempt{
+			{ChannelID: "alipay", UpstreamOrderID: "O3"},
+			{ChannelID: "wechat", UpstreamOrderID: "O3__2"},
+		}},
+	} {
+		if err := store.Create(ctx, o); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+
+	found, err := store.FindUpstream(ctx, KindPayout, "alipay", "O1")
+	if err != nil || found.Kind != KindPayout || found.MerchantID != "M1" {
+		t.Errorf("Expected the payout O1 of M1, got %+v, %v", found, err)
+	}
+	found, err = store.FindUpstream(ctx, KindCollect, "wechat", "O2-1")
+	if err != nil || found.ID != "O2" {
+		t.Errorf("Expected O2 by its upstream order ID, got %+v, %v", found, err)
+	}
+	if _, err := store.FindUpstream(ctx, KindCollect, "wechat", "O2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an ID the channel never saw, got %v", err)
+	}
+	if _, err := store.FindUpstream(ctx, KindCollect, "alipay", "O2-1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound on another channel, got %v", err)
+	}
+
+	found, err = store.FindUpstream(ctx, KindCollect, "alipay", "O3")
+	if err != nil || found.ID != "O3" || found.EarlierAttempt("alipay", "O3") != 0 {
+		t.Errorf("Expected O3 by its first attempt, got %+v, %v", found, err)
+	}
+	if found.EarlierAttempt("wechat", "O3__2") != -1 {
+		t.Error("Expected the attempt the order is on not to be an earlier one")
+	}
+}
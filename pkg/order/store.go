@@ -0,0 +1,149 @@
+package order
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Store persists orders
+type Store interface {
+	// Create stores a new order at version 1
+	Create(ctx context.Context, o Order) error
+	Get(ctx context.Context, kind Kind, merchantID, orderID string) (Order, error)
+	// Update replaces an order if its version is unchanged since it was read,
+	// and increments the version
+	Update(ctx context.Context, o Order) error
+	// List returns the orders of a merchant, or of all merchants when
+	// merchantID is empty, oldest first
+	List(ctx context.Context, merchantID string) ([]Order, error)
+	// ListOpen returns the orders of all merchants whose status is open,
+	// see Status.Open, oldest first
+	ListOpen(ctx context.Context) ([]Order, error)
+	// FindUpstream returns the order of kind a channel knows as
+	// upstreamOrderID, see Order.UpstreamID, including orders that channel
+	// was an earlier attempt at placing, see Order.EarlierAttempt
+	FindUpstream(ctx context.Context, kind Kind, channelID, upstreamOrderID string) (Order, error)
+}
+
+// MemoryStore keeps orders in memory
+type MemoryStore struct {
+	mutex  sync.RWMutex
+	orders map[string]Order
+	// open holds the keys of orders whose status is open
+	open map[string]bool
+}
+
+// NewMemoryStore creates an empty in-memory order store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{orders: make(map[string]Order), open: make(map[string]bool)}
+}
+
+// put stores o under key and keeps the open index in step
+func (ms *MemoryStore) put(key string, o Order) {
+	ms.orders[key] = o.clone()
+	if o.Status.Open() {
+		ms.open[key] = true
+	} else {
+		delete(ms.open, key)
+	}
+}
+
+// Create implements Store
+func (ms *MemoryStore) Create(ctx context.Context, o Order) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	key := o.Key()
+	if _, exists := ms.orders[key]; exists {
+		return fmt.Errorf("%w: %s", ErrExists, key)
+	}
+	o.Version = 1
+	ms.put(key, o)
+	return nil
+}
+
+// Get implements Store
+func (ms *MemoryStore) Get(ctx context.Context, kind Kind, merchantID, orderID string) (Order, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	o, exists := ms.orders[Key(kind, merchantID, orderID)]
+	if !exists {
+		return Order{}, fmt.Errorf("%w: %s", ErrNotFound, Key(kind, merchantID, orderID))
+	}
+	return o.clone(), nil
+}
+
+// Update implements Store
+func (ms *MemoryStore) Update(ctx context.Context, o Order) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	key := o.Key()
+	current, exists := ms.orders[key]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if current.Version != o.Version {
+		return fmt.Errorf("%w: %s is at version %d, not %d", ErrVersionConflict, key, current.Version, o.Version)
+	}
+	o.Version++
+	ms.put(key, o)
+	return nil
+}
+
+// List implements Store
+func (ms *MemoryStore) List(ctx context.Context, merchantID string) ([]Order, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	var result []Order
+	for _, o := range ms.orders {
+		if merchantID == "" || o.MerchantID == merchantID {
+			result = append(result, o.clone())
+		}
+	}
+	sortOrders(result)
+	return result, nil
+}
+
+// ListOpen implements Store
+func (ms *MemoryStore) ListOpen(ctx context.Context) ([]Order, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	result := make([]Order, 0, len(ms.open))
+	for key := range ms.open {
+		result = append(result, ms.orders[key].clone())
+	}
+	sortOrders(result)
+	return result, nil
+}
+
+// sortOrders sorts orders oldest first
+func sortOrders(orders []Order) {
+	sort.Slice(orders, func(i, j int) bool {
+		if !orders[i].CreatedAt.Equal(orders[j].CreatedAt) {
+			return orders[i].CreatedAt.Before(orders[j].CreatedAt)
+		}
+		return orders[i].Key() < orders[j].Key()
+	})
+}
+
+// FindUpstream implements Store
+func (ms *MemoryStore) FindUpstream(ctx context.Context, kind Kind, channelID, upstreamOrderID string) (Order, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	for _, o := range ms.orders {
+		if o.Kind != kind {
+			continue
+		}
+		if (o.ChannelID == channelID && o.UpstreamID() == upstreamOrderID) || o.EarlierAttempt(channelID, upstreamOrderID) >= 0 {
+			return o.clone(), nil
+		}
+	}
+	return Order{}, fmt.Errorf("%w: %s order %s on channel %s", ErrNotFound, kind, upstreamOrderID, channelID)
+}
@@ -0,0 +1,157 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"payment_go/pkg/interfaces"
+)
+
+// DefaultDrainTimeout bounds how long UnloadPlugin and Close wait for
+// in-flight calls before shutting a plugin down anyway
+const DefaultDrainTimeout = 30 * time.Second
+
+// callTracker counts the calls in flight on one plugin instance. Each
+// instance gets its own tracker, so a replaced instance can be drained while
+// its successor serves new calls.
+type callTracker struct {
+	wg     sync.WaitGroup
+	active atomic.Int64
+}
+
+func (ct *callTracker) start() func() {
+	ct.wg.Add(1)
+	ct.active.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ct.active.Add(-1)
+			ct.wg.Done()
+		})
+	}
+}
+
+// wait blocks until no calls are in flight or ctx is done
+func (ct *callTracker) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		ct.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d call(s) still in flight: %w", ct.active.Load(), ctx.Err())
+	}
+}
+
+// Acquire returns the plugin for channelID and marks a call as in flight
+// until release is called. Callers must call release exactly once when the
+// call returns; UnloadPlugin and reconfiguration wait for released calls
+// before shutting the instance down. Further calls to release are no-ops.
+func (pl *PluginLoader) Acquire(channelID string) (interfaces.Plugin, func(), error) {
+	return pl.acquire(channelID, true)
+}
+
+// acquire marks a call as in flight, counting it as usage only if counted
+// is set; health probes are tracked but not counted
+func (pl *PluginLoader) acquire(channelID string, counted bool) (interfaces.Plugin, func(), error) {
+	pl.mutex.Lock()
+	defer pl.mutex.Unlock()
+
+	loadedPlugin, exists := pl.plugins[channelID]
+	if !exists {
+		return nil, nil, fmt.Errorf("plugin for channel %s not found", channelID)
+	}
+
+	if counted {
+		loadedPlugin.LastUsed = time.Now()
+		loadedPlugin.UsageCount++
+	}
+
+	return loadedPlugin.Instance, loadedPlugin.calls.start(), nil
+}
+
+// UnloadPluginWithContext stops routing calls to channelID, waits for its
+// in-flight calls until ctx is done and then shuts the plugin down. The
+// channel is removed even if draining or shutdown fails.
+func (pl *PluginLoader) UnloadPluginWithContext(ctx context.Context, channelID string) error {
+	pl.mutex.Lock()
+	loadedPlugin, exists := pl.plugins[channelID]
+	delete(pl.plugins, channelID)
+	pl.mutex.Unlock()
+
+	if !exists {
+		return fmt.Errorf("plugin for channel %s not found", channelID)
+	}
+
+	// Note: Go plugins cannot be fully unloaded from memory
+	// We can only remove the reference
+	return retire(ctx, channelID, loadedPlugin.Instance, loadedPlugin.calls)
+}
+
+// Shutdown unloads every plugin, draining and shutting them down
+// concurrently until ctx is done
+func (pl *PluginLoader) Shutdown(ctx context.Context) error {
+	pl.mutex.Lock()
+	plugins := pl.plugins
+	pl.plugins = make(map[string]*LoadedPlugin)
+	pl.mutex.Unlock()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 0, len(plugins))
+	var errsMutex sync.Mutex
+	for channelID, loadedPlugin := range plugins {
+		wg.Add(1)
+		go func(channelID string, loadedPlugin *LoadedPlugin) {
+			defer wg.Done()
+			if err := retire(ctx, channelID, loadedPlugin.Instance, loadedPlugin.calls); err != nil {
+				errsMutex.Lock()
+				errs = append(errs, err)
+				errsMutex.Unlock()
+			}
+		}(channelID, loadedPlugin)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// retireInBackground retires an instance that was replaced by a new one
+func (pl *PluginLoader) retireInBackground(channelID string, instance interfaces.Plugin, calls *callTracker) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultDrainTimeout)
+		defer cancel()
+		if err := retire(ctx, channelID, instance, calls); err != nil {
+			pl.logger.Error("failed to retire replaced plugin instance", "channel_id", channelID, "error", err)
+		}
+	}()
+}
+
+// retire waits for an instance's in-flight calls and shuts it down. The
+// instance must already be unreachable for new calls.
+func retire(ctx context.Context, channelID string, instance interfaces.Plugin, calls *callTracker) error {
+	var errs []error
+	if err := calls.wait(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if shutdowner, ok := instance.(interfaces.Shutdowner); ok {
+		if err := shutdowner.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if closer, ok := instance.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("channel %s: %w", channelID, err)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package plugin
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"payment_go/pkg/interfaces"
+)
+
+// HealthStatus summarizes a channel's probe results
+type HealthStatus string
+
+// Health statuses
+const (
+	// HealthUnknown means the plugin has not been probed yet, or cannot be
+	// because it does not implement interfaces.HealthProber
+	HealthUnknown HealthStatus = "unknown"
+	// HealthHealthy means the last probe succeeded in time
+	HealthHealthy HealthStatus = "healthy"
+	// HealthDegraded means the last probe was slow, or failed fewer than
+	// UnhealthyAfter times in a row
+	HealthDegraded HealthStatus = "degraded"
+	// HealthUnhealthy means the last UnhealthyAfter probes failed
+	HealthUnhealthy HealthStatus = "unhealthy"
+)
+
+// HealthRecord is the probe state of one channel
+type HealthRecord struct {
+	Status HealthStatus `json:"status"`
+	// Active is true when the plugin implements interfaces.HealthProber
+	Active              bool          `json:"active"`
+	Latency             time.Duration `json:"latency_ns"`
+	LastError           string        `json:"last_error,omitempty"`
+	LastChecked         time.Time     `json:"last_checked"`
+	LastSuccess         time.Time     `json:"last_success"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+}
+
+// Ready reports whether the channel should receive traffic. Channels that
+// cannot be probed are assumed ready; probed channels must have completed a
+// probe and not be unhealthy.
+func (hr HealthRecord) Ready() bool {
+	if !hr.Active {
+		return true
+	}
+	return hr.Status == HealthHealthy || hr.Status == HealthDegraded
+}
+
+// HealthOptions control active health probing
+type HealthOptions struct {
+	// Timeout bounds each probe
+	Timeout time.Duration
+	// UnhealthyAfter is the number of consecutive failures after which a
+	// channel is unhealthy rather than degraded
+	UnhealthyAfter int
+	// DegradedLatency marks successful probes slower than this as degraded;
+	// zero disables the check
+	DegradedLatency time.Duration
+}
+
+// Health probing defaults
+const (
+	DefaultProbeTimeout   = 5 * time.Second
+	DefaultUnhealthyAfter = 3
+	DefaultProbeInterval  = 30 * time.Second
+)
+
+func (ho HealthOptions) withDefaults() HealthOptions {
+	if ho.Timeout <= 0 {
+		ho.Timeout = DefaultProbeTimeout
+	}
+	if ho.UnhealthyAfter <= 0 {
+		ho.UnhealthyAfter = DefaultUnhealthyAfter
+	}
+	return ho
+}
+
+func newHealthRecord(instance interfaces.Plugin) HealthRecord {
+	_, active := instance.(interfaces.HealthProber)
+	return HealthRecord{Status: HealthUnknown, Active: active}
+}
+
+// SetHealthOptions sets the options used by ProbeAll
+func (pl *PluginLoader) SetHealthOptions(opts HealthOptions) {
+	pl.mutex.Lock()
+	defer pl.mutex.Unlock()
+
+	pl.healthOptions = opts.withDefaults()
+}
+
+// ProbeAll probes every plugin implementing interfaces.HealthProber
+// concurrently and records the results
+func (pl *PluginLoader) ProbeAll(ctx context.Context) {
+	pl.mutex.RLock()
+	opts := pl.healthOptions.withDefaults()
+	var channels []string
+	for channelID, loadedPlugin := range pl.plugins {
+		if _, ok := loadedPlugin.Instance.(interfaces.HealthProber); ok {
+			channels = append(channels, channelID)
+		}
+	}
+	pl.mutex.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, channelID := range channels {
+		wg.Add(1)
+		go func(channelID string) {
+			defer wg.Done()
+			pl.probe(ctx, channelID, opts)
+		}(channelID)
+	}
+	wg.Wait()
+}
+
+// probe runs one probe as a tracked call, so unloading waits for it. Probes
+// do not count as usage.
+func (pl *PluginLoader) probe(ctx context.Context, channelID string, opts HealthOptions) {
+	instance, release, err := pl.acquire(channelID, false)
+	if err != nil {
+		return
+	}
+	defer release()
+
+	prober, ok := instance.(interfaces.HealthProber)
+	if !ok {
+		return
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	start := time.Now()
+	err = prober.Probe(probeCtx)
+	latency := time.Since(start)
+
+	pl.mutex.Lock()
+	defer pl.mutex.Unlock()
+
+	loadedPlugin, exists := pl.plugins[channelID]
+	if !exists {
+		return
+	}
+	record := &loadedPlugin.Health
+	record.Active = true
+	record.Latency = latency
+	record.LastChecked = start
+	if err != nil {
+		record.ConsecutiveFailures++
+		record.LastError = err.Error()
+		if record.ConsecutiveFailures >= opts.UnhealthyAfter {
+			record.Status = HealthUnhealthy
+		} else {
+			record.Status = HealthDegraded
+		}
+		return
+	}
+
+	record.ConsecutiveFailures = 0
+	record.LastError = ""
+	record.LastSuccess = start
+	record.Status = HealthHealthy
+	if opts.DegradedLatency > 0 && latency > opts.DegradedLatency {
+		record.Status = HealthDegraded
+	}
+}
+
+// WatchHealth probes all plugins immediately and then every interval until
+// ctx is done. A non-positive interval means DefaultProbeInterval.
+func (pl *PluginLoader) WatchHealth(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultProbeInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		pl.ProbeAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Health returns the health record of every loaded channel
+func (pl *PluginLoader) Health() map[string]HealthRecord {
+	pl.mutex.RLock()
+	defer pl.mutex.RUnlock()
+
+	health := make(map[string]HealthRecord, len(pl.plugins))
+	for channelID, loadedPlugin := range pl.plugins {
+		health[channelID] = loadedPlugin.Health
+	}
+	return health
+}
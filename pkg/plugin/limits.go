@@ -0,0 +1,189 @@
+package plugin
+
+import (
+	"fmt"
+	"time"
+	// Plugins name their timezone; embedding the database means loading
+	// them does not depend on the host having one
+	_ "time/tzdata"
+
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/money"
+)
+
+// Limits are a plugin's declared operating limits, compiled for checking
+// orders against them
+type Limits struct {
+	declared interfaces.OperatingLimits
+	location *time.Location
+	// windows are maintenance windows as minutes of the day
+	windows [][2]int
+	// cutoff is the payout cutoff as a minute of the day, -1 when none
+	cutoff int
+}
+
+// compileLimits validates the operating limits in info. It returns nil when
+// the plugin declares none.
+func compileLimits(info *interfaces.PluginInfo) (*Limits, error) {
+	declared := info.OperatingLimits
+	if len(declared.Currencies) == 0 && len(declared.Limits) == 0 && len(declared.PaymentMethods) == 0 &&
+		declared.Timezone == "" && len(declared.MaintenanceWindows) == 0 && declared.PayoutCutoff == "" {
+		return nil, nil
+	}
+
+	limits := &Limits{declared: declared, location: time.UTC, cutoff: -1}
+	for _, currency := range declared.Currencies {
+		if currency == "" {
+			return nil, fmt.Errorf("currencies must not be empty")
+		}
+	}
+	for _, method := range declared.PaymentMethods {
+		if !interfaces.KnownPaymentMethod(method) {
+			return nil, fmt.Errorf("unknown payment method %q", method)
+		}
+	}
+	for _, limit := range declared.Limits {
+		if !contains(info.Capabilities, limit.Operation) {
+			return nil, fmt.Errorf("amount limit for %q, which is not a declared capability", limit.Operation)
+		}
+		if limit.Min < 0 || limit.Max < 0 {
+			return nil, fmt.Errorf("amount limit for %s must not be negative", limit.Operation)
+		}
+		if limit.Max != 0 && limit.Max < limit.Min {
+			return nil, fmt.Errorf("amount limit for %s has max below min", limit.Operation)
+		}
+		currencies := declared.Currencies
+		if limit.Currency != "" {
+			currencies = []string{limit.Currency}
+		}
+		for _, currency := range currencies {
+			if _, _, err := minorBounds(limit, currency); err != nil {
+				return nil, fmt.Errorf("amount limit for %s: %w", limit.Operation, err)
+			}
+		}
+	}
+
+	if declared.Timezone != "" {
+		location, err := time.LoadLocation(declared.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone: %w", err)
+		}
+		limits.location = location
+	}
+	for _, window := range declared.MaintenanceWindows {
+		start, err := minuteOfDay(window.Start)
+		if err != nil {
+			return nil, fmt.Errorf("maintenance window start: %w", err)
+		}
+		end, err := minuteOfDay(window.End)
+		if err != nil {
+			return nil, fmt.Errorf("maintenance window end: %w", err)
+		}
+		if start == end {
+			return nil, fmt.Errorf("maintenance window %s-%s is empty", window.Start, window.End)
+		}
+		limits.windows = append(limits.windows, [2]int{start, end})
+	}
+	if declared.PayoutCutoff != "" {
+		cutoff, err := minuteOfDay(declared.PayoutCutoff)
+		if err != nil {
+			return nil, fmt.Errorf("payout cutoff: %w", err)
+		}
+		limits.cutoff = cutoff
+	}
+	return limits, nil
+}
+
+// minuteOfDay parses a "15:04" time of day
+func minuteOfDay(clock string) (int, error) {
+	parsed, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time of day such as \"23:30\"", clock)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// minorBounds converts limit's bounds to minor units of currency, the units
+// orders are checked and routed in
+func minorBounds(limit interfaces.AmountLimit, currency string) (int64, int64, error) {
+	lower, err := money.ToMinor(limit.Min, currency)
+	if err != nil {
+		return 0, 0, err
+	}
+	upper, err := money.ToMinor(limit.Max, currency)
+	if err != nil {
+		return 0, 0, err
+	}
+	return lower, upper, nil
+}
+
+// Check reports why the channel cannot take an order for amount, in minor
+// units of currency, paid by method, at the given time, or nil if it can.
+// An empty method is not checked. Errors read as a predicate of the
+// channel, e.g. "does not accept USD". A nil *Limits allows anything.
+func (l *Limits) Check(operation, method, currency string, amount int64, at time.Time) error {
+	if l == nil {
+		return nil
+	}
+	if method != "" && len(l.declared.PaymentMethods) > 0 && !contains(l.declared.PaymentMethods, method) {
+		return fmt.Errorf("does not support payment method %s", method)
+	}
+	if len(l.declared.Currencies) > 0 && !contains(l.declared.Currencies, currency) {
+		return fmt.Errorf("does not accept %s", currency)
+	}
+	for _, limit := range l.declared.Limits {
+		if limit.Operation != operation || (limit.Currency != "" && limit.Currency != currency) {
+			continue
+		}
+		lower, upper, err := minorBounds(limit, currency)
+		if err != nil {
+			return fmt.Errorf("cannot apply its %s amount limit to %s: %v", operation, currency, err)
+		}
+		if amount < lower {
+			return fmt.Errorf("requires at least %s %s for %s", money.Format(lower, currency), currency, operation)
+		}
+		if upper != 0 && amount > upper {
+			return fmt.Errorf("accepts at most %s %s for %s", money.Format(upper, currency), currency, operation)
+		}
+	}
+
+	local := at.In(l.location)
+	minute := local.Hour()*60 + local.Minute()
+	for i, window := range l.windows {
+		start, end := window[0], window[1]
+		inside := start <= minute && minute < end
+		if start > end {
+			inside = minute >= start || minute < end
+		}
+		if inside {
+			return fmt.Errorf("is in maintenance until %s %s", l.declared.MaintenanceWindows[i].End, l.location)
+		}
+	}
+	if operation == "payout_order" && l.cutoff >= 0 && minute >= l.cutoff {
+		return fmt.Errorf("takes no payouts after %s %s", l.declared.PayoutCutoff, l.location)
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckOrder reports why channelID cannot take an order at the given time,
+// or nil if it can; see Limits.Check. Channels without a plugin are not
+// checked.
+func (pl *PluginLoader) CheckOrder(channelID, operation, method, currency string, amount int64, at time.Time) error {
+	pl.mutex.RLock()
+	var limits *Limits
+	if loadedPlugin, exists := pl.plugins[channelID]; exists {
+		limits = loadedPlugin.Limits
+	}
+	pl.mutex.RUnlock()
+
+	return limits.Check(operation, method, currency, amount, at)
+}
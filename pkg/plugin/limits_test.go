@@ -0,0 +1,124 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"payment_go/pkg/interfaces"
+)
+
+func limitedInfo(limits interfaces.OperatingLimits) *interfaces.PluginInfo {
+	return &interfaces.PluginInfo{
+		Name:            "Limited",
+		Version:         "1.0.0",
+		ChannelType:     "limited",
+		Capabilities:    []string{"collect_order", "payout_order"},
+		OperatingLimits: limits,
+	}
+}
+
+func TestLimitsCheck(t *testing.T) {
+	limits, err := compileLimits(limitedInfo(interfaces.OperatingLimits{
+		Currencies:     []string{"CNY", "USD"},
+		PaymentMethods: []string{interfaces.PaymentMethodQRCode, interfaces.PaymentMethodWAP},
+		Limits: []interfaces.AmountLimit{
+			{Operation: "collect_order", Min: 0.01, Max: 50000},
+			{Operation: "payout_order", Currency: "USD", Max: 1000},
+		},
+		MaintenanceWindows: []interfaces.DailyWindow{{Start: "23:50", End: "00:10"}},
+		PayoutCutoff:       "17:00",
+	}))
+	if err != nil {
+		t.Fatalf("compileLimits failed: %v", err)
+	}
+
+	noon := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name      string
+		operation string
+		method    string
+		currency  string
+		amount    int64
+		at        time.Time
+		refusal   string
+	}{
+		{"allowed", "collect_order", "", "CNY", 10000, noon, ""},
+		{"payment method", "collect_order", "wap", "CNY", 10000, noon, ""},
+		{"unsupported payment method", "collect_order", "app", "CNY", 10000, noon, "does not support payment method app"},
+		{"currency", "collect_order", "", "EUR", 10000, noon, "does not accept EUR"},
+		{"below min", "collect_order", "", "CNY", 0, noon, "requires at least 0.01 CNY"},
+		{"above max", "collect_order", "", "CNY", 5000001, noon, "accepts at most 50000.00 CNY"},
+		{"currency specific", "payout_order", "", "USD", 150000, noon, "accepts at most 1000.00 USD"},
+		{"other currency", "payout_order", "", "CNY", 150000, noon, ""},
+		{"maintenance before midnight", "collect_order", "", "CNY", 10000, noon.Add(11*time.Hour + 55*time.Minute), "is in maintenance until 00:10"},
+		{"maintenance after midnight", "collect_order", "", "CNY", 10000, noon.Add(12*time.Hour + 5*time.Minute), "is in maintenance until 00:10"},
+		{"after maintenance", "collect_order", "", "CNY", 10000, noon.Add(12*time.Hour + 10*time.Minute), ""},
+		{"payout cutoff", "payout_order", "", "CNY", 10000, noon.Add(5 * time.Hour), "takes no payouts after 17:00"},
+		{"collections after cutoff", "collect_order", "", "CNY", 10000, noon.Add(5 * time.Hour), ""},
+	}
+	for _, c := range cases {
+		err := limits.Check(c.operation, c.method, c.currency, c.amount, c.at)
+		if c.refusal == "" && err != nil {
+			t.Errorf("%s: expected order to be allowed, got %v", c.name, err)
+		}
+		if c.refusal != "" && (err == nil || !strings.Contains(err.Error(), c.refusal)) {
+			t.Errorf("%s: expected %q, got %v", c.name, c.refusal, err)
+		}
+	}
+
+	shanghai, err := compileLimits(limitedInfo(interfaces.OperatingLimits{Timezone: "Asia/Shanghai", PayoutCutoff: "17:00"}))
+	if err != nil {
+		t.Fatalf("compileLimits failed: %v", err)
+	}
+	if err := shanghai.Check("payout_order", "", "CNY", 10000, time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)); err == nil {
+		t.Error("Expected the cutoff to apply in the plugin's timezone")
+	}
+
+	var none *Limits
+	if err := none.Check("collect_order", "app", "XXX", 1e12, noon); err != nil {
+		t.Errorf("Expected a plugin without limits to allow anything, got %v", err)
+	}
+}
+
+func TestPluginInfoIsCompiled(t *testing.T) {
+	loader := NewPluginLoader()
+	info := limitedInfo(interfaces.OperatingLimits{Currencies: []string{"CNY"}})
+	if err := loader.RegisterPlugin("limited", &MockPlugin{info: info}); err != nil {
+		t.Fatalf("RegisterPlugin failed: %v", err)
+	}
+
+	// The plugin changing its info afterwards changes nothing enforced
+	info.OperatingLimits = interfaces.OperatingLimits{Currencies: []string{"USD"}}
+	got, err := loader.GetPluginInfo("limited")
+	if err != nil {
+		t.Fatalf("GetPluginInfo failed: %v", err)
+	}
+	if len(got.Currencies) != 1 || got.Currencies[0] != "CNY" {
+		t.Errorf("expected the compiled currencies, got %v", got.Currencies)
+	}
+	if err := loader.CheckOrder("limited", "collect_order", "", "CNY", 100, time.Now()); err != nil {
+		t.Errorf("expected the compiled limits to allow CNY, got %v", err)
+	}
+}
+
+func TestInvalidLimitsRejectedAtLoad(t *testing.T) {
+	invalid := map[string]interfaces.OperatingLimits{
+		"undeclared operation": {Limits: []interfaces.AmountLimit{{Operation: "refund", Max: 10}}},
+		"inverted limit":       {Limits: []interfaces.AmountLimit{{Operation: "collect_order", Min: 10, Max: 5}}},
+		"bad timezone":         {Timezone: "Mars/Olympus_Mons"},
+		"bad window":           {MaintenanceWindows: []interfaces.DailyWindow{{Start: "25:00", End: "01:00"}}},
+		"empty window":         {MaintenanceWindows: []interfaces.DailyWindow{{Start: "01:00", End: "01:00"}}},
+		"bad cutoff":           {PayoutCutoff: "5pm"},
+		"empty currency":       {Currencies: []string{""}},
+		"unknown method":       {PaymentMethods: []string{"cash"}},
+		"sub-minor limit":      {Currencies: []string{"JPY"}, Limits: []interfaces.AmountLimit{{Operation: "collect_order", Min: 0.5}}},
+	}
+	for name, limits := range invalid {
+		loader := NewPluginLoader()
+		plugin := &MockPlugin{info: limitedInfo(limits)}
+		if err := loader.RegisterPlugin("limited", plugin); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
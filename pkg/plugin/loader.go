@@ -1,18 +1,34 @@
 package plugin
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"plugin"
+	"strings"
 	"sync"
 	"time"
 
+	"payment_go/pkg/host"
 	"payment_go/pkg/interfaces"
+	"payment_go/pkg/logging"
+	"payment_go/pkg/schema"
+	"payment_go/pkg/secrets"
 )
 
 // PluginLoader manages the loading and lifecycle of payment channel plugins
 type PluginLoader struct {
 	plugins map[string]*LoadedPlugin
 	mutex   sync.RWMutex
+	logger  *slog.Logger
+	host    *host.Host
+
+	healthOptions HealthOptions
+
+	// replaceMutex serializes initializations, reconfigurations and reloads,
+	// which run plugin code without holding mutex
+	replaceMutex sync.Mutex
 }
 
 // LoadedPlugin represents a loaded plugin with its metadata and instance
@@ -24,15 +40,282 @@ type LoadedPlugin struct {
 	LoadedAt   time.Time
 	LastUsed   time.Time
 	UsageCount int64
+	// Config is the configuration the instance was last initialized with,
+	// with secret:// references left unresolved
+	Config map[string]interface{}
+	// Schema is the compiled Info.ConfigSchema, nil when the plugin declares none
+	Schema *schema.Schema
+	// Limits are the compiled Info.OperatingLimits, nil when the plugin declares none
+	Limits *Limits
+	// InFlight is the number of calls in flight, as of a ListPlugins snapshot
+	InFlight int64
+	// Health is the channel's latest probe state
+	Health HealthRecord
+
+	// secretsFingerprint identifies the secret values Config resolved to
+	secretsFingerprint string
+	// factory creates fresh instances for reconfiguration and reload; nil
+	// for instances passed to RegisterPlugin
+	factory Factory
+	// calls tracks the calls in flight on Instance
+	calls *callTracker
 }
 
 // NewPluginLoader creates a new plugin loader instance
 func NewPluginLoader() *PluginLoader {
 	return &PluginLoader{
 		plugins: make(map[string]*LoadedPlugin),
+		logger:  logging.Default(),
+		host:    host.New(host.Config{}),
+	}
+}
+
+// SetHost sets the host whose services are given to HostAware plugins
+func (pl *PluginLoader) SetHost(h *host.Host) {
+	pl.mutex.Lock()
+	defer pl.mutex.Unlock()
+
+	pl.host = h
+}
+
+// SetLogger sets the logger handed to plugins loaded after this call.
+// The logger should redact personal data, see logging.NewHandler.
+func (pl *PluginLoader) SetLogger(logger *slog.Logger) {
+	pl.mutex.Lock()
+	defer pl.mutex.Unlock()
+
+	pl.logger = logger
+}
+
+// injectLogger gives LoggerAware plugins a logger scoped to their channel
+func (pl *PluginLoader) injectLogger(channelID string, instance interfaces.Plugin, info *interfaces.PluginInfo) {
+	if aware, ok := instance.(interfaces.LoggerAware); ok && pl.logger != nil {
+		aware.SetLogger(pl.channelLogger(channelID, info))
 	}
 }
 
+func (pl *PluginLoader) channelLogger(channelID string, info *interfaces.PluginInfo) *slog.Logger {
+	return pl.logger.With("channel_id", channelID, "plugin", info.Name)
+}
+
+// ValidatePluginConfig resolves secret references in config and checks it
+// against the plugin's schema and its own ValidateConfig without initializing
+// it. It returns the cleaned config the plugin would be initialized with.
+func (pl *PluginLoader) ValidatePluginConfig(channelID string, config map[string]interface{}) (map[string]interface{}, error) {
+	pl.mutex.RLock()
+	loadedPlugin, exists := pl.plugins[channelID]
+	accessor := pl.host.Secrets()
+	pl.mutex.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("plugin for channel %s not found", channelID)
+	}
+	resolved, _, err := resolveSecrets(channelID, accessor, config)
+	if err != nil {
+		return nil, err
+	}
+	return validateConfig(channelID, loadedPlugin.Instance, loadedPlugin.Schema, resolved)
+}
+
+// resolveSecrets replaces secret:// references in config. Resolved values
+// are registered with the logging package so they are scrubbed from logs.
+func resolveSecrets(channelID string, accessor interfaces.SecretsAccessor, config map[string]interface{}) (map[string]interface{}, string, error) {
+	resolved, values, err := secrets.Resolve(context.Background(), accessor, config)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to resolve secrets for channel %s: %w", channelID, err)
+	}
+	for _, value := range values {
+		logging.RegisterSecrets(value)
+	}
+	return resolved, secrets.Fingerprint(values), nil
+}
+
+// validateConfig applies the schema and the plugin's own validation
+func validateConfig(channelID string, instance interfaces.Plugin, configSchema *schema.Schema, config map[string]interface{}) (map[string]interface{}, error) {
+	// Registered before validating, since errors may quote the values
+	registerConfigSecrets(config, configSchema)
+
+	// Defaults and type coercion come from the declared schema, so plugins
+	// receive a clean, typed config
+	if configSchema != nil {
+		cleaned, err := configSchema.Apply(config)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config for channel %s: %w", channelID, err)
+		}
+		config = cleaned
+	}
+
+	if err := instance.ValidateConfig(config); err != nil {
+		return nil, fmt.Errorf("invalid config for channel %s: %w", channelID, err)
+	}
+	return config, nil
+}
+
+// InitializePlugin validates config and initializes the plugin for channelID.
+// String values of the form "secret://name" are resolved through the host's
+// secrets provider just before initialization; the plugin sees the secret
+// values, while the loader only keeps the references.
+// Plugins implementing interfaces.HostAware receive host services through
+// InitializeWithHost; all others are initialized with Initialize.
+func (pl *PluginLoader) InitializePlugin(channelID string, config map[string]interface{}) error {
+	pl.replaceMutex.Lock()
+	defer pl.replaceMutex.Unlock()
+
+	loadedPlugin, current, services, err := pl.lookup(channelID)
+	if err != nil {
+		return err
+	}
+
+	// Plugin code runs without the loader lock so slow initialization does
+	// not block calls to other channels
+	resolved, fingerprint, err := pl.prepareConfig(channelID, current, services, config)
+	if err != nil {
+		return err
+	}
+	if err := initializeInstance(channelID, current.Instance, services, resolved); err != nil {
+		return err
+	}
+
+	pl.mutex.Lock()
+	loadedPlugin.Config = config
+	loadedPlugin.secretsFingerprint = fingerprint
+	pl.mutex.Unlock()
+
+	return nil
+}
+
+// ReconfigurePlugin applies a new config to the plugin serving channelID
+// while it keeps serving traffic. The config is resolved and validated
+// first; if that fails nothing changes. Plugins implementing
+// interfaces.Reconfigurable apply it themselves. Otherwise a fresh instance
+// is created and initialized with the new config, then swapped in, so calls
+// already in flight finish on the old instance and its old config.
+func (pl *PluginLoader) ReconfigurePlugin(channelID string, config map[string]interface{}) error {
+	pl.replaceMutex.Lock()
+	defer pl.replaceMutex.Unlock()
+
+	return pl.reconfigure(channelID, config)
+}
+
+// reconfigure implements ReconfigurePlugin; the caller holds replaceMutex
+func (pl *PluginLoader) reconfigure(channelID string, config map[string]interface{}) error {
+	loadedPlugin, current, services, err := pl.lookup(channelID)
+	if err != nil {
+		return err
+	}
+	resolved, fingerprint, err := pl.prepareConfig(channelID, current, services, config)
+	if err != nil {
+		return err
+	}
+
+	if reconfigurable, ok := current.Instance.(interfaces.Reconfigurable); ok {
+		if err := reconfigurable.Reconfigure(resolved); err != nil {
+			return fmt.Errorf("failed to reconfigure plugin for channel %s: %w", channelID, err)
+		}
+		pl.mutex.Lock()
+		loadedPlugin.Config = config
+		loadedPlugin.secretsFingerprint = fingerprint
+		pl.mutex.Unlock()
+		return nil
+	}
+
+	if current.factory == nil {
+		return fmt.Errorf("plugin for channel %s cannot be reconfigured: it does not implement Reconfigure and was registered without a factory", channelID)
+	}
+	instance, compiled, err := pl.newInstance(channelID, current.factory, services, resolved)
+	if err != nil {
+		return err
+	}
+	return pl.swapInstance(channelID, loadedPlugin, instance, compiled, config, fingerprint)
+}
+
+// lookup returns the channel's entry, a copy of it taken under the read lock
+// and the channel's host services
+func (pl *PluginLoader) lookup(channelID string) (*LoadedPlugin, LoadedPlugin, interfaces.HostServices, error) {
+	pl.mutex.RLock()
+	defer pl.mutex.RUnlock()
+
+	loadedPlugin, exists := pl.plugins[channelID]
+	if !exists {
+		return nil, LoadedPlugin{}, interfaces.HostServices{}, fmt.Errorf("plugin for channel %s not found", channelID)
+	}
+	services := pl.host.ForChannel(channelID, pl.channelLogger(channelID, loadedPlugin.Info))
+	return loadedPlugin, *loadedPlugin, services, nil
+}
+
+// prepareConfig resolves secrets in config and validates the result
+func (pl *PluginLoader) prepareConfig(channelID string, current LoadedPlugin, services interfaces.HostServices, config map[string]interface{}) (map[string]interface{}, string, error) {
+	resolved, fingerprint, err := resolveSecrets(channelID, services.Secrets, config)
+	if err != nil {
+		return nil, "", err
+	}
+	resolved, err = validateConfig(channelID, current.Instance, current.Schema, resolved)
+	if err != nil {
+		return nil, "", err
+	}
+	return resolved, fingerprint, nil
+}
+
+// initializeInstance hands a validated config to a plugin instance
+func initializeInstance(channelID string, instance interfaces.Plugin, services interfaces.HostServices, config map[string]interface{}) error {
+	var err error
+	if aware, ok := instance.(interfaces.HostAware); ok {
+		err = aware.InitializeWithHost(config, services)
+	} else {
+		err = instance.Initialize(config)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to initialize plugin for channel %s: %w", channelID, err)
+	}
+	return nil
+}
+
+// newInstance creates an instance with factory and initializes it with
+// config, which must already be validated. A nil config leaves the instance
+// uninitialized.
+func (pl *PluginLoader) newInstance(channelID string, factory Factory, services interfaces.HostServices, config map[string]interface{}) (interfaces.Plugin, compiledInfo, error) {
+	instance := factory()
+	if instance == nil {
+		return nil, compiledInfo{}, fmt.Errorf("plugin factory for channel %s returned nil", channelID)
+	}
+	compiled, err := compileInfo(instance.GetInfo())
+	if err != nil {
+		return nil, compiledInfo{}, fmt.Errorf("plugin for channel %s validation failed: %w", channelID, err)
+	}
+	if aware, ok := instance.(interfaces.LoggerAware); ok && services.Logger != nil {
+		aware.SetLogger(services.Logger)
+	}
+	if config != nil {
+		if err := initializeInstance(channelID, instance, services, config); err != nil {
+			return nil, compiledInfo{}, err
+		}
+	}
+	return instance, compiled, nil
+}
+
+// swapInstance replaces the instance serving channelID. Calls acquired on the
+// old instance finish on it; it is shut down once they have.
+func (pl *PluginLoader) swapInstance(channelID string, loadedPlugin *LoadedPlugin, instance interfaces.Plugin, compiled compiledInfo, config map[string]interface{}, fingerprint string) error {
+	pl.mutex.Lock()
+	defer pl.mutex.Unlock()
+
+	if pl.plugins[channelID] != loadedPlugin {
+		return fmt.Errorf("plugin for channel %s was unloaded while being replaced", channelID)
+	}
+	old, oldCalls := loadedPlugin.Instance, loadedPlugin.calls
+	loadedPlugin.Instance = instance
+	loadedPlugin.Info = compiled.info
+	loadedPlugin.Schema = compiled.schema
+	loadedPlugin.Limits = compiled.limits
+	loadedPlugin.Config = config
+	loadedPlugin.secretsFingerprint = fingerprint
+	loadedPlugin.calls = &callTracker{}
+	loadedPlugin.Health.Active = newHealthRecord(instance).Active
+
+	pl.retireInBackground(channelID, old, oldCalls)
+	return nil
+}
+
 // LoadPlugin loads a payment channel plugin from a .so file
 func (pl *PluginLoader) LoadPlugin(pluginPath, channelID string) error {
 	pl.mutex.Lock()
@@ -43,51 +326,107 @@ func (pl *PluginLoader) LoadPlugin(pluginPath, channelID string) error {
 		return fmt.Errorf("plugin for channel %s is already loaded", channelID)
 	}
 
+	p, newPlugin, err := openPlugin(pluginPath)
+	if err != nil {
+		return err
+	}
+
+	// Create plugin instance
+	instance := newPlugin()
+
+	// Validate plugin info
+	compiled, err := compileInfo(instance.GetInfo())
+	if err != nil {
+		return fmt.Errorf("plugin %s validation failed: %w", pluginPath, err)
+	}
+
+	pl.injectLogger(channelID, instance, compiled.info)
+
+	// Store the loaded plugin
+	pl.plugins[channelID] = &LoadedPlugin{
+		Path:     pluginPath,
+		Plugin:   p,
+		Instance: instance,
+		Info:     compiled.info,
+		LoadedAt: time.Now(),
+		Schema:   compiled.schema,
+		Limits:   compiled.limits,
+		Health:   newHealthRecord(instance),
+		factory:  newPlugin,
+		calls:    &callTracker{},
+	}
+
+	return nil
+}
+
+// openPlugin opens a .so file and looks up its NewPlugin constructor
+func openPlugin(pluginPath string) (*plugin.Plugin, Factory, error) {
 	// Open the .so file
 	p, err := plugin.Open(pluginPath)
 	if err != nil {
-		return fmt.Errorf("failed to open plugin %s: %w", pluginPath, err)
+		return nil, nil, fmt.Errorf("failed to open plugin %s: %w", pluginPath, err)
 	}
 
 	// Look up the required symbols
 	newPluginFunc, err := p.Lookup("NewPlugin")
 	if err != nil {
-		return fmt.Errorf("plugin %s missing NewPlugin function: %w", pluginPath, err)
+		return nil, nil, fmt.Errorf("plugin %s missing NewPlugin function: %w", pluginPath, err)
 	}
 
 	// Type assert the function
 	newPlugin, ok := newPluginFunc.(func() interfaces.Plugin)
 	if !ok {
-		return fmt.Errorf("plugin %s NewPlugin function has wrong signature", pluginPath)
+		return nil, nil, fmt.Errorf("plugin %s NewPlugin function has wrong signature", pluginPath)
 	}
 
-	// Create plugin instance
-	instance := newPlugin()
+	return p, newPlugin, nil
+}
 
-	// Get plugin info
-	info := instance.GetInfo()
+// RegisterPlugin registers an already constructed plugin instance for a channel.
+// This is used for plugins compiled into the gateway binary and in tests, where
+// there is no .so file to open.
+func (pl *PluginLoader) RegisterPlugin(channelID string, instance interfaces.Plugin) error {
+	return pl.registerPlugin(channelID, instance, nil)
+}
 
-	// Validate plugin info
-	if err := pl.validatePluginInfo(info); err != nil {
-		return fmt.Errorf("plugin %s validation failed: %w", pluginPath, err)
+func (pl *PluginLoader) registerPlugin(channelID string, instance interfaces.Plugin, factory Factory) error {
+	pl.mutex.Lock()
+	defer pl.mutex.Unlock()
+
+	if _, exists := pl.plugins[channelID]; exists {
+		return fmt.Errorf("plugin for channel %s is already loaded", channelID)
+	}
+	if instance == nil {
+		return fmt.Errorf("plugin instance for channel %s is nil", channelID)
 	}
 
-	// Store the loaded plugin
+	compiled, err := compileInfo(instance.GetInfo())
+	if err != nil {
+		return fmt.Errorf("plugin for channel %s validation failed: %w", channelID, err)
+	}
+
+	pl.injectLogger(channelID, instance, compiled.info)
+
 	pl.plugins[channelID] = &LoadedPlugin{
-		Path:     pluginPath,
-		Plugin:   p,
 		Instance: instance,
-		Info:     info,
+		Info:     compiled.info,
 		LoadedAt: time.Now(),
+		Schema:   compiled.schema,
+		Limits:   compiled.limits,
+		Health:   newHealthRecord(instance),
+		factory:  factory,
+		calls:    &callTracker{},
 	}
 
 	return nil
 }
 
-// GetPlugin retrieves a loaded plugin by channel ID
+// GetPlugin retrieves a loaded plugin by channel ID. Calls made on the
+// returned instance are not tracked, so UnloadPlugin will not wait for them;
+// use Acquire for calls that should be drained.
 func (pl *PluginLoader) GetPlugin(channelID string) (interfaces.Plugin, error) {
-	pl.mutex.RLock()
-	defer pl.mutex.RUnlock()
+	pl.mutex.Lock()
+	defer pl.mutex.Unlock()
 
 	loadedPlugin, exists := pl.plugins[channelID]
 	if !exists {
@@ -101,36 +440,249 @@ func (pl *PluginLoader) GetPlugin(channelID string) (interfaces.Plugin, error) {
 	return loadedPlugin.Instance, nil
 }
 
-// UnloadPlugin unloads a plugin and removes it from memory
+// UnloadPlugin stops routing calls to a plugin, waits up to
+// DefaultDrainTimeout for its in-flight calls and shuts it down
 func (pl *PluginLoader) UnloadPlugin(channelID string) error {
-	pl.mutex.Lock()
-	defer pl.mutex.Unlock()
-
-	_, exists := pl.plugins[channelID]
-	if !exists {
-		return fmt.Errorf("plugin for channel %s not found", channelID)
-	}
-
-	// Note: Go plugins cannot be fully unloaded from memory
-	// We can only remove the reference
-	delete(pl.plugins, channelID)
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultDrainTimeout)
+	defer cancel()
 
-	return nil
+	return pl.UnloadPluginWithContext(ctx, channelID)
 }
 
-// ListPlugins returns information about all loaded plugins
+// ListPlugins returns information about all loaded plugins. The entries are
+// snapshots whose Config has secret fields redacted, so they are safe to
+// log or expose.
 func (pl *PluginLoader) ListPlugins() map[string]*LoadedPlugin {
 	pl.mutex.RLock()
 	defer pl.mutex.RUnlock()
 
 	result := make(map[string]*LoadedPlugin)
 	for k, v := range pl.plugins {
-		result[k] = v
+		snapshot := *v
+		snapshot.Config = redactConfig(v.Config, v.Schema)
+		snapshot.InFlight = v.calls.active.Load()
+		result[k] = &snapshot
 	}
 	return result
 }
 
-// GetPluginInfo returns metadata for a specific plugin
+// redactedValue replaces secret config values in ListPlugins output
+const redactedValue = "[REDACTED]"
+
+// redactConfig returns a copy of config with every field the schema marks
+// writeOnly, and every field whose key names a credential at any depth,
+// replaced by redactedValue. secret:// references are kept, since they name
+// a secret without revealing it.
+func redactConfig(config map[string]interface{}, configSchema *schema.Schema) map[string]interface{} {
+	if config == nil {
+		return nil
+	}
+	redacted := copyConfig(config)
+	redactSecretKeys(redacted)
+	if configSchema == nil {
+		return redacted
+	}
+	for _, field := range configSchema.SecretFields() {
+		redactField(redacted, strings.Split(field, "."))
+	}
+	return redacted
+}
+
+// redactSecretKeys redacts the values of keys logging.SecretKey matches,
+// descending into objects and arrays
+func redactSecretKeys(value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range v {
+			if logging.SecretKey(key) && nested != nil && !secrets.IsReference(nested) {
+				v[key] = redactedValue
+				continue
+			}
+			redactSecretKeys(nested)
+		}
+	case []interface{}:
+		for _, item := range v {
+			redactSecretKeys(item)
+		}
+	}
+}
+
+// registerConfigSecrets registers the string values of secret fields with
+// the logging package, as resolveSecrets does for secret:// references, so
+// credentials written inline in config are scrubbed from logs too
+func registerConfigSecrets(config map[string]interface{}, configSchema *schema.Schema) {
+	values := secretKeyValues(config, nil)
+	if configSchema != nil {
+		for _, field := range configSchema.SecretFields() {
+			values = fieldValues(config, strings.Split(field, "."), values)
+		}
+	}
+	logging.RegisterSecrets(values...)
+}
+
+// secretKeyValues appends the strings held under keys logging.SecretKey
+// matches, descending into objects and arrays
+func secretKeyValues(value interface{}, values []string) []string {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range v {
+			if logging.SecretKey(key) {
+				values = stringValues(nested, values)
+				continue
+			}
+			values = secretKeyValues(nested, values)
+		}
+	case []interface{}:
+		for _, item := range v {
+			values = secretKeyValues(item, values)
+		}
+	}
+	return values
+}
+
+// fieldValues appends the strings held at the dotted path in config
+func fieldValues(config map[string]interface{}, path []string, values []string) []string {
+	value, ok := config[path[0]]
+	if !ok {
+		return values
+	}
+	if len(path) > 1 {
+		if nested, ok := value.(map[string]interface{}); ok {
+			return fieldValues(nested, path[1:], values)
+		}
+		return values
+	}
+	return stringValues(value, values)
+}
+
+// stringValues appends every string in value
+func stringValues(value interface{}, values []string) []string {
+	switch v := value.(type) {
+	case string:
+		values = append(values, v)
+	case map[string]interface{}:
+		for _, nested := range v {
+			values = stringValues(nested, values)
+		}
+	case []interface{}:
+		for _, item := range v {
+			values = stringValues(item, values)
+		}
+	}
+	return values
+}
+
+func redactField(config map[string]interface{}, path []string) {
+	value, ok := config[path[0]]
+	if !ok {
+		return
+	}
+	if len(path) > 1 {
+		if nested, ok := value.(map[string]interface{}); ok {
+			redactField(nested, path[1:])
+		}
+		return
+	}
+	if !secrets.IsReference(value) {
+		config[path[0]] = redactedValue
+	}
+}
+
+func copyConfig(config map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(config))
+	for k, v := range config {
+		copied[k] = copyValue(v)
+	}
+	return copied
+}
+
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return copyConfig(v)
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = copyValue(item)
+		}
+		return copied
+	}
+	return value
+}
+
+// RefreshSecrets re-resolves the secret references of every initialized
+// plugin and reconfigures the plugins whose secrets have changed
+func (pl *PluginLoader) RefreshSecrets(ctx context.Context) error {
+	pl.mutex.RLock()
+	var channelIDs []string
+	for channelID, loadedPlugin := range pl.plugins {
+		if loadedPlugin.secretsFingerprint != "" {
+			channelIDs = append(channelIDs, channelID)
+		}
+	}
+	pl.mutex.RUnlock()
+
+	var errs []error
+	for _, channelID := range channelIDs {
+		if err := pl.refreshSecrets(ctx, channelID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// refreshSecrets reconfigures the plugin for channelID if its secrets have
+// changed. The config is read under replaceMutex, so a concurrent
+// ReconfigurePlugin is never undone with the config it replaced.
+func (pl *PluginLoader) refreshSecrets(ctx context.Context, channelID string) error {
+	pl.replaceMutex.Lock()
+	defer pl.replaceMutex.Unlock()
+
+	pl.mutex.RLock()
+	loadedPlugin, exists := pl.plugins[channelID]
+	var config map[string]interface{}
+	var fingerprint string
+	if exists {
+		config, fingerprint = loadedPlugin.Config, loadedPlugin.secretsFingerprint
+	}
+	accessor := pl.host.Secrets()
+	pl.mutex.RUnlock()
+	if fingerprint == "" {
+		// Unloaded, or no longer referencing secrets
+		return nil
+	}
+
+	_, values, err := secrets.Resolve(ctx, accessor, config)
+	if err != nil {
+		return fmt.Errorf("failed to resolve secrets for channel %s: %w", channelID, err)
+	}
+	if secrets.Fingerprint(values) == fingerprint {
+		return nil
+	}
+
+	pl.logger.Info("channel secrets rotated, reconfiguring plugin", "channel_id", channelID)
+	return pl.reconfigure(channelID, config)
+}
+
+// WatchSecrets calls RefreshSecrets every interval until ctx is done
+func (pl *PluginLoader) WatchSecrets(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := pl.RefreshSecrets(ctx); err != nil {
+				pl.logger.Error("secret refresh failed", "error", err)
+			}
+		}
+	}
+}
+
+// GetPluginInfo returns metadata for a specific plugin, as compiled when it
+// was loaded, which is what routing and limit checks use
 func (pl *PluginLoader) GetPluginInfo(channelID string) (*interfaces.PluginInfo, error) {
 	pl.mutex.RLock()
 	defer pl.mutex.RUnlock()
@@ -140,48 +692,100 @@ func (pl *PluginLoader) GetPluginInfo(channelID string) (*interfaces.PluginInfo,
 		return nil, fmt.Errorf("plugin for channel %s not found", channelID)
 	}
 
-	return loadedPlugin.Instance.GetInfo(), nil
+	return loadedPlugin.Info, nil
+}
+
+// compiledInfo is a plugin's info with its config schema and operating
+// limits compiled
+type compiledInfo struct {
+	info   *interfaces.PluginInfo
+	schema *schema.Schema
+	limits *Limits
 }
 
-// validatePluginInfo validates that a plugin has the required metadata
-func (pl *PluginLoader) validatePluginInfo(info *interfaces.PluginInfo) error {
+// compileInfo validates that a plugin has the required metadata and
+// compiles its config schema and operating limits
+func compileInfo(info *interfaces.PluginInfo) (compiledInfo, error) {
 	if info == nil {
-		return fmt.Errorf("plugin info is nil")
+		return compiledInfo{}, fmt.Errorf("plugin info is nil")
 	}
 	if info.Name == "" {
-		return fmt.Errorf("plugin name is required")
+		return compiledInfo{}, fmt.Errorf("plugin name is required")
 	}
 	if info.Version == "" {
-		return fmt.Errorf("plugin version is required")
+		return compiledInfo{}, fmt.Errorf("plugin version is required")
 	}
 	if info.ChannelType == "" {
-		return fmt.Errorf("plugin channel type is required")
+		return compiledInfo{}, fmt.Errorf("plugin channel type is required")
 	}
 	if len(info.Capabilities) == 0 {
-		return fmt.Errorf("plugin must declare at least one capability")
+		return compiledInfo{}, fmt.Errorf("plugin must declare at least one capability")
 	}
 
-	return nil
+	// A copy, so the plugin changing its info later cannot make it disagree
+	// with the compiled schema and limits
+	copied := *info
+	compiled := compiledInfo{info: &copied}
+	if len(info.ConfigSchema) > 0 {
+		configSchema, err := schema.Compile(info.ConfigSchema)
+		if err != nil {
+			return compiledInfo{}, fmt.Errorf("invalid config schema: %w", err)
+		}
+		compiled.schema = configSchema
+	}
+	limits, err := compileLimits(info)
+	if err != nil {
+		return compiledInfo{}, fmt.Errorf("invalid operating limits: %w", err)
+	}
+	compiled.limits = limits
+	return compiled, nil
 }
 
-// ReloadPlugin reloads a plugin from disk (useful for development/testing)
+// ReloadPlugin replaces the plugin for channelID with a fresh instance,
+// initialized with its current config if it has one. The old instance keeps
+// serving until the new one is ready, and stays in place if reloading fails.
+//
+// Go caches plugins by path for the life of the process, so reloading a .so
+// plugin re-runs the constructor of the code already in memory; changes to
+// the file on disk take effect only after a restart. To change settings, use
+// ReconfigurePlugin instead.
 func (pl *PluginLoader) ReloadPlugin(channelID string) error {
-	pl.mutex.Lock()
-	defer pl.mutex.Unlock()
+	pl.replaceMutex.Lock()
+	defer pl.replaceMutex.Unlock()
 
-	loadedPlugin, exists := pl.plugins[channelID]
-	if !exists {
-		return fmt.Errorf("plugin for channel %s not found", channelID)
+	loadedPlugin, current, services, err := pl.lookup(channelID)
+	if err != nil {
+		return err
 	}
 
-	// Unload current plugin
-	delete(pl.plugins, channelID)
+	factory := current.factory
+	if current.Path != "" {
+		// plugin.Open returns the cached plugin, but still verifies the path
+		if _, factory, err = openPlugin(current.Path); err != nil {
+			return err
+		}
+	}
+	if factory == nil {
+		return fmt.Errorf("plugin for channel %s was registered as an instance and cannot be reloaded", channelID)
+	}
 
-	// Reload from disk
-	return pl.LoadPlugin(loadedPlugin.Path, channelID)
+	var resolved map[string]interface{}
+	var fingerprint string
+	if current.Config != nil {
+		if resolved, fingerprint, err = pl.prepareConfig(channelID, current, services, current.Config); err != nil {
+			return err
+		}
+	}
+	instance, compiled, err := pl.newInstance(channelID, factory, services, resolved)
+	if err != nil {
+		return err
+	}
+	return pl.swapInstance(channelID, loadedPlugin, instance, compiled, current.Config, fingerprint)
 }
 
-// HealthCheck performs a basic health check on all loaded plugins
+// HealthCheck reports whether each loaded plugin is usable: it must return
+// its info and, if it is probed, must not be unhealthy. See Health for the
+// full probe records.
 func (pl *PluginLoader) HealthCheck() map[string]bool {
 	pl.mutex.RLock()
 	defer pl.mutex.RUnlock()
@@ -190,7 +794,16 @@ func (pl *PluginLoader) HealthCheck() map[string]bool {
 	for channelID, loadedPlugin := range pl.plugins {
 		// Try to get plugin info as a basic health check
 		info := loadedPlugin.Instance.GetInfo()
-		health[channelID] = info != nil
+		health[channelID] = info != nil && loadedPlugin.Health.Status != HealthUnhealthy
 	}
 	return health
 }
+
+// Close unloads every plugin, waiting up to DefaultDrainTimeout for
+// in-flight calls, and releases their resources such as plugin subprocesses
+func (pl *PluginLoader) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultDrainTimeout)
+	defer cancel()
+
+	return pl.Shutdown(ctx)
+}
@@ -1,11 +1,19 @@
 package plugin
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"payment_go/pkg/host"
 	"payment_go/pkg/interfaces"
+	"payment_go/pkg/logging"
+	"payment_go/pkg/secrets"
 )
 
 // MockPlugin implements the interfaces.Plugin for testing
@@ -61,8 +69,6 @@ func TestNewPluginLoader(t *testing.T) {
 }
 
 func TestValidatePluginInfo(t *testing.T) {
-	loader := NewPluginLoader()
-
 	// Test valid plugin info
 	validInfo := &interfaces.PluginInfo{
 		Name:         "Test Plugin",
@@ -71,7 +77,7 @@ func TestValidatePluginInfo(t *testing.T) {
 		Capabilities: []string{"collect_order"},
 	}
 
-	err := loader.validatePluginInfo(validInfo)
+	_, err := compileInfo(validInfo)
 	if err != nil {
 		t.Errorf("Valid plugin info should not cause error: %v", err)
 	}
@@ -131,7 +137,7 @@ func TestValidatePluginInfo(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			err := loader.validatePluginInfo(tc.info)
+			_, err := compileInfo(tc.info)
 			if tc.shouldError && err == nil {
 				t.Errorf("Expected error for %s, but got none", tc.name)
 			}
@@ -194,3 +200,741 @@ func TestLoadedPluginFields(t *testing.T) {
 		t.Errorf("Expected usage count 42, got %d", plugin.UsageCount)
 	}
 }
+
+// HostAwarePlugin records the host services it was initialized with
+type HostAwarePlugin struct {
+	MockPlugin
+	host        *interfaces.HostServices
+	initialized bool
+}
+
+func (hp *HostAwarePlugin) Initialize(config map[string]interface{}) error {
+	hp.initialized = true
+	return nil
+}
+
+func (hp *HostAwarePlugin) InitializeWithHost(config map[string]interface{}, host interfaces.HostServices) error {
+	hp.host = &host
+	return nil
+}
+
+// RejectingPlugin fails config validation
+type RejectingPlugin struct {
+	MockPlugin
+}
+
+func (rp *RejectingPlugin) ValidateConfig(config map[string]interface{}) error {
+	return errors.New("missing app_id")
+}
+
+func testInfo() *interfaces.PluginInfo {
+	return &interfaces.PluginInfo{
+		Name:         "Test Plugin",
+		Version:      "1.0.0",
+		ChannelType:  "test",
+		Capabilities: []string{"collect_order"},
+	}
+}
+
+func TestInitializePlugin(t *testing.T) {
+	loader := NewPluginLoader()
+
+	aware := &HostAwarePlugin{MockPlugin: MockPlugin{info: testInfo()}}
+	if err := loader.RegisterPlugin("aware", aware); err != nil {
+		t.Fatalf("RegisterPlugin failed: %v", err)
+	}
+	plain := &MockPlugin{info: testInfo()}
+	if err := loader.RegisterPlugin("plain", plain); err != nil {
+		t.Fatalf("RegisterPlugin failed: %v", err)
+	}
+	if err := loader.RegisterPlugin("plain", plain); err == nil {
+		t.Error("Expected error when registering a channel twice")
+	}
+
+	config := map[string]interface{}{"key": "value"}
+	if err := loader.InitializePlugin("aware", config); err != nil {
+		t.Fatalf("InitializePlugin failed: %v", err)
+	}
+	if aware.host == nil || aware.initialized {
+		t.Fatal("HostAware plugins should be initialized through InitializeWithHost")
+	}
+	if aware.host.Logger == nil || aware.host.HTTPClient == nil || aware.host.Clock == nil || aware.host.KV == nil || aware.host.Secrets == nil {
+		t.Errorf("host services should be fully populated: %+v", aware.host)
+	}
+
+	if err := loader.InitializePlugin("plain", config); err != nil {
+		t.Fatalf("InitializePlugin failed for plain plugin: %v", err)
+	}
+	if loader.ListPlugins()["plain"].Config["key"] != "value" {
+		t.Error("Initialized config should be recorded on the loaded plugin")
+	}
+
+	if err := loader.RegisterPlugin("rejecting", &RejectingPlugin{MockPlugin: MockPlugin{info: testInfo()}}); err != nil {
+		t.Fatalf("RegisterPlugin failed: %v", err)
+	}
+	if err := loader.InitializePlugin("rejecting", config); err == nil {
+		t.Error("Expected error when config validation fails")
+	}
+	if err := loader.InitializePlugin("non_existent", config); err == nil {
+		t.Error("Expected error when initializing non-existent plugin")
+	}
+}
+
+// ConfigRecordingPlugin records the config it was initialized with
+type ConfigRecordingPlugin struct {
+	MockPlugin
+	config map[string]interface{}
+}
+
+func (cp *ConfigRecordingPlugin) Initialize(config map[string]interface{}) error {
+	cp.config = config
+	return nil
+}
+
+func (cp *ConfigRecordingPlugin) Reconfigure(config map[string]interface{}) error {
+	cp.config = config
+	return nil
+}
+
+func TestInitializePluginAppliesSchema(t *testing.T) {
+	loader := NewPluginLoader()
+
+	info := testInfo()
+	info.ConfigSchema = map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"app_id"},
+		"properties": map[string]interface{}{
+			"app_id":        map[string]interface{}{"type": "string"},
+			"mock_delay_ms": map[string]interface{}{"type": "integer", "default": 100},
+		},
+	}
+	recorder := &ConfigRecordingPlugin{MockPlugin: MockPlugin{info: info}}
+	if err := loader.RegisterPlugin("schema", recorder); err != nil {
+		t.Fatalf("RegisterPlugin failed: %v", err)
+	}
+
+	if err := loader.InitializePlugin("schema", map[string]interface{}{}); err == nil {
+		t.Error("Expected error when a required field is missing")
+	}
+	if recorder.config != nil {
+		t.Error("Plugin should not be initialized with an invalid config")
+	}
+
+	if err := loader.InitializePlugin("schema", map[string]interface{}{"app_id": "2021", "mock_delay_ms": float64(50)}); err != nil {
+		t.Fatalf("InitializePlugin failed: %v", err)
+	}
+	if delay, ok := recorder.config["mock_delay_ms"].(int); !ok || delay != 50 {
+		t.Errorf("Expected mock_delay_ms coerced to int 50, got %#v", recorder.config["mock_delay_ms"])
+	}
+
+	invalid := testInfo()
+	invalid.ConfigSchema = map[string]interface{}{"type": "decimal"}
+	if err := loader.RegisterPlugin("invalid", &MockPlugin{info: invalid}); err == nil {
+		t.Error("Expected error when registering a plugin with an invalid schema")
+	}
+}
+
+// rotatingSecrets is a secrets provider whose values can be changed
+type rotatingSecrets struct {
+	mutex  sync.Mutex
+	values map[string]string
+	// onGet, when set, runs before each lookup
+	onGet func()
+}
+
+func (rs *rotatingSecrets) GetSecret(ctx context.Context, name string) (string, error) {
+	if rs.onGet != nil {
+		rs.onGet()
+	}
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	value, ok := rs.values[name]
+	if !ok {
+		return "", secrets.ErrNotFound
+	}
+	return value, nil
+}
+
+func (rs *rotatingSecrets) set(name, value string) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	rs.values[name] = value
+}
+
+func TestInitializePluginResolvesSecrets(t *testing.T) {
+	provider := &rotatingSecrets{values: map[string]string{"alipay.private_key": "private-key-v1"}}
+	loader := NewPluginLoader()
+	loader.SetHost(host.New(host.Config{Secrets: provider}))
+
+	info := testInfo()
+	info.ConfigSchema = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"app_id":      map[string]interface{}{"type": "string"},
+			"private_key": map[string]interface{}{"type": "string", "writeOnly": true},
+			"public_key":  map[string]interface{}{"type": "string", "writeOnly": true},
+		},
+	}
+	recorder := &ConfigRecordingPlugin{MockPlugin: MockPlugin{info: info}}
+	if err := loader.RegisterPlugin("alipay", recorder); err != nil {
+		t.Fatalf("RegisterPlugin failed: %v", err)
+	}
+
+	config := map[string]interface{}{
+		"app_id":      "2021",
+		"private_key": "secret://alipay.private_key",
+		"public_key":  "inline-public-key",
+	}
+	if err := loader.InitializePlugin("alipay", config); err != nil {
+		t.Fatalf("InitializePlugin failed: %v", err)
+	}
+	if recorder.config["private_key"] != "private-key-v1" {
+		t.Errorf("plugin should receive the resolved secret, got %v", recorder.config["private_key"])
+	}
+
+	listed := loader.ListPlugins()["alipay"].Config
+	if listed["private_key"] != "secret://alipay.private_key" {
+		t.Errorf("ListPlugins should keep secret references, got %v", listed["private_key"])
+	}
+	if listed["public_key"] != "[REDACTED]" || listed["app_id"] != "2021" {
+		t.Errorf("ListPlugins should redact writeOnly values only, got %v", listed)
+	}
+
+	// Unchanged secrets leave the plugin alone
+	recorder.config = nil
+	if err := loader.RefreshSecrets(context.Background()); err != nil {
+		t.Fatalf("RefreshSecrets failed: %v", err)
+	}
+	if recorder.config != nil {
+		t.Error("plugin should not be reinitialized when secrets are unchanged")
+	}
+
+	provider.set("alipay.private_key", "private-key-v2")
+	if err := loader.RefreshSecrets(context.Background()); err != nil {
+		t.Fatalf("RefreshSecrets failed: %v", err)
+	}
+	if recorder.config["private_key"] != "private-key-v2" {
+		t.Errorf("rotated secret should reinitialize the plugin, got %v", recorder.config["private_key"])
+	}
+
+	if err := loader.InitializePlugin("alipay", map[string]interface{}{"private_key": "secret://missing"}); err == nil {
+		t.Error("Expected error when a referenced secret does not exist")
+	}
+	if _, err := loader.ValidatePluginConfig("alipay", map[string]interface{}{"private_key": "secret://missing"}); err == nil {
+		t.Error("Expected validation error when a referenced secret does not exist")
+	}
+}
+
+func TestRefreshSecretsKeepsNewerConfig(t *testing.T) {
+	provider := &rotatingSecrets{values: map[string]string{"alipay.private_key": "private-key-v1"}}
+	loader := NewPluginLoader()
+	loader.SetHost(host.New(host.Config{Secrets: provider}))
+	recorder := &ConfigRecordingPlugin{MockPlugin: MockPlugin{info: testInfo()}}
+	if err := loader.RegisterPlugin("alipay", recorder); err != nil {
+		t.Fatalf("RegisterPlugin failed: %v", err)
+	}
+	if err := loader.InitializePlugin("alipay", map[string]interface{}{"app_id": "2021", "private_key": "secret://alipay.private_key"}); err != nil {
+		t.Fatalf("InitializePlugin failed: %v", err)
+	}
+
+	// A reconfiguration arrives while the refresh is resolving secrets
+	provider.set("alipay.private_key", "private-key-v2")
+	reconfigured := make(chan error, 1)
+	var once sync.Once
+	provider.onGet = func() {
+		once.Do(func() {
+			go func() {
+				reconfigured <- loader.ReconfigurePlugin("alipay", map[string]interface{}{"app_id": "2022", "private_key": "secret://alipay.private_key"})
+			}()
+			select {
+			case err := <-reconfigured:
+				reconfigured <- err
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+	}
+	if err := loader.RefreshSecrets(context.Background()); err != nil {
+		t.Fatalf("RefreshSecrets failed: %v", err)
+	}
+	if err := <-reconfigured; err != nil {
+		t.Fatalf("ReconfigurePlugin failed: %v", err)
+	}
+
+	if recorder.config["app_id"] != "2022" || loader.ListPlugins()["alipay"].Config["app_id"] != "2022" {
+		t.Errorf("expected the refresh to keep the newer config, got %v", recorder.config)
+	}
+}
+
+// VersionedPlugin reports the config it was initialized with from CollectOrder
+type VersionedPlugin struct {
+	MockPlugin
+	version string
+	started chan struct{}
+	release chan struct{}
+}
+
+func (vp *VersionedPlugin) Initialize(config map[string]interface{}) error {
+	vp.version, _ = config["version"].(string)
+	return nil
+}
+
+func (vp *VersionedPlugin) ValidateConfig(config map[string]interface{}) error {
+	if config["version"] == "bad" {
+		return errors.New("bad version")
+	}
+	return nil
+}
+
+func (vp *VersionedPlugin) CollectOrder(ctx context.Context, req *interfaces.CollectOrderRequest) (*interfaces.CollectOrderResponse, error) {
+	if vp.started != nil {
+		close(vp.started)
+		<-vp.release
+	}
+	return &interfaces.CollectOrderResponse{OrderID: req.OrderID, Status: vp.version}, nil
+}
+
+func TestListPluginsRedactsSecretKeys(t *testing.T) {
+	provider := &rotatingSecrets{values: map[string]string{"alipay.app_secret": "app-secret-v1"}}
+	loader := NewPluginLoader()
+	loader.SetHost(host.New(host.Config{Secrets: provider}))
+
+	// The schema declares the fields but marks none of them writeOnly
+	info := testInfo()
+	info.ConfigSchema = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"app_id":      map[string]interface{}{"type": "string"},
+			"private_key": map[string]interface{}{"type": "string"},
+			"app_secret":  map[string]interface{}{"type": "string"},
+			"merchants":   map[string]interface{}{"type": "array"},
+		},
+	}
+	recorder := &ConfigRecordingPlugin{MockPlugin: MockPlugin{info: info}}
+	if err := loader.RegisterPlugin("alipay", recorder); err != nil {
+		t.Fatalf("RegisterPlugin failed: %v", err)
+	}
+
+	config := map[string]interface{}{
+		"app_id":      "2021",
+		"private_key": "inline-private-key",
+		"app_secret":  "secret://alipay.app_secret",
+		"merchants":   []interface{}{map[string]interface{}{"id": "M1", "api_token": "inline-token"}},
+	}
+	if err := loader.RegisterPlugin("unannotated", &ConfigRecordingPlugin{MockPlugin: MockPlugin{info: testInfo()}}); err != nil {
+		t.Fatalf("RegisterPlugin failed: %v", err)
+	}
+	for _, channelID := range []string{"alipay", "unannotated"} {
+		if err := loader.InitializePlugin(channelID, config); err != nil {
+			t.Fatalf("InitializePlugin failed: %v", err)
+		}
+	}
+
+	for _, channelID := range []string{"alipay", "unannotated"} {
+		listed := loader.ListPlugins()[channelID].Config
+		if listed["private_key"] != redactedValue || listed["app_id"] != "2021" {
+			t.Errorf("%s: expected private_key redacted by its name, got %v", channelID, listed)
+		}
+		if listed["app_secret"] != "secret://alipay.app_secret" {
+			t.Errorf("%s: expected the secret reference kept, got %v", channelID, listed["app_secret"])
+		}
+		merchant := listed["merchants"].([]interface{})[0].(map[string]interface{})
+		if merchant["api_token"] != redactedValue || merchant["id"] != "M1" {
+			t.Errorf("%s: expected nested credentials redacted, got %v", channelID, merchant)
+		}
+	}
+	if nested := config["merchants"].([]interface{})[0].(map[string]interface{}); nested["api_token"] != "inline-token" {
+		t.Errorf("redaction must not modify the loaded config, got %v", nested)
+	}
+}
+
+func TestReconfigurePlugin(t *testing.T) {
+	var created []*VersionedPlugin
+	registerStaticForTest(t, "versioned", func() interfaces.Plugin {
+		vp := &VersionedPlugin{MockPlugin: MockPlugin{info: testInfo()}}
+		created = append(created, vp)
+		return vp
+	})
+
+	loader := NewPluginLoader()
+	if err := loader.LoadStaticPlugin("versioned", "versioned"); err != nil {
+		t.Fatalf("LoadStaticPlugin failed: %v", err)
+	}
+	if err := loader.InitializePlugin("versioned", map[string]interface{}{"version": "v1"}); err != nil {
+		t.Fatalf("InitializePlugin failed: %v", err)
+	}
+
+	// Hold a call open on the v1 instance across the reconfiguration
+	old, _ := loader.GetPlugin("versioned")
+	created[0].started = make(chan struct{})
+	created[0].release = make(chan struct{})
+	inFlight := make(chan string, 1)
+	go func() {
+		resp, _ := old.CollectOrder(context.Background(), &interfaces.CollectOrderRequest{OrderID: "ORDER_001"})
+		inFlight <- resp.Status
+	}()
+	<-created[0].started
+
+	if err := loader.ReconfigurePlugin("versioned", map[string]interface{}{"version": "bad"}); err == nil {
+		t.Error("Expected error when the new config fails validation")
+	}
+	if loader.ListPlugins()["versioned"].Config["version"] != "v1" || len(created) != 1 {
+		t.Error("a rejected config must leave the plugin untouched")
+	}
+
+	if err := loader.ReconfigurePlugin("versioned", map[string]interface{}{"version": "v2"}); err != nil {
+		t.Fatalf("ReconfigurePlugin failed: %v", err)
+	}
+	current, _ := loader.GetPlugin("versioned")
+	resp, _ := current.CollectOrder(context.Background(), &interfaces.CollectOrderRequest{OrderID: "ORDER_002"})
+	if resp.Status != "v2" {
+		t.Errorf("new calls should use the new config, got %s", resp.Status)
+	}
+
+	close(created[0].release)
+	if status := <-inFlight; status != "v1" {
+		t.Errorf("in-flight call should finish on the old config, got %s", status)
+	}
+
+	if err := loader.ReconfigurePlugin("non_existent", nil); err == nil {
+		t.Error("Expected error when reconfiguring non-existent plugin")
+	}
+
+	if err := loader.RegisterPlugin("fixed", &MockPlugin{info: testInfo()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.ReconfigurePlugin("fixed", map[string]interface{}{}); err == nil {
+		t.Error("Expected error reconfiguring a registered instance without Reconfigure")
+	}
+}
+
+func TestReloadPlugin(t *testing.T) {
+	loader := NewPluginLoader()
+	if err := loader.LoadStaticPlugin("test_reload", "reload"); err == nil {
+		t.Fatal("Expected error for unregistered static plugin")
+	}
+
+	registerStaticForTest(t, "test_reload", func() interfaces.Plugin {
+		return &VersionedPlugin{MockPlugin: MockPlugin{info: testInfo()}}
+	})
+	if err := loader.LoadStaticPlugin("test_reload", "reload"); err != nil {
+		t.Fatalf("LoadStaticPlugin failed: %v", err)
+	}
+	if err := loader.InitializePlugin("reload", map[string]interface{}{"version": "v1"}); err != nil {
+		t.Fatalf("InitializePlugin failed: %v", err)
+	}
+	before, _ := loader.GetPlugin("reload")
+
+	done := make(chan error, 1)
+	go func() { done <- loader.ReloadPlugin("reload") }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("ReloadPlugin failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ReloadPlugin deadlocked")
+	}
+
+	after, _ := loader.GetPlugin("reload")
+	if after == before {
+		t.Error("ReloadPlugin should create a new instance")
+	}
+	resp, _ := after.CollectOrder(context.Background(), &interfaces.CollectOrderRequest{})
+	if resp.Status != "v1" {
+		t.Errorf("reloaded instance should be initialized with the current config, got %q", resp.Status)
+	}
+
+	if err := loader.RegisterPlugin("instance", &MockPlugin{info: testInfo()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.ReloadPlugin("instance"); err == nil {
+		t.Error("Expected error reloading a registered instance")
+	}
+	if err := loader.ReloadPlugin("non_existent"); err == nil {
+		t.Error("Expected error reloading non-existent plugin")
+	}
+}
+
+// ShutdownPlugin records when it is shut down
+type ShutdownPlugin struct {
+	MockPlugin
+	shutdown chan struct{}
+}
+
+func (sp *ShutdownPlugin) Shutdown(ctx context.Context) error {
+	close(sp.shutdown)
+	return nil
+}
+
+func newShutdownPlugin() *ShutdownPlugin {
+	return &ShutdownPlugin{MockPlugin: MockPlugin{info: testInfo()}, shutdown: make(chan struct{})}
+}
+
+func TestUnloadPluginDrainsCalls(t *testing.T) {
+	loader := NewPluginLoader()
+	plugin := newShutdownPlugin()
+	if err := loader.RegisterPlugin("drain", plugin); err != nil {
+		t.Fatal(err)
+	}
+
+	_, release, err := loader.Acquire("drain")
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	if inFlight := loader.ListPlugins()["drain"].InFlight; inFlight != 1 {
+		t.Errorf("expected 1 call in flight, got %d", inFlight)
+	}
+
+	unloaded := make(chan error, 1)
+	go func() { unloaded <- loader.UnloadPlugin("drain") }()
+
+	// Routing stops immediately, but shutdown waits for the call
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, probe, err := loader.Acquire("drain")
+		if err != nil {
+			break
+		}
+		probe()
+		if time.Now().After(deadline) {
+			t.Fatal("unloading plugin still accepts calls")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-plugin.shutdown:
+		t.Fatal("plugin shut down while a call was in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	release()
+	release() // extra releases are ignored
+	if err := <-unloaded; err != nil {
+		t.Errorf("UnloadPlugin failed: %v", err)
+	}
+	select {
+	case <-plugin.shutdown:
+	default:
+		t.Error("Shutdown should be called after the call was released")
+	}
+}
+
+func TestUnloadPluginDrainDeadline(t *testing.T) {
+	loader := NewPluginLoader()
+	plugin := newShutdownPlugin()
+	if err := loader.RegisterPlugin("stuck", plugin); err != nil {
+		t.Fatal(err)
+	}
+	_, release, _ := loader.Acquire("stuck")
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := loader.UnloadPluginWithContext(ctx, "stuck")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	select {
+	case <-plugin.shutdown:
+	default:
+		t.Error("Shutdown should still be called when draining times out")
+	}
+	if _, err := loader.GetPlugin("stuck"); err == nil {
+		t.Error("plugin should be removed even when draining times out")
+	}
+}
+
+func TestReplacedInstanceIsShutDown(t *testing.T) {
+	var instances []*ShutdownPlugin
+	var mutex sync.Mutex
+	registerStaticForTest(t, "shutdown_static", func() interfaces.Plugin {
+		mutex.Lock()
+		defer mutex.Unlock()
+		instances = append(instances, newShutdownPlugin())
+		return instances[len(instances)-1]
+	})
+
+	loader := NewPluginLoader()
+	if err := loader.LoadStaticPlugin("shutdown_static", "replace"); err != nil {
+		t.Fatal(err)
+	}
+	_, release, _ := loader.Acquire("replace")
+
+	if err := loader.ReloadPlugin("replace"); err != nil {
+		t.Fatalf("ReloadPlugin failed: %v", err)
+	}
+	select {
+	case <-instances[0].shutdown:
+		t.Fatal("replaced instance shut down while a call was in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	release()
+	select {
+	case <-instances[0].shutdown:
+	case <-time.After(time.Second):
+		t.Fatal("replaced instance was not shut down after draining")
+	}
+
+	if err := loader.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	select {
+	case <-instances[1].shutdown:
+	default:
+		t.Error("Close should shut down the current instance")
+	}
+}
+
+// ProbedPlugin fails its probe while failing is set
+type ProbedPlugin struct {
+	MockPlugin
+	mutex   sync.Mutex
+	failing bool
+	delay   time.Duration
+}
+
+func (pp *ProbedPlugin) Probe(ctx context.Context) error {
+	pp.mutex.Lock()
+	failing, delay := pp.failing, pp.delay
+	pp.mutex.Unlock()
+
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if failing {
+		return errors.New("upstream unreachable")
+	}
+	return nil
+}
+
+func (pp *ProbedPlugin) set(failing bool, delay time.Duration) {
+	pp.mutex.Lock()
+	defer pp.mutex.Unlock()
+
+	pp.failing, pp.delay = failing, delay
+}
+
+func TestHealthProbing(t *testing.T) {
+	loader := NewPluginLoader()
+	loader.SetHealthOptions(HealthOptions{Timeout: 50 * time.Millisecond, UnhealthyAfter: 2, DegradedLatency: 20 * time.Millisecond})
+
+	probed := &ProbedPlugin{MockPlugin: MockPlugin{info: testInfo()}}
+	if err := loader.RegisterPlugin("probed", probed); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.RegisterPlugin("passive", &MockPlugin{info: testInfo()}); err != nil {
+		t.Fatal(err)
+	}
+
+	health := loader.Health()
+	if health["probed"].Status != HealthUnknown || health["probed"].Ready() {
+		t.Errorf("probed channel should not be ready before its first probe: %+v", health["probed"])
+	}
+	if health["passive"].Active || !health["passive"].Ready() {
+		t.Errorf("channels without a prober should be passive and ready: %+v", health["passive"])
+	}
+
+	steps := []struct {
+		failing  bool
+		delay    time.Duration
+		status   HealthStatus
+		failures int
+	}{
+		{false, 0, HealthHealthy, 0},
+		{false, 30 * time.Millisecond, HealthDegraded, 0},
+		{true, 0, HealthDegraded, 1},
+		{true, 0, HealthUnhealthy, 2},
+		{false, 100 * time.Millisecond, HealthUnhealthy, 3}, // timeout counts as failure
+		{false, 0, HealthHealthy, 0},
+	}
+	for i, step := range steps {
+		probed.set(step.failing, step.delay)
+		loader.ProbeAll(context.Background())
+
+		record := loader.Health()["probed"]
+		if record.Status != step.status || record.ConsecutiveFailures != step.failures {
+			t.Errorf("step %d: expected %s with %d failures, got %+v", i, step.status, step.failures, record)
+		}
+		if step.failing && record.LastError != "upstream unreachable" {
+			t.Errorf("step %d: last error not recorded: %+v", i, record)
+		}
+	}
+
+	probed.set(true, 0)
+	loader.ProbeAll(context.Background())
+	loader.ProbeAll(context.Background())
+	if loader.HealthCheck()["probed"] {
+		t.Error("HealthCheck should report unhealthy channels as down")
+	}
+	if !loader.HealthCheck()["passive"] {
+		t.Error("HealthCheck should report passive channels as up")
+	}
+	if usage := loader.plugins["probed"].UsageCount; usage != 0 {
+		t.Errorf("probes should not count as usage, got %d", usage)
+	}
+}
+
+func TestWatchHealthDefaultInterval(t *testing.T) {
+	loader := NewPluginLoader()
+	probed := &ProbedPlugin{MockPlugin: MockPlugin{info: testInfo()}}
+	if err := loader.RegisterPlugin("probed", probed); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		loader.WatchHealth(ctx, 0)
+	}()
+	deadline := time.Now().Add(time.Second)
+	for loader.Health()["probed"].Status == HealthUnknown && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	if status := loader.Health()["probed"].Status; status != HealthHealthy {
+		t.Errorf("expected a zero interval to fall back to the default, got %s", status)
+	}
+}
+
+func TestInlineSecretsAreScrubbed(t *testing.T) {
+	loader := NewPluginLoader()
+	info := testInfo()
+	info.ConfigSchema = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"app_id":     map[string]interface{}{"type": "string"},
+			"public_key": map[string]interface{}{"type": "string", "writeOnly": true},
+			"merchants":  map[string]interface{}{"type": "array"},
+		},
+	}
+	if err := loader.RegisterPlugin("alipay", &ConfigRecordingPlugin{MockPlugin: MockPlugin{info: info}}); err != nil {
+		t.Fatalf("RegisterPlugin failed: %v", err)
+	}
+	config := map[string]interface{}{
+		"app_id":     "2021000123",
+		"public_key": "inline-public-key",
+		"merchants":  []interface{}{map[string]interface{}{"id": "M1", "api_token": "inline-api-token"}},
+	}
+	if err := loader.InitializePlugin("alipay", config); err != nil {
+		t.Fatalf("InitializePlugin failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	logger := logging.New(&buf, slog.LevelInfo, logging.Config{Mode: logging.ModeDevelopment})
+	logger.Info("upstream rejected inline-public-key", "err", errors.New("bad token inline-api-token for app 2021000123"))
+
+	line := buf.String()
+	if strings.Contains(line, "inline-public-key") || strings.Contains(line, "inline-api-token") {
+		t.Errorf("inline secret leaked into log: %s", line)
+	}
+	if !strings.Contains(line, "2021000123") {
+		t.Errorf("expected values of other fields kept: %s", line)
+	}
+}
@@ -0,0 +1,54 @@
+package plugin
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"payment_go/pkg/interfaces"
+)
+
+// Factory creates a new plugin instance
+type Factory func() interfaces.Plugin
+
+var (
+	staticMutex   sync.RWMutex
+	staticPlugins = make(map[string]Factory)
+)
+
+// RegisterStatic makes a plugin compiled into the gateway binary available
+// by name. It is typically called from an init function.
+func RegisterStatic(name string, factory Factory) {
+	staticMutex.Lock()
+	defer staticMutex.Unlock()
+
+	if _, exists := staticPlugins[name]; exists {
+		panic(fmt.Sprintf("static plugin %s registered twice", name))
+	}
+	staticPlugins[name] = factory
+}
+
+// StaticPlugins returns the names of the registered static plugins
+func StaticPlugins() []string {
+	staticMutex.RLock()
+	defer staticMutex.RUnlock()
+
+	names := make([]string, 0, len(staticPlugins))
+	for name := range staticPlugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadStaticPlugin creates an instance of the named static plugin for a channel
+func (pl *PluginLoader) LoadStaticPlugin(name, channelID string) error {
+	staticMutex.RLock()
+	factory, exists := staticPlugins[name]
+	staticMutex.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("static plugin %s is not registered", name)
+	}
+	return pl.registerPlugin(channelID, factory(), factory)
+}
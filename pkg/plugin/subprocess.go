@@ -0,0 +1,678 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"payment_go/pkg/interfaces"
+)
+
+// Subprocess plugins speak newline-delimited JSON over stdin/stdout. Each
+// request carries an id that is echoed in its response, so calls may be
+// answered out of order.
+type subprocessRequest struct {
+	ID     uint64          `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+type subprocessResponse struct {
+	ID     uint64          `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Subprocess protocol methods
+const (
+	methodGetInfo        = "get_info"
+	methodInitialize     = "initialize"
+	methodValidateConfig = "validate_config"
+	methodReconfigure    = "reconfigure"
+	methodShutdown       = "shutdown"
+	// download_statement opens a stream on the child; its lines are fetched
+	// in chunks with statement_next until done, or dropped with statement_close
+	methodDownloadStatement = "download_statement"
+	methodStatementNext     = "statement_next"
+	methodStatementClose    = "statement_close"
+)
+
+// maxMessageSize bounds a single protocol message. A larger response fails
+// only the call it answers.
+const maxMessageSize = 16 * 1024 * 1024
+
+// statementChunkLines is the number of statement lines sent per response
+const statementChunkLines = 1000
+
+// statementHandle names a statement stream open on the child
+type statementHandle struct {
+	Stream uint64 `json:"stream"`
+}
+
+// statementChunk is the next run of lines of a statement stream
+type statementChunk struct {
+	Lines []interfaces.StatementLine `json:"lines"`
+	Done  bool                       `json:"done"`
+}
+
+// handshakeTimeout bounds the get_info exchange when a subprocess starts
+var handshakeTimeout = 10 * time.Second
+
+// configTimeout bounds the initialize, validate_config and reconfigure
+// calls, which the loader makes while holding its replace lock, so a hung
+// child cannot block every other channel's initialization
+var configTimeout = 30 * time.Second
+
+// ErrSubprocessClosed is returned for calls made after the subprocess exited
+var ErrSubprocessClosed = errors.New("plugin subprocess closed")
+
+// subprocessPlugin implements interfaces.Plugin by forwarding calls to a child process
+type subprocessPlugin struct {
+	cmd  *exec.Cmd
+	info *interfaces.PluginInfo
+
+	writeMutex sync.Mutex
+	encoder    *json.Encoder
+	closer     io.Closer
+
+	mutex   sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan subprocessResponse
+	closed  bool
+}
+
+// capabilityReconfigure is added to the capabilities a child reports from
+// get_info when its plugin implements interfaces.Reconfigurable
+const capabilityReconfigure = "reconfigure"
+
+// LoadSubprocessPlugin starts command and registers it as the plugin for
+// channelID. Reconfiguring or reloading the channel starts a fresh child,
+// unless the child reports it can reconfigure itself.
+func (pl *PluginLoader) LoadSubprocessPlugin(command []string, channelID string) error {
+	if len(command) == 0 {
+		return fmt.Errorf("subprocess plugin for channel %s has no command", channelID)
+	}
+
+	sp, err := spawnSubprocess(command)
+	if err != nil {
+		return err
+	}
+	factory := func() interfaces.Plugin {
+		sp, err := spawnSubprocess(command)
+		if err != nil {
+			pl.logger.Error("failed to start plugin subprocess", "channel_id", channelID, "error", err)
+			return nil
+		}
+		return sp.plugin()
+	}
+	if err := pl.registerPlugin(channelID, sp.plugin(), factory); err != nil {
+		sp.Close()
+		return err
+	}
+	return nil
+}
+
+// spawnSubprocess starts command and completes the handshake with it
+func spawnSubprocess(command []string) (*subprocessPlugin, error) {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start plugin %v: %w", command, err)
+	}
+
+	sp, err := newSubprocessPlugin(stdout, stdin)
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return nil, fmt.Errorf("plugin %v: %w", command, err)
+	}
+	sp.cmd = cmd
+	return sp, nil
+}
+
+// newSubprocessPlugin starts the response reader and fetches the plugin info
+func newSubprocessPlugin(r io.Reader, w io.WriteCloser) (*subprocessPlugin, error) {
+	sp := &subprocessPlugin{
+		encoder: json.NewEncoder(w),
+		closer:  w,
+		pending: make(map[uint64]chan subprocessResponse),
+	}
+	go sp.readLoop(r)
+
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	defer cancel()
+	var info interfaces.PluginInfo
+	if err := sp.call(ctx, methodGetInfo, nil, &info); err != nil {
+		sp.Close()
+		return nil, fmt.Errorf("failed to fetch plugin info: %w", err)
+	}
+	sp.info = &info
+	return sp, nil
+}
+
+// responseID finds the id at the start of an encoded response
+var responseID = regexp.MustCompile(`^\s*\{"id":(\d+)`)
+
+func (sp *subprocessPlugin) readLoop(r io.Reader) {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	for {
+		message, truncated, err := readMessage(reader, maxMessageSize)
+		if len(message) > 0 {
+			sp.deliver(message, truncated)
+		}
+		if err != nil {
+			break
+		}
+	}
+	sp.shutdown()
+}
+
+// deliver hands a response to the call waiting for it. An oversized
+// response fails its call instead of being decoded.
+func (sp *subprocessPlugin) deliver(message []byte, truncated bool) {
+	var resp subprocessResponse
+	if truncated {
+		match := responseID.FindSubmatch(message)
+		if match == nil {
+			return
+		}
+		id, err := strconv.ParseUint(string(match[1]), 10, 64)
+		if err != nil {
+			return
+		}
+		resp = subprocessResponse{ID: id, Error: fmt.Sprintf("plugin response exceeds %d bytes", maxMessageSize)}
+	} else if err := json.Unmarshal(message, &resp); err != nil {
+		return
+	}
+
+	sp.mutex.Lock()
+	ch, exists := sp.pending[resp.ID]
+	delete(sp.pending, resp.ID)
+	sp.mutex.Unlock()
+	if exists {
+		ch <- resp
+	}
+}
+
+// readMessage reads one newline-terminated message. Past limit bytes the
+// rest of the message is discarded and only its prefix is returned.
+func readMessage(reader *bufio.Reader, limit int) ([]byte, bool, error) {
+	var message []byte
+	truncated := false
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if room := limit - len(message); len(chunk) > room {
+			message = append(message, chunk[:room]...)
+			truncated = true
+		} else {
+			message = append(message, chunk...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		return message, truncated, err
+	}
+}
+
+// shutdown fails all pending calls once the subprocess output ends
+func (sp *subprocessPlugin) shutdown() {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+
+	sp.closed = true
+	for id, ch := range sp.pending {
+		ch <- subprocessResponse{ID: id, Error: ErrSubprocessClosed.Error()}
+		delete(sp.pending, id)
+	}
+}
+
+func (sp *subprocessPlugin) call(ctx context.Context, method string, params, result interface{}) error {
+	var raw json.RawMessage
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		raw = data
+	}
+
+	sp.mutex.Lock()
+	if sp.closed {
+		sp.mutex.Unlock()
+		return ErrSubprocessClosed
+	}
+	sp.nextID++
+	id := sp.nextID
+	ch := make(chan subprocessResponse, 1)
+	sp.pending[id] = ch
+	sp.mutex.Unlock()
+
+	sp.writeMutex.Lock()
+	err := sp.encoder.Encode(subprocessRequest{ID: id, Method: method, Params: raw})
+	sp.writeMutex.Unlock()
+	if err != nil {
+		sp.mutex.Lock()
+		delete(sp.pending, id)
+		sp.mutex.Unlock()
+		return fmt.Errorf("failed to send %s: %w", method, err)
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != "" {
+			return errors.New(resp.Error)
+		}
+		if result != nil && len(resp.Result) > 0 {
+			return json.Unmarshal(resp.Result, result)
+		}
+		return nil
+	case <-ctx.Done():
+		sp.mutex.Lock()
+		delete(sp.pending, id)
+		sp.mutex.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Close stops the subprocess
+func (sp *subprocessPlugin) Close() error {
+	sp.shutdown()
+	err := sp.closer.Close()
+	if sp.cmd != nil && sp.cmd.Process != nil {
+		_ = sp.cmd.Process.Kill()
+		_ = sp.cmd.Wait()
+	}
+	return err
+}
+
+func (sp *subprocessPlugin) GetInfo() *interfaces.PluginInfo {
+	return sp.info
+}
+
+func (sp *subprocessPlugin) Initialize(config map[string]interface{}) error {
+	return sp.configCall(methodInitialize, config)
+}
+
+func (sp *subprocessPlugin) ValidateConfig(config map[string]interface{}) error {
+	return sp.configCall(methodValidateConfig, config)
+}
+
+// configCall passes config to the child within configTimeout
+func (sp *subprocessPlugin) configCall(method string, config map[string]interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), configTimeout)
+	defer cancel()
+	return sp.call(ctx, method, config, nil)
+}
+
+// Shutdown lets the child flush state before the loader closes it
+func (sp *subprocessPlugin) Shutdown(ctx context.Context) error {
+	err := sp.call(ctx, methodShutdown, nil, nil)
+	if errors.Is(err, ErrSubprocessClosed) {
+		return nil
+	}
+	return err
+}
+
+// plugin returns sp as a plugin implementing interfaces.Reconfigurable if
+// the child reports it can reconfigure itself
+func (sp *subprocessPlugin) plugin() interfaces.Plugin {
+	if contains(sp.info.Capabilities, capabilityReconfigure) {
+		return reconfigurableSubprocess{sp}
+	}
+	return sp
+}
+
+// reconfigurableSubprocess is a subprocess plugin whose child reconfigures
+// itself
+type reconfigurableSubprocess struct {
+	*subprocessPlugin
+}
+
+// Reconfigure forwards to the child
+func (rs reconfigurableSubprocess) Reconfigure(config map[string]interface{}) error {
+	return rs.configCall(methodReconfigure, config)
+}
+
+// DownloadStatement forwards to the child, which fails the call if its
+// plugin does not implement interfaces.StatementDownloader. Lines are
+// fetched a chunk at a time as the stream is read.
+func (sp *subprocessPlugin) DownloadStatement(ctx context.Context, req *interfaces.StatementRequest) (interfaces.StatementStream, error) {
+	var handle statementHandle
+	if err := sp.call(ctx, methodDownloadStatement, req, &handle); err != nil {
+		return nil, err
+	}
+	return &subprocessStatement{sp: sp, ctx: ctx, handle: handle}, nil
+}
+
+// subprocessStatement reads a statement stream open on the child
+type subprocessStatement struct {
+	sp     *subprocessPlugin
+	ctx    context.Context
+	handle statementHandle
+	lines  []interfaces.StatementLine
+	done   bool
+	err    error
+}
+
+func (s *subprocessStatement) Next() (*interfaces.StatementLine, error) {
+	for len(s.lines) == 0 {
+		if s.err != nil {
+			return nil, s.err
+		}
+		if s.done {
+			return nil, io.EOF
+		}
+		var chunk statementChunk
+		if err := s.sp.call(s.ctx, methodStatementNext, s.handle, &chunk); err != nil {
+			s.err = err
+			return nil, err
+		}
+		s.lines, s.done = chunk.Lines, chunk.Done
+	}
+	line := s.lines[0]
+	s.lines = s.lines[1:]
+	return &line, nil
+}
+
+// Close drops the child's stream unless it was read to the end
+func (s *subprocessStatement) Close() error {
+	if s.done {
+		return nil
+	}
+	s.done = true
+	err := s.sp.call(context.Background(), methodStatementClose, s.handle, nil)
+	if errors.Is(err, ErrSubprocessClosed) {
+		return nil
+	}
+	return err
+}
+
+func (sp *subprocessPlugin) CollectOrder(ctx context.Context, req *interfaces.CollectOrderRequest) (*interfaces.CollectOrderResponse, error) {
+	var resp interfaces.CollectOrderResponse
+	if err := sp.call(ctx, "collect_order", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (sp *subprocessPlugin) PayoutOrder(ctx context.Context, req *interfaces.PayoutOrderRequest) (*interfaces.PayoutOrderResponse, error) {
+	var resp interfaces.PayoutOrderResponse
+	if err := sp.call(ctx, "payout_order", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (sp *subprocessPlugin) CollectQuery(ctx context.Context, req *interfaces.CollectQueryRequest) (*interfaces.CollectQueryResponse, error) {
+	var resp interfaces.CollectQueryResponse
+	if err := sp.call(ctx, "collect_query", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (sp *subprocessPlugin) PayoutQuery(ctx context.Context, req *interfaces.PayoutQueryRequest) (*interfaces.PayoutQueryResponse, error) {
+	var resp interfaces.PayoutQueryResponse
+	if err := sp.call(ctx, "payout_query", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (sp *subprocessPlugin) BalanceInquiry(ctx context.Context, req *interfaces.BalanceInquiryRequest) (*interfaces.BalanceInquiryResponse, error) {
+	var resp interfaces.BalanceInquiryResponse
+	if err := sp.call(ctx, "balance_inquiry", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (sp *subprocessPlugin) Callback(ctx context.Context, req *interfaces.CallbackRequest) (*interfaces.CallbackResponse, error) {
+	var resp interfaces.CallbackResponse
+	if err := sp.call(ctx, "callback", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ServeSubprocess runs p as a subprocess plugin, reading requests from in and
+// writing responses to out until in is closed. A plugin binary's main
+// function is typically just:
+//
+//	plugin.ServeSubprocess(NewPlugin(), os.Stdin, os.Stdout)
+func ServeSubprocess(p interfaces.Plugin, in io.Reader, out io.Writer) error {
+	server := &subprocessServer{plugin: p, streams: make(map[uint64]interfaces.StatementStream)}
+	defer server.closeStreams()
+
+	var writeMutex sync.Mutex
+	var wg sync.WaitGroup
+	encoder := json.NewEncoder(out)
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	for scanner.Scan() {
+		var req subprocessRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := server.serve(&req)
+			writeMutex.Lock()
+			_ = encoder.Encode(resp)
+			writeMutex.Unlock()
+		}()
+	}
+	wg.Wait()
+	return scanner.Err()
+}
+
+// subprocessServer is the child's side of the protocol. It holds the
+// statement streams the parent is reading.
+type subprocessServer struct {
+	plugin interfaces.Plugin
+
+	mutex      sync.Mutex
+	nextStream uint64
+	streams    map[uint64]interfaces.StatementStream
+}
+
+func (s *subprocessServer) serve(req *subprocessRequest) subprocessResponse {
+	ctx := context.Background()
+	result, err := s.dispatch(ctx, req)
+	resp := subprocessResponse{ID: req.ID}
+	if err != nil {
+		resp.Error = err.Error()
+		return resp
+	}
+	if result != nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			resp.Error = err.Error()
+			return resp
+		}
+		resp.Result = data
+	}
+	return resp
+}
+
+// openStream keeps stream for the parent to read and returns its handle
+func (s *subprocessServer) openStream(stream interfaces.StatementStream) statementHandle {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.nextStream++
+	s.streams[s.nextStream] = stream
+	return statementHandle{Stream: s.nextStream}
+}
+
+// closeStream forgets and closes a stream; unknown handles are ignored
+func (s *subprocessServer) closeStream(handle statementHandle) error {
+	s.mutex.Lock()
+	stream, exists := s.streams[handle.Stream]
+	delete(s.streams, handle.Stream)
+	s.mutex.Unlock()
+	if !exists {
+		return nil
+	}
+	return stream.Close()
+}
+
+// nextChunk reads up to statementChunkLines lines from a stream, closing
+// it once it ends or fails
+func (s *subprocessServer) nextChunk(handle statementHandle) (*statementChunk, error) {
+	s.mutex.Lock()
+	stream, exists := s.streams[handle.Stream]
+	s.mutex.Unlock()
+	if !exists {
+		return nil, fmt.Errorf("unknown statement stream %d", handle.Stream)
+	}
+
+	chunk := &statementChunk{Lines: []interfaces.StatementLine{}}
+	for len(chunk.Lines) < statementChunkLines {
+		line, err := stream.Next()
+		if errors.Is(err, io.EOF) {
+			chunk.Done = true
+			return chunk, s.closeStream(handle)
+		}
+		if err != nil {
+			_ = s.closeStream(handle)
+			return nil, err
+		}
+		chunk.Lines = append(chunk.Lines, *line)
+	}
+	return chunk, nil
+}
+
+// closeStreams closes the streams the parent left open
+func (s *subprocessServer) closeStreams() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for id, stream := range s.streams {
+		_ = stream.Close()
+		delete(s.streams, id)
+	}
+}
+
+// decodeParams unmarshals request params into a new T
+func decodeParams[T any](raw json.RawMessage) (*T, error) {
+	var v T
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, fmt.Errorf("invalid params: %w", err)
+		}
+	}
+	return &v, nil
+}
+
+func (s *subprocessServer) dispatch(ctx context.Context, req *subprocessRequest) (interface{}, error) {
+	p := s.plugin
+	switch req.Method {
+	case methodGetInfo:
+		info := p.GetInfo()
+		if _, ok := p.(interfaces.Reconfigurable); ok && info != nil && !contains(info.Capabilities, capabilityReconfigure) {
+			advertised := *info
+			advertised.Capabilities = append(append([]string(nil), info.Capabilities...), capabilityReconfigure)
+			return &advertised, nil
+		}
+		return info, nil
+	case methodShutdown:
+		if shutdowner, ok := p.(interfaces.Shutdowner); ok {
+			return nil, shutdowner.Shutdown(ctx)
+		}
+		return nil, nil
+	case methodInitialize, methodValidateConfig, methodReconfigure:
+		config, err := decodeParams[map[string]interface{}](req.Params)
+		if err != nil {
+			return nil, err
+		}
+		switch req.Method {
+		case methodInitialize:
+			return nil, p.Initialize(*config)
+		case methodReconfigure:
+			reconfigurable, ok := p.(interfaces.Reconfigurable)
+			if !ok {
+				return nil, errors.New("plugin does not support reconfiguration")
+			}
+			return nil, reconfigurable.Reconfigure(*config)
+		}
+		return nil, p.ValidateConfig(*config)
+	case methodDownloadStatement:
+		downloader, ok := p.(interfaces.StatementDownloader)
+		if !ok {
+			return nil, errors.New("plugin does not support statement download")
+		}
+		r, err := decodeParams[interfaces.StatementRequest](req.Params)
+		if err != nil {
+			return nil, err
+		}
+		stream, err := downloader.DownloadStatement(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		return s.openStream(stream), nil
+	case methodStatementNext, methodStatementClose:
+		handle, err := decodeParams[statementHandle](req.Params)
+		if err != nil {
+			return nil, err
+		}
+		if req.Method == methodStatementClose {
+			return nil, s.closeStream(*handle)
+		}
+		return s.nextChunk(*handle)
+	case "collect_order":
+		r, err := decodeParams[interfaces.CollectOrderRequest](req.Params)
+		if err != nil {
+			return nil, err
+		}
+		return p.CollectOrder(ctx, r)
+	case "payout_order":
+		r, err := decodeParams[interfaces.PayoutOrderRequest](req.Params)
+		if err != nil {
+			return nil, err
+		}
+		return p.PayoutOrder(ctx, r)
+	case "collect_query":
+		r, err := decodeParams[interfaces.CollectQueryRequest](req.Params)
+		if err != nil {
+			return nil, err
+		}
+		return p.CollectQuery(ctx, r)
+	case "payout_query":
+		r, err := decodeParams[interfaces.PayoutQueryRequest](req.Params)
+		if err != nil {
+			return nil, err
+		}
+		return p.PayoutQuery(ctx, r)
+	case "balance_inquiry":
+		r, err := decodeParams[interfaces.BalanceInquiryRequest](req.Params)
+		if err != nil {
+			return nil, err
+		}
+		return p.BalanceInquiry(ctx, r)
+	case "callback":
+		r, err := decodeParams[interfaces.CallbackRequest](req.Params)
+		if err != nil {
+			return nil, err
+		}
+		return p.Callback(ctx, r)
+	}
+	return nil, fmt.Errorf("unknown method %s", req.Method)
+}
@@ -0,0 +1,287 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"payment_go/pkg/interfaces"
+)
+
+// EchoPlugin answers collect orders with the request's order ID
+type EchoPlugin struct {
+	MockPlugin
+	block chan struct{}
+	// statementLines, when set, is the length of the statement served
+	statementLines int
+}
+
+func (ep *EchoPlugin) ValidateConfig(config map[string]interface{}) error {
+	if config["app_id"] == "SLOW" {
+		<-ep.block
+	}
+	if config["app_id"] == nil {
+		return errors.New("app_id is required")
+	}
+	return nil
+}
+
+func (ep *EchoPlugin) CollectOrder(ctx context.Context, req *interfaces.CollectOrderRequest) (*interfaces.CollectOrderResponse, error) {
+	if req.OrderID == "SLOW" {
+		<-ep.block
+	}
+	if req.OrderID == "HUGE" {
+		return &interfaces.CollectOrderResponse{BaseResponse: interfaces.BaseResponse{Message: strings.Repeat("x", maxMessageSize)}}, nil
+	}
+	return &interfaces.CollectOrderResponse{
+		BaseResponse: interfaces.BaseResponse{Success: true, Code: "SUCCESS"},
+		OrderID:      req.OrderID,
+		Amount:       req.Amount,
+		Status:       "pending",
+	}, nil
+}
+
+func (ep *EchoPlugin) DownloadStatement(ctx context.Context, req *interfaces.StatementRequest) (interfaces.StatementStream, error) {
+	if ep.statementLines > 0 {
+		lines := make([]interfaces.StatementLine, ep.statementLines)
+		for i := range lines {
+			lines[i] = interfaces.StatementLine{Type: interfaces.StatementCollect, OrderID: fmt.Sprintf("ORDER_%d", i), Amount: 1, Currency: "CNY", CompletedAt: req.Date}
+		}
+		return interfaces.NewStatementStream(lines), nil
+	}
+	return interfaces.NewStatementStream([]interfaces.StatementLine{
+		{Type: interfaces.StatementCollect, OrderID: "ORDER_001", Amount: 12.5, Currency: "CNY", CompletedAt: req.Date},
+	}), nil
+}
+
+func startSubprocess(t *testing.T, p interfaces.Plugin) *subprocessPlugin {
+	t.Helper()
+	requestsR, requestsW := io.Pipe()
+	responsesR, responsesW := io.Pipe()
+
+	go func() {
+		_ = ServeSubprocess(p, requestsR, responsesW)
+		responsesW.Close()
+	}()
+
+	sp, err := newSubprocessPlugin(responsesR, requestsW)
+	if err != nil {
+		t.Fatalf("newSubprocessPlugin failed: %v", err)
+	}
+	t.Cleanup(func() { sp.Close() })
+	return sp
+}
+
+func TestSubprocessRoundTrip(t *testing.T) {
+	echo := &EchoPlugin{MockPlugin: MockPlugin{info: testInfo()}, block: make(chan struct{})}
+	sp := startSubprocess(t, echo)
+
+	if sp.GetInfo().Name != "Test Plugin" {
+		t.Errorf("plugin info not fetched: %+v", sp.GetInfo())
+	}
+
+	if err := sp.ValidateConfig(map[string]interface{}{}); err == nil || err.Error() != "app_id is required" {
+		t.Errorf("plugin errors should cross the process boundary, got %v", err)
+	}
+
+	if _, ok := sp.plugin().(interfaces.Reconfigurable); ok {
+		t.Error("expected a child without Reconfigure to be replaced rather than reconfigured")
+	}
+
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	stream, err := sp.DownloadStatement(context.Background(), &interfaces.StatementRequest{Date: day})
+	if err != nil {
+		t.Fatalf("DownloadStatement failed: %v", err)
+	}
+	line, err := stream.Next()
+	if err != nil || line.OrderID != "ORDER_001" || !line.CompletedAt.Equal(day) {
+		t.Errorf("unexpected statement line: %+v, %v", line, err)
+	}
+	if _, err := stream.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF after the last line, got %v", err)
+	}
+
+	// A blocked call must not hold up other calls
+	slowDone := make(chan error, 1)
+	go func() {
+		_, err := sp.CollectOrder(context.Background(), &interfaces.CollectOrderRequest{OrderID: "SLOW"})
+		slowDone <- err
+	}()
+
+	resp, err := sp.CollectOrder(context.Background(), &interfaces.CollectOrderRequest{OrderID: "ORDER_001", Amount: 12.5})
+	if err != nil {
+		t.Fatalf("CollectOrder failed: %v", err)
+	}
+	if resp.OrderID != "ORDER_001" || resp.Amount != 12.5 || !resp.Success {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	close(echo.block)
+	if err := <-slowDone; err != nil {
+		t.Errorf("slow call failed: %v", err)
+	}
+
+	if err := sp.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown failed: %v", err)
+	}
+	sp.Close()
+	if err := sp.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown after exit should be a no-op, got %v", err)
+	}
+}
+
+func TestSubprocessReconfigureCapability(t *testing.T) {
+	recording := &ConfigRecordingPlugin{MockPlugin: MockPlugin{info: testInfo()}}
+	sp := startSubprocess(t, recording)
+
+	if !contains(sp.GetInfo().Capabilities, capabilityReconfigure) {
+		t.Fatalf("expected the child to advertise reconfiguration, got %v", sp.GetInfo().Capabilities)
+	}
+	if contains(recording.GetInfo().Capabilities, capabilityReconfigure) {
+		t.Error("advertising reconfiguration must not change the plugin's own info")
+	}
+	reconfigurable, ok := sp.plugin().(interfaces.Reconfigurable)
+	if !ok {
+		t.Fatal("expected the subprocess plugin to implement Reconfigurable")
+	}
+	if err := reconfigurable.Reconfigure(map[string]interface{}{"app_id": "2022"}); err != nil {
+		t.Fatalf("Reconfigure failed: %v", err)
+	}
+	if recording.config["app_id"] != "2022" {
+		t.Errorf("expected the child to be reconfigured, got %v", recording.config)
+	}
+}
+
+func TestSubprocessContextCancel(t *testing.T) {
+	echo := &EchoPlugin{MockPlugin: MockPlugin{info: testInfo()}, block: make(chan struct{})}
+	sp := startSubprocess(t, echo)
+	defer close(echo.block)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := sp.CollectOrder(ctx, &interfaces.CollectOrderRequest{OrderID: "SLOW"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestSubprocessConfigTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { configTimeout = timeout }(configTimeout)
+	configTimeout = 20 * time.Millisecond
+
+	echo := &EchoPlugin{MockPlugin: MockPlugin{info: testInfo()}, block: make(chan struct{})}
+	sp := startSubprocess(t, echo)
+	defer close(echo.block)
+
+	if err := sp.ValidateConfig(map[string]interface{}{"app_id": "SLOW"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a hung child to time out, got %v", err)
+	}
+}
+
+func TestSubprocessStatementChunks(t *testing.T) {
+	echo := &EchoPlugin{MockPlugin: MockPlugin{info: testInfo()}, statementLines: 2*statementChunkLines + 500}
+	sp := startSubprocess(t, echo)
+
+	stream, err := sp.DownloadStatement(context.Background(), &interfaces.StatementRequest{})
+	if err != nil {
+		t.Fatalf("DownloadStatement failed: %v", err)
+	}
+	defer stream.Close()
+	count := 0
+	for {
+		line, err := stream.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next failed after %d lines: %v", count, err)
+		}
+		if line.OrderID != fmt.Sprintf("ORDER_%d", count) {
+			t.Fatalf("expected ORDER_%d, got %s", count, line.OrderID)
+		}
+		count++
+	}
+	if count != echo.statementLines {
+		t.Errorf("expected %d lines, got %d", echo.statementLines, count)
+	}
+
+	// A stream closed early is dropped by the child
+	early, err := sp.DownloadStatement(context.Background(), &interfaces.StatementRequest{})
+	if err != nil {
+		t.Fatalf("DownloadStatement failed: %v", err)
+	}
+	if _, err := early.Next(); err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if err := early.Close(); err != nil {
+		t.Errorf("expected Close to drop the stream, got %v", err)
+	}
+}
+
+func TestSubprocessOversizedResponse(t *testing.T) {
+	echo := &EchoPlugin{MockPlugin: MockPlugin{info: testInfo()}}
+	sp := startSubprocess(t, echo)
+
+	_, err := sp.CollectOrder(context.Background(), &interfaces.CollectOrderRequest{OrderID: "HUGE"})
+	if err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("expected the oversized response to fail its call, got %v", err)
+	}
+	resp, err := sp.CollectOrder(context.Background(), &interfaces.CollectOrderRequest{OrderID: "ORDER_001"})
+	if err != nil || resp.OrderID != "ORDER_001" {
+		t.Errorf("expected the subprocess to keep serving, got %+v, %v", resp, err)
+	}
+}
+
+func TestSubprocessHandshakeTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { handshakeTimeout = timeout }(handshakeTimeout)
+	handshakeTimeout = 20 * time.Millisecond
+
+	// The child reads requests but never answers
+	requestsR, requestsW := io.Pipe()
+	responsesR, responsesW := io.Pipe()
+	defer responsesW.Close()
+	go func() { _, _ = io.Copy(io.Discard, requestsR) }()
+
+	if _, err := newSubprocessPlugin(responsesR, requestsW); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the handshake to time out, got %v", err)
+	}
+}
+
+func TestLoadSubprocessPluginErrors(t *testing.T) {
+	loader := NewPluginLoader()
+	if err := loader.LoadSubprocessPlugin(nil, "empty"); err == nil {
+		t.Error("Expected error for empty command")
+	}
+	if err := loader.LoadSubprocessPlugin([]string{"/nonexistent/plugin-binary"}, "missing"); err == nil {
+		t.Error("Expected error for missing binary")
+	}
+}
+
+// registerStaticForTest registers a static plugin for the duration of a test
+func registerStaticForTest(t *testing.T, name string, factory Factory) {
+	t.Helper()
+	RegisterStatic(name, factory)
+	t.Cleanup(func() {
+		staticMutex.Lock()
+		defer staticMutex.Unlock()
+		delete(staticPlugins, name)
+	})
+}
+
+func TestStaticPlugins(t *testing.T) {
+	registerStaticForTest(t, "test_static", func() interfaces.Plugin { return &MockPlugin{info: testInfo()} })
+
+	loader := NewPluginLoader()
+	if err := loader.LoadStaticPlugin("test_static", "static_channel"); err != nil {
+		t.Fatalf("LoadStaticPlugin failed: %v", err)
+	}
+	if _, err := loader.GetPlugin("static_channel"); err != nil {
+		t.Errorf("static plugin not registered: %v", err)
+	}
+	if err := loader.LoadStaticPlugin("unknown", "other"); err == nil {
+		t.Error("Expected error for unregistered static plugin")
+	}
+}
@@ -0,0 +1,289 @@
+package qrcode
+
+// encoder lays out the modules of a code. Modules are indexed by row, then
+// column; function modules are the fixed patterns masks do not touch.
+type encoder struct {
+	version  int
+	size     int
+	modules  []bool
+	function []bool
+}
+
+func newEncoder(version int) *encoder {
+	size := 17 + 4*version
+	return &encoder{
+		version:  version,
+		size:     size,
+		modules:  make([]bool, size*size),
+		function: make([]bool, size*size),
+	}
+}
+
+func (e *encoder) set(x, y int, dark bool) {
+	e.modules[y*e.size+x] = dark
+	e.function[y*e.size+x] = true
+}
+
+// drawFunctionPatterns draws the finder, timing and alignment patterns and
+// the version information, and reserves the format information modules
+func (e *encoder) drawFunctionPatterns() {
+	for i := 0; i < e.size; i++ {
+		e.set(6, i, i%2 == 0)
+		e.set(i, 6, i%2 == 0)
+	}
+
+	e.drawFinder(3, 3)
+	e.drawFinder(e.size-4, 3)
+	e.drawFinder(3, e.size-4)
+
+	positions := alignmentPositions(e.version)
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// Skip the three corners taken by finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			e.drawAlignment(x, y)
+		}
+	}
+
+	e.drawFormat(0)
+	e.drawVersion()
+}
+
+// drawFinder draws a finder pattern and its separator centred on x, y
+func (e *encoder) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= e.size || yy < 0 || yy >= e.size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			e.set(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+// drawAlignment draws an alignment pattern centred on x, y
+func (e *encoder) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			e.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormat draws both copies of the 15 format information bits. They
+// are reserved with zeros until applyBestMask picks the mask.
+func (e *encoder) drawFormat(bits int) {
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+	for i := 0; i <= 5; i++ {
+		e.set(8, i, bit(i))
+	}
+	e.set(8, 7, bit(6))
+	e.set(8, 8, bit(7))
+	e.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		e.set(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		e.set(e.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		e.set(8, e.size-15+i, bit(i))
+	}
+	// The dark module is always dark
+	e.set(8, e.size-8, true)
+}
+
+// drawVersion draws both copies of the version information of versions 7
+// and up
+func (e *encoder) drawVersion() {
+	if e.version < 7 {
+		return
+	}
+	rem := e.version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := e.version<<12 | rem
+	for i := 0; i < 18; i++ {
+		dark := bits>>i&1 == 1
+		a, b := e.size-11+i%3, i/3
+		e.set(a, b, dark)
+		e.set(b, a, dark)
+	}
+}
+
+// formatInfo returns the 15 format information bits for level and mask
+func formatInfo(level Level, mask int) int {
+	data := level.formatBits()<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// alignmentPositions returns the row and column centres of the version's
+// alignment patterns
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	numAlign := version/7 + 2
+	step := (version*8 + numAlign*3 + 5) / (numAlign*4 - 4) * 2
+	result := make([]int, numAlign)
+	result[0] = 6
+	for i, pos := numAlign-1, 17+4*version-7; i >= 1; i, pos = i-1, pos-step {
+		result[i] = pos
+	}
+	return result
+}
+
+// drawCodewords places data in the zigzag order of the standard, skipping
+// function modules
+func (e *encoder) drawCodewords(data []byte) {
+	i := 0
+	for right := e.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			// The vertical timing pattern is skipped
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < e.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if upward {
+					y = e.size - 1 - vert
+				}
+				if e.function[y*e.size+x] || i >= len(data)*8 {
+					continue
+				}
+				e.modules[y*e.size+x] = data[i/8]>>(7-i%8)&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+// masks are the eight mask patterns; a module is flipped where one is true
+var masks = [8]func(x, y int) bool{
+	func(x, y int) bool { return (x+y)%2 == 0 },
+	func(x, y int) bool { return y%2 == 0 },
+	func(x, y int) bool { return x%3 == 0 },
+	func(x, y int) bool { return (x+y)%3 == 0 },
+	func(x, y int) bool { return (x/3+y/2)%2 == 0 },
+	func(x, y int) bool { return x*y%2+x*y%3 == 0 },
+	func(x, y int) bool { return (x*y%2+x*y%3)%2 == 0 },
+	func(x, y int) bool { return ((x+y)%2+x*y%3)%2 == 0 },
+}
+
+func (e *encoder) applyMask(mask int) {
+	for y := 0; y < e.size; y++ {
+		for x := 0; x < e.size; x++ {
+			if !e.function[y*e.size+x] && masks[mask](x, y) {
+				e.modules[y*e.size+x] = !e.modules[y*e.size+x]
+			}
+		}
+	}
+}
+
+// applyBestMask applies the mask with the lowest penalty score
+func (e *encoder) applyBestMask(level Level) {
+	best, bestPenalty := 0, -1
+	for mask := range masks {
+		e.applyMask(mask)
+		e.drawFormat(formatInfo(level, mask))
+		if penalty := e.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		// Masks are their own inverse
+		e.applyMask(mask)
+	}
+	e.applyMask(best)
+	e.drawFormat(formatInfo(level, best))
+}
+
+// Penalty weights of the standard's mask evaluation rules
+const (
+	penaltyRun     = 3
+	penaltyBlock   = 3
+	penaltyFinder  = 40
+	penaltyBalance = 10
+)
+
+// penalty scores how hard the current modules are to read; lower is better
+func (e *encoder) penalty() int {
+	n := e.size
+	dark := func(x, y int) bool { return e.modules[y*n+x] }
+	result := 0
+
+	for _, transpose := range []bool{false, true} {
+		at := dark
+		if transpose {
+			at = func(x, y int) bool { return dark(y, x) }
+		}
+		for y := 0; y < n; y++ {
+			run := 1
+			for x := 1; x <= n; x++ {
+				if x < n && at(x, y) == at(x-1, y) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					result += penaltyRun + run - 5
+				}
+				run = 1
+			}
+			for x := 0; x+11 <= n; x++ {
+				if finderLike(func(i int) bool { return at(x+i, y) }) {
+					result += penaltyFinder
+				}
+			}
+		}
+	}
+
+	darkCount := 0
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			if dark(x, y) {
+				darkCount++
+			}
+			if x+1 < n && y+1 < n {
+				c := dark(x, y)
+				if dark(x+1, y) == c && dark(x, y+1) == c && dark(x+1, y+1) == c {
+					result += penaltyBlock
+				}
+			}
+		}
+	}
+	total := n * n
+	k := (abs(darkCount*20-total*10)+total-1)/total - 1
+	return result + k*penaltyBalance
+}
+
+// finderLike reports whether the 11 modules from at(0) are a 1:1:3:1:1
+// dark-light pattern with four light modules before or after it
+func finderLike(at func(i int) bool) bool {
+	const before, after = "00001011101", "10111010000"
+	matches := func(pattern string) bool {
+		for i := 0; i < len(pattern); i++ {
+			if at(i) != (pattern[i] == '1') {
+				return false
+			}
+		}
+		return true
+	}
+	return matches(before) || matches(after)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,116 @@
+package qrcode
+
+import (
+	"errors"
+	"image"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	zxing "github.com/makiuchi-d/gozxing/qrcode"
+	"github.com/makiuchi-d/gozxing/qrcode/decoder"
+)
+
+// decode reads img with an independent decoder and returns the content and
+// the error correction level it found
+func decode(t *testing.T, img image.Image) (string, string) {
+	t.Helper()
+	bitmap, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		t.Fatalf("NewBinaryBitmapFromImage failed: %v", err)
+	}
+	result, err := zxing.NewQRCodeReader().Decode(bitmap, nil)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	level, _ := result.GetResultMetadata()[gozxing.ResultMetadataType_ERROR_CORRECTION_LEVEL].(string)
+	return result.GetText(), level
+}
+
+func TestRoundTrip(t *testing.T) {
+	contents := map[string]string{
+		"url":     "https://qr.alipay.com/bax08431pmxgbgwb4nja0060",
+		"unicode": "支付宝扫码支付 ORDER_1 ¥100.50",
+		"medium":  strings.Repeat("0123456789abcdef", 30),
+	}
+	for name, content := range contents {
+		for level := LevelL; level <= LevelH; level++ {
+			code, err := Encode(content, level)
+			if err != nil {
+				t.Fatalf("%s at %s: Encode failed: %v", name, level, err)
+			}
+			img, err := Image(code, Options{Size: 4 * (code.Size + 8)})
+			if err != nil {
+				t.Fatalf("%s at %s: Image failed: %v", name, level, err)
+			}
+			text, decodedLevel := decode(t, img)
+			if text != content || decodedLevel != level.String() {
+				t.Errorf("%s at %s: Expected %q at %s, got %q at %s", name, level, content, level, text, decodedLevel)
+			}
+		}
+	}
+
+	// The largest code there is: version 40 at level L
+	largest := strings.Repeat("x", 2953)
+	code, err := Encode(largest, LevelL)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if code.Version != 40 || code.Size != 177 {
+		t.Errorf("Expected a version 40 code 177 modules wide, got version %d, %d wide", code.Version, code.Size)
+	}
+	img, _ := Image(code, Options{Size: 3 * (code.Size + 8)})
+	if text, _ := decode(t, img); text != largest {
+		t.Error("Expected the version 40 code to decode")
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	if _, err := Encode(strings.Repeat("x", 2954), LevelL); !errors.Is(err, ErrTooLong) {
+		t.Errorf("Expected ErrTooLong, got %v", err)
+	}
+	if _, err := Encode(strings.Repeat("x", 1274), LevelH); !errors.Is(err, ErrTooLong) {
+		t.Errorf("Expected ErrTooLong at level H, got %v", err)
+	}
+}
+
+func TestTablesMatchStandard(t *testing.T) {
+	levels := map[Level]decoder.ErrorCorrectionLevel{
+		LevelL: decoder.ErrorCorrectionLevel_L,
+		LevelM: decoder.ErrorCorrectionLevel_M,
+		LevelQ: decoder.ErrorCorrectionLevel_Q,
+		LevelH: decoder.ErrorCorrectionLevel_H,
+	}
+	for v := 1; v <= 40; v++ {
+		version, err := decoder.Version_GetVersionForNumber(v)
+		if err != nil {
+			t.Fatalf("Version_GetVersionForNumber failed: %v", err)
+		}
+		if rawModules(v)/8 != version.GetTotalCodewords() {
+			t.Errorf("version %d: Expected %d codewords, got %d", v, version.GetTotalCodewords(), rawModules(v)/8)
+		}
+		if got, want := alignmentPositions(v), version.GetAlignmentPatternCenters(); len(want) > 0 && !reflect.DeepEqual(got, want) {
+			t.Errorf("version %d: Expected alignment patterns at %v, got %v", v, want, got)
+		}
+		for level, ecLevel := range levels {
+			blocks := version.GetECBlocksForLevel(ecLevel)
+			if eccBlocks[level][v] != blocks.GetNumBlocks() || eccPerBlock[level][v] != blocks.GetECCodewordsPerBlock() {
+				t.Errorf("version %d at %s: Expected %d blocks of %d error correction codewords, got %d of %d",
+					v, level, blocks.GetNumBlocks(), blocks.GetECCodewordsPerBlock(), eccBlocks[level][v], eccPerBlock[level][v])
+			}
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, s := range []string{"L", "m", "Q", "h"} {
+		level, err := ParseLevel(s)
+		if err != nil || level.String() != strings.ToUpper(s) {
+			t.Errorf("Expected %q to parse, got %v and %v", s, level, err)
+		}
+	}
+	if _, err := ParseLevel("X"); err == nil {
+		t.Error("Expected error for an unknown level")
+	}
+}
@@ -0,0 +1,184 @@
+package qrcode
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+)
+
+// DefaultBorder is the quiet zone the standard requires around a code, in
+// modules
+const DefaultBorder = 4
+
+// defaultScale is the module size in pixels when Options.Size is zero
+const defaultScale = 8
+
+// ErrLogoLevel is returned when a logo would cover more of a code than its
+// error correction level can recover
+var ErrLogoLevel = errors.New("a logo needs error correction level Q or H")
+
+// Options control how a code is rendered
+type Options struct {
+	// Size is the image width and height in pixels. Modules are drawn a
+	// whole number of pixels wide, so a PNG may come out slightly smaller.
+	// Zero draws modules 8 pixels wide.
+	Size int
+	// Border is the quiet zone in modules, DefaultBorder when zero
+	Border int
+	// Logo, if set, is drawn on a light square over the middle fifth of
+	// the code
+	Logo image.Image
+}
+
+// layout returns the quiet zone in modules and the module size in pixels
+func (o Options) layout(c *Code) (border, scale int) {
+	border = o.Border
+	if border <= 0 {
+		border = DefaultBorder
+	}
+	scale = defaultScale
+	if o.Size > 0 {
+		scale = max(1, o.Size/(c.Size+2*border))
+	}
+	return border, scale
+}
+
+// logoBox returns the modules a logo covers, from offset to offset+side
+// in both directions
+func logoBox(c *Code) (offset, side int) {
+	side = c.Size / 5
+	return (c.Size - side) / 2, side
+}
+
+func checkLogo(c *Code, o Options) error {
+	if o.Logo != nil && c.Level < LevelQ {
+		return ErrLogoLevel
+	}
+	return nil
+}
+
+// Image renders c as an image
+func Image(c *Code, o Options) (image.Image, error) {
+	if err := checkLogo(c, o); err != nil {
+		return nil, err
+	}
+	border, scale := o.layout(c)
+	dim := (c.Size + 2*border) * scale
+	palette := color.Palette{color.White, color.Black}
+	img := image.NewPaletted(image.Rect(0, 0, dim, dim), palette)
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.Dark(x, y) {
+				continue
+			}
+			module := pixels(image.Rect(x, y, x+1, y+1), border, scale)
+			draw.Draw(img, module, image.Black, image.Point{}, draw.Src)
+		}
+	}
+	if o.Logo == nil {
+		return img, nil
+	}
+
+	rgba := image.NewRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), img, image.Point{}, draw.Src)
+	offset, side := logoBox(c)
+	box := pixels(image.Rect(offset, offset, offset+side, offset+side), border, scale)
+	draw.Draw(rgba, box, image.White, image.Point{}, draw.Src)
+	drawFitted(rgba, box.Inset(scale), o.Logo)
+	return rgba, nil
+}
+
+// pixels converts a rectangle of modules to the pixels it covers
+func pixels(r image.Rectangle, border, scale int) image.Rectangle {
+	r = r.Add(image.Pt(border, border))
+	return image.Rect(r.Min.X*scale, r.Min.Y*scale, r.Max.X*scale, r.Max.Y*scale)
+}
+
+// drawFitted scales src into the middle of box, keeping its aspect ratio
+func drawFitted(dst draw.Image, box image.Rectangle, src image.Image) {
+	sb := src.Bounds()
+	w, h := box.Dx(), box.Dy()
+	if sb.Empty() || w <= 0 || h <= 0 {
+		return
+	}
+	if sb.Dx()*h > sb.Dy()*w {
+		h = max(1, sb.Dy()*w/sb.Dx())
+	} else {
+		w = max(1, sb.Dx()*h/sb.Dy())
+	}
+
+	scaled := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			scaled.Set(x, y, src.At(sb.Min.X+x*sb.Dx()/w, sb.Min.Y+y*sb.Dy()/h))
+		}
+	}
+	at := box.Min.Add(image.Pt((box.Dx()-w)/2, (box.Dy()-h)/2))
+	draw.Draw(dst, scaled.Bounds().Add(at), scaled, image.Point{}, draw.Over)
+}
+
+// PNG writes c as a PNG image
+func PNG(w io.Writer, c *Code, o Options) error {
+	img, err := Image(c, o)
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, img)
+}
+
+// SVG writes c as an SVG image. Its coordinates are in modules, so it
+// scales without blurring; Size only sets the default width and height.
+func SVG(w io.Writer, c *Code, o Options) error {
+	if err := checkLogo(c, o); err != nil {
+		return err
+	}
+	border, scale := o.layout(c)
+	modules := c.Size + 2*border
+	dim := modules * scale
+	if o.Size > 0 {
+		dim = o.Size
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d" shape-rendering="crispEdges">`,
+		modules, modules, dim, dim)
+	b.WriteString(`<rect width="100%" height="100%" fill="#fff"/><path fill="#000" d="`)
+	// Each horizontal run of dark modules is one rectangle
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; {
+			if !c.Dark(x, y) {
+				x++
+				continue
+			}
+			run := 1
+			for x+run < c.Size && c.Dark(x+run, y) {
+				run++
+			}
+			fmt.Fprintf(&b, "M%d,%dh%dv1h-%dz", x+border, y+border, run, run)
+			x += run
+		}
+	}
+	b.WriteString(`"/>`)
+
+	if o.Logo != nil {
+		var logo bytes.Buffer
+		if err := png.Encode(&logo, o.Logo); err != nil {
+			return fmt.Errorf("failed to encode logo: %w", err)
+		}
+		offset, side := logoBox(c)
+		offset += border
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="#fff"/>`, offset, offset, side, side)
+		fmt.Fprintf(&b, `<image x="%d" y="%d" width="%d" height="%d" href="data:image/png;base64,%s"/>`,
+			offset+1, offset+1, side-2, side-2, base64.StdEncoding.EncodeToString(logo.Bytes()))
+	}
+	b.WriteString(`</svg>`)
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
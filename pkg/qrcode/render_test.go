@@ -0,0 +1,105 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const content = "https://qr.alipay.com/bax08431pmxgbgwb4nja0060"
+
+// rasterize draws the modules of an SVG written by SVG, scale pixels each
+func rasterize(t *testing.T, svg string, scale int) image.Image {
+	t.Helper()
+	viewBox := regexp.MustCompile(`viewBox="0 0 (\d+) (\d+)"`).FindStringSubmatch(svg)
+	if viewBox == nil {
+		t.Fatalf("Expected a viewBox in %.100s", svg)
+	}
+	modules, _ := strconv.Atoi(viewBox[1])
+	img := image.NewGray(image.Rect(0, 0, modules*scale, modules*scale))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	for _, run := range regexp.MustCompile(`M(\d+),(\d+)h(\d+)v1h-\d+z`).FindAllStringSubmatch(svg, -1) {
+		x, _ := strconv.Atoi(run[1])
+		y, _ := strconv.Atoi(run[2])
+		w, _ := strconv.Atoi(run[3])
+		draw.Draw(img, image.Rect(x*scale, y*scale, (x+w)*scale, (y+1)*scale), image.Black, image.Point{}, draw.Src)
+	}
+	return img
+}
+
+func TestPNGRoundTrip(t *testing.T) {
+	code, err := Encode(content, LevelM)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := PNG(&buf, code, Options{Size: 300}); err != nil {
+		t.Fatalf("PNG failed: %v", err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("Expected a valid PNG: %v", err)
+	}
+	if width := img.Bounds().Dx(); width > 300 || width <= 300-(code.Size+8) {
+		t.Errorf("Expected the image to be just under 300 pixels wide, got %d", width)
+	}
+	if text, _ := decode(t, img); text != content {
+		t.Errorf("Expected %q, got %q", content, text)
+	}
+}
+
+func TestSVGRoundTrip(t *testing.T) {
+	code, err := Encode(content, LevelQ)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := SVG(&buf, code, Options{Size: 256}); err != nil {
+		t.Fatalf("SVG failed: %v", err)
+	}
+	svg := buf.String()
+	if !strings.HasPrefix(svg, "<svg ") || !strings.Contains(svg, `width="256"`) {
+		t.Errorf("Unexpected SVG %.120s", svg)
+	}
+	if text, _ := decode(t, rasterize(t, svg, 4)); text != content {
+		t.Errorf("Expected %q, got %q", content, text)
+	}
+}
+
+func TestLogo(t *testing.T) {
+	logo := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	draw.Draw(logo, logo.Bounds(), &image.Uniform{color.RGBA{R: 0x16, G: 0x77, B: 0xff, A: 0xff}}, image.Point{}, draw.Src)
+
+	code, err := Encode(content, LevelH)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	img, err := Image(code, Options{Size: 400, Logo: logo})
+	if err != nil {
+		t.Fatalf("Image failed: %v", err)
+	}
+	center := img.Bounds().Dx() / 2
+	if r, g, b, _ := img.At(center, center).RGBA(); r>>8 != 0x16 || g>>8 != 0x77 || b>>8 != 0xff {
+		t.Errorf("Expected the logo in the middle of the code, got %v", img.At(center, center))
+	}
+	if text, _ := decode(t, img); text != content {
+		t.Errorf("Expected the code to decode despite the logo, got %q", text)
+	}
+
+	var buf bytes.Buffer
+	if err := SVG(&buf, code, Options{Logo: logo}); err != nil || !strings.Contains(buf.String(), "data:image/png;base64,") {
+		t.Errorf("Expected the logo embedded in the SVG, got %v", err)
+	}
+
+	low, _ := Encode(content, LevelM)
+	if _, err := Image(low, Options{Logo: logo}); !errors.Is(err, ErrLogoLevel) {
+		t.Errorf("Expected ErrLogoLevel for a logo at level M, got %v", err)
+	}
+}
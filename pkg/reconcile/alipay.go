@@ -0,0 +1,87 @@
+package reconcile
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+
+	"payment_go/pkg/interfaces"
+)
+
+// chinaTime is Alipay's time zone; a fixed zone avoids needing tzdata
+var chinaTime = time.FixedZone("CST", 8*60*60)
+
+// AlipayParser parses Alipay trade bills as returned by
+// alipay.data.dataservice.bill.downloadurl.query: a zip archive of GBK
+// encoded CSV files, of which the transaction detail file (业务明细) is
+// read. A detail CSV taken out of the archive is accepted as well.
+type AlipayParser struct{}
+
+// alipayColumns are the detail file columns the parser reads
+var alipayColumns = Columns{
+	Type:           "业务类型",
+	OrderID:        "商户订单号",
+	ChannelOrderID: "支付宝交易号",
+	Amount:         "订单金额（元）",
+	Fee:            "服务费（元）",
+	CreatedAt:      "创建时间",
+	CompletedAt:    "完成时间",
+}
+
+// Parse implements Parser
+func (AlipayParser) Parse(r io.Reader) ([]interfaces.StatementLine, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		if data, err = alipayDetailFile(data); err != nil {
+			return nil, err
+		}
+	}
+
+	parser := &CSVParser{
+		Columns:  alipayColumns,
+		Comment:  '#',
+		Types:    map[string]string{"交易": interfaces.StatementCollect, "退款": interfaces.StatementRefund},
+		Currency: "CNY",
+		Location: chinaTime,
+	}
+	return parser.Parse(simplifiedchinese.GBK.NewDecoder().Reader(bytes.NewReader(data)))
+}
+
+// alipayDetailFile extracts the detail CSV from a bill archive. The archive
+// also holds a summary file (业务明细(汇总)) which is skipped.
+func alipayDetailFile(data []byte) ([]byte, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid bill archive: %w", err)
+	}
+
+	for _, file := range archive.File {
+		name := file.Name
+		if file.NonUTF8 {
+			// Alipay writes entry names in GBK without flagging the encoding
+			if decoded, err := simplifiedchinese.GBK.NewDecoder().String(name); err == nil {
+				name = decoded
+			}
+		}
+		if !strings.HasSuffix(name, ".csv") || strings.Contains(name, "汇总") {
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	return nil, errors.New("bill archive has no detail file")
+}
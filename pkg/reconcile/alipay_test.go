@@ -0,0 +1,72 @@
+package reconcile
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+	"time"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+
+	"payment_go/pkg/interfaces"
+)
+
+const alipayBill = `#支付宝业务明细查询
+#账号：[20881234567890120156]
+#起始日期：[2024年03月01日 00:00:00]   终止日期：[2024年03月02日 00:00:00]
+#-----------------------------------------业务明细列表----------------------------------------
+支付宝交易号,商户订单号,业务类型,商品名称,创建时间,完成时间,门店编号,门店名称,操作员,终端号,对方账户,订单金额（元）,商家实收（元）,支付宝红包（元）,集分宝（元）,支付宝优惠（元）,商家优惠（元）,券核销金额（元）,券名称,商家红包消费金额（元）,卡消费金额（元）,退款批次号/请求号,服务费（元）,分润（元）,备注
+2024030122001412345678901234	,O1	,交易	,测试商品	,2024-03-01 10:00:00	,2024-03-01 10:00:05	,	,	,	,buyer@example.com	,100.00	,100.00	,0.00	,0.00	,0.00	,0.00	,0.00	,	,0.00	,0.00	,0.00	,	,-0.60	,0.00	,
+2024030122001412345678901234	,O1	,退款	,测试商品	,2024-03-01 10:00:00	,2024-03-01 15:30:00	,	,	,	,buyer@example.com	,-30.00	,-30.00	,0.00	,0.00	,0.00	,0.00	,0.00	,	,0.00	,0.00	,0.00	,R1	,0.18	,0.00	,
+#-----------------------------------------业务明细列表结束------------------------------------
+#交易合计：1笔，商家实收共100.00元，商家优惠共0.00元
+#导出时间：[2024年03月02日 09:00:00]
+`
+
+func alipayArchive(t *testing.T) []byte {
+	t.Helper()
+	encoder := simplifiedchinese.GBK.NewEncoder()
+	content, err := encoder.String(alipayBill)
+	if err != nil {
+		t.Fatalf("GBK encoding failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, name := range []string{"20881234567890120156_20240301_业务明细(汇总).csv", "20881234567890120156_20240301_业务明细.csv"} {
+		gbkName, _ := encoder.String(name)
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: gbkName, NonUTF8: true, Method: zip.Deflate})
+		if err != nil {
+			t.Fatalf("CreateHeader failed: %v", err)
+		}
+		if bytes.Contains([]byte(name), []byte("汇总")) {
+			w.Write([]byte("summary only"))
+			continue
+		}
+		w.Write([]byte(content))
+	}
+	archive.Close()
+	return buf.Bytes()
+}
+
+func TestAlipayParser(t *testing.T) {
+	lines, err := AlipayParser{}.Parse(bytes.NewReader(alipayArchive(t)))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(lines))
+	}
+
+	payment, refund := lines[0], lines[1]
+	if payment.Type != interfaces.StatementCollect || payment.OrderID != "O1" ||
+		payment.ChannelOrderID != "2024030122001412345678901234" || payment.Amount != 100 || payment.Fee != 0.6 {
+		t.Errorf("Unexpected payment line: %+v", payment)
+	}
+	if payment.Currency != "CNY" || !payment.CompletedAt.Equal(time.Date(2024, 3, 1, 2, 0, 5, 0, time.UTC)) {
+		t.Errorf("Expected CNY completed at 10:00:05 China time, got %s %v", payment.Currency, payment.CompletedAt)
+	}
+	if refund.Type != interfaces.StatementRefund || refund.Amount != 30 {
+		t.Errorf("Unexpected refund line: %+v", refund)
+	}
+}
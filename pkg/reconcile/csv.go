@@ -0,0 +1,176 @@
+package reconcile
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"payment_go/pkg/interfaces"
+)
+
+// Columns names the statement columns holding each field. Columns left
+// empty are not read; Amount and one of OrderID or ChannelOrderID are required.
+type Columns struct {
+	Type           string `json:"type,omitempty"`
+	OrderID        string `json:"order_id,omitempty"`
+	ChannelOrderID string `json:"channel_order_id,omitempty"`
+	MerchantID     string `json:"merchant_id,omitempty"`
+	Amount         string `json:"amount"`
+	Currency       string `json:"currency,omitempty"`
+	Fee            string `json:"fee,omitempty"`
+	Status         string `json:"status,omitempty"`
+	CreatedAt      string `json:"created_at,omitempty"`
+	CompletedAt    string `json:"completed_at,omitempty"`
+}
+
+// CSVParser parses statements that are a header row followed by one row per
+// transaction. Amounts and fees are read as absolute values; the direction
+// of a transaction comes from its type.
+type CSVParser struct {
+	Columns Columns
+	// Comma is the field separator, default ','
+	Comma rune
+	// Comment starts lines to skip, e.g. '#' for summary lines
+	Comment rune
+	// Types maps raw type values to interfaces.Statement* types; without a
+	// Type column every line is a collection
+	Types map[string]string
+	// Currency is used when there is no Currency column
+	Currency string
+	// TimeLayout parses timestamps, default "2006-01-02 15:04:05"
+	TimeLayout string
+	// Location is the timestamps' zone, default UTC
+	Location *time.Location
+}
+
+// Parse implements Parser
+func (p *CSVParser) Parse(r io.Reader) ([]interfaces.StatementLine, error) {
+	if p.Columns.Amount == "" || (p.Columns.OrderID == "" && p.Columns.ChannelOrderID == "") {
+		return nil, errors.New("amount and order_id or channel_order_id columns are required")
+	}
+
+	reader := csv.NewReader(r)
+	if p.Comma != 0 {
+		reader.Comma = p.Comma
+	}
+	reader.Comment = p.Comment
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("statement is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		positions[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{p.Columns.Amount, p.Columns.OrderID, p.Columns.ChannelOrderID} {
+		if _, ok := positions[name]; name != "" && !ok {
+			return nil, fmt.Errorf("statement has no %q column", name)
+		}
+	}
+
+	var lines []interfaces.StatementLine
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		row, _ := reader.FieldPos(0)
+		field := func(column string) string {
+			if i, ok := positions[column]; ok && column != "" && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		if strings.Join(record, "") == "" {
+			continue
+		}
+
+		line, err := p.parseRecord(field)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", row, err)
+		}
+		lines = append(lines, line)
+	}
+}
+
+func (p *CSVParser) parseRecord(field func(string) string) (interfaces.StatementLine, error) {
+	line := interfaces.StatementLine{
+		Type:           interfaces.StatementCollect,
+		OrderID:        field(p.Columns.OrderID),
+		ChannelOrderID: field(p.Columns.ChannelOrderID),
+		MerchantID:     field(p.Columns.MerchantID),
+		Currency:       p.Currency,
+		Status:         field(p.Columns.Status),
+	}
+	if line.OrderID == "" && line.ChannelOrderID == "" {
+		return line, errors.New("no order ID")
+	}
+
+	if raw := field(p.Columns.Type); p.Columns.Type != "" {
+		line.Type = raw
+		if mapped, ok := p.Types[raw]; ok {
+			line.Type = mapped
+		}
+		switch line.Type {
+		case interfaces.StatementCollect, interfaces.StatementPayout, interfaces.StatementRefund:
+		default:
+			return line, fmt.Errorf("unknown transaction type %q", raw)
+		}
+	}
+	if currency := field(p.Columns.Currency); currency != "" {
+		line.Currency = strings.ToUpper(currency)
+	}
+
+	var err error
+	if line.Amount, err = parseAmount(field(p.Columns.Amount)); err != nil {
+		return line, fmt.Errorf("invalid amount: %w", err)
+	}
+	if raw := field(p.Columns.Fee); raw != "" {
+		if line.Fee, err = parseAmount(raw); err != nil {
+			return line, fmt.Errorf("invalid fee: %w", err)
+		}
+	}
+	if line.CreatedAt, err = p.parseTime(field(p.Columns.CreatedAt)); err != nil {
+		return line, fmt.Errorf("invalid created time: %w", err)
+	}
+	if line.CompletedAt, err = p.parseTime(field(p.Columns.CompletedAt)); err != nil {
+		return line, fmt.Errorf("invalid completed time: %w", err)
+	}
+	return line, nil
+}
+
+func parseAmount(raw string) (float64, error) {
+	amount, err := strconv.ParseFloat(strings.ReplaceAll(raw, ",", ""), 64)
+	if err != nil {
+		return 0, err
+	}
+	return math.Abs(amount), nil
+}
+
+func (p *CSVParser) parseTime(raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	layout := p.TimeLayout
+	if layout == "" {
+		layout = time.DateTime
+	}
+	location := p.Location
+	if location == nil {
+		location = time.UTC
+	}
+	return time.ParseInLocation(layout, raw, location)
+}
@@ -0,0 +1,358 @@
+// Package reconcile compares the gateway's orders with the statements
+// (bill files) channels publish, so that what queries told us can be
+// checked against what the channel actually settled.
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/money"
+	"payment_go/pkg/order"
+)
+
+// DiscrepancyType classifies a difference between the gateway and a statement
+type DiscrepancyType string
+
+const (
+	// MissingLocally is a statement line with no matching order
+	MissingLocally DiscrepancyType = "missing_locally"
+	// MissingUpstream is a settled order absent from the statement
+	MissingUpstream DiscrepancyType = "missing_upstream"
+	// AmountMismatch is a matched order whose amount differs from the line
+	AmountMismatch DiscrepancyType = "amount_mismatch"
+	// StatusMismatch is a matched order whose status contradicts the line
+	StatusMismatch DiscrepancyType = "status_mismatch"
+)
+
+// Discrepancy is one difference found by Reconcile
+type Discrepancy struct {
+	Type           DiscrepancyType `json:"type"`
+	Kind           order.Kind      `json:"kind,omitempty"`
+	MerchantID     string          `json:"merchant_id,omitempty"`
+	OrderID        string          `json:"order_id,omitempty"`
+	ChannelOrderID string          `json:"channel_order_id,omitempty"`
+	Currency       string          `json:"currency,omitempty"`
+	// Amounts are in minor units of Currency
+	LocalAmount    int64        `json:"local_amount,omitempty"`
+	UpstreamAmount int64        `json:"upstream_amount,omitempty"`
+	LocalStatus    order.Status `json:"local_status,omitempty"`
+	UpstreamStatus order.Status `json:"upstream_status,omitempty"`
+	// Line is the statement line, absent for MissingUpstream
+	Line   *interfaces.StatementLine `json:"line,omitempty"`
+	Detail string                    `json:"detail"`
+}
+
+// Period bounds the orders a statement is expected to cover. Zero bounds
+// are open.
+type Period struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// Contains reports whether t falls in [From, To)
+func (p Period) Contains(t time.Time) bool {
+	return (p.From.IsZero() || !t.Before(p.From)) && (p.To.IsZero() || t.Before(p.To))
+}
+
+// Report is the outcome of reconciling one channel statement
+type Report struct {
+	ChannelID   string    `json:"channel_id"`
+	Period      Period    `json:"period"`
+	GeneratedAt time.Time `json:"generated_at"`
+	// Lines is the number of statement lines; Matched those without discrepancies
+	Lines         int           `json:"lines"`
+	Matched       int           `json:"matched"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+}
+
+// Summary counts the report's discrepancies by type
+func (r *Report) Summary() map[DiscrepancyType]int {
+	counts := make(map[DiscrepancyType]int)
+	for _, d := range r.Discrepancies {
+		counts[d.Type]++
+	}
+	return counts
+}
+
+// Parser reads a channel's statement file into normalized lines
+type Parser interface {
+	Parse(r io.Reader) ([]interfaces.StatementLine, error)
+}
+
+// Reconciler matches statements against the gateway's order store
+type Reconciler struct {
+	orders  order.Store
+	mutex   sync.RWMutex
+	parsers map[string]Parser
+}
+
+// New creates a reconciler over orders
+func New(orders order.Store) *Reconciler {
+	return &Reconciler{orders: orders, parsers: make(map[string]Parser)}
+}
+
+// RegisterParser sets the parser for a channel's statement files
+func (r *Reconciler) RegisterParser(channelID string, parser Parser) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.parsers[channelID] = parser
+}
+
+// ReconcileFile parses a statement with the channel's parser and reconciles it
+func (r *Reconciler) ReconcileFile(ctx context.Context, channelID string, file io.Reader, period Period) (*Report, error) {
+	r.mutex.RLock()
+	parser, exists := r.parsers[channelID]
+	r.mutex.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("no statement parser registered for channel %s", channelID)
+	}
+
+	lines, err := parser.Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("channel %s statement: %w", channelID, err)
+	}
+	return r.Reconcile(ctx, channelID, lines, period)
+}
+
+// Reconcile matches statement lines to the channel's orders, by channel
+// order ID first and merchant order ID second. Every line is checked, and
+// orders that settled within period but are absent from the statement are
+// reported as MissingUpstream.
+func (r *Reconciler) Reconcile(ctx context.Context, channelID string, lines []interfaces.StatementLine, period Period) (*Report, error) {
+	orders, err := r.orders.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	idx := newIndex(channelID, orders)
+
+	report := &Report{ChannelID: channelID, Period: period, GeneratedAt: time.Now(), Lines: len(lines)}
+	seen := make(map[string]bool)
+	for i := range lines {
+		line := &lines[i]
+		found := checkLine(idx, line, &report.Discrepancies)
+		if found == nil {
+			continue
+		}
+		if line.Type != interfaces.StatementRefund {
+			seen[found.Key()] = true
+		}
+	}
+	report.Matched = report.Lines - countLineDiscrepancies(report.Discrepancies)
+
+	for _, o := range idx.orders {
+		settled, ok := settledAt(o)
+		if !ok || seen[o.Key()] || !period.Contains(settled) {
+			continue
+		}
+		report.Discrepancies = append(report.Discrepancies, Discrepancy{
+			Type:           MissingUpstream,
+			Kind:           o.Kind,
+			MerchantID:     o.MerchantID,
+			OrderID:        o.ID,
+			ChannelOrderID: o.ChannelOrderID,
+			Currency:       o.Currency,
+			LocalAmount:    o.Amount,
+			LocalStatus:    o.Status,
+			Detail:         fmt.Sprintf("order %s settled at %s but is not in the statement", o.ID, settled.Format(time.RFC3339)),
+		})
+	}
+	return report, nil
+}
+
+// checkLine matches a line and records its discrepancies. It returns the
+// matched order, or nil when the line has none.
+func checkLine(idx *index, line *interfaces.StatementLine, out *[]Discrepancy) *order.Order {
+	kind := lineKind(line.Type)
+	upstream := lineStatus(line)
+	amount, amountErr := money.ToMinor(line.Amount, line.Currency)
+
+	o, detail := idx.match(kind, line)
+	if o == nil {
+		*out = append(*out, Discrepancy{
+			Type:           MissingLocally,
+			Kind:           kind,
+			MerchantID:     line.MerchantID,
+			OrderID:        line.OrderID,
+			ChannelOrderID: line.ChannelOrderID,
+			Currency:       line.Currency,
+			UpstreamAmount: amount,
+			UpstreamStatus: upstream,
+			Line:           line,
+			Detail:         detail,
+		})
+		return nil
+	}
+
+	local, amountMatches := o.Amount, amount == o.Amount
+	statusMatches := consistent(o.Status, upstream)
+	if line.Type == interfaces.StatementRefund {
+		local, amountMatches = refunded(o, amount)
+		statusMatches = o.Status == order.StatusRefunded || len(o.Refunds) > 0
+	}
+
+	base := Discrepancy{
+		Kind:           kind,
+		MerchantID:     o.MerchantID,
+		OrderID:        o.ID,
+		ChannelOrderID: o.ChannelOrderID,
+		Currency:       o.Currency,
+		LocalAmount:    local,
+		UpstreamAmount: amount,
+		LocalStatus:    o.Status,
+		UpstreamStatus: upstream,
+		Line:           line,
+	}
+	if amountErr != nil || !amountMatches || line.Currency != o.Currency {
+		d := base
+		d.Type = AmountMismatch
+		d.Detail = fmt.Sprintf("order %s is %s %s locally but %v %s upstream",
+			o.ID, money.Format(o.Amount, o.Currency), o.Currency, line.Amount, line.Currency)
+		if line.Type == interfaces.StatementRefund {
+			d.Detail = fmt.Sprintf("order %s has %s %s refunded locally but the statement refunds %v %s",
+				o.ID, money.Format(local, o.Currency), o.Currency, line.Amount, line.Currency)
+		}
+		*out = append(*out, d)
+	}
+	if !statusMatches {
+		d := base
+		d.Type = StatusMismatch
+		d.Detail = fmt.Sprintf("order %s is %s locally but %s upstream", o.ID, o.Status, upstream)
+		*out = append(*out, d)
+	}
+	return o
+}
+
+// refunded returns what the gateway refunded of o and whether a refund
+// line for amount agrees with it, either as one of its refunds or as their
+// total. Orders refunded before partial refunds were recorded were refunded
+// in full.
+func refunded(o *order.Order, amount int64) (int64, bool) {
+	total := o.Refunded()
+	if len(o.Refunds) == 0 && o.Status == order.StatusRefunded {
+		total = o.Amount
+	}
+	if amount == total {
+		return total, true
+	}
+	for _, refund := range o.Refunds {
+		if refund.Amount == amount {
+			return total, true
+		}
+	}
+	return total, false
+}
+
+// countLineDiscrepancies counts the lines with at least one discrepancy
+func countLineDiscrepancies(discrepancies []Discrepancy) int {
+	lines := make(map[*interfaces.StatementLine]bool)
+	for _, d := range discrepancies {
+		if d.Line != nil {
+			lines[d.Line] = true
+		}
+	}
+	return len(lines)
+}
+
+func lineKind(lineType string) order.Kind {
+	if lineType == interfaces.StatementPayout {
+		return order.KindPayout
+	}
+	return order.KindCollect
+}
+
+// lineStatus is the status a line says its order should have
+func lineStatus(line *interfaces.StatementLine) order.Status {
+	if line.Type == interfaces.StatementRefund {
+		return order.StatusRefunded
+	}
+	if line.Status == "" {
+		return order.StatusSucceeded
+	}
+	return order.NormalizeStatus(line.Status)
+}
+
+// consistent reports whether a local status agrees with the upstream one.
+// A statement listing the original payment still agrees with an order
+// that has since been refunded or returned.
+func consistent(local, upstream order.Status) bool {
+	if local == upstream {
+		return true
+	}
+	return upstream == order.StatusSucceeded && (local == order.StatusRefunded || local == order.StatusReturned)
+}
+
+// settledAt returns when money moved for an order, if it did
+func settledAt(o *order.Order) (time.Time, bool) {
+	switch o.Status {
+	case order.StatusSucceeded, order.StatusRefunded, order.StatusReturned:
+	default:
+		return time.Time{}, false
+	}
+	for i := len(o.History) - 1; i >= 0; i-- {
+		if o.History[i].To == order.StatusSucceeded {
+			return o.History[i].At, true
+		}
+	}
+	return o.UpdatedAt, true
+}
+
+// index looks up a channel's orders by their IDs
+type index struct {
+	orders         []*order.Order
+	byChannelOrder map[string]*order.Order
+	byOrder        map[string][]*order.Order
+}
+
+func newIndex(channelID string, orders []order.Order) *index {
+	idx := &index{
+		byChannelOrder: make(map[string]*order.Order),
+		byOrder:        make(map[string][]*order.Order),
+	}
+	for i := range orders {
+		o := &orders[i]
+		if o.ChannelID != channelID {
+			continue
+		}
+		idx.orders = append(idx.orders, o)
+		if o.ChannelOrderID != "" {
+			idx.byChannelOrder[string(o.Kind)+":"+o.ChannelOrderID] = o
+		}
+		key := string(o.Kind) + ":" + o.UpstreamID()
+		idx.byOrder[key] = append(idx.byOrder[key], o)
+	}
+	sort.SliceStable(idx.orders, func(i, j int) bool { return idx.orders[i].CreatedAt.Before(idx.orders[j].CreatedAt) })
+	return idx
+}
+
+// match finds the order for a line, or explains why there is none
+func (idx *index) match(kind order.Kind, line *interfaces.StatementLine) (*order.Order, string) {
+	if line.ChannelOrderID != "" {
+		if o, ok := idx.byChannelOrder[string(kind)+":"+line.ChannelOrderID]; ok {
+			return o, ""
+		}
+	}
+	if line.OrderID == "" {
+		return nil, fmt.Sprintf("no %s order with channel order ID %s", kind, line.ChannelOrderID)
+	}
+
+	var candidates []*order.Order
+	for _, o := range idx.byOrder[string(kind)+":"+line.OrderID] {
+		if line.MerchantID == "" || o.MerchantID == line.MerchantID {
+			candidates = append(candidates, o)
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return nil, fmt.Sprintf("no %s order %s", kind, line.OrderID)
+	case 1:
+		return candidates[0], ""
+	}
+	return nil, fmt.Sprintf("%s order %s exists for several merchants and the statement does not say which", kind, line.OrderID)
+}
@@ -0,0 +1,227 @@
+package reconcile
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/order"
+)
+
+var day = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+const statement = `# Statement for 2024-03-01
+type,order_id,trade_no,amount,currency,fee,status,paid_at
+PAY,O1,C1,100.00,CNY,-0.60,SUCCESS,2024-03-01 10:00:00
+PAY,O2,C2,50.01,CNY,-0.30,SUCCESS,2024-03-01 11:00:00
+PAY,O3,C3,20.00,CNY,-0.12,SUCCESS,2024-03-01 12:00:00
+PAY,O5,C5,10.00,CNY,-0.06,SUCCESS,2024-03-01 13:00:00
+REFUND,O6,C6,-30.00,CNY,0.18,SUCCESS,2024-03-01 14:00:00
+`
+
+func testParser() *CSVParser {
+	return &CSVParser{
+		Columns: Columns{
+			Type: "type", OrderID: "order_id", ChannelOrderID: "trade_no", Amount: "amount",
+			Currency: "currency", Fee: "fee", Status: "status", CompletedAt: "paid_at",
+		},
+		Comment: '#',
+		Types:   map[string]string{"PAY": interfaces.StatementCollect, "REFUND": interfaces.StatementRefund},
+	}
+}
+
+func seedOrders(t *testing.T) order.Store {
+	t.Helper()
+	store := order.NewMemoryStore()
+	orders := []struct {
+		id, channelOrderID string
+		amount             int64
+		status             order.Status
+		at                 time.Time
+	}{
+		{"O1", "C1", 10000, order.StatusSucceeded, day.Add(10 * time.Hour)},
+		{"O2", "C2", 5000, order.StatusSucceeded, day.Add(11 * time.Hour)},
+		{"O3", "", 2000, order.StatusPending, day.Add(12 * time.Hour)},
+		{"O4", "C4", 4000, order.StatusSucceeded, day.Add(15 * time.Hour)},
+		{"O6", "C6", 3000, order.StatusRefunded, day.Add(-15 * time.Hour)},
+		{"O7", "C7", 7000, order.StatusSucceeded, day.Add(30 * time.Hour)},
+	}
+	for _, seed := range orders {
+		o := order.Order{
+			ID: seed.id, Kind: order.KindCollect, MerchantID: "M1", ChannelID: "alipay",
+			ChannelOrderID: seed.channelOrderID, Amount: seed.amount, Currency: "CNY",
+			Status: seed.status, CreatedAt: seed.at, UpdatedAt: seed.at,
+			History: []order.Transition{{To: seed.status, At: seed.at}},
+		}
+		if err := store.Create(context.Background(), o); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+	return store
+}
+
+func TestCSVParser(t *testing.T) {
+	lines, err := testParser().Parse(strings.NewReader(statement))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(lines) != 5 {
+		t.Fatalf("Expected 5 lines, got %d", len(lines))
+	}
+	refund := lines[4]
+	if refund.Type != interfaces.StatementRefund || refund.Amount != 30 || refund.Fee != 0.18 {
+		t.Errorf("Expected refund of 30 with fee 0.18, got %+v", refund)
+	}
+	if !lines[0].CompletedAt.Equal(day.Add(10 * time.Hour)) {
+		t.Errorf("Expected completion time to be parsed, got %v", lines[0].CompletedAt)
+	}
+
+	bad := strings.Replace(statement, "20.00", "twenty", 1)
+	if _, err := testParser().Parse(strings.NewReader(bad)); err == nil || !strings.Contains(err.Error(), "line 5") {
+		t.Errorf("Expected error naming line 5 when amount is invalid, got %v", err)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	reconciler := New(seedOrders(t))
+	reconciler.RegisterParser("alipay", testParser())
+
+	period := Period{From: day, To: day.Add(24 * time.Hour)}
+	report, err := reconciler.ReconcileFile(ctx, "alipay", strings.NewReader(statement), period)
+	if err != nil {
+		t.Fatalf("ReconcileFile failed: %v", err)
+	}
+
+	found := make(map[string]DiscrepancyType)
+	for _, d := range report.Discrepancies {
+		found[d.OrderID] = d.Type
+	}
+	expected := map[string]DiscrepancyType{
+		"O2": AmountMismatch,
+		"O3": StatusMismatch,
+		"O4": MissingUpstream,
+		"O5": MissingLocally,
+	}
+	if len(found) != len(expected) {
+		t.Errorf("Expected %d discrepancies, got %+v", len(expected), report.Discrepancies)
+	}
+	for orderID, want := range expected {
+		if found[orderID] != want {
+			t.Errorf("Expected %s for %s, got %q", want, orderID, found[orderID])
+		}
+	}
+	if report.Lines != 5 || report.Matched != 2 {
+		t.Errorf("Expected 2 of 5 lines matched, got %d of %d", report.Matched, report.Lines)
+	}
+
+	if _, err := reconciler.ReconcileFile(ctx, "wechat", strings.NewReader(statement), period); err == nil {
+		t.Error("Expected error when the channel has no parser")
+	}
+}
+
+// settlingQuerier marks queried orders as paid, like a gateway whose
+// channel reports them paid
+type settlingQuerier struct {
+	store   order.Store
+	queried []string
+}
+
+func (sq *settlingQuerier) CollectQuery(ctx context.Context, req *interfaces.CollectQueryRequest) (*interfaces.CollectQueryResponse, error) {
+	sq.queried = append(sq.queried, req.OrderID)
+	o, err := sq.store.Get(ctx, order.KindCollect, req.MerchantID, req.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.Transition(order.StatusSucceeded, "TRADE_SUCCESS", time.Now()); err != nil {
+		return nil, err
+	}
+	return &interfaces.CollectQueryResponse{OrderID: req.OrderID, Status: "TRADE_SUCCESS"}, sq.store.Update(ctx, o)
+}
+
+func (sq *settlingQuerier) PayoutQuery(ctx context.Context, req *interfaces.PayoutQueryRequest) (*interfaces.PayoutQueryResponse, error) {
+	return &interfaces.PayoutQueryResponse{}, nil
+}
+
+func TestResolve(t *testing.T) {
+	ctx := context.Background()
+	store := seedOrders(t)
+	reconciler := New(store)
+
+	lines, _ := testParser().Parse(strings.NewReader(statement))
+	for i := range lines {
+		lines[i].MerchantID = "M1"
+	}
+	report, err := reconciler.Reconcile(ctx, "alipay", lines, Period{From: day, To: day.Add(24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+
+	querier := &settlingQuerier{store: store}
+	resolutions := reconciler.Resolve(ctx, report, querier)
+	if len(resolutions) != len(report.Discrepancies) {
+		t.Fatalf("Expected a resolution per discrepancy, got %d", len(resolutions))
+	}
+	if strings.Join(querier.queried, ",") != "O3,O5" {
+		t.Errorf("Expected queries for O3 and O5 only, got %v", querier.queried)
+	}
+
+	for _, r := range resolutions {
+		switch r.Discrepancy.OrderID {
+		case "O3":
+			if !r.Resolved || r.Status != order.StatusSucceeded {
+				t.Errorf("Expected O3 to be resolved by the query, got %+v", r)
+			}
+		case "O5":
+			if r.Resolved || r.Error == "" {
+				t.Errorf("Expected O5 to stay unresolved with an error, got %+v", r)
+			}
+		default:
+			if r.Queried {
+				t.Errorf("Expected %s not to be queried", r.Discrepancy.OrderID)
+			}
+		}
+	}
+}
+
+func TestReconcileRefunds(t *testing.T) {
+	ctx := context.Background()
+	store := order.NewMemoryStore()
+	at := day.Add(9 * time.Hour)
+	partial := order.Order{
+		ID: "O8", Kind: order.KindCollect, MerchantID: "M1", ChannelID: "alipay",
+		ChannelOrderID: "C8", Amount: 8000, Currency: "CNY",
+		Status: order.StatusSucceeded, CreatedAt: at, UpdatedAt: at,
+		History: []order.Transition{{To: order.StatusSucceeded, At: at}},
+		Refunds: []order.Refund{{ID: "R1", Amount: 2000, At: at}, {ID: "R2", Amount: 1000, At: at}},
+	}
+	if err := store.Create(ctx, partial); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	reconciler := New(store)
+
+	lines := []interfaces.StatementLine{
+		{Type: interfaces.StatementCollect, ChannelOrderID: "C8", Amount: 80, Currency: "CNY"},
+		{Type: interfaces.StatementRefund, ChannelOrderID: "C8", Amount: 20, Currency: "CNY"},
+		{Type: interfaces.StatementRefund, ChannelOrderID: "C8", Amount: 45, Currency: "CNY"},
+		{Type: interfaces.StatementCollect, OrderID: "O9", Amount: 10, Currency: "CNY"},
+	}
+	report, err := reconciler.Reconcile(ctx, "alipay", lines, Period{From: day, To: day.Add(24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	if len(report.Discrepancies) != 2 || report.Matched != 2 {
+		t.Fatalf("Expected a refund mismatch and a missing order, got %+v", report.Discrepancies)
+	}
+	mismatch := report.Discrepancies[0]
+	if mismatch.Type != AmountMismatch || mismatch.Line != &lines[2] || mismatch.LocalAmount != 3000 || mismatch.UpstreamAmount != 4500 {
+		t.Errorf("Expected the 45.00 refund to mismatch the 30.00 refunded, got %+v", mismatch)
+	}
+
+	resolutions := reconciler.Resolve(ctx, report, &settlingQuerier{store: store})
+	if missing := resolutions[1]; missing.Queried || missing.Error == "" {
+		t.Errorf("Expected a line without a merchant to be reported unqueryable, got %+v", missing)
+	}
+}
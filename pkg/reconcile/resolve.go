@@ -0,0 +1,88 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"payment_go/pkg/interfaces"
+	"payment_go/pkg/order"
+)
+
+// Querier issues order queries; *gateway.Gateway implements it, and its
+// bookkeeping applies whatever status the query returns to the order
+type Querier interface {
+	CollectQuery(ctx context.Context, req *interfaces.CollectQueryRequest) (*interfaces.CollectQueryResponse, error)
+	PayoutQuery(ctx context.Context, req *interfaces.PayoutQueryRequest) (*interfaces.PayoutQueryResponse, error)
+}
+
+// Resolution is the outcome of a corrective query for a discrepancy
+type Resolution struct {
+	Discrepancy Discrepancy `json:"discrepancy"`
+	// Queried is false when the discrepancy cannot be fixed by a query or
+	// the statement does not identify the merchant and order
+	Queried bool `json:"queried"`
+	// Status is the order's status after the query
+	Status order.Status `json:"status,omitempty"`
+	// Resolved reports whether the discrepancy no longer holds
+	Resolved bool   `json:"resolved"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Resolve queries the channel for every order the statement shows the
+// gateway to be missing or behind on, letting the gateway's bookkeeping catch
+// up with the upstream, and reports which discrepancies the queries resolved.
+// Amount mismatches and orders missing upstream are left for manual review:
+// the upstream already told us its view of those. Lines that do not say
+// which merchant's order they are cannot be queried and carry an Error.
+func (r *Reconciler) Resolve(ctx context.Context, report *Report, querier Querier) []Resolution {
+	resolutions := make([]Resolution, 0, len(report.Discrepancies))
+	for _, d := range report.Discrepancies {
+		resolution := Resolution{Discrepancy: d}
+		if d.Type != MissingLocally && d.Type != StatusMismatch {
+			resolutions = append(resolutions, resolution)
+			continue
+		}
+		if d.MerchantID == "" || d.OrderID == "" {
+			resolution.Error = "statement line does not identify the merchant and order to query"
+			resolutions = append(resolutions, resolution)
+			continue
+		}
+
+		resolution.Queried = true
+		if err := query(ctx, querier, report.ChannelID, d); err != nil {
+			resolution.Error = err.Error()
+		}
+
+		current, err := r.orders.Get(ctx, d.Kind, d.MerchantID, d.OrderID)
+		switch {
+		case err == nil:
+			resolution.Status = current.Status
+			resolution.Resolved = resolved(d, current.Status)
+		case !errors.Is(err, order.ErrNotFound) && resolution.Error == "":
+			resolution.Error = err.Error()
+		}
+		resolutions = append(resolutions, resolution)
+	}
+	return resolutions
+}
+
+func query(ctx context.Context, querier Querier, channelID string, d Discrepancy) error {
+	base := interfaces.BaseRequest{
+		MerchantID: d.MerchantID,
+		ChannelID:  channelID,
+		RequestID:  "reconcile-" + d.OrderID,
+		Timestamp:  time.Now(),
+	}
+	if d.Kind == order.KindPayout {
+		_, err := querier.PayoutQuery(ctx, &interfaces.PayoutQueryRequest{BaseRequest: base, OrderID: d.OrderID, ChannelOrderID: d.ChannelOrderID})
+		return err
+	}
+	_, err := querier.CollectQuery(ctx, &interfaces.CollectQueryRequest{BaseRequest: base, OrderID: d.OrderID, ChannelOrderID: d.ChannelOrderID})
+	return err
+}
+
+// resolved reports whether the order's status now agrees with the statement
+func resolved(d Discrepancy, status order.Status) bool {
+	return consistent(status, d.UpstreamStatus)
+}
@@ -0,0 +1,34 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"payment_go/pkg/interfaces"
+)
+
+// ReadStatement drains a statement stream and closes it
+func ReadStatement(stream interfaces.StatementStream) ([]interfaces.StatementLine, error) {
+	var lines []interfaces.StatementLine
+	for {
+		line, err := stream.Next()
+		if errors.Is(err, io.EOF) {
+			return lines, stream.Close()
+		}
+		if err != nil {
+			stream.Close()
+			return nil, err
+		}
+		lines = append(lines, *line)
+	}
+}
+
+// ReconcileStream reconciles a statement downloaded from the channel
+func (r *Reconciler) ReconcileStream(ctx context.Context, channelID string, stream interfaces.StatementStream, period Period) (*Report, error) {
+	lines, err := ReadStatement(stream)
+	if err != nil {
+		return nil, err
+	}
+	return r.Reconcile(ctx, channelID, lines, period)
+}
@@ -0,0 +1,320 @@
+// Package routing picks the channel that serves an order when a merchant
+// addresses a route, a named group of channels, instead of a single channel.
+// Channels that cannot take the order are filtered out and the rest are
+// ranked by the route's strategy.
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Strategy ranks the eligible channels of a route
+type Strategy string
+
+// Strategies
+const (
+	// StrategyCost prefers the lowest upstream fee for the order
+	StrategyCost Strategy = "cost"
+	// StrategySuccessRate prefers the best rolling success rate
+	StrategySuccessRate Strategy = "success_rate"
+	// StrategyLatency prefers the lowest rolling average latency. Channels
+	// without calls yet rank first, so they build up a history.
+	StrategyLatency Strategy = "latency"
+	// StrategyWeighted splits traffic randomly in proportion to weights
+	StrategyWeighted Strategy = "weighted"
+)
+
+// Target is one channel of a route and the orders it may take
+type Target struct {
+	ChannelID string `json:"channel_id"`
+	// Weight is the channel's share under StrategyWeighted, default 1
+	Weight int `json:"weight,omitempty"`
+	// Currencies limits the channel to these currencies; empty allows any
+	Currencies []string `json:"currencies,omitempty"`
+	// MinAmount and MaxAmount bound the order amount in minor units; zero
+	// leaves the bound open
+	MinAmount int64 `json:"min_amount,omitempty"`
+	MaxAmount int64 `json:"max_amount,omitempty"`
+}
+
+func (t Target) weight() int {
+	if t.Weight == 0 {
+		return 1
+	}
+	return t.Weight
+}
+
+// Failover configures placing a collection on the next ranked channel when
+// a channel definitively did not create it
+type Failover struct {
+	Enabled bool `json:"enabled"`
+	// MaxAttempts bounds the channels tried per order; zero tries every
+	// eligible channel
+	MaxAttempts int `json:"max_attempts,omitempty"`
+}
+
+// Attempts returns how many of eligible ranked channels to try
+func (f Failover) Attempts(eligible int) int {
+	if !f.Enabled {
+		return min(1, eligible)
+	}
+	if f.MaxAttempts > 0 {
+		return min(f.MaxAttempts, eligible)
+	}
+	return eligible
+}
+
+// Route is a named group of channels orders can be routed across
+type Route struct {
+	ID       string   `json:"id"`
+	Strategy Strategy `json:"strategy"`
+	Channels []Target `json:"channels"`
+	// Failover applies to every merchant not listed in MerchantFailover
+	Failover         Failover            `json:"failover"`
+	MerchantFailover map[string]Failover `json:"merchant_failover,omitempty"`
+}
+
+// FailoverFor returns the failover settings for merchantID's orders
+func (r Route) FailoverFor(merchantID string) Failover {
+	if f, ok := r.MerchantFailover[merchantID]; ok {
+		return f
+	}
+	return r.Failover
+}
+
+// Validate reports structural problems in the route
+func (r Route) Validate() error {
+	if r.ID == "" {
+		return fmt.Errorf("route id is required")
+	}
+	switch r.Strategy {
+	case StrategyCost, StrategySuccessRate, StrategyLatency, StrategyWeighted:
+	default:
+		return fmt.Errorf("route %s: unknown strategy %q", r.ID, r.Strategy)
+	}
+	if len(r.Channels) == 0 {
+		return fmt.Errorf("route %s: at least one channel is required", r.ID)
+	}
+	if r.Failover.MaxAttempts < 0 {
+		return fmt.Errorf("route %s: failover.max_attempts must not be negative", r.ID)
+	}
+	for merchantID, f := range r.MerchantFailover {
+		if f.MaxAttempts < 0 {
+			return fmt.Errorf("route %s: merchant %s: failover.max_attempts must not be negative", r.ID, merchantID)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, target := range r.Channels {
+		if target.ChannelID == "" {
+			return fmt.Errorf("route %s: channel_id is required", r.ID)
+		}
+		if seen[target.ChannelID] {
+			return fmt.Errorf("route %s: channel %s is listed twice", r.ID, target.ChannelID)
+		}
+		seen[target.ChannelID] = true
+		if target.Weight < 0 || target.MinAmount < 0 || target.MaxAmount < 0 {
+			return fmt.Errorf("route %s: channel %s: weight and amounts must not be negative", r.ID, target.ChannelID)
+		}
+		if target.MaxAmount != 0 && target.MaxAmount < target.MinAmount {
+			return fmt.Errorf("route %s: channel %s: max_amount is below min_amount", r.ID, target.ChannelID)
+		}
+	}
+	return nil
+}
+
+// Request describes the order being routed
+type Request struct {
+	// Operation is the capability the channel must declare, e.g. "collect_order"
+	Operation  string
+	MerchantID string
+	Currency   string
+	// Amount is in minor units of Currency
+	Amount int64
+	// PaymentMethod is how the payer pays a collection, if requested
+	PaymentMethod string
+}
+
+// Candidate is what the gateway knows about a channel of the route
+type Candidate struct {
+	// Loaded is false when no plugin serves the channel
+	Loaded       bool
+	Capabilities []string
+	// Ready is false when health probes say the channel is down
+	Ready bool
+	// Refusal says why the channel's declared operating limits rule the
+	// order out, e.g. "does not accept USD"; empty when they allow it
+	Refusal string
+	// Cost is the channel's fee for the order in minor units
+	Cost int64
+}
+
+// Decision is a channel chosen for an order and why
+type Decision struct {
+	RouteID   string `json:"route_id"`
+	ChannelID string `json:"channel_id"`
+	Reason    string `json:"reason"`
+}
+
+// Router ranks the channels of configured routes. It is safe for
+// concurrent use.
+type Router struct {
+	routes map[string]Route
+	stats  *Stats
+	// random returns a number in [0, 1) for weighted splits
+	random func() float64
+}
+
+// New validates routes and builds a router from them
+func New(routes []Route) (*Router, error) {
+	r := &Router{routes: make(map[string]Route), stats: NewStats(DefaultWindow), random: rand.Float64}
+	var errs []error
+	for _, route := range routes {
+		if err := route.Validate(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if _, exists := r.routes[route.ID]; exists {
+			errs = append(errs, fmt.Errorf("route %s is defined twice", route.ID))
+			continue
+		}
+		r.routes[route.ID] = route
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return r, nil
+}
+
+// Route returns the route named id
+func (r *Router) Route(id string) (Route, bool) {
+	if r == nil {
+		return Route{}, false
+	}
+	route, ok := r.routes[id]
+	return route, ok
+}
+
+// Stats returns the rolling call statistics the router ranks by
+func (r *Router) Stats() *Stats {
+	return r.stats
+}
+
+// Rank filters the route's channels down to those that can take req and
+// orders them best first. candidates describes each channel by ID. The
+// error lists why every channel was excluded when none is eligible.
+func (r *Router) Rank(route Route, req Request, candidates map[string]Candidate) ([]Decision, error) {
+	var eligible []Target
+	var excluded []string
+	for _, target := range route.Channels {
+		if reason := exclusion(target, req, candidates[target.ChannelID]); reason != "" {
+			excluded = append(excluded, target.ChannelID+" "+reason)
+			continue
+		}
+		eligible = append(eligible, target)
+	}
+	if len(eligible) == 0 {
+		return nil, fmt.Errorf("route %s has no channel for %s %d %s: %s",
+			route.ID, req.Operation, req.Amount, req.Currency, strings.Join(excluded, "; "))
+	}
+
+	var reasons []string
+	switch route.Strategy {
+	case StrategyCost:
+		sort.SliceStable(eligible, func(i, j int) bool {
+			return candidates[eligible[i].ChannelID].Cost < candidates[eligible[j].ChannelID].Cost
+		})
+		for _, target := range eligible {
+			reasons = append(reasons, fmt.Sprintf("cost %d", candidates[target.ChannelID].Cost))
+		}
+	case StrategySuccessRate:
+		sort.SliceStable(eligible, func(i, j int) bool {
+			return r.stats.Snapshot(eligible[i].ChannelID).SuccessRate() > r.stats.Snapshot(eligible[j].ChannelID).SuccessRate()
+		})
+		for _, target := range eligible {
+			snapshot := r.stats.Snapshot(target.ChannelID)
+			reasons = append(reasons, fmt.Sprintf("success rate %.1f%% over %d calls", snapshot.SuccessRate()*100, snapshot.Calls))
+		}
+	case StrategyLatency:
+		sort.SliceStable(eligible, func(i, j int) bool {
+			return r.stats.Snapshot(eligible[i].ChannelID).Latency < r.stats.Snapshot(eligible[j].ChannelID).Latency
+		})
+		for _, target := range eligible {
+			snapshot := r.stats.Snapshot(target.ChannelID)
+			reasons = append(reasons, fmt.Sprintf("average latency %s over %d calls", snapshot.Latency.Round(time.Millisecond), snapshot.Calls))
+		}
+	case StrategyWeighted:
+		total := 0
+		for _, target := range eligible {
+			total += target.weight()
+		}
+		eligible = r.weighted(eligible, total)
+		for _, target := range eligible {
+			reasons = append(reasons, fmt.Sprintf("weight %d of %d", target.weight(), total))
+		}
+	}
+
+	decisions := make([]Decision, len(eligible))
+	for i, target := range eligible {
+		decisions[i] = Decision{
+			RouteID:   route.ID,
+			ChannelID: target.ChannelID,
+			Reason:    fmt.Sprintf("%s: %s", route.Strategy, reasons[i]),
+		}
+	}
+	return decisions, nil
+}
+
+// weighted draws the first channel in proportion to weight and orders the
+// rest by descending weight
+func (r *Router) weighted(targets []Target, total int) []Target {
+	pick := int(r.random() * float64(total))
+	first := len(targets) - 1
+	for i, target := range targets {
+		if pick < target.weight() {
+			first = i
+			break
+		}
+		pick -= target.weight()
+	}
+
+	ordered := append([]Target{targets[first]}, targets[:first]...)
+	ordered = append(ordered, targets[first+1:]...)
+	rest := ordered[1:]
+	sort.SliceStable(rest, func(i, j int) bool { return rest[i].weight() > rest[j].weight() })
+	return ordered
+}
+
+// exclusion says why target cannot take req, or "" if it can
+func exclusion(target Target, req Request, candidate Candidate) string {
+	switch {
+	case !candidate.Loaded:
+		return "is not loaded"
+	case !contains(candidate.Capabilities, req.Operation):
+		return "does not support " + req.Operation
+	case candidate.Refusal != "":
+		return candidate.Refusal
+	case len(target.Currencies) > 0 && !contains(target.Currencies, req.Currency):
+		return "does not accept " + req.Currency
+	case target.MinAmount != 0 && req.Amount < target.MinAmount:
+		return fmt.Sprintf("requires at least %d", target.MinAmount)
+	case target.MaxAmount != 0 && req.Amount > target.MaxAmount:
+		return fmt.Sprintf("accepts at most %d", target.MaxAmount)
+	case !candidate.Ready:
+		return "is unhealthy"
+	}
+	return ""
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package routing
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func ready(cost int64) Candidate {
+	return Candidate{Loaded: true, Ready: true, Capabilities: []string{"collect_order"}, Cost: cost}
+}
+
+func channels(decisions []Decision) string {
+	var ids []string
+	for _, d := range decisions {
+		ids = append(ids, d.ChannelID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestRankFilters(t *testing.T) {
+	route := Route{ID: "cny", Strategy: StrategyCost, Channels: []Target{
+		{ChannelID: "a"},
+		{ChannelID: "b", Currencies: []string{"USD"}},
+		{ChannelID: "c", MaxAmount: 1000},
+		{ChannelID: "d"},
+		{ChannelID: "e"},
+		{ChannelID: "f"},
+	}}
+	router, err := New([]Route{route})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	down := ready(0)
+	down.Ready = false
+	candidates := map[string]Candidate{
+		"a": ready(30), "b": ready(0), "c": ready(0), "d": down,
+		"e": {Loaded: true, Ready: true, Capabilities: []string{"payout_order"}},
+	}
+
+	req := Request{Operation: "collect_order", Currency: "CNY", Amount: 5000}
+	decisions, err := router.Rank(route, req, candidates)
+	if err != nil {
+		t.Fatalf("Rank failed: %v", err)
+	}
+	if got := channels(decisions); got != "a" {
+		t.Errorf("Expected only a to be eligible, got %s", got)
+	}
+	if decisions[0].RouteID != "cny" || decisions[0].Reason != "cost: cost 30" {
+		t.Errorf("Unexpected decision %+v", decisions[0])
+	}
+
+	delete(candidates, "a")
+	_, err = router.Rank(route, req, candidates)
+	if err == nil {
+		t.Fatal("Expected error when no channel is eligible")
+	}
+	for _, reason := range []string{"a is not loaded", "b does not accept CNY", "c accepts at most 1000", "d is unhealthy", "e does not support collect_order"} {
+		if !strings.Contains(err.Error(), reason) {
+			t.Errorf("Expected error to say %q, got %v", reason, err)
+		}
+	}
+}
+
+func TestRankStrategies(t *testing.T) {
+	targets := []Target{{ChannelID: "a", Weight: 1}, {ChannelID: "b", Weight: 3}, {ChannelID: "c"}}
+	candidates := map[string]Candidate{"a": ready(50), "b": ready(10), "c": ready(30)}
+	req := Request{Operation: "collect_order", Currency: "CNY", Amount: 5000}
+	router, _ := New(nil)
+
+	rank := func(strategy Strategy) string {
+		t.Helper()
+		decisions, err := router.Rank(Route{ID: "r", Strategy: strategy, Channels: targets}, req, candidates)
+		if err != nil {
+			t.Fatalf("Rank failed: %v", err)
+		}
+		return channels(decisions)
+	}
+
+	if got := rank(StrategyCost); got != "b,c,a" {
+		t.Errorf("Expected cheapest first, got %s", got)
+	}
+
+	for i := 0; i < 10; i++ {
+		router.Stats().Record("a", true, 300*time.Millisecond)
+		router.Stats().Record("b", i%2 == 0, 100*time.Millisecond)
+		router.Stats().Record("c", i < 8, 200*time.Millisecond)
+	}
+	if got := rank(StrategySuccessRate); got != "a,c,b" {
+		t.Errorf("Expected most successful first, got %s", got)
+	}
+	if got := rank(StrategyLatency); got != "b,c,a" {
+		t.Errorf("Expected fastest first, got %s", got)
+	}
+
+	// Weights 1, 3 and 1 split [0, 5): a, b, b, b, c
+	for draw, want := range map[float64]string{0.1: "a,b,c", 0.5: "b,a,c", 0.9: "c,b,a"} {
+		router.random = func() float64 { return draw }
+		if got := rank(StrategyWeighted); got != want {
+			t.Errorf("Expected draw %.1f to rank %s, got %s", draw, want, got)
+		}
+	}
+}
+
+func TestStatsWindow(t *testing.T) {
+	stats := NewStats(4)
+	if rate := stats.Snapshot("a").SuccessRate(); rate != 0.5 {
+		t.Errorf("Expected an unknown channel to rate 50%%, got %v", rate)
+	}
+	for i := 0; i < 4; i++ {
+		stats.Record("a", false, time.Second)
+	}
+	for i := 0; i < 4; i++ {
+		stats.Record("a", true, time.Millisecond)
+	}
+	snapshot := stats.Snapshot("a")
+	if snapshot.Calls != 4 || snapshot.Successes != 4 || snapshot.Latency != time.Millisecond {
+		t.Errorf("Expected only the last 4 calls to count, got %+v", snapshot)
+	}
+}
+
+func TestFailoverFor(t *testing.T) {
+	route := Route{
+		Failover:         Failover{Enabled: true, MaxAttempts: 2},
+		MerchantFailover: map[string]Failover{"M2": {}},
+	}
+	if attempts := route.FailoverFor("M1").Attempts(3); attempts != 2 {
+		t.Errorf("Expected max_attempts to bound attempts, got %d", attempts)
+	}
+	if attempts := route.FailoverFor("M2").Attempts(3); attempts != 1 {
+		t.Errorf("Expected a single attempt with failover disabled for the merchant, got %d", attempts)
+	}
+	if attempts := (Failover{Enabled: true}).Attempts(3); attempts != 3 {
+		t.Errorf("Expected every eligible channel to be tried, got %d", attempts)
+	}
+}
+
+func TestRouteValidation(t *testing.T) {
+	invalid := map[string]Route{
+		"no id":          {Strategy: StrategyCost, Channels: []Target{{ChannelID: "a"}}},
+		"bad strategy":   {ID: "r", Strategy: "cheapest", Channels: []Target{{ChannelID: "a"}}},
+		"no channels":    {ID: "r", Strategy: StrategyCost},
+		"duplicate":      {ID: "r", Strategy: StrategyCost, Channels: []Target{{ChannelID: "a"}, {ChannelID: "a"}}},
+		"inverted range": {ID: "r", Strategy: StrategyCost, Channels: []Target{{ChannelID: "a", MinAmount: 10, MaxAmount: 5}}},
+		"negative attempts": {ID: "r", Strategy: StrategyCost, Channels: []Target{{ChannelID: "a"}},
+			Failover: Failover{Enabled: true, MaxAttempts: -1}},
+	}
+	for name, route := range invalid {
+		if _, err := New([]Route{route}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package routing
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultWindow is how many recent calls per channel the statistics cover
+const DefaultWindow = 100
+
+// outcome is one recorded call
+type outcome struct {
+	success bool
+	latency time.Duration
+}
+
+// Stats keeps rolling success and latency figures per channel over the
+// last calls placing orders. It is safe for concurrent use.
+type Stats struct {
+	mutex    sync.Mutex
+	window   int
+	channels map[string]*ring
+}
+
+// ring holds the most recent outcomes of one channel
+type ring struct {
+	outcomes []outcome
+	next     int
+}
+
+// NewStats creates statistics over the last window calls per channel
+func NewStats(window int) *Stats {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	return &Stats{window: window, channels: make(map[string]*ring)}
+}
+
+// Record adds the outcome of a call to channelID
+func (s *Stats) Record(channelID string, success bool, latency time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	r := s.channels[channelID]
+	if r == nil {
+		r = &ring{}
+		s.channels[channelID] = r
+	}
+	o := outcome{success: success, latency: latency}
+	if len(r.outcomes) < s.window {
+		r.outcomes = append(r.outcomes, o)
+		return
+	}
+	r.outcomes[r.next] = o
+	r.next = (r.next + 1) % s.window
+}
+
+// Snapshot summarizes a channel's recent calls
+type Snapshot struct {
+	Calls     int
+	Successes int
+	// Latency is the average latency of the calls
+	Latency time.Duration
+}
+
+// SuccessRate estimates the chance the next call succeeds. One success and
+// one failure are assumed on top of the calls seen, so a channel without
+// history rates 50% and a few lucky calls do not rate 100%.
+func (s Snapshot) SuccessRate() float64 {
+	return float64(s.Successes+1) / float64(s.Calls+2)
+}
+
+// Snapshot returns the figures for channelID
+func (s *Stats) Snapshot(channelID string) Snapshot {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var snapshot Snapshot
+	r := s.channels[channelID]
+	if r == nil {
+		return snapshot
+	}
+	var total time.Duration
+	for _, o := range r.outcomes {
+		snapshot.Calls++
+		if o.success {
+			snapshot.Successes++
+		}
+		total += o.latency
+	}
+	snapshot.Latency = total / time.Duration(snapshot.Calls)
+	return snapshot
+}
@@ -0,0 +1,436 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Schema is the subset of JSON Schema used to describe plugin configuration
+// in PluginInfo.ConfigSchema
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	// WriteOnly marks credentials that must never be echoed back
+	WriteOnly bool `json:"writeOnly,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// FieldError describes a problem with a single config field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (fe FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", fe.Field, fe.Message)
+}
+
+// ValidationError collects every field error found in a config
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (ve *ValidationError) Error() string {
+	messages := make([]string, len(ve.Errors))
+	for i, fe := range ve.Errors {
+		messages[i] = fe.Error()
+	}
+	return "config validation failed: " + strings.Join(messages, "; ")
+}
+
+func (ve *ValidationError) add(field, format string, args ...interface{}) {
+	ve.Errors = append(ve.Errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+var validTypes = map[string]bool{
+	"": true, "object": true, "array": true, "string": true,
+	"integer": true, "number": true, "boolean": true,
+}
+
+// Compile parses a ConfigSchema map. Legacy schemas that map field names
+// directly to {"type", "required", "default"} specs are converted to an
+// object schema, and the legacy "float" type is read as "number".
+func Compile(raw map[string]interface{}) (*Schema, error) {
+	if !isStandard(raw) {
+		raw = fromLegacy(raw)
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("config schema is not serializable: %w", err)
+	}
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("config schema is malformed: %w", err)
+	}
+	if s.Type == "" {
+		s.Type = "object"
+	}
+	if err := s.compile("config"); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// isStandard reports whether raw is already a JSON Schema document
+func isStandard(raw map[string]interface{}) bool {
+	if _, ok := raw["properties"]; ok {
+		return true
+	}
+	_, ok := raw["type"].(string)
+	return ok
+}
+
+func fromLegacy(raw map[string]interface{}) map[string]interface{} {
+	properties := make(map[string]interface{}, len(raw))
+	var required []string
+	for field, spec := range raw {
+		specMap, ok := spec.(map[string]interface{})
+		if !ok {
+			properties[field] = spec
+			continue
+		}
+		converted := make(map[string]interface{}, len(specMap))
+		for k, v := range specMap {
+			switch {
+			case k == "required":
+				if req, _ := v.(bool); req {
+					required = append(required, field)
+				}
+			case k == "type" && v == "float":
+				converted[k] = "number"
+			default:
+				converted[k] = v
+			}
+		}
+		properties[field] = converted
+	}
+	sort.Strings(required)
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+func (s *Schema) compile(path string) error {
+	if !validTypes[s.Type] {
+		return fmt.Errorf("%s: unsupported schema type %q", path, s.Type)
+	}
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("%s: invalid pattern: %w", path, err)
+		}
+		s.pattern = re
+	}
+	for _, name := range s.Required {
+		if _, ok := s.Properties[name]; !ok && s.Properties != nil {
+			return fmt.Errorf("%s: required field %s is not declared", path, name)
+		}
+	}
+	for name, prop := range s.Properties {
+		if prop == nil {
+			return fmt.Errorf("%s.%s: empty schema", path, name)
+		}
+		if err := prop.compile(path + "." + name); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		if err := s.Items.compile(path + "[]"); err != nil {
+			return err
+		}
+	}
+	if s.Default != nil {
+		var ve ValidationError
+		s.apply(path, s.Default, &ve)
+		if len(ve.Errors) > 0 {
+			return fmt.Errorf("%s: default does not match schema: %s", path, ve.Errors[0].Message)
+		}
+	}
+	return nil
+}
+
+// Apply validates config against the schema and returns a cleaned copy with
+// defaults filled in and values coerced to their declared types: integers
+// become int, numbers float64, and numeric or boolean strings are parsed.
+// All problems are reported together in a *ValidationError.
+func (s *Schema) Apply(config map[string]interface{}) (map[string]interface{}, error) {
+	if config == nil {
+		config = map[string]interface{}{}
+	}
+	var ve ValidationError
+	cleaned := s.apply("", config, &ve)
+	if len(ve.Errors) > 0 {
+		return nil, &ve
+	}
+	result, _ := cleaned.(map[string]interface{})
+	return result, nil
+}
+
+// SecretFields returns the dotted paths of fields marked writeOnly
+func (s *Schema) SecretFields() []string {
+	var fields []string
+	s.collectSecrets("", &fields)
+	sort.Strings(fields)
+	return fields
+}
+
+func (s *Schema) collectSecrets(prefix string, fields *[]string) {
+	for name, prop := range s.Properties {
+		path := joinPath(prefix, name)
+		if prop.WriteOnly {
+			*fields = append(*fields, path)
+		}
+		prop.collectSecrets(path, fields)
+	}
+}
+
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+func fieldName(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+	return path
+}
+
+func (s *Schema) apply(path string, value interface{}, ve *ValidationError) interface{} {
+	var result interface{}
+	switch s.Type {
+	case "object":
+		result = s.applyObject(path, value, ve)
+	case "array":
+		result = s.applyArray(path, value, ve)
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			ve.add(fieldName(path), "must be a string, got %s", describe(value))
+			return nil
+		}
+		s.checkString(path, str, ve)
+		result = str
+	case "integer":
+		i, ok := toInt(value)
+		if !ok {
+			ve.add(fieldName(path), "must be an integer, got %s", describe(value))
+			return nil
+		}
+		s.checkRange(path, float64(i), ve)
+		result = i
+	case "number":
+		f, ok := toFloat(value)
+		if !ok {
+			ve.add(fieldName(path), "must be a number, got %s", describe(value))
+			return nil
+		}
+		s.checkRange(path, f, ve)
+		result = f
+	case "boolean":
+		b, ok := toBool(value)
+		if !ok {
+			ve.add(fieldName(path), "must be a boolean, got %s", describe(value))
+			return nil
+		}
+		result = b
+	default:
+		result = value
+	}
+
+	if len(s.Enum) > 0 && !s.inEnum(result) {
+		ve.add(fieldName(path), "must be one of %v", s.Enum)
+	}
+	return result
+}
+
+func (s *Schema) applyObject(path string, value interface{}, ve *ValidationError) interface{} {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		ve.add(fieldName(path), "must be an object, got %s", describe(value))
+		return nil
+	}
+
+	result := make(map[string]interface{}, len(object))
+	for name, v := range object {
+		prop, declared := s.Properties[name]
+		switch {
+		case declared:
+			result[name] = prop.apply(joinPath(path, name), v, ve)
+		case s.AdditionalProperties != nil && !*s.AdditionalProperties:
+			ve.add(joinPath(path, name), "is not a recognized field")
+		default:
+			result[name] = v
+		}
+	}
+
+	for name, prop := range s.Properties {
+		if _, present := result[name]; !present && prop.Default != nil {
+			result[name] = prop.apply(joinPath(path, name), prop.Default, ve)
+		}
+	}
+
+	for _, name := range s.Required {
+		if v, present := result[name]; !present || v == nil || v == "" {
+			ve.add(joinPath(path, name), "is required")
+		}
+	}
+	sortErrors(ve)
+	return result
+}
+
+func (s *Schema) applyArray(path string, value interface{}, ve *ValidationError) interface{} {
+	items, ok := value.([]interface{})
+	if !ok {
+		if strs, isStrings := value.([]string); isStrings {
+			items = make([]interface{}, len(strs))
+			for i, str := range strs {
+				items[i] = str
+			}
+		} else {
+			ve.add(fieldName(path), "must be an array, got %s", describe(value))
+			return nil
+		}
+	}
+	if s.Items == nil {
+		return items
+	}
+	result := make([]interface{}, len(items))
+	for i, item := range items {
+		result[i] = s.Items.apply(fmt.Sprintf("%s[%d]", fieldName(path), i), item, ve)
+	}
+	return result
+}
+
+func (s *Schema) checkString(path, value string, ve *ValidationError) {
+	length := len([]rune(value))
+	if s.MinLength != nil && length < *s.MinLength {
+		ve.add(fieldName(path), "must be at least %d characters", *s.MinLength)
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		ve.add(fieldName(path), "must be at most %d characters", *s.MaxLength)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(value) {
+		ve.add(fieldName(path), "must match pattern %s", s.Pattern)
+	}
+}
+
+func (s *Schema) checkRange(path string, value float64, ve *ValidationError) {
+	if s.Minimum != nil && value < *s.Minimum {
+		ve.add(fieldName(path), "must be >= %v", *s.Minimum)
+	}
+	if s.Maximum != nil && value > *s.Maximum {
+		ve.add(fieldName(path), "must be <= %v", *s.Maximum)
+	}
+}
+
+func (s *Schema) inEnum(value interface{}) bool {
+	for _, candidate := range s.Enum {
+		if fmt.Sprint(candidate) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortErrors keeps error output stable regardless of map iteration order
+func sortErrors(ve *ValidationError) {
+	sort.SliceStable(ve.Errors, func(i, j int) bool {
+		return ve.Errors[i].Field < ve.Errors[j].Field
+	})
+}
+
+func describe(value interface{}) string {
+	if value == nil {
+		return "null"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func toInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int32:
+		return int(v), true
+	case int64:
+		return int(v), true
+	case float32:
+		return toInt(float64(v))
+	case float64:
+		if v != math.Trunc(v) || math.IsInf(v, 0) {
+			return 0, false
+		}
+		return int(v), true
+	case json.Number:
+		i, err := v.Int64()
+		return int(i), err == nil
+	case string:
+		i, err := strconv.Atoi(strings.TrimSpace(v))
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// toFloat accepts finite numbers only; NaN would pass every range check,
+// since every comparison with it is false
+func toFloat(value interface{}) (float64, bool) {
+	f, ok := parseFloat(value)
+	return f, ok && !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+func parseFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func toBool(value interface{}) (bool, bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		return b, err == nil
+	}
+	return false, false
+}
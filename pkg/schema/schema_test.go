@@ -0,0 +1,140 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func mockSchema(t *testing.T) *Schema {
+	t.Helper()
+	s, err := Compile(map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"app_id"},
+		"properties": map[string]interface{}{
+			"app_id":        map[string]interface{}{"type": "string", "pattern": "^[0-9]+$"},
+			"private_key":   map[string]interface{}{"type": "string", "writeOnly": true},
+			"mock_delay_ms": map[string]interface{}{"type": "integer", "default": 100, "minimum": 0, "maximum": 10000},
+			"success_rate":  map[string]interface{}{"type": "number", "default": 0.95, "minimum": 0, "maximum": 1},
+			"sandbox":       map[string]interface{}{"type": "boolean", "default": false},
+			"sign_type":     map[string]interface{}{"type": "string", "enum": []interface{}{"RSA2", "RSA"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	return s
+}
+
+func TestApplyDefaultsAndCoercion(t *testing.T) {
+	s := mockSchema(t)
+
+	// Decode from JSON so numbers arrive as float64, as they do from config files
+	var config map[string]interface{}
+	if err := json.Unmarshal([]byte(`{"app_id":"2021","mock_delay_ms":50,"sandbox":"true","extra":"kept"}`), &config); err != nil {
+		t.Fatal(err)
+	}
+
+	cleaned, err := s.Apply(config)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	if delay, ok := cleaned["mock_delay_ms"].(int); !ok || delay != 50 {
+		t.Errorf("mock_delay_ms should be coerced to int 50, got %#v", cleaned["mock_delay_ms"])
+	}
+	if rate, ok := cleaned["success_rate"].(float64); !ok || rate != 0.95 {
+		t.Errorf("success_rate should default to 0.95, got %#v", cleaned["success_rate"])
+	}
+	if sandbox, ok := cleaned["sandbox"].(bool); !ok || !sandbox {
+		t.Errorf("sandbox should be coerced to true, got %#v", cleaned["sandbox"])
+	}
+	if cleaned["extra"] != "kept" {
+		t.Error("undeclared fields should pass through when additionalProperties is not false")
+	}
+	if _, exists := config["success_rate"]; exists {
+		t.Error("Apply must not modify the caller's config")
+	}
+}
+
+func TestApplyFieldErrors(t *testing.T) {
+	s := mockSchema(t)
+
+	_, err := s.Apply(map[string]interface{}{
+		"mock_delay_ms": 50.5,
+		"success_rate":  1.5,
+		"app_id":        "abc",
+		"sign_type":     "MD5",
+	})
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+
+	expected := map[string]string{
+		"app_id":        "must match pattern",
+		"mock_delay_ms": "must be an integer",
+		"success_rate":  "must be <= 1",
+		"sign_type":     "must be one of",
+	}
+	if len(ve.Errors) != len(expected) {
+		t.Fatalf("expected %d field errors, got %v", len(expected), ve.Errors)
+	}
+	for _, fe := range ve.Errors {
+		if !strings.Contains(fe.Message, expected[fe.Field]) {
+			t.Errorf("field %s: unexpected message %q", fe.Field, fe.Message)
+		}
+	}
+
+	_, err = s.Apply(map[string]interface{}{})
+	if err == nil || !strings.Contains(err.Error(), "app_id: is required") {
+		t.Errorf("expected required field error, got %v", err)
+	}
+
+	// NaN would pass the range check, since every comparison with it is false
+	for _, rate := range []interface{}{"NaN", "Inf", "-inf", math.NaN(), math.Inf(1)} {
+		_, err = s.Apply(map[string]interface{}{"app_id": "2021000123456789", "success_rate": rate})
+		if err == nil || !strings.Contains(err.Error(), "success_rate") {
+			t.Errorf("expected success_rate %v to be rejected, got %v", rate, err)
+		}
+	}
+}
+
+func TestCompileLegacySchema(t *testing.T) {
+	s, err := Compile(map[string]interface{}{
+		"api_key":      map[string]interface{}{"type": "string", "required": true},
+		"success_rate": map[string]interface{}{"type": "float", "default": 0.5},
+	})
+	if err != nil {
+		t.Fatalf("legacy schema should compile: %v", err)
+	}
+	if s.Properties["success_rate"].Type != "number" {
+		t.Errorf("legacy float type should map to number, got %s", s.Properties["success_rate"].Type)
+	}
+	if _, err := s.Apply(map[string]interface{}{}); err == nil {
+		t.Error("legacy required flag should be honoured")
+	}
+}
+
+func TestCompileRejectsInvalidSchemas(t *testing.T) {
+	testCases := map[string]map[string]interface{}{
+		"unknown type":     {"type": "object", "properties": map[string]interface{}{"a": map[string]interface{}{"type": "decimal"}}},
+		"bad pattern":      {"type": "object", "properties": map[string]interface{}{"a": map[string]interface{}{"type": "string", "pattern": "("}}},
+		"bad default":      {"type": "object", "properties": map[string]interface{}{"a": map[string]interface{}{"type": "integer", "default": "x"}}},
+		"undeclared field": {"type": "object", "required": []interface{}{"b"}, "properties": map[string]interface{}{"a": map[string]interface{}{"type": "string"}}},
+	}
+	for name, raw := range testCases {
+		if _, err := Compile(raw); err == nil {
+			t.Errorf("%s: expected compile error", name)
+		}
+	}
+}
+
+func TestSecretFields(t *testing.T) {
+	fields := mockSchema(t).SecretFields()
+	if len(fields) != 1 || fields[0] != "private_key" {
+		t.Errorf("expected [private_key], got %v", fields)
+	}
+}
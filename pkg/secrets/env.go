@@ -0,0 +1,50 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvProvider reads secrets from environment variables. The variable for a
+// secret is Prefix followed by the upper-cased name with '.' and '-' mapped
+// to '_', so "alipay.private_key" with prefix "GATEWAY_SECRET_" is read from
+// GATEWAY_SECRET_ALIPAY_PRIVATE_KEY. The prefix keeps config files from
+// reaching arbitrary variables of the gateway process.
+type EnvProvider struct {
+	Prefix string
+	lookup func(string) (string, bool)
+}
+
+// NewEnvProvider creates a provider reading variables that start with prefix
+func NewEnvProvider(prefix string) *EnvProvider {
+	return &EnvProvider{Prefix: prefix, lookup: os.LookupEnv}
+}
+
+// VariableName returns the environment variable holding secret name
+func (ep *EnvProvider) VariableName(name string) string {
+	mapped := strings.Map(func(c rune) rune {
+		if c == '.' || c == '-' {
+			return '_'
+		}
+		return c
+	}, strings.ToUpper(name))
+	return ep.Prefix + mapped
+}
+
+// GetSecret returns the value of the secret's environment variable
+func (ep *EnvProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	if err := ValidateName(name); err != nil {
+		return "", err
+	}
+	lookup := ep.lookup
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	value, ok := lookup(ep.VariableName(name))
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return value, nil
+}
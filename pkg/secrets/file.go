@@ -0,0 +1,38 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileProvider reads each secret from a file named after it in Dir, the
+// layout used by mounted Kubernetes and Docker secrets. Files are read on
+// every lookup, so replacing a file rotates the secret.
+type FileProvider struct {
+	Dir string
+}
+
+// NewFileProvider creates a provider reading secrets from dir
+func NewFileProvider(dir string) *FileProvider {
+	return &FileProvider{Dir: dir}
+}
+
+// GetSecret returns the file's content without its trailing newline
+func (fp *FileProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	if err := ValidateName(name); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(filepath.Join(fp.Dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret %s: %w", name, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -0,0 +1,218 @@
+package secrets
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// KeySize is the length of a keystore master key (AES-256)
+const KeySize = 32
+
+const keystoreVersion = 1
+
+// Keystore is an encrypted local secrets file. Each secret is sealed with
+// AES-256-GCM under the master key, using the secret's name as additional
+// data so entries cannot be swapped between names. The file is re-read on
+// every lookup, so rewriting it rotates secrets for a running gateway.
+type Keystore struct {
+	path  string
+	aead  cipher.AEAD
+	mutex sync.Mutex
+}
+
+type keystoreFile struct {
+	Version int               `json:"version"`
+	Secrets map[string]string `json:"secrets"`
+}
+
+// OpenKeystore opens the keystore at path with a 32-byte master key. The file
+// does not need to exist yet; it is created by the first Set.
+func OpenKeystore(path string, key []byte) (*Keystore, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("keystore master key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Keystore{path: path, aead: aead}, nil
+}
+
+// GenerateKey returns a new random master key
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ParseKey decodes a master key written as hex or standard base64
+func ParseKey(encoded string) ([]byte, error) {
+	encoded = strings.TrimSpace(encoded)
+	if key, err := hex.DecodeString(encoded); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(encoded); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+	return nil, fmt.Errorf("keystore master key must be %d bytes encoded as hex or base64", KeySize)
+}
+
+// GetSecret decrypts and returns the named secret
+func (ks *Keystore) GetSecret(ctx context.Context, name string) (string, error) {
+	if err := ValidateName(name); err != nil {
+		return "", err
+	}
+	file, err := ks.read()
+	if err != nil {
+		return "", err
+	}
+	sealed, ok := file.Secrets[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return ks.open(name, sealed)
+}
+
+// Set encrypts value and stores it under name, replacing any previous value
+func (ks *Keystore) Set(name, value string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+
+	file, err := ks.read()
+	if err != nil {
+		return err
+	}
+	sealed, err := ks.seal(name, value)
+	if err != nil {
+		return err
+	}
+	file.Secrets[name] = sealed
+	return ks.write(file)
+}
+
+// Delete removes the named secret
+func (ks *Keystore) Delete(name string) error {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+
+	file, err := ks.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := file.Secrets[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	delete(file.Secrets, name)
+	return ks.write(file)
+}
+
+// Names returns the names of all stored secrets
+func (ks *Keystore) Names() ([]string, error) {
+	file, err := ks.read()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(file.Secrets))
+	for name := range file.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (ks *Keystore) read() (*keystoreFile, error) {
+	data, err := os.ReadFile(ks.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &keystoreFile{Version: keystoreVersion, Secrets: make(map[string]string)}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore %s: %w", ks.path, err)
+	}
+
+	var file keystoreFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("keystore %s is corrupted: %w", ks.path, err)
+	}
+	if file.Version != keystoreVersion {
+		return nil, fmt.Errorf("keystore %s has unsupported version %d", ks.path, file.Version)
+	}
+	if file.Secrets == nil {
+		file.Secrets = make(map[string]string)
+	}
+	return &file, nil
+}
+
+// write replaces the keystore file atomically so readers never see a
+// partially written file
+func (ks *Keystore) write(file *keystoreFile) error {
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(ks.path), ".keystore-*")
+	if err != nil {
+		return fmt.Errorf("failed to write keystore: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write keystore: %w", err)
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write keystore: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write keystore: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), ks.path); err != nil {
+		return fmt.Errorf("failed to write keystore: %w", err)
+	}
+	return nil
+}
+
+func (ks *Keystore) seal(name, value string) (string, error) {
+	nonce := make([]byte, ks.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := ks.aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (ks *Keystore) open(name, encoded string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < ks.aead.NonceSize() {
+		return "", fmt.Errorf("keystore entry %s is corrupted", name)
+	}
+	nonce, ciphertext := sealed[:ks.aead.NonceSize()], sealed[ks.aead.NonceSize():]
+	plaintext, err := ks.aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt keystore entry %s: wrong master key or corrupted entry", name)
+	}
+	return string(plaintext), nil
+}
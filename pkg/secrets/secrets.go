@@ -0,0 +1,162 @@
+// Package secrets resolves channel credentials from the host's secret stores
+// so they never have to be written into gateway configuration in clear.
+package secrets
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ReferencePrefix marks a config string as a reference to a named secret
+const ReferencePrefix = "secret://"
+
+// ErrNotFound is returned when a provider has no secret with the given name
+var ErrNotFound = errors.New("secret not found")
+
+// Provider is a source of named secrets. Its method set matches
+// interfaces.SecretsAccessor, so a provider can be handed to plugins directly.
+type Provider interface {
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+// Chain returns a provider that asks each provider in turn and returns the
+// first secret found. Errors other than ErrNotFound stop the search.
+func Chain(providers ...Provider) Provider {
+	return chain(providers)
+}
+
+type chain []Provider
+
+func (c chain) GetSecret(ctx context.Context, name string) (string, error) {
+	for _, provider := range c {
+		value, err := provider.GetSecret(ctx, name)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		return value, err
+	}
+	return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// IsReference reports whether value is a "secret://name" reference
+func IsReference(value interface{}) bool {
+	s, ok := value.(string)
+	return ok && strings.HasPrefix(s, ReferencePrefix)
+}
+
+// Resolve returns a copy of config with every "secret://name" string, at any
+// depth, replaced by the secret's value. The resolved values are returned
+// keyed by secret name. config itself is never modified.
+func Resolve(ctx context.Context, provider Provider, config map[string]interface{}) (map[string]interface{}, map[string]string, error) {
+	r := resolver{ctx: ctx, provider: provider, values: make(map[string]string)}
+	resolved, _ := r.resolve("", config).(map[string]interface{})
+	if len(r.errs) > 0 {
+		return nil, nil, errors.Join(r.errs...)
+	}
+	return resolved, r.values, nil
+}
+
+type resolver struct {
+	ctx      context.Context
+	provider Provider
+	values   map[string]string
+	errs     []error
+}
+
+func (r *resolver) resolve(path string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if !strings.HasPrefix(v, ReferencePrefix) {
+			return v
+		}
+		name := strings.TrimPrefix(v, ReferencePrefix)
+		secret, err := r.lookup(name)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("%s: secret %q: %w", path, name, err))
+			return v
+		}
+		return secret
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = r.resolve(joinPath(path, key), item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = r.resolve(fmt.Sprintf("%s[%d]", path, i), item)
+		}
+		return copied
+	}
+	return value
+}
+
+func (r *resolver) lookup(name string) (string, error) {
+	if value, ok := r.values[name]; ok {
+		return value, nil
+	}
+	if err := ValidateName(name); err != nil {
+		return "", err
+	}
+	if r.provider == nil {
+		return "", errors.New("no secrets provider configured")
+	}
+	value, err := r.provider.GetSecret(r.ctx, name)
+	if err != nil {
+		return "", err
+	}
+	r.values[name] = value
+	return value, nil
+}
+
+// ValidateName checks that name is usable by every backend: letters, digits,
+// '_', '-' and '.', not starting with '.'
+func ValidateName(name string) error {
+	if name == "" {
+		return errors.New("secret name is empty")
+	}
+	if name[0] == '.' {
+		return fmt.Errorf("secret name %q must not start with '.'", name)
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '-', c == '.':
+		default:
+			return fmt.Errorf("secret name %q contains invalid character %q", name, c)
+		}
+	}
+	return nil
+}
+
+// Fingerprint returns a digest of resolved secret values. It changes when any
+// value changes, which is how rotation is detected without keeping the
+// values themselves around.
+func Fingerprint(values map[string]string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%d:%s%d:%s", len(name), name, len(values[name]), values[name])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
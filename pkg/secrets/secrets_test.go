@@ -0,0 +1,183 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mapProvider serves secrets from a map
+type mapProvider map[string]string
+
+func (mp mapProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	value, ok := mp[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func TestResolve(t *testing.T) {
+	provider := mapProvider{"alipay.private_key": "MIIEv...", "alipay.app_id": "2021"}
+	config := map[string]interface{}{
+		"app_id":      "secret://alipay.app_id",
+		"private_key": "secret://alipay.private_key",
+		"timeout_ms":  3000,
+		"nested":      map[string]interface{}{"keys": []interface{}{"secret://alipay.private_key", "plain"}},
+	}
+
+	resolved, values, err := Resolve(context.Background(), provider, config)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if resolved["private_key"] != "MIIEv..." || resolved["app_id"] != "2021" || resolved["timeout_ms"] != 3000 {
+		t.Errorf("unexpected resolved config: %v", resolved)
+	}
+	keys := resolved["nested"].(map[string]interface{})["keys"].([]interface{})
+	if keys[0] != "MIIEv..." || keys[1] != "plain" {
+		t.Errorf("nested references should be resolved, got %v", keys)
+	}
+	if len(values) != 2 || values["alipay.app_id"] != "2021" {
+		t.Errorf("unexpected resolved values: %v", values)
+	}
+	if config["private_key"] != "secret://alipay.private_key" {
+		t.Error("Resolve must not modify its input")
+	}
+
+	_, _, err = Resolve(context.Background(), provider, map[string]interface{}{
+		"a": "secret://missing",
+		"b": "secret://../etc/passwd",
+	})
+	if err == nil || !strings.Contains(err.Error(), "a: secret \"missing\"") || !strings.Contains(err.Error(), "b: ") {
+		t.Errorf("expected errors for both fields, got %v", err)
+	}
+
+	if _, _, err := Resolve(context.Background(), nil, map[string]interface{}{"a": "secret://x"}); err == nil {
+		t.Error("Expected error when resolving without a provider")
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	a := Fingerprint(map[string]string{"k": "v1"})
+	if a == "" || a != Fingerprint(map[string]string{"k": "v1"}) {
+		t.Error("fingerprint should be stable")
+	}
+	if a == Fingerprint(map[string]string{"k": "v2"}) {
+		t.Error("fingerprint should change with the value")
+	}
+	if Fingerprint(nil) != "" {
+		t.Error("no secrets should have an empty fingerprint")
+	}
+}
+
+func TestFileAndEnvProviders(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "alipay.private_key"), []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file := NewFileProvider(dir)
+
+	if value, err := file.GetSecret(context.Background(), "alipay.private_key"); err != nil || value != "from-file" {
+		t.Errorf("file secret = %q, %v", value, err)
+	}
+	if _, err := file.GetSecret(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := file.GetSecret(context.Background(), "../alipay.private_key"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("path traversal should be rejected, got %v", err)
+	}
+
+	env := &EnvProvider{Prefix: "GW_SECRET_", lookup: func(name string) (string, bool) {
+		if name == "GW_SECRET_WECHAT_API_KEY" {
+			return "from-env", true
+		}
+		return "", false
+	}}
+	if value, err := env.GetSecret(context.Background(), "wechat.api-key"); err != nil || value != "from-env" {
+		t.Errorf("env secret = %q, %v", value, err)
+	}
+
+	chained := Chain(file, env)
+	if value, err := chained.GetSecret(context.Background(), "wechat.api-key"); err != nil || value != "from-env" {
+		t.Errorf("chain should fall through to later providers, got %q, %v", value, err)
+	}
+	if _, err := chained.GetSecret(context.Background(), "nowhere"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound from chain, got %v", err)
+	}
+}
+
+func TestKeystore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.keystore")
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := OpenKeystore(path, key)
+	if err != nil {
+		t.Fatalf("OpenKeystore failed: %v", err)
+	}
+
+	if _, err := ks.GetSecret(context.Background(), "alipay.private_key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound from empty keystore, got %v", err)
+	}
+	if err := ks.Set("alipay.private_key", "MIIEv-private"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if value, err := ks.GetSecret(context.Background(), "alipay.private_key"); err != nil || value != "MIIEv-private" {
+		t.Errorf("GetSecret = %q, %v", value, err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "MIIEv-private") {
+		t.Error("keystore file must not contain the secret in clear")
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("keystore should be written with mode 0600, got %v", info.Mode())
+	}
+
+	otherKey, _ := GenerateKey()
+	wrong, _ := OpenKeystore(path, otherKey)
+	if _, err := wrong.GetSecret(context.Background(), "alipay.private_key"); err == nil {
+		t.Error("Expected error when decrypting with the wrong key")
+	}
+
+	// Entries are bound to their name
+	if err := ks.Set("other", "value"); err != nil {
+		t.Fatal(err)
+	}
+	file, _ := ks.read()
+	file.Secrets["other"] = file.Secrets["alipay.private_key"]
+	if err := ks.write(file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.GetSecret(context.Background(), "other"); err == nil {
+		t.Error("Expected error for an entry copied from another name")
+	}
+
+	if err := ks.Delete("other"); err != nil {
+		t.Errorf("Delete failed: %v", err)
+	}
+	if names, _ := ks.Names(); len(names) != 1 || names[0] != "alipay.private_key" {
+		t.Errorf("unexpected names after delete: %v", names)
+	}
+
+	if _, err := OpenKeystore(path, key[:16]); err == nil {
+		t.Error("Expected error for a short master key")
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	hexKey := strings.Repeat("ab", KeySize)
+	if key, err := ParseKey(hexKey); err != nil || len(key) != KeySize {
+		t.Errorf("hex key: %v", err)
+	}
+	if key, err := ParseKey("q6urq6urq6urq6urq6urq6urq6urq6urq6urq6urq6s="); err != nil || len(key) != KeySize {
+		t.Errorf("base64 key: %v", err)
+	}
+	if _, err := ParseKey("too-short"); err == nil {
+		t.Error("Expected error for an invalid key")
+	}
+}
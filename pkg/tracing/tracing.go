@@ -0,0 +1,121 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"payment_go/pkg/interfaces"
+)
+
+// InstrumentationName is the tracer name used by the gateway and its plugins
+const InstrumentationName = "payment_go"
+
+// Span attribute keys shared by the gateway, middleware and plugins
+const (
+	AttrRequestID  = attribute.Key("payment.request_id")
+	AttrMerchantID = attribute.Key("payment.merchant_id")
+	AttrChannelID  = attribute.Key("payment.channel_id")
+	AttrOperation  = attribute.Key("payment.operation")
+	AttrOrderID    = attribute.Key("payment.order_id")
+	AttrSuccess    = attribute.Key("payment.success")
+	AttrCode       = attribute.Key("payment.code")
+)
+
+// Tracer returns the tracer from the globally registered provider.
+// Plugins built against this module share the host's provider, so spans they
+// create become children of the gateway spans carried in ctx.
+func Tracer() trace.Tracer {
+	return otel.Tracer(InstrumentationName)
+}
+
+// StartSpan starts a span as a child of whatever span is carried by ctx
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// RequestAttributes returns the standard attributes describing a request
+func RequestAttributes(base *interfaces.BaseRequest) []attribute.KeyValue {
+	if base == nil {
+		return nil
+	}
+	return []attribute.KeyValue{
+		AttrRequestID.String(base.RequestID),
+		AttrMerchantID.String(base.MerchantID),
+		AttrChannelID.String(base.ChannelID),
+	}
+}
+
+// RecordError marks the span as failed; a nil error is ignored
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// SetupPropagation installs W3C trace context and baggage as the global propagator
+func SetupPropagation() {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+}
+
+// Transport is an http.RoundTripper that creates a client span for each
+// outbound request and injects the trace context into its headers
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := Tracer().Start(req.Context(), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("server.address", req.URL.Hostname()),
+			attribute.String("url.path", req.URL.Path),
+		),
+	)
+	defer span.End()
+
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		RecordError(span, err)
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 500 {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	return resp, nil
+}
+
+// WrapClient returns a copy of client whose transport is traced.
+// Plugins should wrap the HTTP clients they use to talk to upstream providers.
+func WrapClient(client *http.Client) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	wrapped := *client
+	if _, ok := wrapped.Transport.(*Transport); !ok {
+		wrapped.Transport = &Transport{Base: client.Transport}
+	}
+	return &wrapped
+}
@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"payment_go/pkg/interfaces"
+)
+
+func TestWrapClientPropagatesContext(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(tp)
+	SetupPropagation()
+	defer tp.Shutdown(context.Background())
+
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	ctx, parent := StartSpan(context.Background(), "parent")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/ping", nil)
+	resp, err := WrapClient(server.Client()).Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	parent.End()
+
+	if req.Header.Get("traceparent") != "" {
+		t.Error("caller's request headers should not be modified")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	client := spans[0]
+	if client.SpanKind != trace.SpanKindClient {
+		t.Errorf("expected client span kind, got %v", client.SpanKind)
+	}
+	if client.Parent.SpanID() != spans[1].SpanContext.SpanID() {
+		t.Error("HTTP span should be a child of the caller's span")
+	}
+	if received == "" || received[3:35] != client.SpanContext.TraceID().String() {
+		t.Errorf("traceparent %q does not carry trace %s", received, client.SpanContext.TraceID())
+	}
+	if client.Status.Code.String() != "Error" {
+		t.Errorf("5xx responses should mark the span as failed, got %s", client.Status.Code)
+	}
+}
+
+func TestRequestAttributes(t *testing.T) {
+	if RequestAttributes(nil) != nil {
+		t.Error("nil request should produce no attributes")
+	}
+
+	attrs := RequestAttributes(&interfaces.BaseRequest{RequestID: "R1", MerchantID: "M1", ChannelID: "C1"})
+	if len(attrs) != 3 {
+		t.Fatalf("expected 3 attributes, got %d", len(attrs))
+	}
+	if attrs[0] != AttrRequestID.String("R1") || attrs[1] != AttrMerchantID.String("M1") || attrs[2] != AttrChannelID.String("C1") {
+		t.Errorf("unexpected attributes: %v", attrs)
+	}
+}